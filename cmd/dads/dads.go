@@ -76,6 +76,12 @@ func runDS(ctx *lib.Ctx) (err error) {
 		ds = &lib.DSConfluence{}
 	case lib.Rocketchat:
 		ds = &lib.DSRocketchat{}
+	case lib.GitLab:
+		ds = &lib.DSGitLab{}
+	case lib.Discourse:
+		ds = &lib.DSDiscourse{}
+	case lib.Slack:
+		ds = &lib.DSSlack{}
 	case pipermail.Pipermail:
 		manager, err := buildPipermailManager(ctx)
 		if err != nil {
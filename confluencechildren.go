@@ -0,0 +1,133 @@
+package dads
+
+import (
+	"fmt"
+	"strings"
+)
+
+var (
+	// ConfluenceContentTypes - content types fetched via CQL search, comments and attachments are linked to their container page/blogpost
+	ConfluenceContentTypes = []string{"page", "blogpost", "comment", "attachment"}
+	// ConfluenceSearchExpand - properties expanded when searching contents
+	ConfluenceSearchExpand = "ancestors,version,container,metadata.labels"
+)
+
+// ConfluenceSpaceKey - return space key from a content's "_expandable.space" link
+func ConfluenceSpaceKey(content map[string]interface{}) (space string, ok bool) {
+	iSpace, ok := Dig(content, []string{"_expandable", "space"}, false, true)
+	if !ok {
+		return
+	}
+	space, _ = iSpace.(string)
+	space = strings.Replace(space, "/rest/api/space/", "", -1)
+	ok = space != ""
+	return
+}
+
+// ConfluenceLabels - return labels of a content (only contents fetched via search have them expanded)
+func ConfluenceLabels(content map[string]interface{}) (labels []map[string]interface{}) {
+	iLabels, ok := Dig(content, []string{"metadata", "labels", "results"}, false, true)
+	if !ok {
+		return
+	}
+	ary, _ := iLabels.([]interface{})
+	for _, iLabel := range ary {
+		label, ok := iLabel.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := label["name"].(string)
+		if name == "" {
+			continue
+		}
+		labels = append(labels, label)
+	}
+	return
+}
+
+// EnrichContainerFields - set fields linking a comment or an attachment to its container page/blogpost and space
+func (j *DSConfluence) EnrichContainerFields(content, rich map[string]interface{}) {
+	rich["parent_id"] = nil
+	rich["parent_type"] = nil
+	rich["parent_title"] = nil
+	rich["parent_url"] = nil
+	container, ok := content["container"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	rich["parent_id"], _ = container["id"]
+	rich["parent_type"], _ = container["type"]
+	rich["parent_title"], _ = container["title"]
+	webUI, ok := Dig(container, []string{"_links", "webui"}, false, true)
+	if ok {
+		sWebUI, _ := webUI.(string)
+		rich["parent_url"] = j.URL + sWebUI
+	}
+	_, ok = rich["space"]
+	if !ok {
+		space, ok := ConfluenceSpaceKey(container)
+		if ok {
+			rich["space"] = space
+		}
+	}
+}
+
+// EnrichAttachmentFields - set attachment specific fields
+func (j *DSConfluence) EnrichAttachmentFields(content, rich map[string]interface{}) {
+	rich["file_size"], _ = Dig(content, []string{"extensions", "fileSize"}, false, true)
+	rich["media_type"], _ = Dig(content, []string{"extensions", "mediaType"}, false, true)
+	rich["download_url"] = nil
+	download, ok := Dig(content, []string{"_links", "download"}, false, true)
+	if ok {
+		sDownload, _ := download.(string)
+		rich["download_url"] = j.URL + sDownload
+	}
+}
+
+// EnrichLabels - return rich label documents for page's labels
+// Confluence API doesn't say who added a label, so label documents have no author identity and affiliations
+// (copying page's version author would count that author once more in contributors metrics)
+func (j *DSConfluence) EnrichLabels(ctx *Ctx, item, rich map[string]interface{}) (richItems []interface{}, err error) {
+	page, ok := item["data"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	labels := ConfluenceLabels(page)
+	if len(labels) == 0 {
+		return
+	}
+	pageID, _ := page["id"].(string)
+	copyFields := []string{"space", "date", "version", "content_url"}
+	for _, label := range labels {
+		richLabel := make(map[string]interface{})
+		for _, field := range RawFields {
+			richLabel[field], _ = rich[field]
+		}
+		for _, field := range copyFields {
+			v, ok := rich[field]
+			if ok {
+				richLabel[field] = v
+			}
+		}
+		name, _ := label["name"].(string)
+		richLabel[UUID] = UUIDNonEmpty(ctx, j.URL, pageID, "label", name)
+		richLabel["id"] = fmt.Sprintf("%s/label/%s", pageID, name)
+		richLabel["type"] = "label"
+		richLabel["is_label"] = 1
+		richLabel["is_blogpost"] = 0
+		richLabel["label"] = name
+		richLabel["label_id"], _ = label["id"]
+		richLabel["label_prefix"], _ = label["prefix"]
+		richLabel["title"] = name
+		richLabel["parent_id"] = pageID
+		richLabel["parent_type"], _ = page["type"]
+		richLabel["parent_title"], _ = page["title"]
+		richLabel["parent_url"], _ = rich["url"]
+		richLabel["url"], _ = rich["url"]
+		for prop, value := range CommonFields(j, rich[j.DateField(ctx)], Confluence) {
+			richLabel[prop] = value
+		}
+		richItems = append(richItems, richLabel)
+	}
+	return
+}
@@ -0,0 +1,55 @@
+package dads
+
+import (
+	"testing"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+func TestConfluenceChildren(t *testing.T) {
+	content := map[string]interface{}{}
+	err := jsoniter.Unmarshal([]byte(`{
+		"id":"301","type":"attachment","title":"diagram.png",
+		"extensions":{"fileSize":2048,"mediaType":"image/png"},
+		"_links":{"webui":"/pages/viewpage.action?pageId=100&preview=diagram.png","download":"/download/attachments/100/diagram.png"},
+		"container":{"id":"100","type":"page","title":"Design","_links":{"webui":"/display/SP/Design"},"_expandable":{"space":"/rest/api/space/SP"}},
+		"metadata":{"labels":{"results":[{"prefix":"global","name":"arch","id":"9"},{"prefix":"global","name":""}]}}
+	}`), &content)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	j := &DSConfluence{URL: "https://wiki.example.com"}
+	rich := map[string]interface{}{}
+	j.EnrichContainerFields(content, rich)
+	j.EnrichAttachmentFields(content, rich)
+	if rich["parent_id"] != "100" || rich["parent_type"] != "page" || rich["parent_url"] != "https://wiki.example.com/display/SP/Design" || rich["space"] != "SP" {
+		t.Errorf("unexpected container fields: %+v", rich)
+	}
+	if rich["file_size"] != 2048.0 || rich["media_type"] != "image/png" || rich["download_url"] != "https://wiki.example.com/download/attachments/100/diagram.png" {
+		t.Errorf("unexpected attachment fields: %+v", rich)
+	}
+	labels := ConfluenceLabels(content)
+	if len(labels) != 1 || labels[0]["name"] != "arch" {
+		t.Errorf("unexpected labels: %+v", labels)
+	}
+	pageRich := map[string]interface{}{"space": "SP", "url": "https://wiki.example.com/display/SP/Design", "author_name": "Alice", "author_uuid": "u1", "by_uuid": "u1", "author_org_name": "Org", DefaultDateField: "2021-05-20T10:00:00Z"}
+	richLabels, err := j.EnrichLabels(&Ctx{}, map[string]interface{}{"data": content}, pageRich)
+	if err != nil || len(richLabels) != 1 {
+		t.Errorf("expected single label document, got %+v, error: %v", richLabels, err)
+		return
+	}
+	richLabel, _ := richLabels[0].(map[string]interface{})
+	if richLabel["label"] != "arch" || richLabel["is_label"] != 1 || richLabel["space"] != "SP" || richLabel["parent_id"] != "301" {
+		t.Errorf("unexpected label document: %+v", richLabel)
+	}
+	for _, field := range []string{"author_name", "author_uuid", "by_uuid", "author_org_name"} {
+		if _, ok := richLabel[field]; ok {
+			t.Errorf("expected no %s in label document, got %+v", field, richLabel)
+		}
+	}
+	space, ok := ConfluenceSpaceKey(map[string]interface{}{})
+	if ok || space != "" {
+		t.Errorf("expected no space, got %s", space)
+	}
+}
@@ -0,0 +1,170 @@
+package dads
+
+import (
+	"fmt"
+	neturl "net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// ConfluenceMaxVersions - max versions to fetch at a time
+	ConfluenceMaxVersions = 200
+)
+
+// ConfluenceSearchCQL - CQL query returning all contents modified since fromDate (YYYY-MM-DD HH:MI), oldest first
+// There is no upper bound: contents modified after DateTo can still have older versions that should be fetched
+func ConfluenceSearchCQL(fromDate string) string {
+	return "type in (" + strings.Join(ConfluenceContentTypes, ",") + ") and lastModified>='" + fromDate + "' order by lastModified"
+}
+
+// ConfluenceSearchURL - first page URL of a CQL search, next pages are returned by API as cursor links
+func (j *DSConfluence) ConfluenceSearchURL(cql string) string {
+	return j.URL + "/rest/api/content/search?cql=" + neturl.QueryEscape(cql) + fmt.Sprintf("&limit=%d", j.MaxContents) + "&expand=" + neturl.QueryEscape(ConfluenceSearchExpand)
+}
+
+// ConfluenceNextURL - return absolute URL of the next page from API response's "_links.next" or "" when this is the last page
+// Next links are relative to the API context path (like "/wiki" on Confluence Cloud) which is a part of baseURL,
+// some servers return links already containing that path, those are not prefixed twice
+func ConfluenceNextURL(baseURL string, result map[string]interface{}) string {
+	iNext, ok := Dig(result, []string{"_links", "next"}, false, true)
+	if !ok {
+		return ""
+	}
+	next, _ := iNext.(string)
+	if next == "" || strings.HasPrefix(next, "http://") || strings.HasPrefix(next, "https://") {
+		return next
+	}
+	u, err := neturl.Parse(baseURL)
+	if err == nil && u.Path != "" && u.Path != "/" && strings.HasPrefix(next, u.Path+"/") {
+		return u.Scheme + "://" + u.Host + next
+	}
+	return baseURL + next
+}
+
+// ConfluenceInDateRange - is version date within [dateFrom, dateTo], dateTo is optional
+func ConfluenceInDateRange(when, dateFrom time.Time, dateTo *time.Time) bool {
+	return !when.Before(dateFrom) && (dateTo == nil || !when.After(*dateTo))
+}
+
+// ConfluenceHistoricalContent - create a historical content from the current content and one of its versions
+// Versions list only returns version's own data (and optionally its title/status), so other properties come from the current content
+func ConfluenceHistoricalContent(content, version map[string]interface{}) (historical map[string]interface{}) {
+	historical = make(map[string]interface{})
+	for k, v := range content {
+		if k == "metadata" {
+			continue
+		}
+		historical[k] = v
+	}
+	ver := make(map[string]interface{})
+	for k, v := range version {
+		if k == "content" {
+			continue
+		}
+		ver[k] = v
+	}
+	historical["version"] = ver
+	historical["status"] = "historical"
+	historical["history"] = map[string]interface{}{"latest": false}
+	versionContent, ok := version["content"].(map[string]interface{})
+	if ok {
+		title, ok := versionContent["title"].(string)
+		if ok && title != "" {
+			historical["title"] = title
+		}
+	}
+	return
+}
+
+// GetContentVersions - get content versions (other than lastVersion) within dateFrom - dateTo range, oldest first
+// API returns versions newest first, so paging stops on the first version older than dateFrom
+// supported is false when server has no versions list API (older Confluence Server), then versions must be fetched one by one
+func (j *DSConfluence) GetContentVersions(ctx *Ctx, id string, lastVersion int, dateFrom time.Time, dateTo *time.Time) (versions []map[string]interface{}, supported bool, err error) {
+	var headers map[string]string
+	if j.Token != "" {
+		headers = map[string]string{"Authorization": "Basic " + j.Token}
+	}
+	url := j.URL + "/rest/api/content/" + id + "/version" + fmt.Sprintf("?limit=%d", ConfluenceMaxVersions) + "&expand=content"
+	for url != "" {
+		if ctx.Debug > 1 {
+			Printf("content versions url: %s\n", url)
+		}
+		res, status, _, _, e := Request(
+			ctx,
+			url,
+			Get,
+			headers,
+			nil,
+			nil,
+			map[[2]int]struct{}{{200, 200}: {}}, // JSON statuses: 200
+			nil,                                 // Error statuses
+			map[[2]int]struct{}{{200, 200}: {}, {404, 404}: {}}, // OK statuses: 200, 404
+			nil,   // Cache statuses
+			false, // retry
+			nil,   // cache duration
+			false, // skip in dry-run mode
+		)
+		if status == 404 {
+			if len(versions) == 0 {
+				return
+			}
+			break
+		}
+		if e != nil {
+			err = e
+			return
+		}
+		result, ok := res.(map[string]interface{})
+		if !ok {
+			err = fmt.Errorf("cannot parse JSON from (status: %d):\n%s", status, string(res.([]byte)))
+			return
+		}
+		supported = true
+		done := false
+		ary, _ := result["results"].([]interface{})
+		for _, iVersion := range ary {
+			version, ok := iVersion.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			fNumber, _ := version["number"].(float64)
+			if int(fNumber) >= lastVersion {
+				continue
+			}
+			iWhen, ok := version["when"]
+			if !ok {
+				if ctx.Debug > 0 {
+					Printf("missing 'when' attribute for content %s version %.0f, skipping\n", id, fNumber)
+				}
+				continue
+			}
+			var when time.Time
+			when, err = TimeParseInterfaceString(iWhen)
+			if err != nil {
+				return
+			}
+			if when.Before(dateFrom) {
+				done = true
+				break
+			}
+			if dateTo == nil || !when.After(*dateTo) {
+				versions = append(versions, version)
+			}
+		}
+		if done {
+			break
+		}
+		url = ConfluenceNextURL(j.URL, result)
+	}
+	sort.SliceStable(versions, func(a, b int) bool {
+		na, _ := versions[a]["number"].(float64)
+		nb, _ := versions[b]["number"].(float64)
+		return na < nb
+	})
+	if ctx.Debug > 1 {
+		Printf("%s: %d versions in range\n", id, len(versions))
+	}
+	return
+}
@@ -0,0 +1,63 @@
+package dads
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConfluenceNextURL(t *testing.T) {
+	var testCases = []struct {
+		base     string
+		next     interface{}
+		expected string
+	}{
+		{base: "https://org.atlassian.net/wiki", next: nil, expected: ""},
+		{base: "https://org.atlassian.net/wiki", next: "", expected: ""},
+		{base: "https://org.atlassian.net/wiki", next: "/rest/api/content/search?cursor=abc", expected: "https://org.atlassian.net/wiki/rest/api/content/search?cursor=abc"},
+		{base: "https://org.atlassian.net/wiki", next: "/wiki/rest/api/content/search?cursor=abc", expected: "https://org.atlassian.net/wiki/rest/api/content/search?cursor=abc"},
+		{base: "https://wiki.example.com", next: "/rest/api/content/1/version?start=200", expected: "https://wiki.example.com/rest/api/content/1/version?start=200"},
+		{base: "https://wiki.example.com", next: "https://other.example.com/rest/x", expected: "https://other.example.com/rest/x"},
+	}
+	for index, test := range testCases {
+		result := map[string]interface{}{"_links": map[string]interface{}{}}
+		if test.next != nil {
+			result["_links"].(map[string]interface{})["next"] = test.next
+		}
+		got := ConfluenceNextURL(test.base, result)
+		if got != test.expected {
+			t.Errorf("test number %d, expected '%s', got '%s'", index+1, test.expected, got)
+		}
+	}
+}
+
+func TestConfluenceHistoricalContent(t *testing.T) {
+	content := map[string]interface{}{
+		"id":       "100",
+		"type":     "page",
+		"status":   "current",
+		"title":    "Design v3",
+		"metadata": map[string]interface{}{"labels": map[string]interface{}{}},
+		"version":  map[string]interface{}{"number": 3.0},
+	}
+	version := map[string]interface{}{
+		"number":  2.0,
+		"when":    "2021-03-01T10:00:00.000Z",
+		"content": map[string]interface{}{"id": "100", "title": "Design v2"},
+	}
+	historical := ConfluenceHistoricalContent(content, version)
+	ver, _ := historical["version"].(map[string]interface{})
+	if ver["number"] != 2.0 || ver["content"] != nil {
+		t.Errorf("unexpected version: %+v", ver)
+	}
+	if historical["title"] != "Design v2" || historical["status"] != "historical" || historical["metadata"] != nil || historical["id"] != "100" {
+		t.Errorf("unexpected historical content: %+v", historical)
+	}
+	if content["title"] != "Design v3" || content["status"] != "current" {
+		t.Errorf("current content modified: %+v", content)
+	}
+	from := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2021, 3, 31, 0, 0, 0, 0, time.UTC)
+	if !ConfluenceInDateRange(from, from, &to) || ConfluenceInDateRange(to.Add(time.Second), from, &to) || !ConfluenceInDateRange(to.Add(time.Second), from, nil) {
+		t.Errorf("unexpected date range check")
+	}
+}
@@ -0,0 +1,332 @@
+package dads
+
+import (
+	"fmt"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// ConfluenceSpaceCategory - space snapshots category
+	ConfluenceSpaceCategory = "space"
+)
+
+var (
+	// ConfluenceSpaceWindows - trailing windows (in days) to count distinct space contributors and orgs
+	ConfluenceSpaceWindows = []int{30, 90, 365}
+)
+
+// confluenceGet - GET confluence REST API URL and return decoded JSON object
+func (j *DSConfluence) confluenceGet(ctx *Ctx, url string) (result map[string]interface{}, err error) {
+	var headers map[string]string
+	if j.Token != "" {
+		headers = map[string]string{"Authorization": "Basic " + j.Token}
+	}
+	if ctx.Debug > 1 {
+		Printf("confluence url: %s\n", url)
+	}
+	res, status, _, _, err := Request(
+		ctx,
+		url,
+		Get,
+		headers,
+		nil,
+		nil,
+		map[[2]int]struct{}{{200, 200}: {}}, // JSON statuses: 200
+		nil,                                 // Error statuses
+		map[[2]int]struct{}{{200, 200}: {}}, // OK statuses: 200
+		nil,                                 // Cache statuses
+		false,                               // retry
+		nil,                                 // cache duration
+		false,                               // skip in dry-run mode
+	)
+	if err != nil {
+		return
+	}
+	result, ok := res.(map[string]interface{})
+	if !ok {
+		err = fmt.Errorf("cannot parse JSON from (status: %d):\n%s", status, string(res.([]byte)))
+	}
+	return
+}
+
+// confluenceGetAll - GET all pages of a confluence REST API list URL (following _links.next) and return all results
+func (j *DSConfluence) confluenceGetAll(ctx *Ctx, url string) (results []map[string]interface{}, err error) {
+	for url != "" {
+		var result map[string]interface{}
+		result, err = j.confluenceGet(ctx, url)
+		if err != nil {
+			return
+		}
+		ary, _ := result["results"].([]interface{})
+		for _, iItem := range ary {
+			item, ok := iItem.(map[string]interface{})
+			if ok {
+				results = append(results, item)
+			}
+		}
+		url = ConfluenceNextURL(j.URL, result)
+	}
+	return
+}
+
+// ConfluencePageTree - compute page tree metrics of a space from its pages' ancestors chains
+// depth is a number of ancestors, orphaned pages are top level pages other than the space homepage
+// pages outside of the homepage tree are orphaned pages and all their descendants
+func ConfluencePageTree(pages []map[string]interface{}, homepageID string) (tree map[string]interface{}) {
+	maxDepth, sumDepth, roots, outside := 0, 0, 0, 0
+	orphaned := []interface{}{}
+	depths := map[string]int{}
+	for _, page := range pages {
+		id, _ := page["id"].(string)
+		ancestors, _ := page["ancestors"].([]interface{})
+		depth := len(ancestors)
+		depths[strconv.Itoa(depth)]++
+		sumDepth += depth
+		if depth > maxDepth {
+			maxDepth = depth
+		}
+		if depth == 0 {
+			roots++
+			if homepageID != "" && id != homepageID {
+				orphaned = append(orphaned, map[string]interface{}{"id": id, "title": page["title"]})
+				outside++
+			}
+			continue
+		}
+		if homepageID != "" {
+			rootID, _ := Dig(ancestors[0], []string{"id"}, false, true)
+			if rootID != homepageID {
+				outside++
+			}
+		}
+	}
+	tree = map[string]interface{}{
+		"page_tree_max_depth":               maxDepth,
+		"page_tree_avg_depth":               0.0,
+		"page_tree_depths":                  depths,
+		"n_root_pages":                      roots,
+		"n_orphaned_pages":                  len(orphaned),
+		"orphaned_pages":                    orphaned,
+		"n_pages_outside_homepage_tree":     outside,
+		"pages_outside_homepage_tree_ratio": 0.0,
+	}
+	if len(pages) > 0 {
+		tree["page_tree_avg_depth"] = float64(sumDepth) / float64(len(pages))
+		tree["pages_outside_homepage_tree_ratio"] = float64(outside) / float64(len(pages))
+	}
+	return
+}
+
+// ConfluenceLastModifiedPage - return the most recently modified page
+func ConfluenceLastModifiedPage(pages []map[string]interface{}) (page map[string]interface{}) {
+	var last time.Time
+	for _, p := range pages {
+		iWhen, ok := Dig(p, []string{"version", "when"}, false, true)
+		if !ok {
+			continue
+		}
+		when, err := TimeParseInterfaceString(iWhen)
+		if err != nil {
+			continue
+		}
+		if page == nil || when.After(last) {
+			page = p
+			last = when
+		}
+	}
+	return
+}
+
+// GetConfluenceSpaces - get all (or configured) spaces
+func (j *DSConfluence) GetConfluenceSpaces(ctx *Ctx) (spaces []map[string]interface{}, err error) {
+	url := j.URL + "/rest/api/space?" + fmt.Sprintf("limit=%d", j.MaxContents) + "&expand=" + neturl.QueryEscape("homepage,description.plain")
+	if j.Spaces != "" {
+		for _, key := range strings.Split(j.Spaces, ",") {
+			url += "&spaceKey=" + neturl.QueryEscape(strings.TrimSpace(key))
+		}
+	}
+	spaces, err = j.confluenceGetAll(ctx, url)
+	return
+}
+
+// GetConfluenceSpacePages - get all current pages of a space with their ancestors
+func (j *DSConfluence) GetConfluenceSpacePages(ctx *Ctx, key string) (pages []map[string]interface{}, err error) {
+	cql := `space="` + key + `" and type=page`
+	url := j.URL + "/rest/api/content/search?cql=" + neturl.QueryEscape(cql) + fmt.Sprintf("&limit=%d", j.MaxContents) + "&expand=" + neturl.QueryEscape("ancestors,version")
+	pages, err = j.confluenceGetAll(ctx, url)
+	return
+}
+
+// ProcessSpace - add pages count, last modified page and page tree metrics to a space
+func (j *DSConfluence) ProcessSpace(ctx *Ctx, space map[string]interface{}) (err error) {
+	key, _ := space["key"].(string)
+	pages, err := j.GetConfluenceSpacePages(ctx, key)
+	if err != nil {
+		return
+	}
+	space["pages_count"] = len(pages)
+	space["last_modified_page"] = nil
+	last := ConfluenceLastModifiedPage(pages)
+	if last != nil {
+		lastPage := map[string]interface{}{"id": last["id"], "title": last["title"]}
+		lastPage["when"], _ = Dig(last, []string{"version", "when"}, false, true)
+		lastPage["by"], _ = Dig(last, []string{"version", "by"}, false, true)
+		webUI, ok := Dig(last, []string{"_links", "webui"}, false, true)
+		if ok {
+			lastPage["url"] = j.URL + webUI.(string)
+		}
+		space["last_modified_page"] = lastPage
+	}
+	homepageID, _ := Dig(space, []string{"homepage", "id"}, false, true)
+	sHomepageID, _ := homepageID.(string)
+	space["page_tree"] = ConfluencePageTree(pages, sHomepageID)
+	return
+}
+
+// FetchItemsSpace - snapshot all spaces
+func (j *DSConfluence) FetchItemsSpace(ctx *Ctx) (err error) {
+	spaces, err := j.GetConfluenceSpaces(ctx)
+	if err != nil {
+		return
+	}
+	fetchedOn := fmt.Sprintf("%.6f", float64(time.Now().UnixNano())/1.0e9)
+	items := []interface{}{}
+	for _, space := range spaces {
+		err = j.ProcessSpace(ctx, space)
+		if err != nil {
+			return
+		}
+		space["fetched_on"] = fetchedOn
+		esItem := j.AddMetadata(ctx, space)
+		if ctx.Project != "" {
+			space["project"] = ctx.Project
+		}
+		esItem["data"] = space
+		items = append(items, esItem)
+		if len(items) >= ctx.ESBulkSize {
+			err = SendToElastic(ctx, j, true, UUID, items)
+			if err != nil {
+				Printf("Error %v sending %d spaces to ES\n", err, len(items))
+				return
+			}
+			items = []interface{}{}
+		}
+	}
+	if len(items) > 0 {
+		err = SendToElastic(ctx, j, true, UUID, items)
+		if err != nil {
+			Printf("Error %v sending %d spaces to ES\n", err, len(items))
+		}
+	}
+	Printf("%s: %d spaces snapshotted\n", j.URL, len(spaces))
+	return
+}
+
+// ConfluenceSpaceContributorsQuery - return contents rich index query counting distinct contributors and their orgs of a space
+// within [to - days, to], snapshot's fetched on date is used as to, so re-enriched snapshots keep their values
+func ConfluenceSpaceContributorsQuery(key string, days int, to time.Time) []byte {
+	to = to.UTC()
+	from := to.AddDate(0, 0, -days)
+	return []byte(`{"query":{"bool":{"filter":[{"term":{"space":"` + JSONEscape(key) + `"}},{"range":{"grimoire_creation_date":{"gte":"` + ToESDate(from) + `","lte":"` + ToESDate(to) + `"}}}]}},` +
+		`"aggs":{"contributors":{"cardinality":{"field":"` + Author + `_uuid"}},"known":{"filter":{"bool":{"must_not":{"term":{"` + Author + `_org_name":"` + Unknown + `"}}}},` +
+		`"aggs":{"orgs":{"cardinality":{"field":"` + Author + `_org_name"}}}}}}`)
+}
+
+// SpaceContributors - count distinct contributors and their orgs of a space within days before to using contents rich index
+func (j *DSConfluence) SpaceContributors(ctx *Ctx, key string, days int, to time.Time) (contributors, orgs int, err error) {
+	url := ctx.ESURL + "/" + j.ContentIndex + "/_search?size=0"
+	payload := ConfluenceSpaceContributorsQuery(key, days, to)
+	var resp interface{}
+	resp, _, _, _, err = Request(
+		ctx,
+		url,
+		Post,
+		map[string]string{"Content-Type": "application/json"}, // headers
+		payload,                             // payload
+		[]string{},                          // cookies
+		map[[2]int]struct{}{{200, 200}: {}}, // JSON statuses: 200
+		nil,                                 // Error statuses
+		map[[2]int]struct{}{{200, 200}: {}}, // OK statuses: 200
+		nil,                                 // Cache statuses
+		true,                                // retry
+		nil,                                 // cache for
+		false,                               // skip in dry-run mode
+	)
+	if err != nil {
+		return
+	}
+	v, _ := Dig(resp, []string{"aggregations", "contributors", "value"}, false, true)
+	f, _ := v.(float64)
+	contributors = int(f)
+	v, _ = Dig(resp, []string{"aggregations", "known", "orgs", "value"}, false, true)
+	f, _ = v.(float64)
+	orgs = int(f)
+	return
+}
+
+// EnrichSpaceItem - return rich item from raw space snapshot
+func (j *DSConfluence) EnrichSpaceItem(ctx *Ctx, item map[string]interface{}, author string, affs bool, extra interface{}) (rich map[string]interface{}, err error) {
+	rich = make(map[string]interface{})
+	for _, field := range RawFields {
+		v, _ := item[field]
+		rich[field] = v
+	}
+	space, ok := item["data"].(map[string]interface{})
+	if !ok {
+		err = fmt.Errorf("missing data field in item %+v", DumpKeys(item))
+		return
+	}
+	key, _ := space["key"].(string)
+	rich["id"], _ = space["id"]
+	rich["space"] = key
+	rich["space_key"] = key
+	rich["space_name"], _ = space["name"]
+	rich["space_type"], _ = space["type"]
+	rich["space_status"], _ = space["status"]
+	rich["title"], _ = space["name"]
+	rich["description"], _ = Dig(space, []string{"description", "plain", "value"}, false, true)
+	rich["type"] = ConfluenceSpaceCategory
+	rich["is_space"] = 1
+	rich["url"] = nil
+	webUI, ok := Dig(space, []string{"_links", "webui"}, false, true)
+	if ok {
+		rich["url"] = j.URL + webUI.(string)
+	}
+	rich["homepage_id"], _ = Dig(space, []string{"homepage", "id"}, false, true)
+	rich["homepage_title"], _ = Dig(space, []string{"homepage", "title"}, false, true)
+	rich["pages_count"], _ = space["pages_count"]
+	for _, field := range []string{"id", "title", "url", "when"} {
+		rich["last_modified_page_"+field], _ = Dig(space, []string{"last_modified_page", field}, false, true)
+	}
+	rich["last_modified_page_author_name"], _ = Dig(space, []string{"last_modified_page", "by", "displayName"}, false, true)
+	updatedOn := j.ItemUpdatedOn(space)
+	rich["days_since_last_modified"] = nil
+	iWhen, ok := rich["last_modified_page_when"]
+	if ok && iWhen != nil {
+		when, e := TimeParseInterfaceString(iWhen)
+		if e == nil {
+			rich["days_since_last_modified"] = float64(updatedOn.Sub(when).Seconds()) / 86400.0
+		}
+	}
+	tree, _ := space["page_tree"].(map[string]interface{})
+	for k, v := range tree {
+		rich[k] = v
+	}
+	for _, days := range ConfluenceSpaceWindows {
+		var contributors, orgs int
+		contributors, orgs, err = j.SpaceContributors(ctx, key, days, updatedOn)
+		if err != nil {
+			return
+		}
+		rich[fmt.Sprintf("contributors_%dd", days)] = contributors
+		rich[fmt.Sprintf("orgs_%dd", days)] = orgs
+	}
+	rich["date"] = updatedOn
+	for prop, value := range CommonFields(j, updatedOn, ConfluenceSpaceCategory) {
+		rich[prop] = value
+	}
+	return
+}
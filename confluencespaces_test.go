@@ -0,0 +1,67 @@
+package dads
+
+import (
+	"testing"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+func TestConfluencePageTree(t *testing.T) {
+	var pages []map[string]interface{}
+	err := jsoniter.Unmarshal([]byte(`[
+		{"id":"1","title":"Home","version":{"when":"2021-03-01T10:00:00.000Z"}},
+		{"id":"2","title":"Docs","ancestors":[{"id":"1"}],"version":{"when":"2021-03-05T10:00:00.000Z"}},
+		{"id":"3","title":"API","ancestors":[{"id":"1"},{"id":"2"}],"version":{"when":"2021-02-01T10:00:00.000Z"}},
+		{"id":"4","title":"Stray","version":{"when":"2021-01-01T10:00:00.000Z"}},
+		{"id":"5","title":"Stray child","ancestors":[{"id":"4"}]}
+	]`), &pages)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	tree := ConfluencePageTree(pages, "1")
+	if tree["page_tree_max_depth"] != 2 || tree["n_root_pages"] != 2 || tree["n_orphaned_pages"] != 1 || tree["n_pages_outside_homepage_tree"] != 2 {
+		t.Errorf("unexpected page tree: %+v", tree)
+	}
+	if tree["page_tree_avg_depth"] != 0.8 || tree["pages_outside_homepage_tree_ratio"] != 0.4 {
+		t.Errorf("unexpected page tree ratios: %+v", tree)
+	}
+	depths, _ := tree["page_tree_depths"].(map[string]int)
+	if depths["0"] != 2 || depths["1"] != 2 || depths["2"] != 1 {
+		t.Errorf("unexpected page tree depths: %+v", depths)
+	}
+	last := ConfluenceLastModifiedPage(pages)
+	if last == nil || last["id"] != "2" {
+		t.Errorf("unexpected last modified page: %+v", last)
+	}
+	empty := ConfluencePageTree(nil, "")
+	if empty["page_tree_avg_depth"] != 0.0 || empty["n_root_pages"] != 0 {
+		t.Errorf("unexpected empty page tree: %+v", empty)
+	}
+}
+
+func TestConfluenceSpaceContributorsQuery(t *testing.T) {
+	to := time.Date(2021, 6, 30, 12, 0, 0, 0, time.UTC)
+	var query interface{}
+	err := jsoniter.Unmarshal(ConfluenceSpaceContributorsQuery("DOC", 30, to), &query)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	filters, _ := Dig(query, []string{"query", "bool", "filter"}, false, true)
+	ary, _ := filters.([]interface{})
+	if len(ary) != 2 {
+		t.Errorf("unexpected filters %+v", filters)
+		return
+	}
+	gte, _ := Dig(ary[1], []string{"range", "grimoire_creation_date", "gte"}, false, true)
+	lte, _ := Dig(ary[1], []string{"range", "grimoire_creation_date", "lte"}, false, true)
+	if gte != "2021-05-31T12:00:00.000000+00:00" || lte != "2021-06-30T12:00:00.000000+00:00" {
+		t.Errorf("window should end at snapshot date, got %v - %v", gte, lte)
+	}
+	space, _ := Dig(ary[0], []string{"term", "space"}, false, true)
+	if space != "DOC" {
+		t.Errorf("unexpected space filter %v", space)
+	}
+}
@@ -30,6 +30,15 @@ const Confluence string = "confluence"
 // Rocketchat - common constant string
 const Rocketchat string = "rocketchat"
 
+// GitLab - common constant string
+const GitLab string = "gitlab"
+
+// Discourse - common constant string
+const Discourse string = "discourse"
+
+// Slack - common constant string
+const Slack string = "slack"
+
 // Stub - common constant string
 const Stub string = "stub"
 
@@ -138,6 +147,12 @@ const Changeset = "changeset"
 // Approval - common constant string
 const Approval = "approval"
 
+// PatchsetFile - common constant string
+const PatchsetFile = "patchset_file"
+
+// InlineComment - common constant string
+const InlineComment = "inline_comment"
+
 // HistoricalContent - common constant string
 const HistoricalContent = "historical content"
 
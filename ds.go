@@ -1549,6 +1549,61 @@ func Enrich(ctx *Ctx, ds DS) (err error) {
 	return
 }
 
+// OriginResume - resume state detected by generic FetchRaw for one origin of a datasource processing many origins
+type OriginResume struct {
+	DateFrom           *time.Time
+	DateFromDetected   bool
+	OffsetFrom         float64
+	OffsetFromDetected bool
+}
+
+// ForEachOrigin - call f for every origin of a datasource processing many origins (org repositories, server rooms, workspace channels)
+// switchTo(i) switches datasource to i-th origin and returns its key, switchTo(-1) switches it back to all origins mode
+// every origin has its own resume state, so ctx resume state is reset before each call and restored at the end
+func ForEachOrigin(ctx *Ctx, ds DS, origins int, switchTo func(int) string, f func(string) error) (err error) {
+	dateFrom, dateFromDetected, offsetFrom, offsetFromDetected := ctx.DateFrom, ctx.DateFromDetected, ctx.OffsetFrom, ctx.OffsetFromDetected
+	defer func() {
+		ctx.DateFrom, ctx.DateFromDetected, ctx.OffsetFrom, ctx.OffsetFromDetected = dateFrom, dateFromDetected, offsetFrom, offsetFromDetected
+		switchTo(-1)
+	}()
+	for i := 0; i < origins; i++ {
+		ctx.DateFrom, ctx.DateFromDetected, ctx.OffsetFrom, ctx.OffsetFromDetected = dateFrom, dateFromDetected, offsetFrom, offsetFromDetected
+		key := switchTo(i)
+		Printf("%s: processing origin %d/%d\n", ds.Origin(ctx), i+1, origins)
+		err = f(key)
+		if err != nil {
+			err = fmt.Errorf("%s: %v", ds.Origin(ctx), err)
+			return
+		}
+	}
+	return
+}
+
+// FetchRawOrigin - return ForEachOrigin callback running generic FetchRaw and saving resume state it detected
+func FetchRawOrigin(ctx *Ctx, ds DS, resume map[string]OriginResume) func(string) error {
+	return func(key string) (err error) {
+		err = FetchRaw(ctx, ds)
+		resume[key] = OriginResume{
+			DateFrom:           ctx.DateFrom,
+			DateFromDetected:   ctx.DateFromDetected,
+			OffsetFrom:         ctx.OffsetFrom,
+			OffsetFromDetected: ctx.OffsetFromDetected,
+		}
+		return
+	}
+}
+
+// EnrichOrigin - return ForEachOrigin callback running generic Enrich, starting from resume state detected while fetching origin's raw data
+func EnrichOrigin(ctx *Ctx, ds DS, resume map[string]OriginResume) func(string) error {
+	return func(key string) error {
+		state, ok := resume[key]
+		if ok {
+			ctx.DateFrom, ctx.DateFromDetected, ctx.OffsetFrom, ctx.OffsetFromDetected = state.DateFrom, state.DateFromDetected, state.OffsetFrom, state.OffsetFromDetected
+		}
+		return Enrich(ctx, ds)
+	}
+}
+
 // EnrichItem - perform generic additional operations on already enriched item
 func EnrichItem(ctx *Ctx, ds DS, richItem map[string]interface{}) (err error) {
 	richItem[DefaultEnrichDateField] = time.Now()
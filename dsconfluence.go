@@ -22,7 +22,7 @@ var (
 	// ConfluenceRichMapping - Confluence rich index mapping
 	ConfluenceRichMapping = []byte(`{"properties":{"metadata__updated_on":{"type":"date"},"title_analyzed":{"type":"text","index":true}}}`)
 	// ConfluenceCategories - categories defined for Confluence
-	ConfluenceCategories = map[string]struct{}{HistoricalContent: {}}
+	ConfluenceCategories = map[string]struct{}{HistoricalContent: {}, ConfluenceSpaceCategory: {}}
 	// ConfluenceDefaultMaxContents - max contents to fetch at a time
 	ConfluenceDefaultMaxContents = 1000
 	// ConfluenceDefaultSearchField - default search field
@@ -35,13 +35,16 @@ var (
 
 // DSConfluence - DS implementation for confluence - does nothing at all, just presents a skeleton code
 type DSConfluence struct {
-	DS          string
-	URL         string // From DA_CONFLUENCE_URL - Group name like GROUP-topic
-	NoSSLVerify bool   // From DA_CONFLUENCE_NO_SSL_VERIFY
-	MultiOrigin bool   // From DA_CONFLUENCE_MULTI_ORIGIN - allow multiple groups in a single index
-	MaxContents int    // From DA_CONFLUENCE_MAX_CONTENTS, defaults to ConfluenceDefaultMaxContents (200)
-	User        string // From DA_CONFLUENCE_USER - if user is provided then we assume that we don't have base64 encoded user:token yet
-	Token       string // From DA_CONFLUENCE_TOKEN - if user is not specified we assume that token already contains "<username>:<your-api-token>"
+	DS           string
+	URL          string // From DA_CONFLUENCE_URL - Group name like GROUP-topic
+	NoSSLVerify  bool   // From DA_CONFLUENCE_NO_SSL_VERIFY
+	MultiOrigin  bool   // From DA_CONFLUENCE_MULTI_ORIGIN - allow multiple groups in a single index
+	MaxContents  int    // From DA_CONFLUENCE_MAX_CONTENTS, defaults to ConfluenceDefaultMaxContents (200)
+	User         string // From DA_CONFLUENCE_USER - if user is provided then we assume that we don't have base64 encoded user:token yet
+	Token        string // From DA_CONFLUENCE_TOKEN - if user is not specified we assume that token already contains "<username>:<your-api-token>"
+	Category     string // From DA_CONFLUENCE_CATEGORY - "historical content" (default) or "space"
+	Spaces       string // From DA_CONFLUENCE_SPACES - space category: "," separated list of space keys to snapshot, all spaces when not set
+	ContentIndex string // From DA_CONFLUENCE_CONTENT_INDEX - space category: rich index with historical contents used to count contributors, defaults to the current rich index
 }
 
 // ParseArgs - parse confluence specific environment variables
@@ -51,6 +54,9 @@ func (j *DSConfluence) ParseArgs(ctx *Ctx) (err error) {
 	j.URL = os.Getenv(prefix + "URL")
 	j.NoSSLVerify = StringToBool(os.Getenv(prefix + "NO_SSL_VERIFY"))
 	j.MultiOrigin = StringToBool(os.Getenv(prefix + "MULTI_ORIGIN"))
+	j.Category = ctx.Category
+	j.Spaces = os.Getenv(prefix + "SPACES")
+	j.ContentIndex = os.Getenv(prefix + "CONTENT_INDEX")
 	if j.NoSSLVerify {
 		NoSSLVerify()
 	}
@@ -83,6 +89,21 @@ func (j *DSConfluence) Validate(ctx *Ctx) (err error) {
 	}
 	if j.URL == "" {
 		err = fmt.Errorf("URL must be set")
+		return
+	}
+	j.Category = strings.TrimSpace(j.Category)
+	if j.Category == "" {
+		j.Category = HistoricalContent
+	}
+	_, ok := ConfluenceCategories[j.Category]
+	if !ok {
+		err = fmt.Errorf("unsupported category %s", j.Category)
+		return
+	}
+	j.Spaces = strings.TrimSpace(j.Spaces)
+	j.ContentIndex = strings.TrimSpace(j.ContentIndex)
+	if j.ContentIndex == "" {
+		j.ContentIndex = ctx.RichIndex
 	}
 	return
 }
@@ -119,8 +140,9 @@ func (j *DSConfluence) Enrich(ctx *Ctx) (err error) {
 	return
 }
 
-// GetHistoricalContents - get historical contents from teh current content
-func (j *DSConfluence) GetHistoricalContents(ctx *Ctx, content map[string]interface{}, dateFrom time.Time) (contents []map[string]interface{}, err error) {
+// GetHistoricalContents - get historical contents from the current content
+// Returns contents' versions modified within dateFrom - dateTo range (dateTo is optional), the current content is the last one
+func (j *DSConfluence) GetHistoricalContents(ctx *Ctx, content map[string]interface{}, dateFrom time.Time, dateTo *time.Time) (contents []map[string]interface{}, err error) {
 	iContentURL, _ := Dig(content, []string{"_links", "webui"}, true, false)
 	ancestors, ok := Dig(content, []string{"ancestors"}, false, true)
 	if !ok {
@@ -132,10 +154,6 @@ func (j *DSConfluence) GetHistoricalContents(ctx *Ctx, content map[string]interf
 	content["ancestors"] = ancestors
 	iVersionNumber, _ := Dig(content, []string{"version", "number"}, true, false)
 	lastVersion := int(iVersionNumber.(float64))
-	if lastVersion == 1 {
-		contents = append(contents, content)
-		return
-	}
 	iID, ok := content["id"]
 	if !ok {
 		err = fmt.Errorf("missing id property in content: %+v", content)
@@ -146,19 +164,64 @@ func (j *DSConfluence) GetHistoricalContents(ctx *Ctx, content map[string]interf
 		err = fmt.Errorf("id property is not a string: %+v", content)
 		return
 	}
+	if lastVersion > 1 {
+		var (
+			versions  []map[string]interface{}
+			supported bool
+		)
+		versions, supported, err = j.GetContentVersions(ctx, id, lastVersion, dateFrom, dateTo)
+		if err != nil {
+			return
+		}
+		if supported {
+			for _, version := range versions {
+				contents = append(contents, ConfluenceHistoricalContent(content, version))
+			}
+		} else {
+			contents, err = j.GetHistoricalContentsOneByOne(ctx, content, id, lastVersion, dateFrom, dateTo)
+			if err != nil {
+				return
+			}
+		}
+	}
+	current := true
+	if dateTo != nil {
+		iWhen, ok := Dig(content, []string{"version", "when"}, false, true)
+		if ok {
+			var when time.Time
+			when, err = TimeParseInterfaceString(iWhen)
+			if err != nil {
+				return
+			}
+			current = !when.After(*dateTo)
+		}
+	}
+	if current {
+		contents = append(contents, content)
+	}
+	if ctx.Debug > 1 {
+		Printf("final %s %d (%d historical contents)\n", id, lastVersion, len(contents))
+	}
+	return
+}
+
+// GetHistoricalContentsOneByOne - get historical contents (other than lastVersion) fetching each version separately
+// Used for servers that don't support versions list API
+func (j *DSConfluence) GetHistoricalContentsOneByOne(ctx *Ctx, content map[string]interface{}, id string, lastVersion int, dateFrom time.Time, dateTo *time.Time) (contents []map[string]interface{}, err error) {
+	contentURL := content["content_url"]
+	ancestors := content["ancestors"]
+	container, hasContainer := content["container"]
 	method := Get
 	var headers map[string]string
 	if j.Token != "" {
 		headers = map[string]string{"Authorization": "Basic " + j.Token}
 	}
 	cacheDur := time.Duration(24) * time.Hour
-	version := 1
 	var (
 		res    interface{}
 		status int
 	)
-	for {
-		////url := j.URL + "/rest/api/content/" + id + "?version=" + strconv.Itoa(version) + "&status=historical&expand=" + neturl.QueryEscape("body.storage,history,version")
+	for version := 1; version < lastVersion; version++ {
 		url := j.URL + "/rest/api/content/" + id + "?version=" + strconv.Itoa(version) + "&status=historical&expand=" + neturl.QueryEscape("history,version")
 		if ctx.Debug > 1 {
 			Printf("historical content url: %s\n", url)
@@ -182,6 +245,7 @@ func (j *DSConfluence) GetHistoricalContents(ctx *Ctx, content map[string]interf
 			if ctx.Debug > 1 {
 				Printf("%s: v%d status %d: %s\n", id, version, status, url)
 			}
+			err = nil
 			break
 		}
 		if err != nil {
@@ -206,7 +270,6 @@ func (j *DSConfluence) GetHistoricalContents(ctx *Ctx, content map[string]interf
 			if latest {
 				break
 			}
-			version++
 			continue
 		}
 		var when time.Time
@@ -214,9 +277,12 @@ func (j *DSConfluence) GetHistoricalContents(ctx *Ctx, content map[string]interf
 		if err != nil {
 			return
 		}
-		if !when.Before(dateFrom) {
+		if ConfluenceInDateRange(when, dateFrom, dateTo) {
 			result["content_url"] = contentURL
 			result["ancestors"] = ancestors
+			if hasContainer {
+				result["container"] = container
+			}
 			contents = append(contents, result)
 		}
 		if ctx.Debug > 2 {
@@ -225,75 +291,17 @@ func (j *DSConfluence) GetHistoricalContents(ctx *Ctx, content map[string]interf
 		if latest {
 			break
 		}
-		version++
-		if version == lastVersion {
-			break
-		}
-	}
-	contents = append(contents, content)
-	if ctx.Debug > 1 {
-		Printf("final %s %d (%d historical contents)\n", id, version, len(contents))
 	}
 	return
 }
 
-// GetConfluenceContents - get confluence historical contents
-func (j *DSConfluence) GetConfluenceContents(ctx *Ctx, fromDate, next string) (contents []map[string]interface{}, newNext string, err error) {
-	/*
-		Printf("GetConfluenceContents: in\n")
-		defer func() {
-			Printf("GetConfluenceContents: out %d\n", len(contents))
-		}()
-	*/
-	if next == "" {
-		return
-	}
-	method := Get
-	var headers map[string]string
-	if j.Token != "" {
-		headers = map[string]string{"Authorization": "Basic " + j.Token}
-	}
-	cacheDur := time.Duration(24) * time.Hour
-	var url string
-	// Init state
-	if next == "i" {
-		////url = j.URL + "/rest/api/content/search?cql=" + neturl.QueryEscape("lastModified>='"+fromDate+"' order by lastModified") + fmt.Sprintf("&limit=%d&expand=ancestors", j.MaxContents)
-		url = j.URL + "/rest/api/content/search?cql=" + neturl.QueryEscape("lastModified>='"+fromDate+"' order by lastModified") + fmt.Sprintf("&limit=%d", j.MaxContents) + "&expand=" + neturl.QueryEscape("ancestors,version")
-	} else {
-		url = j.URL + next
-	}
-	if ctx.Debug > 1 {
-		Printf("content url: %s\n", url)
-	}
-	res, status, _, _, err := Request(
-		ctx,
-		url,
-		method,
-		headers,
-		nil,
-		nil,
-		map[[2]int]struct{}{{200, 200}: {}}, // JSON statuses: 200
-		nil,                                 // Error statuses
-		map[[2]int]struct{}{{200, 200}: {}}, // OK statuses: 200
-		map[[2]int]struct{}{{200, 200}: {}}, // Cache statuses: 200
-		false,                               // retry
-		&cacheDur,                           // cache duration
-		false,                               // skip in dry-run mode
-	)
-	// Printf("res=%v\n", res.(map[string]interface{}))
-	// Printf("status=%d, err=%v\n", status, err)
+// GetConfluenceContents - get a page of CQL search results and the next page (cursor) URL, which is empty on the last page
+func (j *DSConfluence) GetConfluenceContents(ctx *Ctx, url string) (contents []map[string]interface{}, next string, err error) {
+	result, err := j.confluenceGet(ctx, url)
 	if err != nil {
 		return
 	}
-	result, ok := res.(map[string]interface{})
-	if !ok {
-		err = fmt.Errorf("cannot parse JSON from (status: %d):\n%s", status, string(res.([]byte)))
-		return
-	}
-	iNext, ok := Dig(result, []string{"_links", "next"}, false, true)
-	if ok {
-		newNext, _ = iNext.(string)
-	}
+	next = ConfluenceNextURL(j.URL, result)
 	iResults, ok := result["results"]
 	if ok {
 		results, ok := iResults.([]interface{})
@@ -311,6 +319,9 @@ func (j *DSConfluence) GetConfluenceContents(ctx *Ctx, fromDate, next string) (c
 
 // FetchItems - implement enrich data for confluence datasource
 func (j *DSConfluence) FetchItems(ctx *Ctx) (err error) {
+	if j.Category == ConfluenceSpaceCategory {
+		return j.FetchItemsSpace(ctx)
+	}
 	var (
 		sDateFrom string
 		dateFrom  time.Time
@@ -322,7 +333,8 @@ func (j *DSConfluence) FetchItems(ctx *Ctx) (err error) {
 		dateFrom = DefaultDateFrom
 		sDateFrom = "1970-01-01 00:00"
 	}
-	next := "i"
+	dateTo := ctx.DateTo
+	url := j.ConfluenceSearchURL(ConfluenceSearchCQL(sDateFrom))
 	var (
 		ch             chan error
 		allContents    []interface{}
@@ -345,7 +357,7 @@ func (j *DSConfluence) FetchItems(ctx *Ctx) (err error) {
 		}()
 		// Printf("processContent: in\n")
 		var contents []map[string]interface{}
-		contents, e = j.GetHistoricalContents(ctx, content, dateFrom)
+		contents, e = j.GetHistoricalContents(ctx, content, dateFrom, dateTo)
 		if e != nil {
 			return
 		}
@@ -402,7 +414,7 @@ func (j *DSConfluence) FetchItems(ctx *Ctx) (err error) {
 	if thrN > 1 {
 		for {
 			var contents []map[string]interface{}
-			contents, next, err = j.GetConfluenceContents(ctx, sDateFrom, next)
+			contents, url, err = j.GetConfluenceContents(ctx, url)
 			if err != nil {
 				return
 			}
@@ -436,7 +448,7 @@ func (j *DSConfluence) FetchItems(ctx *Ctx) (err error) {
 					nThreads--
 				}
 			}
-			if next == "" {
+			if url == "" {
 				break
 			}
 		}
@@ -450,7 +462,7 @@ func (j *DSConfluence) FetchItems(ctx *Ctx) (err error) {
 	} else {
 		for {
 			var contents []map[string]interface{}
-			contents, next, err = j.GetConfluenceContents(ctx, sDateFrom, next)
+			contents, url, err = j.GetConfluenceContents(ctx, url)
 			if err != nil {
 				return
 			}
@@ -460,7 +472,7 @@ func (j *DSConfluence) FetchItems(ctx *Ctx) (err error) {
 					return
 				}
 			}
-			if next == "" {
+			if url == "" {
 				break
 			}
 		}
@@ -510,7 +522,7 @@ func (j *DSConfluence) DateField(*Ctx) string {
 
 // RichIDField - return rich ID field name
 func (j *DSConfluence) RichIDField(*Ctx) string {
-	// Because in confluence one raw item generates no more than 1 rich item
+	// Label documents get their own UUIDs (see EnrichLabels), other raw items generate no more than 1 rich item
 	return UUID
 }
 
@@ -557,6 +569,11 @@ func (j *DSConfluence) Origin(ctx *Ctx) string {
 
 // ItemID - return unique identifier for an item
 func (j *DSConfluence) ItemID(item interface{}) string {
+	if j.Category == ConfluenceSpaceCategory {
+		key, _ := Dig(item, []string{"key"}, true, false)
+		fetchedOn, _ := Dig(item, []string{"fetched_on"}, true, false)
+		return key.(string) + "#" + fetchedOn.(string)
+	}
 	id, _ := Dig(item, []string{"id"}, true, false)
 	versionNumber, _ := Dig(item, []string{"version", "number"}, true, false)
 	return id.(string) + "#v" + fmt.Sprintf("%.0f", versionNumber.(float64))
@@ -583,6 +600,15 @@ func (j *DSConfluence) AddMetadata(ctx *Ctx, item interface{}) (mItem map[string
 	mItem[DefaultOffsetField] = float64(updatedOn.Unix())
 	mItem["category"] = j.ItemCategory(item)
 	mItem["search_fields"] = make(map[string]interface{})
+	if j.Category == ConfluenceSpaceCategory {
+		key, _ := Dig(item, []string{"key"}, true, false)
+		FatalOnError(DeepSet(mItem, []string{"search_fields", ConfluenceDefaultSearchField}, itemID, false))
+		FatalOnError(DeepSet(mItem, []string{"search_fields", "space_key"}, key, false))
+		mItem[DefaultDateField] = ToESDate(updatedOn)
+		mItem[DefaultTimestampField] = ToESDate(timestamp)
+		mItem[ProjectSlug] = ctx.ProjectSlug
+		return
+	}
 	id, _ := Dig(item, []string{"id"}, true, false)
 	versionNumber, _ := Dig(item, []string{"version", "number"}, true, false)
 	var ancestorIDs []interface{}
@@ -615,6 +641,13 @@ func (j *DSConfluence) AddMetadata(ctx *Ctx, item interface{}) (mItem map[string
 
 // ItemUpdatedOn - return updated on date for an item
 func (j *DSConfluence) ItemUpdatedOn(item interface{}) time.Time {
+	if j.Category == ConfluenceSpaceCategory {
+		iFetchedOn, _ := Dig(item, []string{"fetched_on"}, true, false)
+		epochNS, err := strconv.ParseFloat(iFetchedOn.(string), 64)
+		FatalOnError(err)
+		epochNS *= 1.0e9
+		return time.Unix(0, int64(epochNS))
+	}
 	iWhen, _ := Dig(item, []string{"version", "when"}, false, true)
 	when, err := TimeParseInterfaceString(iWhen)
 	FatalOnError(err)
@@ -623,7 +656,7 @@ func (j *DSConfluence) ItemUpdatedOn(item interface{}) time.Time {
 
 // ItemCategory - return unique identifier for an item
 func (j *DSConfluence) ItemCategory(item interface{}) string {
-	return HistoricalContent
+	return j.Category
 }
 
 // ElasticRawMapping - Raw index mapping definition
@@ -645,6 +678,9 @@ func (j *DSConfluence) GetItemIdentities(ctx *Ctx, doc interface{}) (identities
 			Printf("%+v -> %+v\n", DumpPreview(doc, 100), identities)
 		}()
 	}
+	if j.Category == ConfluenceSpaceCategory {
+		return
+	}
 	iUser, ok := Dig(doc, []string{"data", "version", "by"}, true, false)
 	user, _ := iUser.(map[string]interface{})
 	username := Nil
@@ -723,10 +759,23 @@ func ConfluenceEnrichItemsFunc(ctx *Ctx, ds DS, thrN int, items []interface{}, d
 		if e != nil {
 			return
 		}
+		richItems := []interface{}{rich}
+		var labels []interface{}
+		labels, e = ds.(*DSConfluence).EnrichLabels(ctx, doc, rich)
+		if e != nil {
+			return
+		}
+		for _, label := range labels {
+			e = EnrichItem(ctx, ds, label.(map[string]interface{}))
+			if e != nil {
+				return
+			}
+			richItems = append(richItems, label)
+		}
 		if thrN > 1 {
 			mtx.Lock()
 		}
-		*docs = append(*docs, rich)
+		*docs = append(*docs, richItems...)
 		if thrN > 1 {
 			mtx.Unlock()
 		}
@@ -773,6 +822,9 @@ func (j *DSConfluence) EnrichItems(ctx *Ctx) (err error) {
 
 // EnrichItem - return rich item from raw item for a given author type
 func (j *DSConfluence) EnrichItem(ctx *Ctx, item map[string]interface{}, author string, affs bool, extra interface{}) (rich map[string]interface{}, err error) {
+	if j.Category == ConfluenceSpaceCategory {
+		return j.EnrichSpaceItem(ctx, item, author, affs, extra)
+	}
 	rich = make(map[string]interface{})
 	for _, field := range RawFields {
 		v, _ := item[field]
@@ -815,10 +867,8 @@ func (j *DSConfluence) EnrichItem(ctx *Ctx, item map[string]interface{}, author
 	webUI, _ := Dig(page, []string{"_links", "webui"}, true, false)
 	////rich["url"] = base.(string) + webUI.(string)
 	rich["url"] = j.URL + webUI.(string)
-	iSpace, ok := Dig(page, []string{"_expandable", "space"}, false, true)
+	space, ok := ConfluenceSpaceKey(page)
 	if ok {
-		space, _ := iSpace.(string)
-		space = strings.Replace(space, "/rest/api/space/", "", -1)
 		rich["space"] = space
 	}
 	var (
@@ -854,6 +904,13 @@ func (j *DSConfluence) EnrichItem(ctx *Ctx, item map[string]interface{}, author
 	rich["is_blogpost"] = 0
 	tp, _ := rich["type"].(string)
 	rich["is_"+tp] = 1
+	switch tp {
+	case "comment":
+		j.EnrichContainerFields(page, rich)
+	case "attachment":
+		j.EnrichContainerFields(page, rich)
+		j.EnrichAttachmentFields(page, rich)
+	}
 	// can also be rich["date"]
 	updatedOn, _ := Dig(item, []string{j.DateField(ctx)}, true, false)
 	if affs {
@@ -956,6 +1013,9 @@ func (j *DSConfluence) GetRoleIdentity(ctx *Ctx, item map[string]interface{}, ro
 // second return parameter is static mode (true/false)
 // dynamic roles will use item to get its roles
 func (j *DSConfluence) AllRoles(ctx *Ctx, item map[string]interface{}) ([]string, bool) {
+	if j.Category == ConfluenceSpaceCategory {
+		return []string{}, true
+	}
 	return []string{"by"}, true
 }
 
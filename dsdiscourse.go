@@ -0,0 +1,1166 @@
+package dads
+
+import (
+	"fmt"
+	"html"
+	neturl "net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DiscourseBackendVersion - backend version
+	DiscourseBackendVersion = "0.0.1"
+	// DiscourseTopic - topic category, rich topic document type
+	DiscourseTopic = "topic"
+	// DiscoursePost - rich post document type
+	DiscoursePost = "post"
+	// DiscoursePostsChunk - max number of posts fetched via a single topic posts request
+	DiscoursePostsChunk = 20
+	// DiscourseMaxBodyLength - max rich body extract length
+	DiscourseMaxBodyLength = 1000
+	// DiscourseMaxRichBodyLines - max rich body extract lines
+	DiscourseMaxRichBodyLines = 10
+	// DiscourseDefaultRetryAfter - seconds to wait when rate limited response has no Retry-After header
+	DiscourseDefaultRetryAfter = 60
+	// DiscoursePostRegular - regular post type, other types are moderator actions, small actions (like "closed the topic") and whispers
+	DiscoursePostRegular = 1
+)
+
+var (
+	// DiscourseRawMapping - Discourse raw index mapping
+	DiscourseRawMapping = []byte(`{"dynamic":true,"properties":{"metadata__updated_on":{"type":"date"},"data":{"dynamic":false,"properties":{}}}}`)
+	// DiscourseRichMapping - Discourse rich index mapping
+	DiscourseRichMapping = []byte(`{"properties":{"metadata__updated_on":{"type":"date"},"Subject_analyzed":{"type":"text","fielddata":true,"index":true},"body":{"type":"text","index":true}}}`)
+	// DiscourseCategories - categories defined for Discourse
+	DiscourseCategories = map[string]struct{}{DiscourseTopic: {}}
+	// DiscourseDefaultSearchField - default search field
+	DiscourseDefaultSearchField = "item_id"
+	// DiscourseRoles - roles to fetch affiliation data for discourse topics and posts
+	DiscourseRoles = []string{Author}
+	// DiscourseHTMLTagRE - HTML tag in cooked post
+	DiscourseHTMLTagRE = regexp.MustCompile(`<[^>]*>`)
+)
+
+// DSDiscourse - DS implementation for discourse
+type DSDiscourse struct {
+	DS              string
+	URL             string // From DA_DISCOURSE_URL - forum URL
+	Category        string // From DA_DISCOURSE_CATEGORY - optional category slug or id, only its topics (including subcategories) are fetched then
+	APIUsername     string // From DA_DISCOURSE_API_USERNAME - optional, API key user
+	APIKey          string // From DA_DISCOURSE_API_KEY - optional, needed for private categories and emails
+	Emails          bool   // From DA_DISCOURSE_EMAILS - resolve authors' emails, requires admin or moderator API key
+	NoSSLVerify     bool   // From DA_DISCOURSE_NO_SSL_VERIFY
+	SingleOrigin    bool   // From DA_DISCOURSE_SINGLE_ORIGIN - if you want to store only one discourse endpoint in the index
+	CategoryID      int
+	CategorySlug    string
+	ForumCategories map[int]map[string]interface{} // forum categories by id
+	UserEmails      map[string]string              // emails cache by username
+}
+
+// ParseArgs - parse discourse specific environment variables
+func (j *DSDiscourse) ParseArgs(ctx *Ctx) (err error) {
+	j.DS = Discourse
+	prefix := "DA_DISCOURSE_"
+	j.URL = os.Getenv(prefix + "URL")
+	j.Category = os.Getenv(prefix + "CATEGORY")
+	j.APIUsername = os.Getenv(prefix + "API_USERNAME")
+	j.APIKey = os.Getenv(prefix + "API_KEY")
+	AddRedacted(j.APIKey, false)
+	j.Emails = StringToBool(os.Getenv(prefix + "EMAILS"))
+	j.NoSSLVerify = StringToBool(os.Getenv(prefix + "NO_SSL_VERIFY"))
+	if j.NoSSLVerify {
+		NoSSLVerify()
+	}
+	j.SingleOrigin = StringToBool(os.Getenv(prefix + "SINGLE_ORIGIN"))
+	return
+}
+
+// Validate - is current DS configuration OK?
+func (j *DSDiscourse) Validate(ctx *Ctx) (err error) {
+	j.URL = strings.TrimSpace(j.URL)
+	if strings.HasSuffix(j.URL, "/") {
+		j.URL = j.URL[:len(j.URL)-1]
+	}
+	if j.URL == "" {
+		err = fmt.Errorf("URL must be set")
+		return
+	}
+	j.Category = strings.TrimSpace(j.Category)
+	if j.Emails && j.APIKey == "" {
+		err = fmt.Errorf("emails can only be resolved with admin or moderator API key")
+		return
+	}
+	j.UserEmails = make(map[string]string)
+	return
+}
+
+// Name - return data source name
+func (j *DSDiscourse) Name() string {
+	return j.DS
+}
+
+// Info - return DS configuration in a human readable form
+func (j DSDiscourse) Info() string {
+	return fmt.Sprintf("%+v", j)
+}
+
+// CustomFetchRaw - is this datasource using custom fetch raw implementation?
+func (j *DSDiscourse) CustomFetchRaw() bool {
+	return false
+}
+
+// FetchRaw - implement fetch raw data for discourse datasource
+func (j *DSDiscourse) FetchRaw(ctx *Ctx) (err error) {
+	Printf("%s should use generic FetchRaw()\n", j.DS)
+	return
+}
+
+// CustomEnrich - is this datasource using custom enrich implementation?
+func (j *DSDiscourse) CustomEnrich() bool {
+	return false
+}
+
+// Enrich - implement enrich data for discourse datasource
+func (j *DSDiscourse) Enrich(ctx *Ctx) (err error) {
+	Printf("%s should use generic Enrich()\n", j.DS)
+	return
+}
+
+// CalculateTimeToReset - calculate time to reset rate limits based on rate limit value and rate limit reset value
+func (j *DSDiscourse) CalculateTimeToReset(ctx *Ctx, rateLimit, rateLimitReset int) (seconds int) {
+	seconds = rateLimitReset
+	return
+}
+
+// discourseGet - GET discourse API path and return decoded JSON object, waits as requested when rate limited
+// status is returned for 403 and 404 (private or deleted resources), data is nil then
+func (j *DSDiscourse) discourseGet(ctx *Ctx, path string) (data map[string]interface{}, status int, err error) {
+	url := j.URL + path
+	headers := map[string]string{"Accept": "application/json"}
+	if j.APIKey != "" {
+		headers["Api-Key"] = j.APIKey
+		headers["Api-Username"] = j.APIUsername
+	}
+	var (
+		res        interface{}
+		outHeaders map[string][]string
+	)
+	sleeps := 0
+	for {
+		if ctx.Debug > 1 {
+			Printf("discourse url: %s\n", url)
+		}
+		res, status, _, outHeaders, err = Request(
+			ctx,
+			url,
+			Get,
+			headers,
+			nil,
+			nil,
+			map[[2]int]struct{}{{200, 200}: {}, {429, 429}: {}}, // JSON statuses: 200, 429
+			nil, // Error statuses
+			map[[2]int]struct{}{{200, 200}: {}, {403, 404}: {}, {429, 429}: {}}, // OK statuses: 200, 403, 404, 429
+			nil,   // Cache statuses
+			true,  // retry
+			nil,   // cache duration
+			false, // skip in dry-run mode
+		)
+		// Too many requests
+		if status == 429 {
+			seconds := DiscourseRetryAfter(outHeaders, res)
+			Printf("rate limited, sleeping for %d seconds\n", seconds)
+			time.Sleep(time.Duration(seconds) * time.Second)
+			sleeps++
+			continue
+		}
+		if err != nil {
+			return
+		}
+		if sleeps > 0 {
+			Printf("recovered after %d sleeps\n", sleeps)
+		}
+		break
+	}
+	if status != 200 {
+		return
+	}
+	data, ok := res.(map[string]interface{})
+	if !ok {
+		err = fmt.Errorf("cannot parse JSON from (status: %d):\n%s", status, string(res.([]byte)))
+	}
+	return
+}
+
+// DiscourseRetryAfter - return seconds to wait from rate limited response: Retry-After header or "extras.wait_seconds"
+func DiscourseRetryAfter(headers map[string][]string, res interface{}) (seconds int) {
+	seconds = DiscourseDefaultRetryAfter
+	for k, v := range headers {
+		if strings.ToLower(k) != "retry-after" || len(v) == 0 {
+			continue
+		}
+		after, err := strconv.Atoi(strings.TrimSpace(v[0]))
+		if err == nil && after >= 0 {
+			return after + 1
+		}
+	}
+	wait, ok := Dig(res, []string{"extras", "wait_seconds"}, false, true)
+	if ok {
+		fWait, ok := wait.(float64)
+		if ok && fWait >= 0 {
+			seconds = int(fWait) + 1
+		}
+	}
+	return
+}
+
+// GetDiscourseCategories - get all forum categories (including subcategories) and resolve configured category
+func (j *DSDiscourse) GetDiscourseCategories(ctx *Ctx) (err error) {
+	data, status, err := j.discourseGet(ctx, "/site.json")
+	if err != nil {
+		return
+	}
+	if status != 200 {
+		err = fmt.Errorf("cannot get %s categories, status %d", j.URL, status)
+		return
+	}
+	j.ForumCategories = make(map[int]map[string]interface{})
+	categories, _ := data["categories"].([]interface{})
+	for _, iCategory := range categories {
+		category, ok := iCategory.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		fID, ok := category["id"].(float64)
+		if !ok {
+			continue
+		}
+		info := map[string]interface{}{"id": int(fID)}
+		for _, field := range []string{"name", "slug", "parent_category_id", "read_restricted"} {
+			info[field], _ = category[field]
+		}
+		j.ForumCategories[int(fID)] = info
+	}
+	if j.Category == "" {
+		return
+	}
+	id, e := strconv.Atoi(j.Category)
+	for cid, category := range j.ForumCategories {
+		if (e == nil && cid == id) || category["slug"] == j.Category {
+			j.CategoryID = cid
+			j.CategorySlug, _ = category["slug"].(string)
+			return
+		}
+	}
+	err = fmt.Errorf("category %s not found in %s", j.Category, j.URL)
+	return
+}
+
+// DiscourseCategoryInfo - return topic's category info: id, name, slug and parent category name
+func (j *DSDiscourse) DiscourseCategoryInfo(categoryID int) (info map[string]interface{}) {
+	category, ok := j.ForumCategories[categoryID]
+	if !ok {
+		return map[string]interface{}{"id": categoryID}
+	}
+	info = map[string]interface{}{"id": categoryID, "name": category["name"], "slug": category["slug"]}
+	fParentID, ok := category["parent_category_id"].(float64)
+	if ok {
+		parent, ok := j.ForumCategories[int(fParentID)]
+		if ok {
+			info["parent_id"] = int(fParentID)
+			info["parent_name"] = parent["name"]
+		}
+	}
+	return
+}
+
+// DiscourseTopicUpdatedOn - topic's last activity date: bumped_at, falls back to last_posted_at and created_at
+func DiscourseTopicUpdatedOn(topic map[string]interface{}) (updated time.Time, err error) {
+	for _, field := range []string{"bumped_at", "last_posted_at", "created_at"} {
+		sDate, _ := topic[field].(string)
+		if sDate != "" {
+			return TimeParseAny(sDate)
+		}
+	}
+	err = fmt.Errorf("topic has no dates: %+v", DumpKeys(topic))
+	return
+}
+
+// GetDiscourseTopic - get full topic with all its posts
+func (j *DSDiscourse) GetDiscourseTopic(ctx *Ctx, topicID int) (topic map[string]interface{}, err error) {
+	topic, status, err := j.discourseGet(ctx, fmt.Sprintf("/t/%d.json", topicID))
+	if err != nil || status != 200 {
+		if status != 200 {
+			Printf("%s: topic %d not available, status %d\n", j.URL, topicID, status)
+		}
+		return
+	}
+	postStream, ok := topic["post_stream"].(map[string]interface{})
+	if !ok {
+		err = fmt.Errorf("topic %d has no post stream", topicID)
+		return
+	}
+	posts, _ := postStream["posts"].([]interface{})
+	have := make(map[int]struct{})
+	for _, iPost := range posts {
+		fID, _ := Dig(iPost, []string{"id"}, false, true)
+		id, _ := fID.(float64)
+		have[int(id)] = struct{}{}
+	}
+	stream, _ := postStream["stream"].([]interface{})
+	missing := []int{}
+	for _, iID := range stream {
+		id, _ := iID.(float64)
+		_, ok := have[int(id)]
+		if !ok {
+			missing = append(missing, int(id))
+		}
+	}
+	missingPosts := 0
+	for from := 0; from < len(missing); from += DiscoursePostsChunk {
+		to := from + DiscoursePostsChunk
+		if to > len(missing) {
+			to = len(missing)
+		}
+		args := neturl.Values{}
+		for _, id := range missing[from:to] {
+			args.Add("post_ids[]", strconv.Itoa(id))
+		}
+		var data map[string]interface{}
+		data, status, err = j.discourseGet(ctx, fmt.Sprintf("/t/%d/posts.json?%s", topicID, args.Encode()))
+		if err != nil {
+			return
+		}
+		if status != 200 {
+			Printf("%s: topic %d: %d posts not available, status %d, topic will be marked incomplete\n", j.URL, topicID, to-from, status)
+			missingPosts += to - from
+			continue
+		}
+		chunk, _ := Dig(data, []string{"post_stream", "posts"}, false, true)
+		aChunk, _ := chunk.([]interface{})
+		posts = append(posts, aChunk...)
+	}
+	sort.SliceStable(posts, func(a, b int) bool {
+		na, _ := Dig(posts[a], []string{"post_number"}, false, true)
+		nb, _ := Dig(posts[b], []string{"post_number"}, false, true)
+		fa, _ := na.(float64)
+		fb, _ := nb.(float64)
+		return fa < fb
+	})
+	postStream["posts"] = posts
+	delete(postStream, "stream")
+	if missingPosts > 0 {
+		topic["missing_posts"] = float64(missingPosts)
+	}
+	if j.Emails {
+		for _, iPost := range posts {
+			post, ok := iPost.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			username, _ := post["username"].(string)
+			if username == "" {
+				continue
+			}
+			var email string
+			email, err = j.GetDiscourseUserEmail(ctx, username)
+			if err != nil {
+				return
+			}
+			if email != "" {
+				post["user_email"] = email
+			}
+		}
+	}
+	return
+}
+
+// GetDiscourseUserEmail - get user's primary email (cached), empty when not available
+func (j *DSDiscourse) GetDiscourseUserEmail(ctx *Ctx, username string) (email string, err error) {
+	email, ok := j.UserEmails[username]
+	if ok {
+		return
+	}
+	data, status, err := j.discourseGet(ctx, "/u/"+neturl.PathEscape(username)+"/emails.json")
+	if err != nil {
+		return
+	}
+	if status != 200 {
+		if ctx.Debug > 0 {
+			Printf("%s: cannot get %s email, status %d\n", j.URL, username, status)
+		}
+	} else {
+		email, _ = data["email"].(string)
+	}
+	j.UserEmails[username] = email
+	return
+}
+
+// FetchItems - implement fetch items for discourse datasource
+// Topics are listed by last activity (newest first) until the first not pinned topic without activity since date from,
+// each topic is fetched with all its posts, so a topic is a single raw document
+func (j *DSDiscourse) FetchItems(ctx *Ctx) (err error) {
+	var dateFrom time.Time
+	if ctx.DateFrom != nil {
+		dateFrom = *ctx.DateFrom
+	} else {
+		dateFrom = DefaultDateFrom
+	}
+	err = j.GetDiscourseCategories(ctx)
+	if err != nil {
+		return
+	}
+	path := "/latest.json"
+	if j.CategoryID > 0 {
+		path = fmt.Sprintf("/c/%s/%d/l/latest.json", j.CategorySlug, j.CategoryID)
+	}
+	var allTopics []interface{}
+	seen := make(map[int]struct{})
+	nTopics := 0
+	for page := 0; ; page++ {
+		var (
+			data   map[string]interface{}
+			status int
+		)
+		data, status, err = j.discourseGet(ctx, fmt.Sprintf("%s?order=activity&ascending=false&page=%d", path, page))
+		if err != nil {
+			return
+		}
+		if status != 200 {
+			err = fmt.Errorf("cannot list %s topics, status %d", j.URL+path, status)
+			return
+		}
+		topics, _ := Dig(data, []string{"topic_list", "topics"}, false, true)
+		aTopics, _ := topics.([]interface{})
+		done := len(aTopics) == 0
+		for _, iTopic := range aTopics {
+			listed, ok := iTopic.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			var updated time.Time
+			updated, err = DiscourseTopicUpdatedOn(listed)
+			if err != nil {
+				return
+			}
+			if updated.Before(dateFrom) {
+				pinned, _ := listed["pinned"].(bool)
+				pinnedGlobally, _ := listed["pinned_globally"].(bool)
+				if !pinned && !pinnedGlobally {
+					done = true
+					break
+				}
+				continue
+			}
+			fID, _ := listed["id"].(float64)
+			id := int(fID)
+			_, ok = seen[id]
+			if ok {
+				continue
+			}
+			seen[id] = struct{}{}
+			var topic map[string]interface{}
+			topic, err = j.GetDiscourseTopic(ctx, id)
+			if err != nil {
+				return
+			}
+			if topic == nil {
+				continue
+			}
+			for _, field := range []string{"bumped_at", "last_posted_at", "has_accepted_answer"} {
+				_, ok := topic[field]
+				if !ok {
+					topic[field], _ = listed[field]
+				}
+			}
+			fCategoryID, _ := topic["category_id"].(float64)
+			topic["category_info"] = j.DiscourseCategoryInfo(int(fCategoryID))
+			esItem := j.AddMetadata(ctx, topic)
+			if ctx.Project != "" {
+				topic["project"] = ctx.Project
+			}
+			esItem["data"] = topic
+			allTopics = append(allTopics, esItem)
+			nTopics++
+			if len(allTopics) >= ctx.ESBulkSize {
+				err = SendToElastic(ctx, j, true, UUID, allTopics)
+				if err != nil {
+					Printf("error %v sending %d topics to ElasticSearch\n", err, len(allTopics))
+					return
+				}
+				allTopics = []interface{}{}
+			}
+		}
+		more, _ := Dig(data, []string{"topic_list", "more_topics_url"}, false, true)
+		if done || more == nil {
+			break
+		}
+	}
+	if ctx.Debug > 0 {
+		Printf("%d topics fetched, %d remaining topics to send to ES\n", nTopics, len(allTopics))
+	}
+	if len(allTopics) > 0 {
+		err = SendToElastic(ctx, j, true, UUID, allTopics)
+		if err != nil {
+			Printf("Error %v sending %d topics to ES\n", err, len(allTopics))
+		}
+	}
+	return
+}
+
+// SupportDateFrom - does DS support resuming from date?
+func (j *DSDiscourse) SupportDateFrom() bool {
+	return true
+}
+
+// SupportOffsetFrom - does DS support resuming from offset?
+func (j *DSDiscourse) SupportOffsetFrom() bool {
+	return false
+}
+
+// DateField - return date field used to detect where to restart from
+func (j *DSDiscourse) DateField(*Ctx) string {
+	return DefaultDateField
+}
+
+// RichIDField - return rich ID field name
+func (j *DSDiscourse) RichIDField(*Ctx) string {
+	return UUID
+}
+
+// RichAuthorField - return rich author field name
+func (j *DSDiscourse) RichAuthorField(*Ctx) string {
+	return DefaultAuthorField
+}
+
+// OffsetField - return offset field used to detect where to restart from
+func (j *DSDiscourse) OffsetField(*Ctx) string {
+	return DefaultOffsetField
+}
+
+// OriginField - return origin field used to detect where to restart from
+func (j *DSDiscourse) OriginField(ctx *Ctx) string {
+	if ctx.Tag != "" {
+		return DefaultTagField
+	}
+	return DefaultOriginField
+}
+
+// Categories - return a set of configured categories
+func (j *DSDiscourse) Categories() map[string]struct{} {
+	return DiscourseCategories
+}
+
+// ResumeNeedsOrigin - is origin field needed when resuming
+// Origin should be needed when multiple configurations save to the same index
+func (j *DSDiscourse) ResumeNeedsOrigin(ctx *Ctx, raw bool) bool {
+	return !j.SingleOrigin
+}
+
+// ResumeNeedsCategory - is category field needed when resuming
+// Category should be needed when multiple types of categories save to the same index
+// or there are multiple types of documents within the same category
+func (j *DSDiscourse) ResumeNeedsCategory(ctx *Ctx, raw bool) bool {
+	return false
+}
+
+// Origin - return current origin
+func (j *DSDiscourse) Origin(ctx *Ctx) string {
+	if j.Category != "" {
+		return j.URL + "/c/" + j.Category
+	}
+	return j.URL
+}
+
+// ItemID - return unique identifier for an item
+func (j *DSDiscourse) ItemID(item interface{}) string {
+	id, _ := Dig(item, []string{"id"}, true, false)
+	return strconv.FormatInt(int64(id.(float64)), 10)
+}
+
+// AddMetadata - add metadata to the item
+func (j *DSDiscourse) AddMetadata(ctx *Ctx, item interface{}) (mItem map[string]interface{}) {
+	mItem = make(map[string]interface{})
+	origin := j.Origin(ctx)
+	tag := ctx.Tag
+	if tag == "" {
+		tag = origin
+	}
+	itemID := j.ItemID(item)
+	updatedOn := j.ItemUpdatedOn(item)
+	uuid := UUIDNonEmpty(ctx, origin, itemID)
+	timestamp := time.Now()
+	mItem["backend_name"] = j.DS
+	mItem["backend_version"] = DiscourseBackendVersion
+	mItem["timestamp"] = fmt.Sprintf("%.06f", float64(timestamp.UnixNano())/1.0e9)
+	mItem[UUID] = uuid
+	mItem[DefaultOriginField] = origin
+	mItem[DefaultTagField] = tag
+	mItem[DefaultOffsetField] = float64(updatedOn.Unix())
+	mItem["category"] = j.ItemCategory(item)
+	mItem["search_fields"] = make(map[string]interface{})
+	categoryID, _ := Dig(item, []string{"category_id"}, false, true)
+	FatalOnError(DeepSet(mItem, []string{"search_fields", DiscourseDefaultSearchField}, itemID, false))
+	FatalOnError(DeepSet(mItem, []string{"search_fields", "topic_id"}, itemID, false))
+	FatalOnError(DeepSet(mItem, []string{"search_fields", "category_id"}, categoryID, false))
+	mItem[DefaultDateField] = ToESDate(updatedOn)
+	mItem[DefaultTimestampField] = ToESDate(timestamp)
+	mItem[ProjectSlug] = ctx.ProjectSlug
+	return
+}
+
+// ItemUpdatedOn - return updated on date for an item
+func (j *DSDiscourse) ItemUpdatedOn(item interface{}) time.Time {
+	topic, _ := item.(map[string]interface{})
+	updated, err := DiscourseTopicUpdatedOn(topic)
+	FatalOnError(err)
+	return updated
+}
+
+// ItemCategory - return unique identifier for an item
+func (j *DSDiscourse) ItemCategory(item interface{}) string {
+	return DiscourseTopic
+}
+
+// ElasticRawMapping - Raw index mapping definition
+func (j *DSDiscourse) ElasticRawMapping() []byte {
+	return DiscourseRawMapping
+}
+
+// ElasticRichMapping - Rich index mapping definition
+func (j *DSDiscourse) ElasticRichMapping() []byte {
+	return DiscourseRichMapping
+}
+
+// DiscourseTopicPosts - return topic's posts (ordered by post number)
+func DiscourseTopicPosts(topic map[string]interface{}) (posts []map[string]interface{}) {
+	iPosts, _ := Dig(topic, []string{"post_stream", "posts"}, false, true)
+	aPosts, _ := iPosts.([]interface{})
+	for _, iPost := range aPosts {
+		post, ok := iPost.(map[string]interface{})
+		if ok {
+			posts = append(posts, post)
+		}
+	}
+	return
+}
+
+// DiscoursePostType - return post type, DiscoursePostRegular when not set
+func DiscoursePostType(post map[string]interface{}) int {
+	postType, ok := post["post_type"].(float64)
+	if !ok {
+		return DiscoursePostRegular
+	}
+	return int(postType)
+}
+
+// DiscourseFirstReply - return first regular reply to the topic posted by someone else than topic's author
+func DiscourseFirstReply(posts []map[string]interface{}) map[string]interface{} {
+	if len(posts) == 0 {
+		return nil
+	}
+	author, _ := posts[0]["username"].(string)
+	for _, post := range posts[1:] {
+		if DiscoursePostType(post) != DiscoursePostRegular {
+			continue
+		}
+		username, _ := post["username"].(string)
+		if username != author {
+			return post
+		}
+	}
+	return nil
+}
+
+// DiscourseAcceptedAnswer - return post accepted as the answer (solved plugin), nil when there is none
+func DiscourseAcceptedAnswer(topic map[string]interface{}, posts []map[string]interface{}) map[string]interface{} {
+	number, _ := Dig(topic, []string{"accepted_answer", "post_number"}, false, true)
+	for _, post := range posts {
+		accepted, _ := post["accepted_answer"].(bool)
+		if accepted || (number != nil && post["post_number"] == number) {
+			return post
+		}
+	}
+	return nil
+}
+
+// DiscourseLikes - return number of post's likes
+func DiscourseLikes(post map[string]interface{}) int {
+	likes, ok := post["like_count"].(float64)
+	if ok {
+		return int(likes)
+	}
+	actions, _ := post["actions_summary"].([]interface{})
+	for _, iAction := range actions {
+		action, _ := iAction.(map[string]interface{})
+		id, _ := action["id"].(float64)
+		// 2 is a like action
+		if int(id) == 2 {
+			count, _ := action["count"].(float64)
+			return int(count)
+		}
+	}
+	return 0
+}
+
+// DiscourseTags - return topic's tag names (tags are strings or objects depending on discourse version)
+func DiscourseTags(topic map[string]interface{}) (tags []interface{}) {
+	tags = []interface{}{}
+	iTags, _ := topic["tags"].([]interface{})
+	for _, iTag := range iTags {
+		switch tag := iTag.(type) {
+		case string:
+			tags = append(tags, tag)
+		case map[string]interface{}:
+			name, ok := tag["name"].(string)
+			if ok {
+				tags = append(tags, name)
+			}
+		}
+	}
+	return
+}
+
+// DiscoursePlainText - return post's plain text from its cooked HTML
+func DiscoursePlainText(cooked string) string {
+	return strings.TrimSpace(html.UnescapeString(DiscourseHTMLTagRE.ReplaceAllString(cooked, "")))
+}
+
+// SetBodyFields - set size and body_extract (as groupsio messages have them) from post's cooked HTML
+func (j *DSDiscourse) SetBodyFields(rich, post map[string]interface{}) {
+	rich["size"] = nil
+	rich["body_extract"] = ""
+	cooked, ok := post["cooked"].(string)
+	if !ok {
+		return
+	}
+	text := DiscoursePlainText(cooked)
+	rich["size"] = len(text)
+	ary := strings.Split(text, "\n")
+	if len(ary) > DiscourseMaxRichBodyLines {
+		ary = ary[:DiscourseMaxRichBodyLines]
+	}
+	text = strings.Join(ary, "\n")
+	if len(text) > DiscourseMaxBodyLength {
+		text = text[:DiscourseMaxBodyLength]
+	}
+	rich["body_extract"] = text
+}
+
+// GetItemIdentities return list of item's identities, each one is [3]string
+// (name, username, email) tripples, special value Nil "none" means null
+// we use string and not *string which allows nil to allow usage as a map key
+// topic contains all its posts, so identities of all posts' authors are returned
+func (j *DSDiscourse) GetItemIdentities(ctx *Ctx, doc interface{}) (identities map[[3]string]struct{}, err error) {
+	if ctx.Debug > 2 {
+		defer func() {
+			Printf("GetItemIdentities: %+v -> %+v\n", DumpPreview(doc, 100), identities)
+		}()
+	}
+	topic, ok := Dig(doc, []string{"data"}, false, true)
+	if !ok {
+		return
+	}
+	topicMap, _ := topic.(map[string]interface{})
+	for _, post := range DiscourseTopicPosts(topicMap) {
+		identity := DiscoursePostIdentity(post)
+		if identity == nil {
+			continue
+		}
+		if identities == nil {
+			identities = make(map[[3]string]struct{})
+		}
+		identities[*identity] = struct{}{}
+	}
+	return
+}
+
+// DiscoursePostIdentity - return post's author identity (name, username, email), nil for system/deleted users
+func DiscoursePostIdentity(post map[string]interface{}) *[3]string {
+	identity := [3]string{Nil, Nil, Nil}
+	for i, field := range []string{"name", "username", "user_email"} {
+		value, _ := post[field].(string)
+		if value != "" {
+			identity[i] = value
+		}
+	}
+	if identity[1] == Nil || identity[1] == "system" {
+		return nil
+	}
+	return &identity
+}
+
+// DiscourseEnrichItemsFunc - iterate items and enrich them
+// items is a current pack of input items
+// docs is a pointer to where extracted identities will be stored
+func DiscourseEnrichItemsFunc(ctx *Ctx, ds DS, thrN int, items []interface{}, docs *[]interface{}) (err error) {
+	if ctx.Debug > 0 {
+		Printf("discourse enrich items %d/%d func\n", len(items), len(*docs))
+	}
+	var (
+		mtx *sync.RWMutex
+		ch  chan error
+	)
+	if thrN > 1 {
+		mtx = &sync.RWMutex{}
+		ch = make(chan error)
+	}
+	dbConfigured := ctx.AffsDBConfigured()
+	nThreads := 0
+	procItem := func(c chan error, idx int) (e error) {
+		if thrN > 1 {
+			mtx.RLock()
+		}
+		item := items[idx]
+		if thrN > 1 {
+			mtx.RUnlock()
+		}
+		defer func() {
+			if c != nil {
+				c <- e
+			}
+		}()
+		src, ok := item.(map[string]interface{})["_source"]
+		if !ok {
+			e = fmt.Errorf("Missing _source in item %+v", DumpKeys(item))
+			return
+		}
+		doc, ok := src.(map[string]interface{})
+		if !ok {
+			e = fmt.Errorf("Failed to parse document %+v", doc)
+			return
+		}
+		var rich map[string]interface{}
+		rich, e = ds.EnrichItem(ctx, doc, "", dbConfigured, nil)
+		if e != nil {
+			return
+		}
+		e = EnrichItem(ctx, ds, rich)
+		if e != nil {
+			return
+		}
+		richItems := []interface{}{rich}
+		var posts []interface{}
+		posts, e = ds.(*DSDiscourse).EnrichPosts(ctx, doc, rich, dbConfigured)
+		if e != nil {
+			return
+		}
+		for _, post := range posts {
+			e = EnrichItem(ctx, ds, post.(map[string]interface{}))
+			if e != nil {
+				return
+			}
+			richItems = append(richItems, post)
+		}
+		if thrN > 1 {
+			mtx.Lock()
+		}
+		*docs = append(*docs, richItems...)
+		if thrN > 1 {
+			mtx.Unlock()
+		}
+		return
+	}
+	if thrN > 1 {
+		for i := range items {
+			go func(i int) {
+				_ = procItem(ch, i)
+			}(i)
+			nThreads++
+			if nThreads == thrN {
+				err = <-ch
+				if err != nil {
+					return
+				}
+				nThreads--
+			}
+		}
+		for nThreads > 0 {
+			err = <-ch
+			nThreads--
+			if err != nil {
+				return
+			}
+		}
+		return
+	}
+	for i := range items {
+		err = procItem(nil, i)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// EnrichItems - perform the enrichment
+func (j *DSDiscourse) EnrichItems(ctx *Ctx) (err error) {
+	Printf("enriching items\n")
+	err = ForEachESItem(ctx, j, true, ESBulkUploadFunc, DiscourseEnrichItemsFunc, nil, true)
+	return
+}
+
+// setAffsFields - set author affiliation fields for a post (topic uses its first post)
+func (j *DSDiscourse) setAffsFields(ctx *Ctx, rich, post map[string]interface{}, date interface{}) (err error) {
+	affsItems, err := j.AffsItems(ctx, map[string]interface{}{"data": post}, DiscourseRoles, date)
+	if err != nil {
+		return
+	}
+	for prop, value := range affsItems {
+		rich[prop] = value
+	}
+	orgsKey := Author + MultiOrgNames
+	_, ok := Dig(rich, []string{orgsKey}, false, true)
+	if !ok {
+		rich[orgsKey] = []interface{}{}
+	}
+	return
+}
+
+// EnrichItem - return rich topic item from raw item
+func (j *DSDiscourse) EnrichItem(ctx *Ctx, item map[string]interface{}, author string, affs bool, extra interface{}) (rich map[string]interface{}, err error) {
+	rich = make(map[string]interface{})
+	for _, field := range RawFields {
+		v, _ := item[field]
+		rich[field] = v
+	}
+	topic, ok := item["data"].(map[string]interface{})
+	if !ok {
+		err = fmt.Errorf("missing data field in item %+v", DumpKeys(item))
+		return
+	}
+	posts := DiscourseTopicPosts(topic)
+	rich["type"] = DiscourseTopic
+	rich["id"], _ = topic["id"]
+	rich["topic_id"], _ = topic["id"]
+	title, _ := topic["title"].(string)
+	rich["Subject_analyzed"] = title
+	if len(title) > KeywordMaxlength {
+		title = title[:KeywordMaxlength]
+	}
+	rich["Subject"] = title
+	rich["slug"], _ = topic["slug"]
+	rich["url"] = fmt.Sprintf("%s/t/%v/%s", j.URL, j.ItemID(topic), rich["slug"])
+	rich["list"], _ = item[DefaultOriginField]
+	rich["root"] = true
+	for _, field := range []string{"id", "name", "slug", "parent_name"} {
+		rich["category_"+field], _ = Dig(topic, []string{"category_info", field}, false, true)
+	}
+	rich["parent_category_name"] = rich["category_parent_name"]
+	delete(rich, "category_parent_name")
+	rich["tags"] = DiscourseTags(topic)
+	createdAt, _ := topic["created_at"]
+	rich["Date"] = createdAt
+	rich["bumped_at"], _ = topic["bumped_at"]
+	rich["last_posted_at"], _ = topic["last_posted_at"]
+	for _, field := range []string{"views", "like_count", "reply_count", "posts_count", "participant_count", "word_count"} {
+		rich[field], _ = topic[field]
+	}
+	closed, _ := topic["closed"].(bool)
+	archived, _ := topic["archived"].(bool)
+	pinnedGlobally, _ := topic["pinned_globally"].(bool)
+	rich["is_closed"] = 0
+	if closed {
+		rich["is_closed"] = 1
+	}
+	rich["is_archived"] = 0
+	if archived {
+		rich["is_archived"] = 1
+	}
+	rich["is_pinned"] = 0
+	if pinnedGlobally || topic["pinned_at"] != nil {
+		rich["is_pinned"] = 1
+	}
+	// posts that could not be fetched are not in the topic, so its counts and reply metrics are incomplete
+	missingPosts, _ := topic["missing_posts"].(float64)
+	rich["missing_posts"] = int(missingPosts)
+	rich["is_incomplete"] = 0
+	if missingPosts > 0 {
+		rich["is_incomplete"] = 1
+	}
+	created, e := TimeParseInterfaceString(createdAt)
+	rich["first_reply_date"] = nil
+	rich["time_to_first_reply_days"] = nil
+	firstReply := DiscourseFirstReply(posts)
+	if firstReply != nil {
+		rich["first_reply_date"], _ = firstReply["created_at"]
+		replied, e2 := TimeParseInterfaceString(firstReply["created_at"])
+		if e == nil && e2 == nil {
+			rich["time_to_first_reply_days"] = float64(replied.Sub(created).Seconds()) / 86400.0
+		}
+	}
+	rich["has_accepted_answer"] = 0
+	rich["accepted_answer_post_number"] = nil
+	rich["accepted_answer_username"] = nil
+	rich["time_to_accepted_answer_days"] = nil
+	answer := DiscourseAcceptedAnswer(topic, posts)
+	if answer != nil {
+		rich["has_accepted_answer"] = 1
+		rich["accepted_answer_post_number"], _ = answer["post_number"]
+		rich["accepted_answer_username"], _ = answer["username"]
+		answered, e2 := TimeParseInterfaceString(answer["created_at"])
+		if e == nil && e2 == nil {
+			rich["time_to_accepted_answer_days"] = float64(answered.Sub(created).Seconds()) / 86400.0
+		}
+	}
+	rich["user_name"] = nil
+	rich["user_username"] = nil
+	rich["size"] = nil
+	rich["body_extract"] = ""
+	if len(posts) > 0 {
+		first := posts[0]
+		rich["user_name"], _ = first["name"]
+		rich["user_username"], _ = first["username"]
+		j.SetBodyFields(rich, first)
+		if affs {
+			err = j.setAffsFields(ctx, rich, first, createdAt)
+			if err != nil {
+				return
+			}
+		}
+	}
+	for prop, value := range CommonFields(j, createdAt, DiscourseTopic) {
+		rich[prop] = value
+	}
+	return
+}
+
+// EnrichPosts - return rich post documents for all topic's regular posts (including the first one)
+func (j *DSDiscourse) EnrichPosts(ctx *Ctx, item, richTopic map[string]interface{}, affs bool) (richItems []interface{}, err error) {
+	topic, ok := item["data"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	topicID := j.ItemID(topic)
+	answer := DiscourseAcceptedAnswer(topic, DiscourseTopicPosts(topic))
+	copyFields := []string{"topic_id", "Subject", "Subject_analyzed", "slug", "list", "category_id", "category_name", "category_slug", "parent_category_name", "tags"}
+	for _, post := range DiscourseTopicPosts(topic) {
+		if DiscoursePostType(post) != DiscoursePostRegular {
+			continue
+		}
+		rich := make(map[string]interface{})
+		for _, field := range RawFields {
+			rich[field], _ = richTopic[field]
+		}
+		for _, field := range copyFields {
+			rich[field], _ = richTopic[field]
+		}
+		postID := j.ItemID(post)
+		rich[UUID] = UUIDNonEmpty(ctx, j.Origin(ctx), topicID, DiscoursePost, postID)
+		rich["type"] = DiscoursePost
+		rich["id"], _ = post["id"]
+		rich["post_id"], _ = post["id"]
+		number, _ := post["post_number"].(float64)
+		rich["post_number"] = int(number)
+		rich["root"] = number == 1
+		rich["reply_to_post_number"], _ = post["reply_to_post_number"]
+		rich["url"] = fmt.Sprintf("%s/%d", richTopic["url"], int(number))
+		createdAt, _ := post["created_at"]
+		rich["Date"] = createdAt
+		rich["updated_at"], _ = post["updated_at"]
+		rich["likes"] = DiscourseLikes(post)
+		for _, field := range []string{"reads", "reply_count", "quote_count", "score", "trust_level"} {
+			rich[field], _ = post[field]
+		}
+		rich["is_accepted_answer"] = 0
+		if answer != nil && answer["id"] == post["id"] {
+			rich["is_accepted_answer"] = 1
+		}
+		rich["user_name"], _ = post["name"]
+		rich["user_username"], _ = post["username"]
+		j.SetBodyFields(rich, post)
+		if affs {
+			err = j.setAffsFields(ctx, rich, post, createdAt)
+			if err != nil {
+				return
+			}
+		}
+		for prop, value := range CommonFields(j, createdAt, DiscoursePost) {
+			rich[prop] = value
+		}
+		richItems = append(richItems, rich)
+	}
+	return
+}
+
+// AffsItems - return affiliations data items for given roles and date
+func (j *DSDiscourse) AffsItems(ctx *Ctx, post map[string]interface{}, roles []string, date interface{}) (affsItems map[string]interface{}, err error) {
+	affsItems = make(map[string]interface{})
+	var dt time.Time
+	dt, err = TimeParseInterfaceString(date)
+	if err != nil {
+		return
+	}
+	for _, role := range roles {
+		identity := j.GetRoleIdentity(ctx, post, role)
+		if len(identity) == 0 {
+			continue
+		}
+		affsIdentity, empty, e := IdentityAffsData(ctx, j, identity, nil, dt, role)
+		if e != nil {
+			Printf("AffsItems/IdentityAffsData: error: %v for %v,%v,%v\n", e, identity, dt, role)
+			if ctx.AffsAPIFailFatal {
+				err = e
+				return
+			}
+		}
+		if empty {
+			Printf("no identity affiliation data for identity %+v\n", identity)
+			continue
+		}
+		for prop, value := range affsIdentity {
+			affsItems[prop] = value
+		}
+		for _, suff := range RequiredAffsFields {
+			k := role + suff
+			_, ok := affsIdentity[k]
+			if !ok {
+				affsIdentity[k] = Unknown
+			}
+		}
+	}
+	return
+}
+
+// GetRoleIdentity - return identity data for a given role
+// item's data is a post, for a topic (which holds posts) its first post is used
+func (j *DSDiscourse) GetRoleIdentity(ctx *Ctx, item map[string]interface{}, role string) (identity map[string]interface{}) {
+	data, _ := item["data"].(map[string]interface{})
+	_, isTopic := data["post_stream"]
+	if isTopic {
+		posts := DiscourseTopicPosts(data)
+		if len(posts) == 0 {
+			return
+		}
+		data = posts[0]
+	}
+	postIdentity := DiscoursePostIdentity(data)
+	if postIdentity == nil {
+		return
+	}
+	identity = map[string]interface{}{"name": postIdentity[0], "username": postIdentity[1], "email": postIdentity[2]}
+	return
+}
+
+// AllRoles - return all roles defined for the backend
+// roles can be static (always the same) or dynamic (per item)
+// second return parameter is static mode (true/false)
+// dynamic roles will use item to get its roles
+func (j *DSDiscourse) AllRoles(ctx *Ctx, item map[string]interface{}) ([]string, bool) {
+	return DiscourseRoles, true
+}
+
+// HasIdentities - does this data source support identity data
+func (j *DSDiscourse) HasIdentities() bool {
+	return true
+}
+
+// UseDefaultMapping - apply MappingNotAnalyzeString for raw/rich (raw=fals/true) index in this DS?
+func (j *DSDiscourse) UseDefaultMapping(ctx *Ctx, raw bool) bool {
+	return true
+}
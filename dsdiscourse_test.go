@@ -0,0 +1,105 @@
+package dads
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDiscourseTopicHelpers(t *testing.T) {
+	posts := []map[string]interface{}{
+		{"id": 10.0, "post_number": 1.0, "username": "alice", "created_at": "2021-06-01T10:00:00.000Z"},
+		{"id": 11.0, "post_number": 2.0, "username": "alice", "created_at": "2021-06-01T11:00:00.000Z"},
+		{"id": 12.0, "post_number": 3.0, "username": "system", "post_type": 3.0, "created_at": "2021-06-01T12:00:00.000Z"},
+		{"id": 13.0, "post_number": 4.0, "username": "bob", "created_at": "2021-06-02T10:00:00.000Z", "actions_summary": []interface{}{map[string]interface{}{"id": 2.0, "count": 3.0}}},
+		{"id": 14.0, "post_number": 5.0, "username": "carol", "created_at": "2021-06-03T10:00:00.000Z", "accepted_answer": true},
+	}
+	reply := DiscourseFirstReply(posts)
+	if reply == nil || reply["id"] != 13.0 {
+		t.Errorf("unexpected first reply: %+v", reply)
+	}
+	if DiscourseFirstReply(posts[:3]) != nil {
+		t.Errorf("topic author's own posts and small actions should not be replies")
+	}
+	answer := DiscourseAcceptedAnswer(map[string]interface{}{}, posts)
+	if answer == nil || answer["id"] != 14.0 {
+		t.Errorf("unexpected accepted answer: %+v", answer)
+	}
+	answer = DiscourseAcceptedAnswer(map[string]interface{}{"accepted_answer": map[string]interface{}{"post_number": 4.0}}, posts[:4])
+	if answer == nil || answer["id"] != 13.0 {
+		t.Errorf("unexpected accepted answer from topic: %+v", answer)
+	}
+	if DiscourseLikes(posts[3]) != 3 || DiscourseLikes(posts[0]) != 0 || DiscourseLikes(map[string]interface{}{"like_count": 7.0}) != 7 {
+		t.Errorf("unexpected likes")
+	}
+	tags := DiscourseTags(map[string]interface{}{"tags": []interface{}{"help", map[string]interface{}{"id": 1.0, "name": "ci"}}})
+	if len(tags) != 2 || tags[0] != "help" || tags[1] != "ci" {
+		t.Errorf("unexpected tags: %+v", tags)
+	}
+	if DiscoursePostIdentity(posts[2]) != nil {
+		t.Errorf("system user should have no identity")
+	}
+	identity := DiscoursePostIdentity(map[string]interface{}{"username": "bob", "user_email": "bob@example.com"})
+	if identity == nil || *identity != [3]string{Nil, "bob", "bob@example.com"} {
+		t.Errorf("unexpected identity: %+v", identity)
+	}
+}
+
+func TestDiscourseText(t *testing.T) {
+	text := DiscoursePlainText("<p>Hello &amp; <a href=\"https://example.com\">welcome</a></p>\n<p>Second line</p>")
+	if text != "Hello & welcome\nSecond line" {
+		t.Errorf("unexpected plain text: %q", text)
+	}
+	seconds := DiscourseRetryAfter(map[string][]string{"Retry-After": {"12"}}, nil)
+	if seconds != 13 {
+		t.Errorf("unexpected retry after %d", seconds)
+	}
+	seconds = DiscourseRetryAfter(nil, map[string]interface{}{"extras": map[string]interface{}{"wait_seconds": 5.0}})
+	if seconds != 6 {
+		t.Errorf("unexpected retry after from response %d", seconds)
+	}
+	if DiscourseRetryAfter(nil, nil) != DiscourseDefaultRetryAfter {
+		t.Errorf("unexpected default retry after")
+	}
+}
+
+func TestGetDiscourseTopicMissingPosts(t *testing.T) {
+	var testCases = []struct {
+		postsStatus     int
+		expectedPosts   int
+		expectedMissing interface{}
+	}{
+		{postsStatus: 200, expectedPosts: 3, expectedMissing: nil},
+		{postsStatus: 404, expectedPosts: 1, expectedMissing: 2.0},
+		{postsStatus: 403, expectedPosts: 1, expectedMissing: 2.0},
+	}
+	for index, test := range testCases {
+		postsStatus := test.postsStatus
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			switch r.URL.Path {
+			case "/t/5.json":
+				_, _ = w.Write([]byte(`{"id":5,"post_stream":{"posts":[{"id":10,"post_number":1}],"stream":[10,11,12]}}`))
+			case "/t/5/posts.json":
+				w.WriteHeader(postsStatus)
+				if postsStatus == 200 {
+					_, _ = w.Write([]byte(`{"post_stream":{"posts":[{"id":12,"post_number":3},{"id":11,"post_number":2}]}}`))
+				}
+			default:
+				w.WriteHeader(404)
+			}
+		}))
+		j := &DSDiscourse{URL: server.URL}
+		topic, err := j.GetDiscourseTopic(&Ctx{}, 5)
+		server.Close()
+		if err != nil {
+			t.Errorf("test number %d, unexpected error: %v", index+1, err)
+			continue
+		}
+		posts, _ := Dig(topic, []string{"post_stream", "posts"}, false, true)
+		aPosts, _ := posts.([]interface{})
+		if len(aPosts) != test.expectedPosts || topic["missing_posts"] != test.expectedMissing {
+			t.Errorf("test number %d, expected %d posts and %v missing, got %d posts and %v missing", index+1, test.expectedPosts, test.expectedMissing, len(aPosts), topic["missing_posts"])
+		}
+	}
+}
@@ -3,7 +3,9 @@ package dads
 import (
 	"fmt"
 	"io/ioutil"
+	"math"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
@@ -24,13 +26,15 @@ const (
 	GerritDefaultMaxReviews = 1000
 	// GerritCodeReviewApprovalType - code review approval type
 	GerritCodeReviewApprovalType = "Code-Review"
+	// GerritSubmitApprovalType - pseudo approval type gerrit query reports when change is submitted
+	GerritSubmitApprovalType = "SUBM"
 )
 
 var (
 	// GerritRawMapping - Gerrit raw index mapping
 	GerritRawMapping = []byte(`{"dynamic":true,"properties":{"metadata__updated_on":{"type":"date"},"data":{"properties":{"commitMessage":{"type":"text","index":true},"comments":{"properties":{"message":{"type":"text","index":true}}},"subject":{"type":"text","index":true},"patchSets":{"properties":{"approvals":{"properties":{"description":{"type":"text","index":true}}},"comments":{"properties":{"message":{"type":"text","index":true}}}}}}}}}`)
 	// GerritRichMapping - Gerrit rich index mapping
-	GerritRichMapping = []byte(`{"properties":{"metadata__updated_on":{"type":"date"},"approval_description_analyzed":{"type":"text","index":true},"comment_message_analyzed":{"type":"text","index":true},"status":{"type":"keyword"},"summary_analyzed":{"type":"text","index":true},"timeopen":{"type":"double"}}}`)
+	GerritRichMapping = []byte(`{"properties":{"metadata__updated_on":{"type":"date"},"approval_description_analyzed":{"type":"text","index":true},"comment_message_analyzed":{"type":"text","index":true},"inline_comment_message_analyzed":{"type":"text","index":true},"status":{"type":"keyword"},"summary_analyzed":{"type":"text","index":true},"timeopen":{"type":"double"}}}`)
 	// GerritCategories - categories defined for gerrit
 	GerritCategories = map[string]struct{}{Review: {}}
 	// GerritVersionRegexp - gerrit verion pattern
@@ -43,8 +47,13 @@ var (
 	GerritCommentRoles = []string{"reviewer"}
 	// GerritPatchsetRoles - roles to fetch affiliation data for patchset
 	GerritPatchsetRoles = []string{"author", "uploader"}
+	// GerritMagicFiles - gerrit virtual files (commit message, merge parents list, patch set level comments), they are not repository files
+	GerritMagicFiles = map[string]struct{}{"/COMMIT_MSG": {}, "/MERGE_LIST": {}, "/PATCHSET_LEVEL": {}}
 	// GerritApprovalRoles - roles to fetch affiliation data for approval
 	GerritApprovalRoles = []string{"by"}
+	// GerritDefaultBotPatterns - default bot accounts patterns, matched against username and email
+	// they are anchored to whole name parts, so "jenkinson" or "ljenkins@" are not bots while "onap-jenkins" is
+	GerritDefaultBotPatterns = []string{`(^|[-_.])jenkins([-_.@]|$)`, `(^|[-_.])jobbuilder([-_.@]|$)`, `(^|[-_.])zuul([-_.@]|$)`, `(^|[-_.])bot([-_.@]|$)`, `(^|[-_.])ci([-_.@]|$)`}
 )
 
 // DSGerrit - DS implementation for stub - does nothing at all, just presents a skeleton code
@@ -59,12 +68,17 @@ type DSGerrit struct {
 	MaxReviews          int    // From DA_GERRIT_MAX_REVIEWS, defaults to GerritDefaultMaxReviews (1000)
 	NoSSLVerify         bool   // From DA_GERRIT_NO_SSL_VERIFY
 	DisableHostKeyCheck bool   // From DA_GERRIT_DISABLE_HOST_KEY_CHECK
+	Transport           string // From DA_GERRIT_TRANSPORT - ssh (default) or rest
+	HTTPPassword        string // From DA_GERRIT_HTTP_PASSWORD - gerrit HTTP password for rest transport, anonymous access when not set
+	BotPatterns         string // From DA_GERRIT_BOT_PATTERNS - comma separated regexps matched against username/email to detect bot accounts, defaults to GerritDefaultBotPatterns, "-" disables
 	// Non-config variables
-	SSHOpts        string   // SSH Options
-	SSHKeyTempPath string   // if used SSHKey - temp file with this name was used to store key contents
-	GerritCmd      []string // gerrit remote command used to fetch data
-	VersionMajor   int      // gerrit major version
-	VersionMinor   int      // gerrit minor version
+	Scheme         string           // URL scheme used by rest transport, defaults to https
+	SSHOpts        string           // SSH Options
+	SSHKeyTempPath string           // if used SSHKey - temp file with this name was used to store key contents
+	GerritCmd      []string         // gerrit remote command used to fetch data
+	VersionMajor   int              // gerrit major version
+	VersionMinor   int              // gerrit minor version
+	BotRegexps     []*regexp.Regexp // compiled BotPatterns
 }
 
 // ParseArgs - parse gerrit specific environment variables
@@ -85,6 +99,13 @@ func (j *DSGerrit) ParseArgs(ctx *Ctx) (err error) {
 		NoSSLVerify()
 	}
 	j.DisableHostKeyCheck = StringToBool(os.Getenv(prefix + "DISABLE_HOST_KEY_CHECK"))
+	j.Transport = strings.ToLower(strings.TrimSpace(os.Getenv(prefix + "TRANSPORT")))
+	if j.Transport == "" {
+		j.Transport = GerritTransportSSH
+	}
+	j.HTTPPassword = os.Getenv(prefix + "HTTP_PASSWORD")
+	j.BotPatterns = os.Getenv(prefix + "BOT_PATTERNS")
+	AddRedacted(j.HTTPPassword, false)
 	if ctx.Env("SSH_PORT") != "" {
 		sshPort, err := strconv.Atoi(ctx.Env("SSH_PORT"))
 		FatalOnError(err)
@@ -106,16 +127,56 @@ func (j *DSGerrit) ParseArgs(ctx *Ctx) (err error) {
 	return
 }
 
+// GerritBotRegexps - compile comma separated bot patterns (case insensitive), GerritDefaultBotPatterns are used when empty
+func GerritBotRegexps(botPatterns string) (regexps []*regexp.Regexp, err error) {
+	patterns := GerritDefaultBotPatterns
+	if botPatterns != "" {
+		patterns = strings.Split(botPatterns, ",")
+	}
+	regexps = []*regexp.Regexp{}
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" || pattern == "-" {
+			continue
+		}
+		var re *regexp.Regexp
+		re, err = regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			err = fmt.Errorf("invalid bot pattern %s: %v", pattern, err)
+			return
+		}
+		regexps = append(regexps, re)
+	}
+	return
+}
+
 // Validate - is current DS configuration OK?
 func (j *DSGerrit) Validate(ctx *Ctx) (err error) {
 	j.URL = strings.TrimSpace(j.URL)
 	if strings.HasSuffix(j.URL, "/") {
 		j.URL = j.URL[:len(j.URL)-1]
 	}
+	j.BotRegexps, err = GerritBotRegexps(j.BotPatterns)
+	if err != nil {
+		return
+	}
+	j.Scheme = "https"
 	ary := strings.Split(j.URL, "://")
 	if len(ary) > 1 {
+		j.Scheme = ary[0]
 		j.URL = ary[1]
 	}
+	_, ok := GerritTransports[j.Transport]
+	if !ok {
+		err = fmt.Errorf("unknown transport %s, allowed: ssh, rest", j.Transport)
+		return
+	}
+	if j.Transport == GerritTransportREST {
+		if j.URL == "" {
+			err = fmt.Errorf("URL must be set")
+		}
+		return
+	}
 	j.SSHKeyPath = os.ExpandEnv(j.SSHKeyPath)
 	if j.SSHKeyPath == "" && j.SSHKey == "" {
 		err = fmt.Errorf("Either SSH key or SSH key path must be set")
@@ -161,6 +222,9 @@ func (j *DSGerrit) Enrich(ctx *Ctx) (err error) {
 
 // InitGerrit - initializes gerrit client
 func (j *DSGerrit) InitGerrit(ctx *Ctx) (err error) {
+	if j.Transport == GerritTransportREST {
+		return
+	}
 	if j.DisableHostKeyCheck {
 		j.SSHOpts += "-o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null "
 	}
@@ -205,6 +269,9 @@ func (j *DSGerrit) InitGerrit(ctx *Ctx) (err error) {
 
 // GetGerritVersion - get gerrit version
 func (j *DSGerrit) GetGerritVersion(ctx *Ctx) (err error) {
+	if j.Transport == GerritTransportREST {
+		return j.GetGerritRESTVersion(ctx)
+	}
 	cmdLine := j.GerritCmd
 	cmdLine = append(cmdLine, "version")
 	var (
@@ -231,6 +298,9 @@ func (j *DSGerrit) GetGerritVersion(ctx *Ctx) (err error) {
 
 // GetGerritReviews - get gerrit reviews
 func (j *DSGerrit) GetGerritReviews(ctx *Ctx, after string, afterEpoch float64, startFrom int) (reviews []map[string]interface{}, newStartFrom int, err error) {
+	if j.Transport == GerritTransportREST {
+		return j.GetGerritRESTReviews(ctx, after, afterEpoch, startFrom)
+	}
 	cmdLine := j.GerritCmd
 	// https://gerrit-review.googlesource.com/Documentation/user-search.html:
 	// ssh -o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null -i ./ssh-key.secret -p XYZ usr@gerrit-url gerrit query after:'1970-01-01 00:00:00' limit: 2 (status:open OR status:closed) --all-approvals --all-reviewers --comments --format=JSON
@@ -240,7 +310,7 @@ func (j *DSGerrit) GetGerritReviews(ctx *Ctx, after string, afterEpoch float64,
 	if ctx.ProjectFilter && ctx.Project != "" {
 		cmdLine = append(cmdLine, "project:", ctx.Project)
 	}
-	cmdLine = append(cmdLine, `after:"`+after+`"`, "limit:", strconv.Itoa(j.MaxReviews), "(status:open OR status:closed)", "--all-approvals", "--all-reviewers", "--comments", "--format=JSON")
+	cmdLine = append(cmdLine, `after:"`+after+`"`, "limit:", strconv.Itoa(j.MaxReviews), "(status:open OR status:closed)", "--all-approvals", "--all-reviewers", "--comments", "--patch-sets", "--files", "--dependencies", "--format=JSON")
 	// 2006-01-02[ 15:04:05[.890][ -0700]]
 	if startFrom > 0 {
 		cmdLine = append(cmdLine, "--start="+strconv.Itoa(startFrom))
@@ -713,6 +783,25 @@ func (j *DSGerrit) GetItemIdentities(ctx *Ctx, doc interface{}) (identities map[
 						identities[j.IdentityForObject(ctx, author)] = struct{}{}
 					}
 				}
+				iInlineComments, ok := Dig(patch, []string{"comments"}, false, true)
+				if ok {
+					inlineComments, ok := iInlineComments.([]interface{})
+					if ok {
+						for _, iInlineComment := range inlineComments {
+							iReviewer, ok := Dig(iInlineComment, []string{"reviewer"}, false, true)
+							if ok {
+								reviewer, ok := iReviewer.(map[string]interface{})
+								if ok {
+									if !init {
+										identities = make(map[[3]string]struct{})
+										init = true
+									}
+									identities[j.IdentityForObject(ctx, reviewer)] = struct{}{}
+								}
+							}
+						}
+					}
+				}
 				iApprovals, ok := Dig(patch, []string{"approvals"}, false, true)
 				if ok {
 					approvals, ok := iApprovals.([]interface{})
@@ -963,12 +1052,164 @@ func GerritEnrichItemsFunc(ctx *Ctx, ds DS, thrN int, items []interface{}, docs
 func (j *DSGerrit) EnrichItems(ctx *Ctx) (err error) {
 	Printf("enriching items\n")
 	err = ForEachESItem(ctx, j, true, ESBulkUploadFunc, GerritEnrichItemsFunc, nil, true)
+	if err != nil {
+		return
+	}
+	err = j.GerritStacks(ctx)
+	return
+}
+
+// DependencyNumbers - return change numbers from dependsOn/neededBy arrays, gerrit returns them as numbers or strings
+func (j *DSGerrit) DependencyNumbers(iDeps interface{}) (numbers []int) {
+	numbers = []int{}
+	deps, _ := iDeps.([]interface{})
+	for _, iDep := range deps {
+		iNumber, _ := Dig(iDep, []string{"number"}, false, true)
+		switch v := iNumber.(type) {
+		case float64:
+			numbers = append(numbers, int(v))
+		case string:
+			n, err := strconv.Atoi(v)
+			if err == nil {
+				numbers = append(numbers, n)
+			}
+		}
+	}
+	return
+}
+
+// GerritStacks - find stacks of dependent changes (connected by depends_on/needed_by) within the origin
+// and set stack_size on all their changeset documents
+func (j *DSGerrit) GerritStacks(ctx *Ctx) (err error) {
+	url := ctx.ESURL + "/" + ctx.RichIndex + "/_search"
+	parent := make(map[int]int)
+	var find func(int) int
+	find = func(n int) int {
+		p, ok := parent[n]
+		if !ok {
+			parent[n] = n
+			return n
+		}
+		if p == n {
+			return n
+		}
+		root := find(p)
+		parent[n] = root
+		return root
+	}
+	union := func(a, b int) {
+		ra, rb := find(a), find(b)
+		if ra != rb {
+			parent[ra] = rb
+		}
+	}
+	searchAfter := ""
+	for {
+		payload := []byte(`{"size":` + strconv.Itoa(ctx.ESScrollSize) + `,"_source":["changeset_number","depends_on","needed_by"],"sort":[{"changeset_number":"asc"}],` +
+			`"query":{"bool":{"filter":[{"term":{"origin":"` + JSONEscape(j.URL) + `"}},{"term":{"type":"` + Changeset + `"}}],` +
+			`"should":[{"exists":{"field":"depends_on"}},{"exists":{"field":"needed_by"}}],"minimum_should_match":1}}` + searchAfter + `}`)
+		var resp interface{}
+		resp, _, _, _, err = Request(
+			ctx,
+			url,
+			Post,
+			map[string]string{"Content-Type": "application/json"}, // headers
+			payload,                             // payload
+			[]string{},                          // cookies
+			map[[2]int]struct{}{{200, 200}: {}}, // JSON statuses: 200
+			nil,                                 // Error statuses
+			map[[2]int]struct{}{{200, 200}: {}}, // OK statuses: 200
+			nil,                                 // Cache statuses
+			true,                                // retry
+			nil,                                 // cache for
+			false,                               // skip in dry-run mode
+		)
+		if err != nil {
+			Printf("GerritStacks error: %v\n", err)
+			return
+		}
+		iHits, _ := Dig(resp, []string{"hits", "hits"}, false, true)
+		hits, _ := iHits.([]interface{})
+		if len(hits) == 0 {
+			break
+		}
+		for _, hit := range hits {
+			iNumber, _ := Dig(hit, []string{"_source", "changeset_number"}, false, true)
+			number, ok := iNumber.(float64)
+			if !ok {
+				continue
+			}
+			find(int(number))
+			for _, key := range []string{"depends_on", "needed_by"} {
+				iRelated, _ := Dig(hit, []string{"_source", key}, false, true)
+				related, _ := iRelated.([]interface{})
+				for _, iRel := range related {
+					rel, ok := iRel.(float64)
+					if ok {
+						union(int(number), int(rel))
+					}
+				}
+			}
+		}
+		sortValues, _ := Dig(hits[len(hits)-1], []string{"sort"}, false, true)
+		data, e := jsoniter.Marshal(sortValues)
+		if e != nil {
+			err = e
+			return
+		}
+		searchAfter = `,"search_after":` + string(data)
+	}
+	if len(parent) == 0 {
+		return
+	}
+	sizes := make(map[int]int)
+	for number := range parent {
+		sizes[find(number)]++
+	}
+	bySize := make(map[int][]int)
+	for number := range parent {
+		size := sizes[find(number)]
+		bySize[size] = append(bySize[size], number)
+	}
+	Printf("found %d changes in %d stacks\n", len(parent), len(sizes))
+	url = ctx.ESURL + "/" + ctx.RichIndex + "/_update_by_query?conflicts=proceed&refresh=true&timeout=20m"
+	packSize := ctx.ESBulkSize
+	for size, numbers := range bySize {
+		for from := 0; from < len(numbers); from += packSize {
+			to := from + packSize
+			if to > len(numbers) {
+				to = len(numbers)
+			}
+			data, _ := jsoniter.Marshal(numbers[from:to])
+			payload := []byte(`{"script":{"inline":"ctx._source.stack_size=params.size;","params":{"size":` + strconv.Itoa(size) + `}},` +
+				`"query":{"bool":{"filter":[{"term":{"origin":"` + JSONEscape(j.URL) + `"}},{"term":{"type":"` + Changeset + `"}},{"terms":{"changeset_number":` + string(data) + `}}]}}}`)
+			_, _, _, _, err = Request(
+				ctx,
+				url,
+				Post,
+				map[string]string{"Content-Type": "application/json"}, // headers
+				payload,                             // payload
+				[]string{},                          // cookies
+				map[[2]int]struct{}{{200, 200}: {}}, // JSON statuses: 200
+				nil,                                 // Error statuses
+				map[[2]int]struct{}{{200, 200}: {}}, // OK statuses: 200
+				nil,                                 // Cache statuses
+				true,                                // retry
+				nil,                                 // cache for
+				true,                                // skip in dry-run mode
+			)
+			if err != nil {
+				Printf("GerritStacks update error: %v\n", err)
+				return
+			}
+		}
+	}
 	return
 }
 
 // ConvertDates - convert floating point dates to datetimes
 func (j *DSGerrit) ConvertDates(ctx *Ctx, review map[string]interface{}) {
-	for _, field := range []string{"timestamp", "createdOn", "lastUpdated"} {
+	for _, field := range []string{"timestamp", "createdOn", "lastUpdated", "submitted"} {
 		idt, ok := Dig(review, []string{field}, false, true)
 		if !ok {
 			continue
@@ -998,6 +1239,22 @@ func (j *DSGerrit) ConvertDates(ctx *Ctx, review map[string]interface{}) {
 						// Printf("converted patch %s: %v -> %v\n", field, idt, patch[field])
 					}
 				}
+				iInlineComments, ok := Dig(patch, []string{"comments"}, false, true)
+				if ok {
+					inlineComments, ok := iInlineComments.([]interface{})
+					if ok {
+						for _, iInlineComment := range inlineComments {
+							inlineComment, ok := iInlineComment.(map[string]interface{})
+							if !ok {
+								continue
+							}
+							fdt, ok := inlineComment["timestamp"].(float64)
+							if ok {
+								inlineComment["timestamp"] = time.Unix(int64(fdt), 0)
+							}
+						}
+					}
+				}
 				iApprovals, ok := Dig(patch, []string{"approvals"}, false, true)
 				if ok {
 					approvals, ok := iApprovals.([]interface{})
@@ -1045,7 +1302,7 @@ func (j *DSGerrit) ConvertDates(ctx *Ctx, review map[string]interface{}) {
 	}
 }
 
-// FirstReviewDatetime - return first review date/time
+// FirstReviewDatetime - return first review date/time, bot votes are not reviews
 func (j *DSGerrit) FirstReviewDatetime(ctx *Ctx, review map[string]interface{}, patchSets []interface{}) (reviewDatetime interface{}) {
 	if ctx.Debug > 2 {
 		defer func() {
@@ -1103,6 +1360,9 @@ func (j *DSGerrit) FirstReviewDatetime(ctx *Ctx, review map[string]interface{},
 				}
 				continue
 			}
+			if j.IsBot(approval["by"]) {
+				continue
+			}
 			iGrantedOn, okGrantedOn := approval["grantedOn"]
 			var grantedOn time.Time
 			if okCreatedOn && okGrantedOn {
@@ -1378,7 +1638,7 @@ func (j *DSGerrit) FirstPatchsetApprovalDatetime(ctx *Ctx, patchSet map[string]i
 	return
 }
 
-// FirstPatchsetReviewDatetime - return first patchset review date/time
+// FirstPatchsetReviewDatetime - return first patchset review date/time, bot votes are not reviews
 func (j *DSGerrit) FirstPatchsetReviewDatetime(ctx *Ctx, patchSet map[string]interface{}) (reviewDatetime interface{}) {
 	if ctx.Debug > 2 {
 		defer func() {
@@ -1428,6 +1688,9 @@ func (j *DSGerrit) FirstPatchsetReviewDatetime(ctx *Ctx, patchSet map[string]int
 			}
 			continue
 		}
+		if j.IsBot(approval["by"]) {
+			continue
+		}
 		iGrantedOn, okGrantedOn := approval["grantedOn"]
 		var grantedOn time.Time
 		if okCreatedOn && okGrantedOn {
@@ -1573,6 +1836,236 @@ func (j *DSGerrit) LastChangesetApprovalValue(ctx *Ctx, patchSets []interface{})
 	return
 }
 
+// IsBot - is a given gerrit account a bot account?
+func (j *DSGerrit) IsBot(iAccount interface{}) bool {
+	account, ok := iAccount.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	for _, field := range []string{"username", "email"} {
+		val, _ := account[field].(string)
+		if val == "" {
+			continue
+		}
+		for _, re := range j.BotRegexps {
+			if re.MatchString(val) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// GerritLabelField - return rich field name part for a given label vote, "Code-Review", 2 -> "code_review_plus2"
+func GerritLabelField(label string, value int) string {
+	name := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, strings.ToLower(label))
+	return fmt.Sprintf("%s_plus%d", name, value)
+}
+
+// LabelMetrics - return first positive vote date/time for each label and value found in patch sets
+// together with time (in days) from created, for example first_verified_plus1_date and time_to_first_verified_plus1
+// bot votes are included, because labels like Verified are usually granted by CI
+func (j *DSGerrit) LabelMetrics(ctx *Ctx, patchSets []interface{}, created time.Time, prefix string) (metrics map[string]interface{}) {
+	firsts := make(map[string]time.Time)
+	for _, iPatchSet := range patchSets {
+		iApprovals, ok := Dig(iPatchSet, []string{"approvals"}, false, true)
+		if !ok {
+			continue
+		}
+		approvals, _ := iApprovals.([]interface{})
+		for _, iApproval := range approvals {
+			approval, ok := iApproval.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			label, _ := approval["type"].(string)
+			if label == "" || label == GerritSubmitApprovalType {
+				continue
+			}
+			sValue, _ := approval["value"].(string)
+			value, err := strconv.Atoi(sValue)
+			if err != nil || value <= 0 {
+				continue
+			}
+			grantedOn, ok := approval["grantedOn"].(time.Time)
+			if !ok {
+				continue
+			}
+			field := GerritLabelField(label, value)
+			first, ok := firsts[field]
+			if !ok || grantedOn.Before(first) {
+				firsts[field] = grantedOn
+			}
+		}
+	}
+	metrics = make(map[string]interface{})
+	for field, first := range firsts {
+		metrics[prefix+"first_"+field+"_date"] = first
+		metrics[prefix+"time_to_first_"+field] = float64(first.Sub(created).Seconds()) / 86400.0
+	}
+	if ctx.Debug > 2 {
+		Printf("LabelMetrics: %+v\n", metrics)
+	}
+	return
+}
+
+// SubmitDatetime - return date/time when the change was submitted, nil if not submitted
+func (j *DSGerrit) SubmitDatetime(ctx *Ctx, review map[string]interface{}, patchSets []interface{}) (submitDatetime interface{}) {
+	for _, iPatchSet := range patchSets {
+		iApprovals, ok := Dig(iPatchSet, []string{"approvals"}, false, true)
+		if !ok {
+			continue
+		}
+		approvals, _ := iApprovals.([]interface{})
+		for _, iApproval := range approvals {
+			approval, ok := iApproval.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			approvalType, _ := approval["type"].(string)
+			if approvalType != GerritSubmitApprovalType {
+				continue
+			}
+			grantedOn, ok := approval["grantedOn"].(time.Time)
+			if ok {
+				submitDatetime = grantedOn
+				return
+			}
+		}
+	}
+	// rest transport doesn't report SUBM approvals, but has submitted timestamp
+	submitted, ok := review["submitted"].(time.Time)
+	if ok {
+		submitDatetime = submitted
+	}
+	return
+}
+
+// SameAccount - do two gerrit account objects represent the same person? compares usernames if both set, emails otherwise
+func (j *DSGerrit) SameAccount(iAccount1, iAccount2 interface{}) bool {
+	for _, field := range []string{"username", "email"} {
+		val1, _ := Dig(iAccount1, []string{field}, false, true)
+		val2, _ := Dig(iAccount2, []string{field}, false, true)
+		s1, _ := val1.(string)
+		s2, _ := val2.(string)
+		if s1 != "" && s2 != "" {
+			return s1 == s2
+		}
+	}
+	return false
+}
+
+// PatchsetMetrics - return changeset level patch set iteration metrics:
+// number of patch sets of each kind (REWORK, TRIVIAL_REBASE, ...), total insertions/deletions (positive line counts) of all revisions,
+// time between patch sets, review rounds (patch sets reviewed by non-bot other than patch set author),
+// votes reset by rework (votes on patch sets followed by a REWORK one) and time from last patch set to merge
+// all times are in days
+func (j *DSGerrit) PatchsetMetrics(ctx *Ctx, reviewStatus string, patchSets []interface{}, submitDatetime interface{}) (metrics map[string]interface{}) {
+	metrics = map[string]interface{}{
+		"patchsets_rework":                 0,
+		"patchsets_trivial_rebase":         0,
+		"total_insertions":                 0.0,
+		"total_deletions":                  0.0,
+		"review_rounds":                    0,
+		"votes_reset_by_rework":            0,
+		"patchsets_avg_interval":           nil,
+		"patchsets_max_interval":           nil,
+		"time_from_last_patchset_to_merge": nil,
+	}
+	var (
+		prevCreated  time.Time
+		lastCreated  time.Time
+		sumInterval  float64
+		maxInterval  float64
+		nIntervals   int
+		prevNVotes   int
+		insertions   float64
+		deletions    float64
+		reviewRounds int
+		votesReset   int
+	)
+	for _, iPatchSet := range patchSets {
+		patchSet, ok := iPatchSet.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		kind, _ := patchSet["kind"].(string)
+		if kind != "" {
+			key := "patchsets_" + strings.ToLower(kind)
+			n, _ := metrics[key].(int)
+			metrics[key] = n + 1
+		}
+		if kind == "REWORK" {
+			votesReset += prevNVotes
+		}
+		ins, _ := patchSet["sizeInsertions"].(float64)
+		insertions += ins
+		// gerrit reports deletions as negative numbers
+		del, _ := patchSet["sizeDeletions"].(float64)
+		deletions += math.Abs(del)
+		created, ok := patchSet["createdOn"].(time.Time)
+		if ok {
+			if !prevCreated.IsZero() {
+				interval := float64(created.Sub(prevCreated).Seconds()) / 86400.0
+				sumInterval += interval
+				nIntervals++
+				if interval > maxInterval {
+					maxInterval = interval
+				}
+			}
+			prevCreated = created
+			lastCreated = created
+		}
+		prevNVotes = 0
+		reviewed := false
+		approvals, _ := patchSet["approvals"].([]interface{})
+		for _, iApproval := range approvals {
+			approval, ok := iApproval.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			approvalType, _ := approval["type"].(string)
+			if approvalType == GerritSubmitApprovalType {
+				continue
+			}
+			sValue, _ := approval["value"].(string)
+			value, _ := strconv.Atoi(sValue)
+			if value != 0 {
+				prevNVotes++
+			}
+			if approvalType == GerritCodeReviewApprovalType && !j.IsBot(approval["by"]) && !j.SameAccount(approval["by"], patchSet["author"]) {
+				reviewed = true
+			}
+		}
+		if reviewed {
+			reviewRounds++
+		}
+	}
+	metrics["total_insertions"] = insertions
+	metrics["total_deletions"] = deletions
+	metrics["review_rounds"] = reviewRounds
+	metrics["votes_reset_by_rework"] = votesReset
+	if nIntervals > 0 {
+		metrics["patchsets_avg_interval"] = sumInterval / float64(nIntervals)
+		metrics["patchsets_max_interval"] = maxInterval
+	}
+	if reviewStatus == "MERGED" && !lastCreated.IsZero() {
+		submitDt, ok := submitDatetime.(time.Time)
+		if ok {
+			metrics["time_from_last_patchset_to_merge"] = float64(submitDt.Sub(lastCreated).Seconds()) / 86400.0
+		}
+	}
+	if ctx.Debug > 2 {
+		Printf("PatchsetMetrics: %+v\n", metrics)
+	}
+	return
+}
+
 // EnrichItem - return rich item from raw item
 func (j *DSGerrit) EnrichItem(ctx *Ctx, item map[string]interface{}, author string, affs bool, extra interface{}) (rich map[string]interface{}, err error) {
 	if ctx.Debug > 2 {
@@ -1685,6 +2178,21 @@ func (j *DSGerrit) EnrichItem(ctx *Ctx, item map[string]interface{}, author stri
 			rich["time_to_first_approval"] = float64(firstApprovalDt.Sub(createdOn).Seconds()) / 86400.0
 		}
 	}
+	for prop, value := range j.LabelMetrics(ctx, patchSets, createdOn, "") {
+		rich[prop] = value
+	}
+	iSubmitDt := j.SubmitDatetime(ctx, review, patchSets)
+	rich["submit_date"] = iSubmitDt
+	rich["time_to_submit"] = nil
+	if iSubmitDt != nil {
+		submitDt, ok := iSubmitDt.(time.Time)
+		if ok {
+			rich["time_to_submit"] = float64(submitDt.Sub(createdOn).Seconds()) / 86400.0
+		}
+	}
+	for prop, value := range j.PatchsetMetrics(ctx, reviewStatus, patchSets, iSubmitDt) {
+		rich[prop] = value
+	}
 	var lastUpdatedOn time.Time
 	iLastUpdatedOn, ok := review["lastUpdated"]
 	if ok {
@@ -1703,6 +2211,18 @@ func (j *DSGerrit) EnrichItem(ctx *Ctx, item map[string]interface{}, author stri
 		rich["wip"] = false
 	}
 	rich["open"], _ = Dig(review, []string{"open"}, false, true)
+	rich["topic"], _ = review["topic"]
+	hashtags, ok := review["hashtags"].([]interface{})
+	if !ok {
+		hashtags = []interface{}{}
+	}
+	rich["hashtags"] = hashtags
+	dependsOn := j.DependencyNumbers(review["dependsOn"])
+	neededBy := j.DependencyNumbers(review["neededBy"])
+	rich["depends_on"] = dependsOn
+	rich["needed_by"] = neededBy
+	// direct relations only, GerritStacks updates it with the whole stack size after enrichment
+	rich["stack_size"] = 1 + len(dependsOn) + len(neededBy)
 	rich["type"] = Changeset
 	if affs {
 		authorKey := "owner"
@@ -1740,7 +2260,7 @@ func (j *DSGerrit) EnrichItem(ctx *Ctx, item map[string]interface{}, author stri
 
 // EnrichPatchsets - return rich items from raw patch sets
 func (j *DSGerrit) EnrichPatchsets(ctx *Ctx, review map[string]interface{}, patchSets []map[string]interface{}, affs bool) (richItems []interface{}, err error) {
-	copyFields := []string{"wip", "open", "url", "summary", "repository", "branch", "changeset_number", "changeset_status", "changeset_status_value", "repo_short_name"}
+	copyFields := []string{"wip", "open", "url", "summary", "repository", "branch", "topic", "changeset_number", "changeset_status", "changeset_status_value", "repo_short_name"}
 	iReviewID, ok := review["id"]
 	if !ok {
 		err = fmt.Errorf("cannot get id property of review: %+v", review)
@@ -1751,6 +2271,7 @@ func (j *DSGerrit) EnrichPatchsets(ctx *Ctx, review map[string]interface{}, patc
 		err = fmt.Errorf("cannot get string id property of review: %+v", iReviewID)
 		return
 	}
+	var prevCreated time.Time
 	for _, patchSet := range patchSets {
 		rich := make(map[string]interface{})
 		for _, field := range RawFields {
@@ -1802,6 +2323,11 @@ func (j *DSGerrit) EnrichPatchsets(ctx *Ctx, review map[string]interface{}, patc
 			return
 		}
 		rich["patchset_created_on"] = created
+		rich["patchset_time_since_previous"] = nil
+		if !prevCreated.IsZero() {
+			rich["patchset_time_since_previous"] = float64(created.Sub(prevCreated).Seconds()) / 86400.0
+		}
+		prevCreated = created
 		number := patchSet["number"]
 		rich["patchset_number"] = number
 		rich["patchset_isDraft"], _ = patchSet["isDraft"]
@@ -1828,6 +2354,9 @@ func (j *DSGerrit) EnrichPatchsets(ctx *Ctx, review map[string]interface{}, patc
 				rich["patchset_time_to_first_approval"] = float64(firstApprovalDt.Sub(created).Seconds()) / 86400.0
 			}
 		}
+		for prop, value := range j.LabelMetrics(ctx, []interface{}{patchSet}, created, "patchset_") {
+			rich[prop] = value
+		}
 		rich["type"] = Patchset
 		rich["id"] = reviewID + "_patchset_" + fmt.Sprintf("%v", number)
 		if affs {
@@ -1879,6 +2408,211 @@ func (j *DSGerrit) EnrichPatchsets(ctx *Ctx, review map[string]interface{}, patc
 				}
 			}
 		}
+		var riches []interface{}
+		riches, err = j.EnrichPatchsetFiles(ctx, review, rich, patchSet, affs)
+		if err != nil {
+			return
+		}
+		richItems = append(richItems, riches...)
+		riches, err = j.EnrichInlineComments(ctx, review, rich, patchSet, affs)
+		if err != nil {
+			return
+		}
+		for _, rich := range riches {
+			_, authorIDOK := Dig(rich, []string{"author_id"}, false, true)
+			if !authorIDOK && ctx.CheckAuthorID {
+				continue
+			}
+			richItems = append(richItems, rich)
+		}
+	}
+	return
+}
+
+// InlineComments - return inline (file level) comments of a given patch set
+func (j *DSGerrit) InlineComments(patchSet map[string]interface{}) (comments []map[string]interface{}) {
+	iComments, _ := patchSet["comments"].([]interface{})
+	for _, iComment := range iComments {
+		comment, ok := iComment.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		comments = append(comments, comment)
+	}
+	return
+}
+
+// GerritMagicFile - is file name a gerrit virtual file (like /COMMIT_MSG)?
+func GerritMagicFile(fileName string) bool {
+	_, ok := GerritMagicFiles[fileName]
+	return ok
+}
+
+// EnrichPatchsetFiles - return rich items for files changed in a patch set, with the number of inline comments
+// each file received and flag saying if the file was reviewed - commented by a non-bot other than patch set author
+func (j *DSGerrit) EnrichPatchsetFiles(ctx *Ctx, review, patchSetRich, patchSet map[string]interface{}, affs bool) (richItems []interface{}, err error) {
+	iFiles, ok := patchSet["files"].([]interface{})
+	if !ok || len(iFiles) == 0 {
+		return
+	}
+	patchSetID, _ := patchSetRich["id"].(string)
+	created := patchSetRich["patchset_created_on"]
+	var affsItems map[string]interface{}
+	if affs {
+		dtCreated, ok := created.(time.Time)
+		if !ok {
+			err = fmt.Errorf("cannot determine patch set files date: %+v", created)
+			return
+		}
+		affsItems, err = j.AffsItems(ctx, patchSet, GerritPatchsetRoles, ToYMDTHMSZDate(dtCreated))
+		if err != nil {
+			return
+		}
+	}
+	comments := make(map[string]int)
+	reviewers := make(map[string]int)
+	for _, comment := range j.InlineComments(patchSet) {
+		file, _ := comment["file"].(string)
+		comments[file]++
+		if !j.IsBot(comment["reviewer"]) && !j.SameAccount(comment["reviewer"], patchSet["author"]) {
+			reviewers[file]++
+		}
+	}
+	copyFields := []string{"wip", "open", "url", "summary", "repository", "branch", "changeset_number", "changeset_status", "changeset_status_value", "patchset_number", "patchset_revision", "patchset_ref", "patchset_created_on", "patchset_author_name", "patchset_author_domain", "patchset_uploader_name", "patchset_uploader_domain", "repo_short_name"}
+	for _, iFile := range iFiles {
+		file, ok := iFile.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		fileName, _ := file["file"].(string)
+		if fileName == "" || GerritMagicFile(fileName) {
+			continue
+		}
+		rich := make(map[string]interface{})
+		for _, field := range RawFields {
+			rich[field], _ = patchSetRich[field]
+		}
+		for _, field := range copyFields {
+			rich[field] = patchSetRich[field]
+		}
+		rich["file_name"] = fileName
+		rich["file_ext"] = strings.TrimPrefix(filepath.Ext(fileName), ".")
+		rich["file_dir"] = filepath.Dir(fileName)
+		rich["file_type"], _ = file["type"]
+		insertions, _ := file["insertions"].(float64)
+		deletions, _ := file["deletions"].(float64)
+		rich["file_insertions"] = math.Abs(insertions)
+		rich["file_deletions"] = math.Abs(deletions)
+		rich["file_inline_comments"] = comments[fileName]
+		rich["file_reviewer_comments"] = reviewers[fileName]
+		rich["file_reviewed"] = 0
+		if reviewers[fileName] > 0 {
+			rich["file_reviewed"] = 1
+		}
+		rich["type"] = PatchsetFile
+		rich["id"] = patchSetID + "_file_" + fileName
+		if affs {
+			for prop, value := range affsItems {
+				rich[prop] = value
+			}
+			role := Changeset + "_" + Author
+			CopyAffsRoleData(rich, review, role, role)
+		}
+		for prop, value := range CommonFields(j, created, Review) {
+			rich[prop] = value
+		}
+		for prop, value := range CommonFields(j, created, PatchsetFile) {
+			rich[prop] = value
+		}
+		richItems = append(richItems, rich)
+	}
+	return
+}
+
+// EnrichInlineComments - return rich items for inline (file level) comments of a patch set
+// gerrit query doesn't return inline comment dates, patch set creation date is used then
+func (j *DSGerrit) EnrichInlineComments(ctx *Ctx, review, patchSetRich, patchSet map[string]interface{}, affs bool) (richItems []interface{}, err error) {
+	patchSetID, _ := patchSetRich["id"].(string)
+	copyFields := []string{"wip", "open", "url", "summary", "repository", "branch", "changeset_number", "patchset_number", "patchset_revision", "patchset_created_on", "repo_short_name"}
+	for i, comment := range j.InlineComments(patchSet) {
+		rich := make(map[string]interface{})
+		for _, field := range RawFields {
+			rich[field], _ = patchSetRich[field]
+		}
+		for _, field := range copyFields {
+			rich[field] = patchSetRich[field]
+		}
+		created, ok := comment["timestamp"].(time.Time)
+		if !ok {
+			created, ok = patchSetRich["patchset_created_on"].(time.Time)
+			if !ok {
+				err = fmt.Errorf("cannot determine inline comment date: %+v", comment)
+				return
+			}
+		}
+		rich["inline_comment_created_on"] = created
+		rich["inline_comment_file"], _ = comment["file"]
+		rich["inline_comment_line"], _ = comment["line"]
+		message, _ := comment["message"].(string)
+		rich["inline_comment_message_analyzed"] = message
+		if len(message) > KeywordMaxlength {
+			message = message[:KeywordMaxlength]
+		}
+		rich["inline_comment_message"] = message
+		rich["reviewer_name"] = nil
+		rich["reviewer_domain"] = nil
+		reviewerName, ok := Dig(comment, []string{"reviewer", "name"}, false, true)
+		if ok {
+			rich["reviewer_name"] = reviewerName
+			reviewerEmail, _ := Dig(comment, []string{"reviewer", "email"}, false, true)
+			email, _ := reviewerEmail.(string)
+			ary := strings.Split(email, "@")
+			if len(ary) > 1 {
+				rich["reviewer_domain"] = strings.TrimSpace(ary[1])
+			}
+		}
+		rich["is_bot"] = 0
+		if j.IsBot(comment["reviewer"]) {
+			rich["is_bot"] = 1
+		}
+		rich["type"] = InlineComment
+		id, ok := comment["id"]
+		if ok {
+			rich["id"] = patchSetID + "_inline_comment_" + fmt.Sprintf("%v", id)
+		} else {
+			rich["id"] = patchSetID + "_inline_comment_" + strconv.Itoa(i)
+		}
+		if affs {
+			_, okReviewer := comment["reviewer"]
+			if okReviewer {
+				authorKey := "reviewer"
+				var affsItems map[string]interface{}
+				affsItems, err = j.AffsItems(ctx, comment, GerritCommentRoles, ToYMDTHMSZDate(created))
+				if err != nil {
+					return
+				}
+				for prop, value := range affsItems {
+					rich[prop] = value
+				}
+				for _, suff := range AffsFields {
+					rich[Author+suff] = rich[authorKey+suff]
+				}
+				orgsKey := authorKey + MultiOrgNames
+				_, ok := Dig(rich, []string{orgsKey}, false, true)
+				if !ok {
+					rich[orgsKey] = []interface{}{}
+				}
+			}
+			role := Changeset + "_" + Author
+			CopyAffsRoleData(rich, review, role, role)
+		}
+		for prop, value := range CommonFields(j, created, Review) {
+			rich[prop] = value
+		}
+		for prop, value := range CommonFields(j, created, InlineComment) {
+			rich[prop] = value
+		}
+		richItems = append(richItems, rich)
 	}
 	return
 }
@@ -1944,6 +2678,10 @@ func (j *DSGerrit) EnrichApprovals(ctx *Ctx, review, patchSet map[string]interfa
 			desc = desc[:KeywordMaxlength]
 		}
 		rich["approval_description"] = desc
+		rich["is_bot"] = 0
+		if j.IsBot(approval["by"]) {
+			rich["is_bot"] = 1
+		}
 		rich["type"] = Approval
 		rich["id"] = patchSetID + "_approval_" + fmt.Sprintf("%d.0", created.Unix())
 		rich["changeset_created_on"], _ = review["created_on"]
@@ -1982,7 +2720,7 @@ func (j *DSGerrit) EnrichApprovals(ctx *Ctx, review, patchSet map[string]interfa
 
 // EnrichComments - return rich items from raw patch sets
 func (j *DSGerrit) EnrichComments(ctx *Ctx, review map[string]interface{}, comments []map[string]interface{}, affs bool) (richItems []interface{}, err error) {
-	copyFields := []string{"wip", "open", "url", "summary", "repository", "branch", "changeset_number", "repo_short_name"}
+	copyFields := []string{"wip", "open", "url", "summary", "repository", "branch", "topic", "changeset_number", "repo_short_name"}
 	iReviewID, ok := review["id"]
 	if !ok {
 		err = fmt.Errorf("cannot get id property of review: %+v", review)
@@ -2038,6 +2776,10 @@ func (j *DSGerrit) EnrichComments(ctx *Ctx, review map[string]interface{}, comme
 			message = message[:KeywordMaxlength]
 		}
 		rich["comment_message"] = message
+		rich["is_bot"] = 0
+		if j.IsBot(comment["reviewer"]) {
+			rich["is_bot"] = 1
+		}
 		rich["type"] = Comment
 		rich["id"] = reviewID + "_comment_" + fmt.Sprintf("%d.0", created.Unix())
 		if affs {
@@ -2149,9 +2891,9 @@ func (j *DSGerrit) AllRoles(ctx *Ctx, rich map[string]interface{}) (roles []stri
 	switch tp {
 	case Changeset:
 		possibleRoles = GerritReviewRoles
-	case Comment:
+	case Comment, InlineComment:
 		possibleRoles = GerritCommentRoles
-	case Patchset:
+	case Patchset, PatchsetFile:
 		possibleRoles = []string{"uploader"}
 	case Approval:
 		possibleRoles = GerritApprovalRoles
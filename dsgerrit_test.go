@@ -0,0 +1,331 @@
+package dads
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+func TestGerritIsBot(t *testing.T) {
+	j := &DSGerrit{}
+	var err error
+	j.BotRegexps, err = GerritBotRegexps("")
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	var testCases = []struct {
+		account  interface{}
+		expected bool
+	}{
+		{account: map[string]interface{}{"username": "jenkins"}, expected: true},
+		{account: map[string]interface{}{"username": "onap-jenkins"}, expected: true},
+		{account: map[string]interface{}{"email": "jenkins@example.org"}, expected: true},
+		{account: map[string]interface{}{"name": "ONAP Jobbuilder", "email": "onap-jobbuilder@jenkins.onap.org", "username": "onap-jobbuilder"}, expected: true},
+		{account: map[string]interface{}{"username": "zuul"}, expected: true},
+		{account: map[string]interface{}{"username": "review-bot"}, expected: true},
+		{account: map[string]interface{}{"email": "ci@example.org"}, expected: true},
+		{account: map[string]interface{}{"username": "jenkinson"}, expected: false},
+		{account: map[string]interface{}{"email": "ljenkins@example.org"}, expected: false},
+		{account: map[string]interface{}{"username": "abbot"}, expected: false},
+		{account: map[string]interface{}{"username": "cindy"}, expected: false},
+		{account: map[string]interface{}{"name": "Jenkins"}, expected: false},
+		{account: nil, expected: false},
+	}
+	for index, test := range testCases {
+		got := j.IsBot(test.account)
+		if got != test.expected {
+			t.Errorf("test number %d, expected %+v to be bot: %v, got %v", index+1, test.account, test.expected, got)
+		}
+	}
+	j.BotRegexps, err = GerritBotRegexps("-")
+	if err != nil || j.IsBot(map[string]interface{}{"username": "jenkins"}) {
+		t.Errorf("expected bot detection to be disabled, error: %v", err)
+	}
+	j.BotRegexps, err = GerritBotRegexps("^svc-, robot$")
+	if err != nil || !j.IsBot(map[string]interface{}{"username": "SVC-build"}) || !j.IsBot(map[string]interface{}{"username": "release-robot"}) || j.IsBot(map[string]interface{}{"username": "jenkins"}) {
+		t.Errorf("expected custom patterns to replace default ones, error: %v", err)
+	}
+	_, err = GerritBotRegexps("(")
+	if err == nil {
+		t.Errorf("expected invalid pattern error")
+	}
+}
+
+func TestGerritFirstReviewDatetime(t *testing.T) {
+	ctx := &Ctx{}
+	j := &DSGerrit{}
+	j.BotRegexps, _ = GerritBotRegexps("")
+	created := time.Date(2021, 5, 20, 0, 0, 0, 0, time.UTC)
+	owner := map[string]interface{}{"name": "Owner", "email": "owner@est.tech", "username": "owner"}
+	bot := map[string]interface{}{"name": "ONAP Jobbuilder", "email": "onap-jobbuilder@jenkins.onap.org", "username": "onap-jobbuilder"}
+	reviewer := map[string]interface{}{"name": "Reviewer", "email": "rev@est.tech", "username": "rev"}
+	approval := func(label, value string, by interface{}, grantedOn time.Time) interface{} {
+		return map[string]interface{}{"type": label, "value": value, "by": by, "grantedOn": grantedOn}
+	}
+	var testCases = []struct {
+		approvals []interface{}
+		expected  interface{}
+	}{
+		{approvals: []interface{}{approval("Verified", "1", bot, created.Add(time.Minute))}, expected: nil},
+		{approvals: []interface{}{approval("Verified", "1", bot, created.Add(time.Minute)), approval("Code-Review", "1", bot, created.Add(2*time.Minute))}, expected: nil},
+		{
+			approvals: []interface{}{approval("Verified", "1", bot, created.Add(time.Minute)), approval("Code-Review", "-1", owner, created.Add(2*time.Minute)), approval("Code-Review", "2", reviewer, created.Add(time.Hour))},
+			expected:  created.Add(time.Hour),
+		},
+	}
+	for index, test := range testCases {
+		patchSet := map[string]interface{}{"author": owner, "createdOn": created, "approvals": test.approvals}
+		got := j.FirstReviewDatetime(ctx, map[string]interface{}{"owner": owner, "createdOn": created}, []interface{}{patchSet})
+		if got != test.expected {
+			t.Errorf("test number %d, expected first review %v, got %v", index+1, test.expected, got)
+		}
+		got = j.FirstPatchsetReviewDatetime(ctx, patchSet)
+		if got != test.expected {
+			t.Errorf("test number %d, expected first patch set review %v, got %v", index+1, test.expected, got)
+		}
+	}
+}
+
+func TestGerritLabelMetrics(t *testing.T) {
+	ctx := &Ctx{}
+	j := &DSGerrit{}
+	created := time.Date(2021, 5, 20, 0, 0, 0, 0, time.UTC)
+	day := func(n int) time.Time {
+		return created.AddDate(0, 0, n)
+	}
+	approval := func(label, value string, grantedOn time.Time) interface{} {
+		return map[string]interface{}{"type": label, "value": value, "grantedOn": grantedOn}
+	}
+	var testCases = []struct {
+		patchSets []interface{}
+		expected  map[string]interface{}
+	}{
+		{patchSets: []interface{}{}, expected: map[string]interface{}{}},
+		{
+			patchSets: []interface{}{
+				map[string]interface{}{"approvals": []interface{}{approval("Code-Review", "-1", day(1)), approval("Code-Review", "0", day(1))}},
+			},
+			expected: map[string]interface{}{},
+		},
+		{
+			patchSets: []interface{}{
+				map[string]interface{}{"approvals": []interface{}{approval("Verified", "1", day(2)), approval("Code-Review", "1", day(3))}},
+				map[string]interface{}{"approvals": []interface{}{approval("Verified", "1", day(1)), approval("Code-Review", "2", day(4)), approval(GerritSubmitApprovalType, "1", day(4))}},
+			},
+			expected: map[string]interface{}{
+				"first_verified_plus1_date":       day(1),
+				"time_to_first_verified_plus1":    1.0,
+				"first_code_review_plus1_date":    day(3),
+				"time_to_first_code_review_plus1": 3.0,
+				"first_code_review_plus2_date":    day(4),
+				"time_to_first_code_review_plus2": 4.0,
+			},
+		},
+		{
+			patchSets: []interface{}{
+				map[string]interface{}{"approvals": []interface{}{map[string]interface{}{"type": "Code-Review", "value": "2"}}},
+			},
+			expected: map[string]interface{}{},
+		},
+	}
+	for index, test := range testCases {
+		got := j.LabelMetrics(ctx, test.patchSets, created, "")
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("test number %d, expected %+v, got %+v", index+1, test.expected, got)
+		}
+	}
+	got := j.LabelMetrics(ctx, []interface{}{map[string]interface{}{"approvals": []interface{}{approval("Code-Review", "2", day(2))}}}, created, "patchset_")
+	if got["patchset_first_code_review_plus2_date"] != day(2) || got["patchset_time_to_first_code_review_plus2"] != 2.0 {
+		t.Errorf("unexpected prefixed metrics %+v", got)
+	}
+}
+
+func TestGerritEnrichPatchsetFiles(t *testing.T) {
+	ctx := &Ctx{}
+	j := &DSGerrit{DS: Gerrit}
+	j.BotRegexps, _ = GerritBotRegexps("")
+	created := time.Date(2021, 5, 20, 15, 24, 38, 0, time.UTC)
+	author := map[string]interface{}{"name": "Owner", "email": "owner@est.tech", "username": "owner"}
+	reviewer := map[string]interface{}{"name": "Reviewer", "email": "rev@est.tech", "username": "rev"}
+	bot := map[string]interface{}{"name": "CI", "username": "jenkins"}
+	patchSet := map[string]interface{}{
+		"author":   author,
+		"uploader": reviewer,
+		"files": []interface{}{
+			map[string]interface{}{"file": "/COMMIT_MSG", "type": "ADDED", "insertions": 10.0, "deletions": 0.0},
+			map[string]interface{}{"file": "/MERGE_LIST", "type": "ADDED", "insertions": 4.0, "deletions": 0.0},
+			map[string]interface{}{"file": "src/a.go", "type": "MODIFIED", "insertions": 5.0, "deletions": -2.0},
+			map[string]interface{}{"file": "README", "type": "DELETED", "insertions": 0.0, "deletions": -7.0},
+		},
+		"comments": []interface{}{
+			map[string]interface{}{"file": "src/a.go", "line": 1.0, "reviewer": reviewer, "message": "typo"},
+			map[string]interface{}{"file": "src/a.go", "line": 2.0, "reviewer": author, "message": "done"},
+			map[string]interface{}{"file": "README", "line": 1.0, "reviewer": bot, "message": "lint"},
+			map[string]interface{}{"file": "/COMMIT_MSG", "line": 3.0, "reviewer": reviewer, "message": "wording", "timestamp": created.Add(time.Hour)},
+		},
+	}
+	patchSetRich := map[string]interface{}{
+		"id":                       "r1_patchset_1",
+		"patchset_created_on":      created,
+		"patchset_uploader_name":   "Reviewer",
+		"patchset_uploader_domain": "est.tech",
+	}
+	richItems, err := j.EnrichPatchsetFiles(ctx, map[string]interface{}{}, patchSetRich, patchSet, false)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	var testCases = []struct {
+		id                 string
+		expectedInsertions float64
+		expectedDeletions  float64
+		expectedComments   int
+		expectedReviewed   int
+	}{
+		{id: "r1_patchset_1_file_src/a.go", expectedInsertions: 5.0, expectedDeletions: 2.0, expectedComments: 2, expectedReviewed: 1},
+		{id: "r1_patchset_1_file_README", expectedInsertions: 0.0, expectedDeletions: 7.0, expectedComments: 1, expectedReviewed: 0},
+	}
+	if len(richItems) != len(testCases) {
+		t.Errorf("expected %d file docs (magic files skipped), got %d", len(testCases), len(richItems))
+		return
+	}
+	for index, test := range testCases {
+		rich, _ := richItems[index].(map[string]interface{})
+		if rich["id"] != test.id || rich["file_insertions"] != test.expectedInsertions || rich["file_deletions"] != test.expectedDeletions || rich["file_inline_comments"] != test.expectedComments || rich["file_reviewed"] != test.expectedReviewed {
+			t.Errorf("test number %d, expected %s %v/%v/%d/%d, got %+v", index+1, test.id, test.expectedInsertions, test.expectedDeletions, test.expectedComments, test.expectedReviewed, rich)
+		}
+		if rich["patchset_uploader_name"] != "Reviewer" || rich["patchset_uploader_domain"] != "est.tech" || rich["type"] != PatchsetFile {
+			t.Errorf("test number %d, expected uploader identity and type, got %+v", index+1, rich)
+		}
+	}
+	richItems, err = j.EnrichInlineComments(ctx, map[string]interface{}{}, patchSetRich, patchSet, false)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	if len(richItems) != 4 {
+		t.Errorf("expected 4 inline comments, got %d", len(richItems))
+		return
+	}
+	first, _ := richItems[0].(map[string]interface{})
+	if first["id"] != "r1_patchset_1_inline_comment_0" || first["inline_comment_created_on"] != created || first["reviewer_name"] != "Reviewer" || first["reviewer_domain"] != "est.tech" || first["is_bot"] != 0 {
+		t.Errorf("unexpected first inline comment %+v", first)
+	}
+	third, _ := richItems[2].(map[string]interface{})
+	if third["is_bot"] != 1 || third["reviewer_domain"] != nil {
+		t.Errorf("unexpected bot inline comment %+v", third)
+	}
+	last, _ := richItems[3].(map[string]interface{})
+	if last["inline_comment_created_on"] != created.Add(time.Hour) || last["inline_comment_file"] != "/COMMIT_MSG" {
+		t.Errorf("unexpected timestamped inline comment %+v", last)
+	}
+}
+
+func TestGerritPatchsetMetrics(t *testing.T) {
+	ctx := &Ctx{}
+	j := &DSGerrit{DS: Gerrit}
+	j.BotRegexps, _ = GerritBotRegexps("")
+	// the same change, as returned by SSH query and by REST API, both have 2 patch sets created 322 seconds apart
+	ssh := `{
+		"id":"Iabc","number":121462,"status":"MERGED","createdOn":1621524278,"submitted":1621526400,
+		"owner":{"name":"Owner","email":"owner@est.tech","username":"owner"},
+		"patchSets":[
+			{"number":1,"revision":"aaa","createdOn":1621524278,"kind":"REWORK","author":{"name":"Owner","email":"owner@est.tech","username":"owner"},"sizeInsertions":40,"sizeDeletions":-20},
+			{"number":2,"revision":"bbb","createdOn":1621524600,"kind":"TRIVIAL_REBASE","author":{"name":"Owner","email":"owner@est.tech","username":"owner"},"sizeInsertions":45,"sizeDeletions":-22,
+			 "approvals":[
+				{"type":"Code-Review","description":"Code-Review","value":"2","grantedOn":1621524660,"by":{"name":"Reviewer","username":"rev"}},
+				{"type":"Verified","description":"Verified","value":"1","grantedOn":1621524660,"by":{"name":"CI","username":"ci"}}
+			 ]}
+		]
+	}`
+	rest := `{
+		"project":"sdc","branch":"master","change_id":"Iabc","_number":121462,"status":"MERGED",
+		"created":"2021-05-20 15:24:38.000000000","submitted":"2021-05-20 16:00:00.000000000","insertions":45,"deletions":22,
+		"owner":{"_account_id":1,"name":"Owner","email":"owner@est.tech","username":"owner"},
+		"current_revision":"bbb",
+		"revisions":{
+			"bbb":{"_number":2,"created":"2021-05-20 15:30:00.000000000","kind":"TRIVIAL_REBASE","commit":{"author":{"name":"Owner","email":"owner@est.tech"}}},
+			"aaa":{"_number":1,"created":"2021-05-20 15:24:38.000000000","kind":"REWORK","commit":{"author":{"name":"Owner","email":"owner@est.tech"}},"files":{"/COMMIT_MSG":{"status":"A","lines_inserted":9},"a.go":{"lines_inserted":40,"lines_deleted":20}}}
+		},
+		"labels":{
+			"Code-Review":{"all":[{"_account_id":2,"name":"Reviewer","username":"rev","value":2,"date":"2021-05-20 15:31:00.000000000"}]},
+			"Verified":{"all":[{"_account_id":3,"name":"CI","username":"ci","value":1,"date":"2021-05-20 15:31:00.000000000"}]}
+		}
+	}`
+	var testCases = []struct {
+		source string
+		data   string
+	}{
+		{source: "ssh", data: ssh},
+		{source: "rest", data: rest},
+	}
+	interval := 322.0 / 86400.0
+	expectedMetrics := map[string]interface{}{
+		"patchsets_rework":                 1,
+		"patchsets_trivial_rebase":         1,
+		"total_insertions":                 85.0,
+		"total_deletions":                  42.0,
+		"review_rounds":                    1,
+		"votes_reset_by_rework":            0,
+		"patchsets_avg_interval":           interval,
+		"patchsets_max_interval":           interval,
+		"time_from_last_patchset_to_merge": 1800.0 / 86400.0,
+	}
+	expectedPatchsets := []struct {
+		id                string
+		sincePrevious     interface{}
+		sizeInsertions    float64
+		sizeDeletions     float64
+		timeToFirstReview interface{}
+	}{
+		{id: "Iabc_patchset_1", sincePrevious: nil, sizeInsertions: 40.0, sizeDeletions: -20.0, timeToFirstReview: nil},
+		{id: "Iabc_patchset_2", sincePrevious: interval, sizeInsertions: 45.0, sizeDeletions: -22.0, timeToFirstReview: 60.0 / 86400.0},
+	}
+	for index, test := range testCases {
+		review := map[string]interface{}{}
+		err := jsoniter.Unmarshal([]byte(test.data), &review)
+		if err != nil {
+			t.Errorf("test number %d (%s), unexpected error: %v", index+1, test.source, err)
+			continue
+		}
+		if test.source == "rest" {
+			review = GerritRESTChangeToReview("https://gerrit.onap.org/r", review)
+		}
+		j.ConvertDates(ctx, review)
+		patchSets, _ := review["patchSets"].([]interface{})
+		got := j.PatchsetMetrics(ctx, "MERGED", patchSets, review["submitted"])
+		if !reflect.DeepEqual(got, expectedMetrics) {
+			t.Errorf("test number %d (%s), expected metrics %+v, got %+v", index+1, test.source, expectedMetrics, got)
+		}
+		var patches []map[string]interface{}
+		for _, iPatch := range patchSets {
+			patch, _ := iPatch.(map[string]interface{})
+			patches = append(patches, patch)
+		}
+		richItems, err := j.EnrichPatchsets(ctx, map[string]interface{}{"id": "Iabc"}, patches, false)
+		if err != nil {
+			t.Errorf("test number %d (%s), unexpected error: %v", index+1, test.source, err)
+			continue
+		}
+		var richPatchsets []map[string]interface{}
+		for _, iRich := range richItems {
+			rich, _ := iRich.(map[string]interface{})
+			if rich["type"] == Patchset {
+				richPatchsets = append(richPatchsets, rich)
+			}
+		}
+		if len(richPatchsets) != len(expectedPatchsets) {
+			t.Errorf("test number %d (%s), expected %d patch sets, got %d", index+1, test.source, len(expectedPatchsets), len(richPatchsets))
+			continue
+		}
+		for i, expected := range expectedPatchsets {
+			rich := richPatchsets[i]
+			if rich["id"] != expected.id || rich["patchset_time_since_previous"] != expected.sincePrevious || rich["patchset_sizeInsertions"] != expected.sizeInsertions || rich["patchset_sizeDeletions"] != expected.sizeDeletions || rich["patchset_time_to_first_review"] != expected.timeToFirstReview {
+				t.Errorf("test number %d (%s), patch set %d, expected %+v, got %+v", index+1, test.source, i+1, expected, rich)
+			}
+		}
+	}
+}
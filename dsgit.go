@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math"
 	"net/url"
 	"os"
@@ -23,6 +24,12 @@ const (
 	GitBackendVersion = "0.1.1"
 	// GitDefaultReposPath - default path where git repository clones
 	GitDefaultReposPath = "$HOME/.perceval/repositories"
+	// GitCloneFull - clone strategy: full bare clone
+	GitCloneFull = "full"
+	// GitClonePartial - clone strategy: partial clone without blobs, only commits metadata is parsed (no files stats)
+	GitClonePartial = "partial"
+	// GitCloneShallow - clone strategy: shallow clone/fetch bounded by date from (full clone when date from is not set)
+	GitCloneShallow = "shallow"
 	// GitDefaultCachePath - default path where gitops cache files are stored
 	GitDefaultCachePath = "$HOME/.perceval/cache"
 	// GitOpsCommand - command that maintains git stats cache
@@ -30,10 +37,14 @@ const (
 	GitOpsCommand = "gitops"
 	// GitOpsFailureFatal - is GitOpsCommand failure fatal?
 	GitOpsFailureFatal = false
-	// OrphanedCommitsCommand - command to list orphaned commits
-	OrphanedCommitsCommand = "detect-removed-commits.sh"
-	// OrphanedCommitsFailureFatal - is OrphanedCommitsCommand failure fatal?
+	// OrphanedCommitsFailureFatal - is orphaned commits detection failure fatal?
 	OrphanedCommitsFailureFatal = true
+	// OrphanedReasonUnreachable - commit present in object storage but not reachable from any ref
+	OrphanedReasonUnreachable = "unreachable"
+	// OrphanedReasonHistoryRewrite - commit removed from a branch by a non-fast-forward update
+	OrphanedReasonHistoryRewrite = "history_rewrite"
+	// GitHistoryRewrite - type of history rewrite event documents
+	GitHistoryRewrite = "history_rewrite"
 	// GitOpsNoCleanup - if set, it will skip gitops repo cleanup
 	GitOpsNoCleanup = false
 	// GitParseStateInit - init parser state
@@ -58,6 +69,10 @@ const (
 	GitMaxCommitProperties = 300
 	// GitGenerateFlatDocs - do we want to generate flat commit co-authors docs, like docs with type: commit_co_author, commit_signer etc.?
 	GitGenerateFlatDocs = true
+	// GitSignaturesFailureFatal - is failure to get commit signatures fatal?
+	GitSignaturesFailureFatal = false
+	// GitDCOSummary - type of per-origin DCO compliance summary documents
+	GitDCOSummary = "dco_summary"
 )
 
 var (
@@ -82,6 +97,28 @@ var (
 		"-C",              //detect and report copies
 		"-c",              //show merge info
 	}
+	// GitSignatureFormat - git log format used to get commits signatures data: SHA, status, key ID, signer, fingerprint
+	GitSignatureFormat = "--format=%H%x1f%G?%x1f%GK%x1f%GS%x1f%GF"
+	// GitSignatureStatuses - git signature status codes (%G?), "N" means no signature
+	GitSignatureStatuses = map[string]string{
+		"G": "good",
+		"B": "bad",
+		"U": "good_unknown_validity",
+		"X": "good_expired",
+		"Y": "good_expired_key",
+		"R": "good_revoked_key",
+		"E": "cannot_check",
+	}
+	// GitValidSignatureStatuses - signature statuses (%G?) that verified correctly, only these count as signed commits
+	GitValidSignatureStatuses = map[string]struct{}{"G": {}, "U": {}, "X": {}, "Y": {}, "R": {}}
+	// GitMetadataLogOptions - git log options used for partial clones, they don't need blobs to be fetched
+	GitMetadataLogOptions = []string{
+		"--pretty=fuller", // pretty output
+		"--decorate=full", // show full refs
+		"--parents",       //show parents information
+	}
+	// GitCloneStrategies - allowed clone strategies
+	GitCloneStrategies = map[string]struct{}{GitCloneFull: {}, GitClonePartial: {}, GitCloneShallow: {}}
 	// GitCommitPattern - pattern to match a commit
 	GitCommitPattern = regexp.MustCompile(`^commit[ \t](?P<commit>[a-f0-9]{40})(?:[ \t](?P<parents>[a-f0-9][a-f0-9 \t]+))?(?:[ \t]\((?P<refs>.+)\))?$`)
 	// GitHeaderPattern - pattern to match a commit
@@ -517,8 +554,12 @@ type DSGit struct {
 	CachePath       string // From DA_GIT_CACHE_PATH - default GitDefaultCachePath
 	NoSSLVerify     bool   // From DA_GIT_NO_SSL_VERIFY
 	PairProgramming bool   // From DA_GIT_PAIR_PROGRAMMING
+	TrailerPolicy   string // From DA_GIT_TRAILER_POLICY - path to trailer policy JSON file, if not set compiled GitAllowedTrailers table is used
+	CloneStrategy   string // From DA_GIT_CLONE_STRATEGY - full (default), partial or shallow (history since date from, orphaned commits and history rewrites are only detected within it)
+	ReposMaxSize    int64  // From DA_GIT_REPOS_MAX_SIZE - evict least recently used clones when ReposPath is bigger than this, for example 50G, default 0 - no limit
 	// Non-config variables
 	RepoName        string                            // repo name
+	Trailers        *GitTrailersPolicy                // effective commit trailers policy
 	Loc             int                               // lines of code as reported by GitOpsCommand
 	Pls             []PLS                             // programming language suppary as reported by GitOpsCommand
 	GitPath         string                            // path to git repo clone
@@ -529,6 +570,11 @@ type DSGit struct {
 	CommitFiles     map[string]map[string]interface{} // current commit's files
 	RecentLines     []string                          // recent commit lines
 	OrphanedCommits []string                          // orphaned commits SHAs
+	OrphanedReasons map[string]string                 // orphaned commit SHA -> reason (only set for commits orphaned by history rewrites)
+	HistoryRewrites []map[string]interface{}          // non-fast-forward branch updates detected in UpdateGitRepo
+	HeadsPath       string                            // path to file storing previous per-branch head SHAs
+	BranchHeads     map[string]string                 // per-branch head SHAs fetched in this run, saved once history rewrites are stored
+	Signatures      map[string]map[string]interface{} // signed commits SHAs -> signature data
 }
 
 // ParseArgs - parse git specific environment variables
@@ -538,6 +584,17 @@ func (j *DSGit) ParseArgs(ctx *Ctx) (err error) {
 	j.URL = os.Getenv(prefix + "URL")
 	j.SingleOrigin = StringToBool(os.Getenv(prefix + "SINGLE_ORIGIN"))
 	j.PairProgramming = StringToBool(os.Getenv(prefix + "PAIR_PROGRAMMING"))
+	j.TrailerPolicy = os.Getenv(prefix + "TRAILER_POLICY")
+	j.CloneStrategy = os.Getenv(prefix + "CLONE_STRATEGY")
+	if j.CloneStrategy == "" {
+		j.CloneStrategy = GitCloneFull
+	}
+	if os.Getenv(prefix+"REPOS_MAX_SIZE") != "" {
+		j.ReposMaxSize, err = ParseByteSize(os.Getenv(prefix + "REPOS_MAX_SIZE"))
+		if err != nil {
+			return
+		}
+	}
 	if os.Getenv(prefix+"REPOS_PATH") != "" {
 		j.ReposPath = os.Getenv(prefix + "REPOS_PATH")
 	} else {
@@ -575,6 +632,12 @@ func (j *DSGit) Validate(ctx *Ctx) (err error) {
 	if strings.HasSuffix(j.CachePath, "/") {
 		j.CachePath = j.CachePath[:len(j.CachePath)-1]
 	}
+	_, ok := GitCloneStrategies[j.CloneStrategy]
+	if !ok {
+		err = fmt.Errorf("unknown clone strategy %s", j.CloneStrategy)
+		return
+	}
+	j.Trailers, err = LoadGitTrailersPolicy(ctx, os.ExpandEnv(j.TrailerPolicy))
 	return
 }
 
@@ -624,7 +687,7 @@ func (j *DSGit) GetOrphanedCommits(ctx *Ctx, thrN int) (ch chan error, err error
 			sout string
 			serr string
 		)
-		cmdLine := []string{OrphanedCommitsCommand}
+		cmdLine := []string{"git", "rev-list", "--all", "--remotes"}
 		sout, serr, e = ExecCommand(ctx, cmdLine, j.GitPath, GitDefaultEnv)
 		if e != nil {
 			if OrphanedCommitsFailureFatal {
@@ -635,13 +698,56 @@ func (j *DSGit) GetOrphanedCommits(ctx *Ctx, thrN int) (ch chan error, err error
 			}
 			return
 		}
-		ary := strings.Split(sout, " ")
-		for _, sha := range ary {
+		reachable := make(map[string]struct{})
+		for _, sha := range strings.Split(sout, "\n") {
 			sha = strings.TrimSpace(sha)
-			if sha == "" {
+			if sha != "" {
+				reachable[sha] = struct{}{}
+			}
+		}
+		if len(reachable) == 0 {
+			Printf("no commits found, skipping orphaned commits detection\n")
+			return
+		}
+		cmdLine = []string{"git", "cat-file", "--unordered", "--batch-all-objects", "--buffer", "--batch-check"}
+		var (
+			pipe io.ReadCloser
+			cmd  *exec.Cmd
+		)
+		pipe, cmd, e = ExecCommandPipe(ctx, cmdLine, j.GitPath, GitDefaultEnv)
+		if e != nil {
+			if OrphanedCommitsFailureFatal {
+				Printf("error executing %v: %v\n", cmdLine, e)
+			} else {
+				Printf("WARNING: error executing %v: %v\n", cmdLine, e)
+				e = nil
+			}
+			return
+		}
+		scanner := bufio.NewScanner(pipe)
+		for scanner.Scan() {
+			// <sha> <type> <size>
+			ary := strings.Fields(scanner.Text())
+			if len(ary) < 2 || ary[1] != Commit {
 				continue
 			}
-			j.OrphanedCommits = append(j.OrphanedCommits, sha)
+			_, ok := reachable[ary[0]]
+			if !ok {
+				j.OrphanedCommits = append(j.OrphanedCommits, ary[0])
+			}
+		}
+		e = scanner.Err()
+		if e == nil {
+			e = cmd.Wait()
+		}
+		if e != nil {
+			if OrphanedCommitsFailureFatal {
+				Printf("error executing %v: %v\n", cmdLine, e)
+			} else {
+				Printf("WARNING: error executing %v: %v\n", cmdLine, e)
+				e = nil
+			}
+			return
 		}
 		Printf("found %d orphaned commits\n", len(j.OrphanedCommits))
 		if ctx.Debug > 1 {
@@ -657,6 +763,72 @@ func (j *DSGit) GetOrphanedCommits(ctx *Ctx, thrN int) (ch chan error, err error
 	return ch, nil
 }
 
+// GetCommitSignatures - return GPG/SSH signature data for all signed commits
+// commits without signature are not stored
+func (j *DSGit) GetCommitSignatures(ctx *Ctx, thrN int) (ch chan error, err error) {
+	worker := func(c chan error) (e error) {
+		Printf("getting commits signatures\n")
+		defer func() {
+			if c != nil {
+				c <- e
+			}
+		}()
+		var (
+			sout string
+			serr string
+		)
+		cmdLine := []string{"git", "log", "--branches", "--tags", "--remotes=origin", GitSignatureFormat}
+		if ctx.DateFrom != nil {
+			cmdLine = append(cmdLine, "--since="+ToYMDHMSDate(*ctx.DateFrom))
+		}
+		if ctx.DateTo != nil {
+			cmdLine = append(cmdLine, "--until="+ToYMDHMSDate(*ctx.DateTo))
+		}
+		sout, serr, e = ExecCommand(ctx, cmdLine, j.GitPath, GitDefaultEnv)
+		if e != nil {
+			if GitSignaturesFailureFatal {
+				Printf("error executing %v: %v\n%s\n%s\n", cmdLine, e, sout, serr)
+			} else {
+				Printf("WARNING: error executing %v: %v\n%s\n%s\n", cmdLine, e, sout, serr)
+				e = nil
+			}
+			return
+		}
+		j.Signatures = ParseGitSignatures(sout)
+		Printf("found %d signed commits\n", len(j.Signatures))
+		return
+	}
+	if thrN <= 1 {
+		return nil, worker(nil)
+	}
+	ch = make(chan error)
+	go func() { _ = worker(ch) }()
+	return ch, nil
+}
+
+// ParseGitSignatures - parse git log output in GitSignatureFormat, return SHA -> signature data for signed commits only
+func ParseGitSignatures(sout string) (sigs map[string]map[string]interface{}) {
+	sigs = make(map[string]map[string]interface{})
+	for _, line := range strings.Split(sout, "\n") {
+		ary := strings.Split(line, "\x1f")
+		if len(ary) < 5 {
+			continue
+		}
+		status := strings.TrimSpace(ary[1])
+		_, ok := GitSignatureStatuses[status]
+		if !ok {
+			continue
+		}
+		sigs[strings.TrimSpace(ary[0])] = map[string]interface{}{
+			"status":      status,
+			"key_id":      strings.TrimSpace(ary[2]),
+			"signer":      strings.TrimSpace(ary[3]),
+			"fingerprint": strings.TrimSpace(ary[4]),
+		}
+	}
+	return
+}
+
 // GetGitOps - LOC, lang summary stats
 func (j *DSGit) GetGitOps(ctx *Ctx, thrN int) (ch chan error, err error) {
 	worker := func(c chan error, url string) (e error) {
@@ -742,7 +914,9 @@ func (j *DSGit) CreateGitRepo(ctx *Ctx) (err error) {
 		if ctx.Debug > 0 {
 			Printf("cloning %s to %s\n", j.URL, j.GitPath)
 		}
-		cmdLine := []string{"git", "clone", "--bare", j.URL, j.GitPath}
+		cmdLine := []string{"git", "clone", "--bare"}
+		cmdLine = append(cmdLine, j.CloneOptions(ctx)...)
+		cmdLine = append(cmdLine, j.URL, j.GitPath)
 		env := map[string]string{"LANG": "C"}
 		var sout, serr string
 		sout, serr, err = ExecCommand(ctx, cmdLine, "", env)
@@ -766,11 +940,34 @@ func (j *DSGit) CreateGitRepo(ctx *Ctx) (err error) {
 	return
 }
 
-// UpdateGitRepo - update git repo
+// CloneOptions - additional git clone options for the configured clone strategy
+func (j *DSGit) CloneOptions(ctx *Ctx) (opts []string) {
+	switch j.CloneStrategy {
+	case GitClonePartial:
+		opts = []string{"--filter=blob:none"}
+	case GitCloneShallow:
+		// --shallow-since implies --single-branch, other branches are needed for commits and history rewrites detection
+		if ctx.DateFrom != nil {
+			opts = []string{"--shallow-since=" + ToYMDHMSDate(*ctx.DateFrom), "--no-single-branch"}
+		}
+	}
+	return
+}
+
+// UpdateGitRepo - update git repo, detect non-fast-forward branch updates
 func (j *DSGit) UpdateGitRepo(ctx *Ctx) (err error) {
 	if ctx.Debug > 0 {
 		Printf("updating repo %s\n", j.URL)
 	}
+	prevHeads, ok := j.LoadBranchHeads(ctx)
+	if !ok {
+		prevHeads, err = j.GetBranchHeads(ctx)
+		if err != nil {
+			return
+		}
+	}
+	// No depth options here: --shallow-since with the (auto-detected) date from would shorten an existing shallow clone on every run
+	// plain fetch keeps the clone's shallow boundary and only adds new commits
 	cmdLine := []string{"git", "fetch", "origin", "+refs/heads/*:refs/heads/*", "--prune"}
 	var sout, serr string
 	sout, serr, err = ExecCommand(ctx, cmdLine, j.GitPath, GitDefaultEnv)
@@ -781,6 +978,148 @@ func (j *DSGit) UpdateGitRepo(ctx *Ctx) (err error) {
 	if ctx.Debug > 0 {
 		Printf("updated repo %s\n", j.URL)
 	}
+	heads, err := j.GetBranchHeads(ctx)
+	if err != nil {
+		return
+	}
+	err = j.DetectHistoryRewrites(ctx, prevHeads, heads)
+	if err != nil {
+		return
+	}
+	// heads are saved after history rewrite events are stored (see StoreHistoryRewrites), otherwise a failed run would lose them
+	j.BranchHeads = heads
+	return
+}
+
+// IsShallow - is the local clone shallow (its history is bounded by clone depth)
+func (j *DSGit) IsShallow(ctx *Ctx) bool {
+	cmdLine := []string{"git", "rev-parse", "--is-shallow-repository"}
+	sout, serr, err := ExecCommand(ctx, cmdLine, j.GitPath, GitDefaultEnv)
+	if err != nil {
+		Printf("WARNING: error executing %v: %v\n%s\n%s\n", cmdLine, err, sout, serr)
+		return false
+	}
+	return strings.TrimSpace(sout) == "true"
+}
+
+// GetBranchHeads - return current branch -> head SHA map from the local clone
+func (j *DSGit) GetBranchHeads(ctx *Ctx) (heads map[string]string, err error) {
+	cmdLine := []string{"git", "for-each-ref", "--format=%(refname) %(objectname)", "refs/heads/"}
+	var sout, serr string
+	sout, serr, err = ExecCommand(ctx, cmdLine, j.GitPath, GitDefaultEnv)
+	if err != nil {
+		Printf("error executing %v: %v\n%s\n%s\n", cmdLine, err, sout, serr)
+		return
+	}
+	heads = make(map[string]string)
+	for _, line := range strings.Split(sout, "\n") {
+		ary := strings.Fields(line)
+		if len(ary) != 2 {
+			continue
+		}
+		heads[strings.TrimPrefix(ary[0], "refs/heads/")] = ary[1]
+	}
+	return
+}
+
+// LoadBranchHeads - load branch heads saved by the previous run, ok is false when there is no saved state
+func (j *DSGit) LoadBranchHeads(ctx *Ctx) (heads map[string]string, ok bool) {
+	if j.HeadsPath == "" {
+		return
+	}
+	data, err := ioutil.ReadFile(j.HeadsPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			Printf("WARNING: cannot read branch heads from %s: %v\n", j.HeadsPath, err)
+		}
+		return
+	}
+	err = jsoniter.Unmarshal(data, &heads)
+	if err != nil {
+		Printf("WARNING: cannot parse branch heads from %s: %v\n", j.HeadsPath, err)
+		return
+	}
+	ok = true
+	return
+}
+
+// SaveBranchHeads - save current branch heads, so the next run can detect non-fast-forward updates
+func (j *DSGit) SaveBranchHeads(ctx *Ctx, heads map[string]string) (err error) {
+	if j.HeadsPath == "" || ctx.DryRun {
+		return
+	}
+	var data []byte
+	data, err = jsoniter.Marshal(heads)
+	if err != nil {
+		return
+	}
+	err = ioutil.WriteFile(j.HeadsPath, data, 0644)
+	if err != nil {
+		Printf("error saving branch heads to %s: %v\n", j.HeadsPath, err)
+	}
+	return
+}
+
+// DetectHistoryRewrites - compare previous and current branch heads, record non-fast-forward updates
+// and commits that are no longer reachable because of them
+func (j *DSGit) DetectHistoryRewrites(ctx *Ctx, prevHeads, heads map[string]string) (err error) {
+	detectedAt := time.Now()
+	branches := []string{}
+	for branch := range prevHeads {
+		branches = append(branches, branch)
+	}
+	sort.Strings(branches)
+	for _, branch := range branches {
+		oldHead := prevHeads[branch]
+		newHead, ok := heads[branch]
+		if !ok || newHead == oldHead {
+			continue
+		}
+		var sout, serr string
+		cmdLine := []string{"git", "merge-base", "--is-ancestor", oldHead, newHead}
+		sout, serr, err = ExecCommand(ctx, cmdLine, j.GitPath, GitDefaultEnv)
+		if err == nil {
+			continue
+		}
+		exitErr, ok := err.(*exec.ExitError)
+		oldHeadMissing := !ok || exitErr.ExitCode() != 1
+		if oldHeadMissing && ctx.Debug > 0 {
+			Printf("cannot check %s..%s on %s: %v\n%s\n%s\n", oldHead, newHead, branch, err, sout, serr)
+		}
+		err = nil
+		orphaned := []string{}
+		if !oldHeadMissing {
+			cmdLine = []string{"git", "rev-list", oldHead, "--not", "--branches", "--tags"}
+			sout, serr, err = ExecCommand(ctx, cmdLine, j.GitPath, GitDefaultEnv)
+			if err != nil {
+				Printf("error executing %v: %v\n%s\n%s\n", cmdLine, err, sout, serr)
+				return
+			}
+			for _, sha := range strings.Split(sout, "\n") {
+				sha = strings.TrimSpace(sha)
+				if sha == "" {
+					continue
+				}
+				orphaned = append(orphaned, sha)
+				if j.OrphanedReasons == nil {
+					j.OrphanedReasons = make(map[string]string)
+				}
+				j.OrphanedReasons[sha] = OrphanedReasonHistoryRewrite
+			}
+		}
+		Printf("history rewrite detected on %s branch %s: %s -> %s, %d orphaned commits\n", j.URL, branch, oldHead, newHead, len(orphaned))
+		j.HistoryRewrites = append(
+			j.HistoryRewrites,
+			map[string]interface{}{
+				"branch":           branch,
+				"old_head":         oldHead,
+				"new_head":         newHead,
+				"old_head_missing": oldHeadMissing,
+				"orphaned_commits": len(orphaned),
+				"detected_at":      detectedAt,
+			},
+		)
+	}
 	return
 }
 
@@ -790,7 +1129,11 @@ func (j *DSGit) ParseGitLog(ctx *Ctx) (cmd *exec.Cmd, err error) {
 		Printf("parsing logs from %s\n", j.GitPath)
 	}
 	cmdLine := []string{"git", "log", "--reverse", "--topo-order", "--branches", "--tags", "--remotes=origin"}
-	cmdLine = append(cmdLine, GitLogOptions...)
+	if j.CloneStrategy == GitClonePartial {
+		cmdLine = append(cmdLine, GitMetadataLogOptions...)
+	} else {
+		cmdLine = append(cmdLine, GitLogOptions...)
+	}
 	if ctx.DateFrom != nil {
 		cmdLine = append(cmdLine, "--since="+ToYMDHMSDate(*ctx.DateFrom))
 	}
@@ -1058,10 +1401,10 @@ func (j *DSGit) ParseTrailer(ctx *Ctx, line string) {
 	}
 	oTrailer := m["name"]
 	lTrailer := strings.ToLower(oTrailer)
-	trailers, ok := GitAllowedTrailers[lTrailer]
+	trailers, ok := j.TrailersPolicy().TrailerRoles(oTrailer)
 	if !ok {
 		if ctx.Debug > 1 {
-			Printf("Trailer %s/%s not in the allowed list %v, skipping\n", oTrailer, lTrailer, GitAllowedTrailers)
+			Printf("Trailer %s/%s not allowed by the trailers policy, skipping\n", oTrailer, lTrailer)
 		}
 		return
 	}
@@ -1213,7 +1556,9 @@ func (j *DSGit) FetchItems(ctx *Ctx) (err error) {
 		eschaMtx      *sync.Mutex
 		goch          chan error
 		occh          chan error
+		sgch          chan error
 		waitLOCMtx    *sync.Mutex
+		waitSigsMtx   *sync.Mutex
 	)
 	thrN := GetThreadsNum(ctx)
 	_, gitOpsOnly := os.LookupEnv("DA_GIT_GITOPS_ONLY")
@@ -1238,6 +1583,7 @@ func (j *DSGit) FetchItems(ctx *Ctx) (err error) {
 		allCommitsMtx = &sync.Mutex{}
 		eschaMtx = &sync.Mutex{}
 		waitLOCMtx = &sync.Mutex{}
+		waitSigsMtx = &sync.Mutex{}
 		goch, _ = j.GetGitOps(ctx, thrN)
 	} else {
 		_, err = j.GetGitOps(ctx, thrN)
@@ -1252,15 +1598,40 @@ func (j *DSGit) FetchItems(ctx *Ctx) (err error) {
 	if ctx.Debug > 0 {
 		Printf("path to store git repository: %s\n", j.GitPath)
 	}
-	FatalOnError(j.CreateGitRepo(ctx))
-	FatalOnError(j.UpdateGitRepo(ctx))
+	j.HeadsPath, err = EnsurePath(j.CachePath+"/"+j.URL+"-heads.json", true)
+	FatalOnError(err)
+	err = LockGitRepo(ctx, j.GitPath)
+	if err != nil {
+		return
+	}
+	defer func() {
+		UnlockGitRepo(ctx, j.GitPath)
+	}()
+	err = EvictGitRepos(ctx, j.ReposPath, j.ReposMaxSize, j.GitPath)
+	if err != nil {
+		Printf("WARNING: error evicting git clones from %s: %v\n", j.ReposPath, err)
+		err = nil
+	}
+	err = j.CreateGitRepo(ctx)
+	if err != nil {
+		return
+	}
+	err = j.UpdateGitRepo(ctx)
+	if err != nil {
+		return
+	}
 	if thrN > 1 {
 		occh, _ = j.GetOrphanedCommits(ctx, thrN)
+		sgch, _ = j.GetCommitSignatures(ctx, thrN)
 	} else {
 		_, err = j.GetOrphanedCommits(ctx, thrN)
 		if err != nil {
 			return
 		}
+		_, err = j.GetCommitSignatures(ctx, thrN)
+		if err != nil {
+			return
+		}
 	}
 	var cmd *exec.Cmd
 	cmd, err = j.ParseGitLog(ctx)
@@ -1290,6 +1661,26 @@ func (j *DSGit) FetchItems(ctx *Ctx) (err error) {
 		waitLOCMtx.Unlock()
 		return
 	}
+	var sigsErr error
+	sigsFinished := false
+	waitForSigs := func() (e error) {
+		if thrN <= 1 {
+			sigsFinished = true
+			return
+		}
+		waitSigsMtx.Lock()
+		// signatures worker sends its result only once, so other waiters must get the stored error
+		if !sigsFinished {
+			if ctx.Debug > 0 {
+				Printf("waiting for commits signatures\n")
+			}
+			sigsErr = <-sgch
+			sigsFinished = true
+		}
+		e = sigsErr
+		waitSigsMtx.Unlock()
+		return
+	}
 	processCommit := func(c chan error, commit map[string]interface{}) (wch chan error, e error) {
 		defer func() {
 			if c != nil {
@@ -1306,6 +1697,14 @@ func (j *DSGit) FetchItems(ctx *Ctx) (err error) {
 		}
 		commit["total_lines_of_code"] = j.Loc
 		commit["program_language_summary"] = j.Pls
+		e = waitForSigs()
+		if e != nil {
+			return
+		}
+		sig, signed := j.Signatures[j.ItemID(commit)]
+		if signed {
+			commit["signature"] = sig
+		}
 		esItem["data"] = commit
 		if allCommitsMtx != nil {
 			allCommitsMtx.Lock()
@@ -1452,9 +1851,19 @@ func (j *DSGit) FetchItems(ctx *Ctx) (err error) {
 			}
 		}()
 	}
+	if thrN > 1 {
+		err = waitForSigs()
+		if err != nil {
+			return
+		}
+	}
 	if thrN > 1 {
 		err = <-occh
+		if err != nil {
+			return
+		}
 	}
+	err = j.StoreHistoryRewrites(ctx)
 	return
 }
 
@@ -1588,9 +1997,31 @@ func (j *DSGit) ElasticRawMapping() []byte {
 
 // ElasticRichMapping - Rich index mapping definition
 func (j *DSGit) ElasticRichMapping() []byte {
+	if j.Trailers != nil {
+		return j.Trailers.RichMapping(GitRichMapping)
+	}
 	return GitRichMapping
 }
 
+// TrailersPolicy - return loaded trailers policy, compiled defaults when it was not loaded (no Validate call)
+func (j *DSGit) TrailersPolicy() *GitTrailersPolicy {
+	if j.Trailers != nil {
+		return j.Trailers
+	}
+	return DefaultGitTrailersPolicy()
+}
+
+// TrailersNeedAffs - do any of given trailer roles ([rich key, author] pairs) need affiliations data?
+func (j *DSGit) TrailersNeedAffs(roles map[[2]string]struct{}) bool {
+	for _, role := range j.TrailersPolicy().Roles {
+		_, ok := roles[[2]string{role.RichKey, role.Author}]
+		if ok && role.Affiliations {
+			return true
+		}
+	}
+	return false
+}
+
 // GetAuthors - parse multiple authors used in pair programming mode
 func (j *DSGit) GetAuthors(ctx *Ctx, m map[string]string, n map[string][]string) (authors map[string]struct{}, author string) {
 	if ctx.Debug > 1 {
@@ -1731,7 +2162,7 @@ func (j *DSGit) GetAuthorsData(ctx *Ctx, doc interface{}, auth string) (authorsM
 
 // GetOtherPPAuthors - get others authors - possible from fields: Signed-off-by and/or Co-authored-by
 func (j *DSGit) GetOtherPPAuthors(ctx *Ctx, doc interface{}) (othersMap map[string]map[string]struct{}) {
-	for otherKey := range GitTrailerPPAuthors {
+	for otherKey := range j.TrailersPolicy().PPAuthors {
 		iothers, ok := Dig(doc, []string{"data", otherKey}, false, true)
 		if ok {
 			others, _ := iothers.([]interface{})
@@ -1759,10 +2190,11 @@ func (j *DSGit) GetOtherPPAuthors(ctx *Ctx, doc interface{}) (othersMap map[stri
 func (j *DSGit) GetOtherTrailersAuthors(ctx *Ctx, doc interface{}) (othersMap map[string]map[[2]string]struct{}) {
 	// "Signed-off-by":  {"authors_signed", "signer"},
 	commitAuthor := ""
-	for otherKey, otherRichKey := range GitTrailerOtherAuthors {
+	for otherKey, role := range j.TrailersPolicy().Roles {
+		otherRichKey := [2]string{role.RichKey, role.Author}
 		iothers, ok := Dig(doc, []string{"data", otherKey}, false, true)
 		if ok {
-			sameAsAuthorAllowed, _ := GitTrailerSameAsAuthor[otherKey]
+			sameAsAuthorAllowed := role.SameAsAuthor
 			if !sameAsAuthorAllowed {
 				if commitAuthor == "" {
 					iCommitAuthor, _ := Dig(doc, []string{"data", "Author"}, true, false)
@@ -1880,12 +2312,19 @@ func GitEnrichItemsFunc(ctx *Ctx, ds DS, thrN int, items []interface{}, docs *[]
 					if auth == firstAuthor {
 						continue
 					}
-					_, signedOff := authTypes["Signed-off-by"]
+					signedOff, coAuthored := false, false
+					for authType := range authTypes {
+						switch git.TrailersPolicy().PPAuthors[authType] {
+						case "authors_signed_off":
+							signedOff = true
+						case "co_authors":
+							coAuthored = true
+						}
+					}
 					if signedOff {
 						hasSigners = true
 						signers = append(signers, auth)
 					}
-					_, coAuthored := authTypes["Co-authored-by"]
 					if coAuthored {
 						hasCoAuthors = true
 						coAuthors = append(coAuthors, auth)
@@ -2168,43 +2607,69 @@ func (j *DSGit) EnrichItems(ctx *Ctx) (err error) {
 		return
 	}
 	err = j.MarkOrphanedCommits(ctx)
+	if err != nil {
+		return
+	}
+	err = j.DCOSummary(ctx)
 	return
 }
 
-// MarkOrphanedCommits - mark all orphaned commits as "orphaned: true"
+// OrphanedCommitsByReason - group orphaned commits by the reason they were orphaned
+func (j *DSGit) OrphanedCommitsByReason() (byReason map[string][]string) {
+	byReason = make(map[string][]string)
+	for _, sha := range j.OrphanedCommits {
+		reason, ok := j.OrphanedReasons[sha]
+		if !ok {
+			reason = OrphanedReasonUnreachable
+		}
+		byReason[reason] = append(byReason[reason], sha)
+	}
+	return
+}
+
+// MarkOrphanedCommits - mark all orphaned commits as "orphaned: true", record when and why they were orphaned
 func (j *DSGit) MarkOrphanedCommits(ctx *Ctx) (err error) {
 	nOrphanedCommits := len(j.OrphanedCommits)
 	if nOrphanedCommits == 0 {
 		return
 	}
+	byReason := j.OrphanedCommitsByReason()
 	packSize := ctx.ESBulkSize
-	nPacks := nOrphanedCommits / packSize
-	if nOrphanedCommits%packSize != 0 {
-		nPacks++
+	type packType struct {
+		reason string
+		shas   string
 	}
-	packs := []string{}
-	for i := 0; i < nPacks; i++ {
-		from := i * packSize
-		to := from + packSize
-		if to > nOrphanedCommits {
-			to = nOrphanedCommits
+	packs := []packType{}
+	for reason, shas := range byReason {
+		nShas := len(shas)
+		nPacks := nShas / packSize
+		if nShas%packSize != 0 {
+			nPacks++
 		}
-		s := "["
-		for k := from; k < to; k++ {
-			s += `"` + j.OrphanedCommits[k] + `",`
-		}
-		if s != "[" {
-			s = s[:len(s)-1] + "]"
-			packs = append(packs, s)
+		for i := 0; i < nPacks; i++ {
+			from := i * packSize
+			to := from + packSize
+			if to > nShas {
+				to = nShas
+			}
+			s := "["
+			for k := from; k < to; k++ {
+				s += `"` + shas[k] + `",`
+			}
+			if s != "[" {
+				s = s[:len(s)-1] + "]"
+				packs = append(packs, packType{reason: reason, shas: s})
+			}
 		}
 	}
 	url := ctx.ESURL + "/" + ctx.RichIndex + "/_update_by_query?conflicts=proceed&refresh=true&timeout=20m"
 	method := Post
+	orphanedAt := ToESDate(time.Now())
 	Printf("updating %d orphaned commits in %d packs\n", nOrphanedCommits, len(packs))
 	for _, pack := range packs {
 		// payload := []byte(`{"script":{"inline":"ctx._source.orphaned=true;"},"query":{"terms":{"hash":` + pack + `}}}`)
 		// payload := []byte(`{"script":{"inline":"if(!ctx._source.containsKey(\"orphaned\")){ctx._source.orphaned=true;}"},"query":{"terms":{"hash":` + pack + `}}}`)
-		payload := []byte(`{"script":{"inline":"ctx._source.orphaned=true;"},"query":{"bool":{"must":{"terms":{"hash":` + pack + `}},"must_not":{"terms":{"orphaned":[true]}}}}}`)
+		payload := []byte(`{"script":{"inline":"ctx._source.orphaned=true;ctx._source.orphaned_at=params.dt;ctx._source.orphaned_reason=params.reason;","params":{"dt":"` + orphanedAt + `","reason":"` + pack.reason + `"}},"query":{"bool":{"must":{"terms":{"hash":` + pack.shas + `}},"must_not":{"terms":{"orphaned":[true]}}}}}`)
 		resp, _, _, _, e := Request(
 			ctx,
 			url,
@@ -2226,7 +2691,204 @@ func (j *DSGit) MarkOrphanedCommits(ctx *Ctx) (err error) {
 			return
 		}
 		updated, _ := Dig(resp, []string{"updated"}, true, false)
-		Printf("marked %v orphaned commits\n", updated)
+		Printf("marked %v orphaned commits (%s)\n", updated, pack.reason)
+	}
+	return
+}
+
+// StoreHistoryRewrites - save history rewrite events detected while updating the repo and then current branch heads,
+// this is done at the end of fetch, so fetch-only runs don't lose events nor keep comparing against stale heads
+func (j *DSGit) StoreHistoryRewrites(ctx *Ctx) (err error) {
+	if len(j.HistoryRewrites) > 0 && ctx.RichIndex == "" {
+		Printf("WARNING: no rich index configured, %d history rewrite events on %s are not saved\n", len(j.HistoryRewrites), j.URL)
+	} else {
+		err = j.HistoryRewriteDocs(ctx)
+		if err != nil {
+			return
+		}
+	}
+	if j.BranchHeads != nil {
+		err = j.SaveBranchHeads(ctx, j.BranchHeads)
+	}
+	return
+}
+
+// HistoryRewriteDocs - save history rewrite events detected while updating the repo
+func (j *DSGit) HistoryRewriteDocs(ctx *Ctx) (err error) {
+	if len(j.HistoryRewrites) == 0 {
+		return
+	}
+	origin := AnonymizeURL(j.URL)
+	tag := AnonymizeURL(ctx.Tag)
+	if tag == "" {
+		tag = origin
+	}
+	docs := []interface{}{}
+	for _, event := range j.HistoryRewrites {
+		branch, _ := event["branch"].(string)
+		oldHead, _ := event["old_head"].(string)
+		newHead, _ := event["new_head"].(string)
+		uuid := UUIDNonEmpty(ctx, j.URL, branch, oldHead, newHead)
+		doc := map[string]interface{}{
+			UUID:                          uuid,
+			GitUUID:                       uuid,
+			"type":                        GitHistoryRewrite,
+			"origin":                      origin,
+			"tag":                         tag,
+			"repo_name":                   origin,
+			"repo_short_name":             j.GetRepoShortURL(j.URL),
+			"project":                     ctx.Project,
+			ProjectSlug:                   ctx.ProjectSlug,
+			"grimoire_creation_date":      event["detected_at"],
+			DefaultEnrichDateField:        time.Now(),
+			"is_git_" + GitHistoryRewrite: 1,
+		}
+		for k, v := range event {
+			doc[k] = v
+		}
+		docs = append(docs, doc)
+	}
+	Printf("saving %d history rewrite events\n", len(docs))
+	err = SendToElastic(ctx, j, false, j.RichIDField(ctx), docs)
+	return
+}
+
+// DCOSummary - calculate and save per-origin DCO compliance summary document
+func (j *DSGit) DCOSummary(ctx *Ctx) (err error) {
+	origin := AnonymizeURL(j.URL)
+	url := ctx.ESURL + "/" + ctx.RichIndex + "/_search?size=0"
+	payload := []byte(`{"query":{"bool":{"filter":[{"term":{"origin":"` + JSONEscape(origin) + `"}},{"term":{"type":"` + Commit + `"}},{"term":{"is_parent_commit":1}}]}},` +
+		`"aggs":{"commits":{"value_count":{"field":"hash"}},"signed":{"sum":{"field":"is_signed"}},"signed_off":{"sum":{"field":"dco_signed_off"}},"matches_author":{"sum":{"field":"dco_matches_author"}}}}`)
+	var resp interface{}
+	resp, _, _, _, err = Request(
+		ctx,
+		url,
+		Post,
+		map[string]string{"Content-Type": "application/json"}, // headers
+		payload,                             // payload
+		[]string{},                          // cookies
+		map[[2]int]struct{}{{200, 200}: {}}, // JSON statuses: 200
+		nil,                                 // Error statuses
+		map[[2]int]struct{}{{200, 200}: {}}, // OK statuses: 200
+		nil,                                 // Cache statuses
+		true,                                // retry
+		nil,                                 // cache for
+		false,                               // skip in dry-run mode
+	)
+	if err != nil {
+		Printf("DCOSummary error: %v\n", err)
+		return
+	}
+	aggValue := func(name string) int {
+		v, _ := Dig(resp, []string{"aggregations", name, "value"}, false, true)
+		f, _ := v.(float64)
+		return int(f)
+	}
+	commits := aggValue("commits")
+	if commits == 0 {
+		return
+	}
+	signed := aggValue("signed")
+	signedOff := aggValue("signed_off")
+	matchesAuthor := aggValue("matches_author")
+	pct := func(n int) float64 {
+		return math.Round(10000.0*float64(n)/float64(commits)) / 100.0
+	}
+	now := time.Now()
+	uuid := UUIDNonEmpty(ctx, j.URL, GitDCOSummary)
+	summary := map[string]interface{}{
+		UUID:                      uuid,
+		GitUUID:                   uuid,
+		"type":                    GitDCOSummary,
+		"origin":                  origin,
+		"tag":                     AnonymizeURL(ctx.Tag),
+		"repo_name":               origin,
+		"repo_short_name":         j.GetRepoShortURL(j.URL),
+		"project":                 ctx.Project,
+		ProjectSlug:               ctx.ProjectSlug,
+		"commits":                 commits,
+		"signed_commits":          signed,
+		"signed_off_commits":      signedOff,
+		"dco_matching_commits":    matchesAuthor,
+		"signed_pct":              pct(signed),
+		"dco_signed_off_pct":      pct(signedOff),
+		"dco_compliance_pct":      pct(matchesAuthor),
+		"grimoire_creation_date":  now,
+		DefaultEnrichDateField:    now,
+		"is_git_" + GitDCOSummary: 1,
+	}
+	if ctx.Tag == "" {
+		summary["tag"] = origin
+	}
+	Printf("%s DCO summary: %d commits, %d signed, %d signed-off, %d signed-off by author\n", origin, commits, signed, signedOff, matchesAuthor)
+	err = SendToElastic(ctx, j, false, j.RichIDField(ctx), []interface{}{summary})
+	return
+}
+
+// EnrichSignature - set commit signature fields, is_signed is only set for signatures that verified correctly
+func (j *DSGit) EnrichSignature(ctx *Ctx, commit, rich map[string]interface{}) {
+	rich["is_signed"] = 0
+	iSig, ok := Dig(commit, []string{"signature"}, false, true)
+	if ok {
+		sig, _ := iSig.(map[string]interface{})
+		status, _ := sig["status"].(string)
+		// bad and uncheckable signatures are only reported via signature_status
+		_, valid := GitValidSignatureStatuses[status]
+		if valid {
+			rich["is_signed"] = 1
+		}
+		rich["signature_status"] = GitSignatureStatuses[status]
+		rich["signature_key_id"] = sig["key_id"]
+		rich["signature_fingerprint"] = sig["fingerprint"]
+		signer, _ := sig["signer"].(string)
+		if signer != "" {
+			rich["signature_signer"] = signer
+			ident := j.IdentityFromGitAuthor(ctx, signer)
+			rich["signature_signer_name"] = ident[0]
+			rich["signature_signer_email"] = ident[2]
+		}
+	}
+}
+
+// DCOStatus - check if commit has DCO sign-off and if any sign-off matches commit's author (by email or name)
+func (j *DSGit) DCOStatus(ctx *Ctx, commit map[string]interface{}) (signedOff, matchesAuthor bool) {
+	signOffs := []string{}
+	for _, key := range []string{"Signed-off-by", "Signed-off-by-Trailer"} {
+		iSignOffs, ok := commit[key]
+		if !ok {
+			continue
+		}
+		switch v := iSignOffs.(type) {
+		case string:
+			signOffs = append(signOffs, v)
+		case []interface{}:
+			for _, iSignOff := range v {
+				signOff, ok := iSignOff.(string)
+				if ok {
+					signOffs = append(signOffs, signOff)
+				}
+			}
+		case []string:
+			signOffs = append(signOffs, v...)
+		}
+	}
+	if len(signOffs) == 0 {
+		return
+	}
+	signedOff = true
+	iAuthor, _ := commit["Author"]
+	author, _ := iAuthor.(string)
+	authorIdent := j.IdentityFromGitAuthor(ctx, strings.TrimSpace(author))
+	for _, signOff := range signOffs {
+		ident := j.IdentityFromGitAuthor(ctx, strings.TrimSpace(signOff))
+		if ident[2] != Nil && strings.EqualFold(ident[2], authorIdent[2]) {
+			matchesAuthor = true
+			return
+		}
+		if ident[0] != "" && strings.EqualFold(ident[0], authorIdent[0]) {
+			matchesAuthor = true
+			return
+		}
 	}
 	return
 }
@@ -2238,9 +2900,12 @@ func (j *DSGit) TrailerDocs(ctx *Ctx, rich map[string]interface{}) (trailers []m
 		trailer map[string]interface{}
 		skip    bool
 	)
-	for _, data := range GitTrailerOtherAuthors {
-		aryName := data[0]
-		authorName := data[1]
+	for _, role := range j.TrailersPolicy().Roles {
+		if !role.FlatDoc {
+			continue
+		}
+		aryName := role.RichKey
+		authorName := role.Author
 		iAry, ok := rich[aryName]
 		if ok {
 			ary, _ := iAry.([]interface{})
@@ -2272,6 +2937,7 @@ func (j *DSGit) TrailerDoc(ctx *Ctx, rich, item map[string]interface{}, author s
 		"hash", "hash_short", "repo_name", "files", "doc_commit", "orphaned",
 		"lines_added", "lines_removed", "lines_changed", "total_lines_of_code",
 		"commit_url", "repo_short_name", "github_repo", "project", "project_ts",
+		"is_signed", "dco_signed_off", "dco_matches_author",
 	}
 	authorID, ok := item[author+"_id"].(string)
 	if !ok {
@@ -2397,6 +3063,16 @@ func (j *DSGit) EnrichItem(ctx *Ctx, item map[string]interface{}, skip string, a
 	}
 
 	rich["branches"] = []interface{}{}
+	j.EnrichSignature(ctx, commit, rich)
+	dcoSignedOff, dcoMatchesAuthor := j.DCOStatus(ctx, commit)
+	rich["dco_signed_off"] = 0
+	if dcoSignedOff {
+		rich["dco_signed_off"] = 1
+	}
+	rich["dco_matches_author"] = 0
+	if dcoMatchesAuthor {
+		rich["dco_matches_author"] = 1
+	}
 	dtDiff := float64(commitDate.Sub(authorDate).Seconds()) / 3600.0
 	dtDiff = math.Round(dtDiff*100.0) / 100.0
 	rich["time_to_commit_hours"] = dtDiff
@@ -2496,7 +3172,7 @@ func (j *DSGit) EnrichItem(ctx *Ctx, item map[string]interface{}, skip string, a
 			rolePH + "_email":    ident[2],
 		}
 		otherIdents[authorStr] = identity
-		if !affs {
+		if !affs || !j.TrailersNeedAffs(othersMap[authorStr]) {
 			continue
 		}
 		affsIdentity, empty, e := IdentityAffsData(ctx, j, identity, nil, authorDate, rolePH)
@@ -2532,11 +3208,15 @@ func (j *DSGit) EnrichItem(ctx *Ctx, item map[string]interface{}, skip string, a
 		for roleData := range roles {
 			roleObject := roleData[0]
 			roleName := roleData[1]
+			roleAffs := j.TrailersNeedAffs(map[[2]string]struct{}{roleData: {}})
 			item := map[string]interface{}{}
 			for prop, value := range identity {
 				if !strings.HasPrefix(prop, rolePH) {
 					continue
 				}
+				if !roleAffs && prop != rolePH+"_name" && prop != rolePH+"_username" && prop != rolePH+"_email" {
+					continue
+				}
 				prop = strings.Replace(prop, rolePH, roleName, -1)
 				item[prop] = value
 			}
@@ -2610,7 +3290,7 @@ func (j *DSGit) PairProgrammingMetrics(ctx *Ctx, rich, commit map[string]interfa
 			allAuthors[author] = struct{}{}
 		}
 	}
-	for k, v := range GitTrailerPPAuthors {
+	for k, v := range j.TrailersPolicy().PPAuthors {
 		_, ok := Dig(commit, []string{k}, false, true)
 		if !ok {
 			continue
@@ -0,0 +1,273 @@
+package dads
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// gitScratchExec - run git command in a scratch repository, fail the test on error
+func gitScratchExec(t *testing.T, ctx *Ctx, dir string, env map[string]string, args ...string) string {
+	cmdLine := append([]string{"git"}, args...)
+	sout, serr, err := ExecCommand(ctx, cmdLine, dir, env)
+	if err != nil {
+		t.Fatalf("error executing %v: %v\n%s\n%s\n", cmdLine, err, sout, serr)
+	}
+	return strings.TrimSpace(sout)
+}
+
+// gitScratchRepo - create an empty non-bare repository with a main branch
+func gitScratchRepo(t *testing.T, ctx *Ctx) (dir string) {
+	dir, err := ioutil.TempDir("", "dads-git-")
+	if err != nil {
+		t.Fatalf("cannot create temp dir: %v", err)
+	}
+	gitScratchExec(t, ctx, dir, GitDefaultEnv, "init", "-q", "-b", "main", dir+"/src")
+	return dir
+}
+
+// gitScratchCommit - add an empty commit with given author/committer date to the current branch of src
+func gitScratchCommit(t *testing.T, ctx *Ctx, src, message string, dt time.Time) string {
+	date := dt.Format(time.RFC3339)
+	env := map[string]string{
+		"LANG":                "C",
+		"GIT_AUTHOR_NAME":     "Author",
+		"GIT_AUTHOR_EMAIL":    "author@example.com",
+		"GIT_AUTHOR_DATE":     date,
+		"GIT_COMMITTER_NAME":  "Author",
+		"GIT_COMMITTER_EMAIL": "author@example.com",
+		"GIT_COMMITTER_DATE":  date,
+	}
+	gitScratchExec(t, ctx, src, env, "commit", "-q", "--allow-empty", "-m", message)
+	return gitScratchExec(t, ctx, src, GitDefaultEnv, "rev-parse", "HEAD")
+}
+
+// gitScratchCount - number of commits reachable from all branches of a clone
+func gitScratchCount(t *testing.T, ctx *Ctx, dir string) int {
+	n, err := strconv.Atoi(gitScratchExec(t, ctx, dir, GitDefaultEnv, "rev-list", "--count", "--all"))
+	if err != nil {
+		t.Fatalf("cannot count commits: %v", err)
+	}
+	return n
+}
+
+func TestGitShallowIncrementalUpdates(t *testing.T) {
+	ctx := &Ctx{}
+	dir := gitScratchRepo(t, ctx)
+	defer func() { _ = os.RemoveAll(dir) }()
+	src := dir + "/src"
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 6; i++ {
+		gitScratchCommit(t, ctx, src, "initial "+strconv.Itoa(i), start.AddDate(0, i, 0))
+	}
+	dateFrom := start.AddDate(0, 3, 0)
+	ctx.DateFrom = &dateFrom
+	j := &DSGit{URL: "file://" + src, GitPath: dir + "/clone", CloneStrategy: GitCloneShallow}
+	err := j.CreateGitRepo(ctx)
+	if err != nil {
+		t.Fatalf("cannot clone: %v", err)
+	}
+	if !j.IsShallow(ctx) {
+		t.Fatalf("expected shallow clone")
+	}
+	count := gitScratchCount(t, ctx, j.GitPath)
+	if count == 0 || count >= 6 {
+		t.Errorf("expected clone bounded by date from, got %d commits", count)
+	}
+	for update := 0; update < 2; update++ {
+		// date from moves forward, as it does when it is detected from the last enriched commit
+		gitScratchCommit(t, ctx, src, "update "+strconv.Itoa(update), start.AddDate(1, update, 0))
+		dateFrom = start.AddDate(1, update, 0)
+		ctx.DateFrom = &dateFrom
+		err = j.UpdateGitRepo(ctx)
+		if err != nil {
+			t.Fatalf("update %d: cannot update: %v", update+1, err)
+		}
+		newCount := gitScratchCount(t, ctx, j.GitPath)
+		if newCount != count+1 {
+			t.Errorf("update %d: expected %d commits, got %d", update+1, count+1, newCount)
+		}
+		count = newCount
+		_, err = j.GetOrphanedCommits(ctx, 1)
+		if err != nil {
+			t.Fatalf("update %d: cannot get orphaned commits: %v", update+1, err)
+		}
+		if len(j.OrphanedCommits) != 0 || len(j.HistoryRewrites) != 0 {
+			t.Errorf("update %d: expected no orphans and no history rewrites, got %v, %+v", update+1, j.OrphanedCommits, j.HistoryRewrites)
+		}
+	}
+}
+
+func TestGitHistoryRewrites(t *testing.T) {
+	dt := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	// shallow clone boundary is inside the history: the first commit is not cloned
+	shallowSince := dt.Add(12 * time.Hour)
+	var strategies = []struct {
+		strategy string
+		dateFrom *time.Time
+		shallow  bool
+	}{
+		{strategy: GitCloneFull},
+		{strategy: GitCloneShallow, dateFrom: &shallowSince, shallow: true},
+	}
+	for index, strategy := range strategies {
+		ctx := &Ctx{DateFrom: strategy.dateFrom}
+		dir := gitScratchRepo(t, ctx)
+		src := dir + "/src"
+		gitScratchCommit(t, ctx, src, "c1", dt)
+		c2 := gitScratchCommit(t, ctx, src, "c2", dt.AddDate(0, 0, 1))
+		c3 := gitScratchCommit(t, ctx, src, "c3", dt.AddDate(0, 0, 2))
+		gitScratchExec(t, ctx, src, GitDefaultEnv, "checkout", "-q", "-b", "feature", c2)
+		f1 := gitScratchCommit(t, ctx, src, "f1", dt.AddDate(0, 0, 3))
+		gitScratchExec(t, ctx, src, GitDefaultEnv, "checkout", "-q", "main")
+		j := &DSGit{URL: "file://" + src, GitPath: dir + "/clone", CloneStrategy: strategy.strategy}
+		err := j.CreateGitRepo(ctx)
+		if err != nil {
+			t.Fatalf("strategy %d: cannot clone: %v", index+1, err)
+		}
+		if j.IsShallow(ctx) != strategy.shallow {
+			t.Fatalf("strategy %d: expected shallow clone %v", index+1, strategy.shallow)
+		}
+		// force-push main (c3 replaced by c3'), delete feature branch (f1), add a new topic branch
+		gitScratchExec(t, ctx, src, GitDefaultEnv, "reset", "-q", "--hard", c2)
+		c3b := gitScratchCommit(t, ctx, src, "c3 amended", dt.AddDate(0, 0, 4))
+		gitScratchExec(t, ctx, src, GitDefaultEnv, "branch", "-q", "-D", "feature")
+		gitScratchExec(t, ctx, src, GitDefaultEnv, "checkout", "-q", "-b", "topic")
+		t1 := gitScratchCommit(t, ctx, src, "t1", dt.AddDate(0, 0, 5))
+		err = j.UpdateGitRepo(ctx)
+		if err != nil {
+			t.Fatalf("strategy %d: cannot update: %v", index+1, err)
+		}
+		if len(j.HistoryRewrites) != 1 {
+			t.Fatalf("strategy %d: expected 1 history rewrite, got %+v", index+1, j.HistoryRewrites)
+		}
+		rewrite := j.HistoryRewrites[0]
+		if rewrite["branch"] != "main" || rewrite["old_head"] != c3 || rewrite["new_head"] != c3b || rewrite["old_head_missing"] != false || rewrite["orphaned_commits"] != 1 {
+			t.Errorf("strategy %d: unexpected history rewrite %+v", index+1, rewrite)
+		}
+		if j.BranchHeads["main"] != c3b || j.BranchHeads["topic"] != t1 || len(j.BranchHeads) != 2 {
+			t.Errorf("strategy %d: unexpected branch heads to save %+v", index+1, j.BranchHeads)
+		}
+		_, err = j.GetOrphanedCommits(ctx, 1)
+		if err != nil {
+			t.Fatalf("strategy %d: cannot get orphaned commits: %v", index+1, err)
+		}
+		// cat-file vs rev-list: rewritten and deleted branch commits are orphaned, new ones and shallow boundary are not
+		byReason := j.OrphanedCommitsByReason()
+		var testCases = []struct {
+			reason   string
+			expected []string
+		}{
+			{reason: OrphanedReasonHistoryRewrite, expected: []string{c3}},
+			{reason: OrphanedReasonUnreachable, expected: []string{f1}},
+		}
+		for caseIndex, test := range testCases {
+			got := byReason[test.reason]
+			if strings.Join(got, ",") != strings.Join(test.expected, ",") {
+				t.Errorf("strategy %d, test number %d, expected %s orphans %v, got %v", index+1, caseIndex+1, test.reason, test.expected, got)
+			}
+		}
+		if len(byReason) != len(testCases) {
+			t.Errorf("strategy %d: unexpected orphaned commits reasons %+v", index+1, byReason)
+		}
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func TestParseGitSignatures(t *testing.T) {
+	sout := strings.Join([]string{
+		"aaa\x1fG\x1fKEY1\x1fAlice <alice@example.com>\x1fFP1",
+		"bbb\x1fN\x1f\x1f\x1f",
+		"ccc\x1fE\x1fKEY2\x1f\x1f",
+		"ddd\x1fB\x1fKEY3",
+		"eee\x1fB\x1fKEY4\x1fMallory <mallory@example.com>\x1fFP4",
+		"fff\x1fX\x1fKEY5\x1fBob <bob@example.com>\x1fFP5",
+		"",
+	}, "\n")
+	sigs := ParseGitSignatures(sout)
+	ctx := &Ctx{}
+	j := &DSGit{}
+	var testCases = []struct {
+		sha                     string
+		expectedSigned          bool
+		expectedStatus          string
+		expectedKeyID           string
+		expectedSigner          string
+		expectedIsSigned        int
+		expectedSignatureStatus interface{}
+	}{
+		{sha: "aaa", expectedSigned: true, expectedStatus: "G", expectedKeyID: "KEY1", expectedSigner: "Alice <alice@example.com>", expectedIsSigned: 1, expectedSignatureStatus: "good"},
+		{sha: "bbb", expectedSigned: false, expectedIsSigned: 0},
+		{sha: "ccc", expectedSigned: true, expectedStatus: "E", expectedKeyID: "KEY2", expectedSigner: "", expectedIsSigned: 0, expectedSignatureStatus: "cannot_check"},
+		{sha: "ddd", expectedSigned: false, expectedIsSigned: 0},
+		{sha: "eee", expectedSigned: true, expectedStatus: "B", expectedKeyID: "KEY4", expectedSigner: "Mallory <mallory@example.com>", expectedIsSigned: 0, expectedSignatureStatus: "bad"},
+		{sha: "fff", expectedSigned: true, expectedStatus: "X", expectedKeyID: "KEY5", expectedSigner: "Bob <bob@example.com>", expectedIsSigned: 1, expectedSignatureStatus: "good_expired"},
+	}
+	for index, test := range testCases {
+		sig, signed := sigs[test.sha]
+		if signed != test.expectedSigned {
+			t.Errorf("test number %d, expected signed %v, got %v", index+1, test.expectedSigned, signed)
+			continue
+		}
+		commit := map[string]interface{}{}
+		if signed {
+			if sig["status"] != test.expectedStatus || sig["key_id"] != test.expectedKeyID || sig["signer"] != test.expectedSigner {
+				t.Errorf("test number %d, expected %s/%s/%s, got %+v", index+1, test.expectedStatus, test.expectedKeyID, test.expectedSigner, sig)
+			}
+			commit["signature"] = sig
+		}
+		// bad (B) and uncheckable (E) signatures keep their status but are not counted as signed
+		rich := map[string]interface{}{}
+		j.EnrichSignature(ctx, commit, rich)
+		if rich["is_signed"] != test.expectedIsSigned || rich["signature_status"] != test.expectedSignatureStatus {
+			t.Errorf("test number %d, expected is_signed %d and status %v, got %v and %v", index+1, test.expectedIsSigned, test.expectedSignatureStatus, rich["is_signed"], rich["signature_status"])
+		}
+	}
+	if len(sigs) != 4 {
+		t.Errorf("expected 4 signatures, got %d", len(sigs))
+	}
+}
+
+func TestGitDCOStatus(t *testing.T) {
+	ctx := &Ctx{}
+	j := &DSGit{}
+	var testCases = []struct {
+		commit                map[string]interface{}
+		expectedSignedOff     bool
+		expectedMatchesAuthor bool
+	}{
+		{
+			commit:            map[string]interface{}{"Author": "Alice <alice@example.com>"},
+			expectedSignedOff: false,
+		},
+		{
+			commit:                map[string]interface{}{"Author": "Alice <alice@example.com>", "Signed-off-by": []interface{}{"Alice <ALICE@example.com>"}},
+			expectedSignedOff:     true,
+			expectedMatchesAuthor: true,
+		},
+		{
+			commit:                map[string]interface{}{"Author": "Alice <alice@example.com>", "Signed-off-by": []interface{}{"Bob <bob@example.com>"}},
+			expectedSignedOff:     true,
+			expectedMatchesAuthor: false,
+		},
+		{
+			commit:                map[string]interface{}{"Author": "Alice Smith <alice@work.com>", "Signed-off-by-Trailer": "alice smith <alice@home.com>"},
+			expectedSignedOff:     true,
+			expectedMatchesAuthor: true,
+		},
+		{
+			commit:                map[string]interface{}{"Author": "Alice <alice@example.com>", "Signed-off-by": []string{"Bob <bob@example.com>", "Alice <alice@example.com>"}},
+			expectedSignedOff:     true,
+			expectedMatchesAuthor: true,
+		},
+	}
+	for index, test := range testCases {
+		gotSignedOff, gotMatchesAuthor := j.DCOStatus(ctx, test.commit)
+		if gotSignedOff != test.expectedSignedOff || gotMatchesAuthor != test.expectedMatchesAuthor {
+			t.Errorf("test number %d, expected signed off/matches author %v/%v, got %v/%v", index+1, test.expectedSignedOff, test.expectedMatchesAuthor, gotSignedOff, gotMatchesAuthor)
+		}
+	}
+}
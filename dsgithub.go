@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"math/rand"
+	"net/http"
 	"os"
 	"runtime"
 	"sort"
@@ -23,6 +24,10 @@ const (
 	GitHubBackendVersion = "0.1.0"
 	// GitHubURLRoot - GitHub URL root
 	GitHubURLRoot = "https://github.com/"
+	// GitHubAPIURLRoot - GitHub API URL root
+	GitHubAPIURLRoot = "https://api.github.com/"
+	// GitHubGraphQLURL - GitHub GraphQL v4 API endpoint
+	GitHubGraphQLURL = GitHubAPIURLRoot + "graphql"
 	// MaxGitHubUsersFileCacheAge 90 days (in seconds) - file is considered too old anywhere between 90-180 days
 	MaxGitHubUsersFileCacheAge = 7776000
 	// MaxCommentBodyLength - max comment body length
@@ -93,7 +98,7 @@ var (
 	// GitHubRichMapping = []byte(`{"dynamic":true,"properties":{"metadata__updated_on":{"type":"date","format":"strict_date_optional_time||epoch_millis"},"merge_author_geolocation":{"type":"geo_point"},"assignee_geolocation":{"type":"geo_point"},"id_in_repo":{"type":"long"},"state":{"type":"keyword"},"user_geolocation":{"type":"geo_point"},"title_analyzed":{"type":"text","index":true},"body_analyzed":{"type":"text","index":true},"code_merge_duration":{"type":"float"},"time_open_days":{"type":"float"},"time_to_close_days":{"type":"float"},"time_to_first_attention":{"type":"float"},"time_to_merge_request_response":{"type":"float"},"id_in_repo":{"type":"long"}},"dynamic_templates":[{"notanalyzed":{"match":"*","unmatch":"body","match_mapping_type":"string","mapping":{"type":"keyword"}}},{"formatdate":{"match":"*","match_mapping_type":"date","mapping":{"format":"strict_date_optional_time||epoch_millis","type":"date"}}}]}`)
 	GitHubRichMapping = []byte(`{"dynamic":true,"properties":{"metadata__updated_on":{"type":"date","format":"strict_date_optional_time||epoch_millis"},"merge_author_geolocation":{"type":"geo_point"},"assignee_geolocation":{"type":"geo_point"},"state":{"type":"keyword"},"user_geolocation":{"type":"geo_point"},"title_analyzed":{"type":"text","index":true},"body_analyzed":{"type":"text","index":true},"code_merge_duration":{"type":"float"},"time_open_days":{"type":"float"},"time_to_close_days":{"type":"float"},"time_to_first_attention":{"type":"float"},"time_to_merge_request_response":{"type":"float"},"id_in_repo":{"type":"long"}},"dynamic_templates":[{"notanalyzed":{"match":"*","unmatch":"body","match_mapping_type":"string","mapping":{"type":"keyword"}}},{"formatdate":{"match":"*","match_mapping_type":"date","mapping":{"format":"strict_date_optional_time||epoch_millis","type":"date"}}}]}`)
 	// GitHubCategories - categories defined for GitHub
-	GitHubCategories = map[string]struct{}{"issue": {}, "pull_request": {}, "repository": {}}
+	GitHubCategories = map[string]struct{}{"issue": {}, "pull_request": {}, "repository": {}, "event": {}, "discussion": {}, "release": {}, "workflow_run": {}}
 	// GitHubIssueRoles - roles to fetch affiliation data for github issue
 	GitHubIssueRoles = []string{"user_data", "assignee_data"}
 	// GitHubIssueCommentRoles - roles to fetch affiliation data for github issue comment
@@ -114,19 +119,49 @@ var (
 	GitHubPullRequestRequestedReviewerRoles = []string{"requested_reviewer"}
 	// GitHubPullRequestReviewRoles - roles to fetch affiliation data for github pull request comment
 	GitHubPullRequestReviewRoles = []string{"user_data"}
+	// GitHubEventRoles - roles to fetch affiliation data for github issue/pull request timeline event
+	GitHubEventRoles = []string{"actor_data"}
+	// GitHubDiscussionRoles - roles to fetch affiliation data for github discussion
+	GitHubDiscussionRoles = []string{"user_data", "answer_chosen_by_data"}
+	// GitHubDiscussionCommentRoles - roles to fetch affiliation data for github discussion comment, answer or reply
+	GitHubDiscussionCommentRoles = []string{"user_data"}
+	// GitHubReleaseRoles - roles to fetch affiliation data for github release
+	GitHubReleaseRoles = []string{"author_data"}
+	// GitHubReleaseAssetRoles - roles to fetch affiliation data for github release asset
+	GitHubReleaseAssetRoles = []string{"uploader_data"}
+	// GitHubWorkflowRunRoles - roles to fetch affiliation data for github actions workflow run (and its jobs)
+	GitHubWorkflowRunRoles = []string{"actor_data"}
 )
 
 // DSGitHub - DS implementation for GitHub
 type DSGitHub struct {
 	DS                              string // From DA_DS - data source type "github"
 	Org                             string // From DA_GITHUB_ORG - github org
-	Repo                            string // From DA_GITHUB_REPO - github repo
+	Repo                            string // From DA_GITHUB_REPO - github repo, when empty all org repositories (that pass filters below) are processed
 	Category                        string // From DA_GITHUB_CATEGORY - issue, pull_request, repository
 	Tokens                          string // From DA_GITHUB_TOKENS - "," separated list of OAuth tokens
+	GraphQL                         bool   // From DA_GITHUB_GRAPHQL - use GraphQL v4 API to fetch issues and pull requests with their sub items in bulk
+	AttentionEvents                 bool   // From DA_GITHUB_ATTENTION_EVENTS - timeline events (labeled, assigned, ...) by others count as attention, REST API needs one more paginated call per issue/pull request then
+	AppIDs                          string // From DA_GITHUB_APP_ID - "," separated list of GitHub App IDs
+	AppKeys                         string // From DA_GITHUB_APP_PRIVATE_KEY - "," separated list of GitHub App private keys (PEM file paths or PEM contents)
+	AppInstallationIDs              string // From DA_GITHUB_APP_INSTALLATION_ID - "," separated list of GitHub App installation IDs, optional: looked up for org/repo when not set
+	APIURL                          string // From DA_GITHUB_API_URL - GitHub REST API URL root, for GitHub Enterprise Server use https://host/api/v3/, defaults to https://api.github.com/
+	WebURL                          string // From DA_GITHUB_WEB_URL - GitHub web URL root, for GitHub Enterprise Server use https://host/, defaults to https://github.com/
+	GraphQLURL                      string
+	IncludeArchived                 bool   // From DA_GITHUB_INCLUDE_ARCHIVED - org-wide mode: include archived repositories
+	IncludeForks                    bool   // From DA_GITHUB_INCLUDE_FORKS - org-wide mode: include forks
+	IncludePrivate                  bool   // From DA_GITHUB_INCLUDE_PRIVATE - org-wide mode: include private and internal repositories
+	Topics                          string // From DA_GITHUB_TOPICS - org-wide mode: "," separated list of topics, repository must have at least one of them
+	ReposRegexp                     string // From DA_GITHUB_REPOS_REGEXP - org-wide mode: repository name must match this regexp
+	GitIndex                        string // From DA_GITHUB_GIT_INDEX - git rich index, when set pull_request enrichment links merged PRs commits in that index
+	OrgWide                         bool
+	OrgRepos                        []string
+	OrgResume                       map[string]OriginResume
 	URL                             string
 	Clients                         []*github.Client
 	Context                         context.Context
 	OAuthKeys                       []string
+	TokenSources                    []oauth2.TokenSource
 	ThrN                            int
 	Hint                            int
 	RateHandled                     bool
@@ -162,6 +197,9 @@ type DSGitHub struct {
 	GitHubPullRequestedReviewers    map[string][]map[string]interface{}
 	GitHubPullCommits               map[string][]map[string]interface{}
 	GitHubUserOrgs                  map[string][]map[string]interface{}
+	GraphQLHint                     int
+	GraphQLRemaining                []int
+	GraphQLResetAt                  []time.Time
 }
 
 func (j *DSGitHub) getRateLimits(gctx context.Context, ctx *Ctx, gcs []*github.Client, core bool) (int, []int, []int, []time.Duration) {
@@ -173,6 +211,15 @@ func (j *DSGitHub) getRateLimits(gctx context.Context, ctx *Ctx, gcs []*github.C
 	display := false
 	for idx, gc := range gcs {
 		rl, _, err := gc.RateLimits(gctx)
+		if GitHubRateLimitsDisabled(err) {
+			if ctx.Debug > 0 {
+				Printf("GetRateLimit(%d): rate limiting is disabled: %v\n", idx, err)
+			}
+			limits = append(limits, GitHubRateLimitDisabled)
+			remainings = append(remainings, GitHubRateLimitDisabled)
+			durations = append(durations, time.Duration(0))
+			continue
+		}
 		if err != nil {
 			rem, ok := PeriodParse(err.Error())
 			if ok {
@@ -289,6 +336,94 @@ func (j *DSGitHub) isAbuse(e error) (abuse, rateLimit bool) {
 	return
 }
 
+// githubGetPages - GET all pages of a REST API path that has no typed go-github method
+// process is called with every decoded page, 404 Not Found is not an error (process is not called then)
+func (j *DSGitHub) githubGetPages(ctx *Ctx, what, path, accept string, process func(interface{}) error) (err error) {
+	var c *github.Client
+	if j.GitHubMtx != nil {
+		j.GitHubMtx.RLock()
+	}
+	c = j.Clients[j.Hint]
+	if j.GitHubMtx != nil {
+		j.GitHubMtx.RUnlock()
+	}
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	page := 1
+	retry := false
+	for {
+		var (
+			response *github.Response
+			req      *http.Request
+			data     interface{}
+			e        error
+		)
+		req, e = c.NewRequest(Get, fmt.Sprintf("%s%sper_page=%d&page=%d", path, sep, ItemsPerPage, page), nil)
+		if e != nil {
+			err = e
+			return
+		}
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		response, e = c.Do(j.Context, req, &data)
+		if ctx.Debug > 2 {
+			Printf("GET %s -> {%+v, %+v, %+v}\n", path, data, response, e)
+		}
+		if e != nil && strings.Contains(e.Error(), "404 Not Found") {
+			if ctx.Debug > 1 {
+				Printf("githubGetPages: %s not found: %v\n", what, e)
+			}
+			return
+		}
+		if e != nil && !retry {
+			Printf("Unable to get %s: response: %+v, because: %+v, retrying rate\n", what, response, e)
+			Printf("githubGetPages: handle rate\n")
+			abuse, rateLimit := j.isAbuse(e)
+			if abuse {
+				sleepFor := AbuseWaitSeconds + rand.Intn(AbuseWaitSeconds)
+				Printf("GitHub detected abuse (get %s), waiting for %ds\n", what, sleepFor)
+				time.Sleep(time.Duration(sleepFor) * time.Second)
+			}
+			if rateLimit {
+				Printf("Rate limit reached on a token (get %s) waiting 1s before token switch\n", what)
+				time.Sleep(time.Duration(1) * time.Second)
+			}
+			if j.GitHubMtx != nil {
+				j.GitHubMtx.Lock()
+			}
+			j.Hint, _ = j.handleRate(ctx)
+			c = j.Clients[j.Hint]
+			if j.GitHubMtx != nil {
+				j.GitHubMtx.Unlock()
+			}
+			if !abuse && !rateLimit {
+				retry = true
+			}
+			continue
+		}
+		if e != nil {
+			err = e
+			return
+		}
+		err = process(data)
+		if err != nil {
+			return
+		}
+		if response.NextPage == 0 {
+			break
+		}
+		page = response.NextPage
+		if ctx.Debug > 0 {
+			Printf("%s/%s: processing next %s page: %d\n", j.URL, j.Category, what, page)
+		}
+		retry = false
+	}
+	return
+}
+
 func (j *DSGitHub) githubRepo(ctx *Ctx, org, repo string) (repoData map[string]interface{}, err error) {
 	var found bool
 	origin := org + "/" + repo
@@ -2219,6 +2354,24 @@ func (j *DSGitHub) ParseArgs(ctx *Ctx) (err error) {
 	j.Repo = os.Getenv(prefix + "REPO")
 	j.Category = os.Getenv(prefix + "CATEGORY")
 	j.Tokens = os.Getenv(prefix + "TOKENS")
+	j.GraphQL = StringToBool(os.Getenv(prefix + "GRAPHQL"))
+	j.AttentionEvents = StringToBool(os.Getenv(prefix + "ATTENTION_EVENTS"))
+	j.AppIDs = os.Getenv(prefix + "APP_ID")
+	j.AppKeys = os.Getenv(prefix + "APP_PRIVATE_KEY")
+	j.AppInstallationIDs = os.Getenv(prefix + "APP_INSTALLATION_ID")
+	j.APIURL = os.Getenv(prefix + "API_URL")
+	j.WebURL = os.Getenv(prefix + "WEB_URL")
+	j.IncludeArchived = StringToBool(os.Getenv(prefix + "INCLUDE_ARCHIVED"))
+	j.IncludeForks = StringToBool(os.Getenv(prefix + "INCLUDE_FORKS"))
+	j.IncludePrivate = StringToBool(os.Getenv(prefix + "INCLUDE_PRIVATE"))
+	j.Topics = os.Getenv(prefix + "TOPICS")
+	j.ReposRegexp = os.Getenv(prefix + "REPOS_REGEXP")
+	j.GitIndex = os.Getenv(prefix + "GIT_INDEX")
+	if j.AppKeys != "" {
+		for _, key := range strings.Split(j.AppKeys, ",") {
+			AddRedacted(strings.TrimSpace(key), false)
+		}
+	}
 	return
 }
 
@@ -2234,16 +2387,28 @@ func (j *DSGitHub) Validate(ctx *Ctx) (err error) {
 		lRepo := len(j.Repo)
 		j.Repo = j.Repo[:lRepo-4]
 	}
-	if j.Repo == "" {
-		err = fmt.Errorf("github repo must be set")
-		return
-	}
+	j.OrgWide = j.Repo == ""
 	j.Category = strings.TrimSpace(j.Category)
+	j.GitIndex = strings.TrimSpace(j.GitIndex)
 	if j.Category == "" {
 		err = fmt.Errorf("github category must be set")
 		return
 	}
-	j.URL = "https://github.com/" + j.Org + "/" + j.Repo
+	j.APIURL, j.WebURL, j.GraphQLURL, err = GitHubURLs(j.APIURL, j.WebURL)
+	if err != nil {
+		return
+	}
+	if j.OrgWide {
+		j.Topics = strings.TrimSpace(j.Topics)
+		j.ReposRegexp = strings.TrimSpace(j.ReposRegexp)
+		_, err = j.githubRepoFilter()
+		if err != nil {
+			return
+		}
+		j.URL = j.WebURL + j.Org
+	} else {
+		j.URL = j.WebURL + j.Org + "/" + j.Repo
+	}
 	defer func() {
 		Printf("configured %d GitHub OAuth clients\n", len(j.Clients))
 	}()
@@ -2257,19 +2422,53 @@ func (j *DSGitHub) Validate(ctx *Ctx) (err error) {
 	}
 	// GitHub authentication or use public access
 	j.Context = context.Background()
-	if oAuth == "" {
-		client := github.NewClient(nil)
-		j.Clients = append(j.Clients, client)
-	} else {
+	if oAuth != "" {
 		oAuths := strings.Split(oAuth, ",")
 		for _, auth := range oAuths {
+			AddRedacted(auth, false)
 			j.OAuthKeys = append(j.OAuthKeys, auth)
 			ts := oauth2.StaticTokenSource(
 				&oauth2.Token{AccessToken: auth},
 			)
-			tc := oauth2.NewClient(j.Context, ts)
-			client := github.NewClient(tc)
-			j.Clients = append(j.Clients, client)
+			j.TokenSources = append(j.TokenSources, ts)
+		}
+	}
+	// GitHub Apps authenticate via short lived installation tokens, refreshed before they expire
+	j.AppIDs = strings.TrimSpace(j.AppIDs)
+	j.AppKeys = strings.TrimSpace(j.AppKeys)
+	j.AppInstallationIDs = strings.TrimSpace(j.AppInstallationIDs)
+	appSources, err := j.githubAppTokenSources(ctx)
+	if err != nil {
+		return
+	}
+	j.TokenSources = append(j.TokenSources, appSources...)
+	if len(j.TokenSources) == 0 {
+		var client *github.Client
+		client, err = j.newGitHubClient(nil)
+		if err != nil {
+			return
+		}
+		j.Clients = append(j.Clients, client)
+	}
+	for _, ts := range j.TokenSources {
+		tc := oauth2.NewClient(j.Context, ts)
+		var client *github.Client
+		client, err = j.newGitHubClient(tc)
+		if err != nil {
+			return
+		}
+		j.Clients = append(j.Clients, client)
+	}
+	// Discussions are only available via GraphQL API
+	if j.GraphQL || j.Category == "discussion" {
+		if len(j.TokenSources) == 0 {
+			err = fmt.Errorf("github GraphQL API requires at least one OAuth token or GitHub App installation")
+			return
+		}
+		j.GraphQLRemaining = make([]int, len(j.TokenSources))
+		j.GraphQLResetAt = make([]time.Time, len(j.TokenSources))
+		for i := range j.GraphQLRemaining {
+			j.GraphQLRemaining[i] = -1
 		}
 	}
 	if CacheGitHubRepo {
@@ -2379,36 +2578,53 @@ func (j DSGitHub) Info() string {
 }
 
 // CustomFetchRaw - is this datasource using custom fetch raw implementation?
+// Org-wide mode runs generic FetchRaw for every org repository
 func (j *DSGitHub) CustomFetchRaw() bool {
-	return false
+	return j.OrgWide && j.Repo == ""
 }
 
 // FetchRaw - implement fetch raw data for GitHub datasource
 func (j *DSGitHub) FetchRaw(ctx *Ctx) (err error) {
+	if j.CustomFetchRaw() {
+		return j.fetchOrgRepos(ctx)
+	}
 	Printf("%s should use generic FetchRaw()\n", j.DS)
 	return
 }
 
 // CustomEnrich - is this datasource using custom enrich implementation?
+// Org-wide mode runs generic Enrich for every org repository
 func (j *DSGitHub) CustomEnrich() bool {
-	return false
+	return j.OrgWide && j.Repo == ""
 }
 
 // Enrich - implement enrich data for GitHub datasource
 func (j *DSGitHub) Enrich(ctx *Ctx) (err error) {
+	if j.CustomEnrich() {
+		return j.enrichOrgRepos(ctx)
+	}
 	Printf("%s should use generic Enrich()\n", j.DS)
 	return
 }
 
 // FetchItems - implement raw data for GitHub datasource
 func (j *DSGitHub) FetchItems(ctx *Ctx) (err error) {
+	if j.OrgWide && j.Repo == "" {
+		return j.forEachOrgRepo(ctx, func(string) error { return j.FetchItems(ctx) })
+	}
 	switch j.Category {
 	case "repository":
 		return j.FetchItemsRepository(ctx)
-	case "issue":
+	case "issue", "event":
 		return j.FetchItemsIssue(ctx)
 	case "pull_request":
 		return j.FetchItemsPullRequest(ctx)
+	case "discussion":
+		return j.FetchItemsDiscussion(ctx)
+	case "release":
+		return j.FetchItemsRelease(ctx)
+	case "workflow_run":
+		return j.FetchItemsWorkflowRun(ctx)
 	default:
 		err = fmt.Errorf("FetchItems: unknown category %s", j.Category)
 	}
@@ -2439,13 +2655,20 @@ func (j *DSGitHub) FetchItemsRepository(ctx *Ctx) (err error) {
 
 // ProcessIssue - add issues sub items
 func (j *DSGitHub) ProcessIssue(ctx *Ctx, inIssue map[string]interface{}) (issue map[string]interface{}, err error) {
+	if j.Category == "event" {
+		return j.ProcessIssueEvents(ctx, inIssue)
+	}
+	if j.GraphQL {
+		return j.ProcessGraphQLIssue(ctx, inIssue)
+	}
 	issue = inIssue
 	issue["user_data"] = map[string]interface{}{}
 	issue["assignee_data"] = map[string]interface{}{}
 	issue["assignees_data"] = []interface{}{}
 	issue["comments_data"] = []interface{}{}
 	issue["reactions_data"] = []interface{}{}
-	// ["user", "assignee", "assignees", "comments", "reactions"]
+	issue["events_data"] = []interface{}{}
+	// ["user", "assignee", "assignees", "comments", "reactions", "events"]
 	userLogin, ok := Dig(issue, []string{"user", "login"}, false, true)
 	if ok {
 		issue["user_data"], _, err = j.githubUser(ctx, userLogin.(string))
@@ -2483,6 +2706,13 @@ func (j *DSGitHub) ProcessIssue(ctx *Ctx, inIssue map[string]interface{}) (issue
 		if err != nil {
 			return
 		}
+		// Timeline is only needed for time to first attention, GraphQL API fetches it together with the issue
+		if j.AttentionEvents {
+			issue["events_data"], err = j.githubIssueTimeline(ctx, j.Org, j.Repo, int(number.(float64)))
+			if err != nil {
+				return
+			}
+		}
 		iCnt, ok := Dig(issue, []string{"reactions", "total_count"}, false, true)
 		if ok {
 			issue["reactions_data"] = []interface{}{}
@@ -2500,6 +2730,9 @@ func (j *DSGitHub) ProcessIssue(ctx *Ctx, inIssue map[string]interface{}) (issue
 
 // ProcessPull - add PRs sub items
 func (j *DSGitHub) ProcessPull(ctx *Ctx, inPull map[string]interface{}) (pull map[string]interface{}, err error) {
+	if j.GraphQL {
+		return j.ProcessGraphQLPull(ctx, inPull)
+	}
 	pull = inPull
 	pull["user_data"] = map[string]interface{}{}
 	pull["assignee_data"] = map[string]interface{}{}
@@ -2509,7 +2742,8 @@ func (j *DSGitHub) ProcessPull(ctx *Ctx, inPull map[string]interface{}) (pull ma
 	pull["reviews_data"] = []interface{}{}
 	pull["requested_reviewers_data"] = []interface{}{}
 	pull["commits_data"] = []interface{}{}
-	// ["user", "review_comments", "requested_reviewers", "merged_by", "commits", "assignee", "assignees"]
+	pull["events_data"] = []interface{}{}
+	// ["user", "review_comments", "requested_reviewers", "merged_by", "commits", "assignee", "assignees", "events"]
 	number, ok := Dig(pull, []string{"number"}, false, true)
 	if ok {
 		iNumber := int(number.(float64))
@@ -2525,6 +2759,12 @@ func (j *DSGitHub) ProcessPull(ctx *Ctx, inPull map[string]interface{}) (pull ma
 		if err != nil {
 			return
 		}
+		if j.AttentionEvents {
+			pull["events_data"], err = j.githubIssueTimeline(ctx, j.Org, j.Repo, iNumber)
+			if err != nil {
+				return
+			}
+		}
 		// TODO: commits
 		// That would fetch the full commit data
 		//pull["commits_data"], err = j.githubPullCommits(ctx, j.Org, j.Repo, iNumber, true)
@@ -2655,7 +2895,12 @@ func (j *DSGitHub) FetchItemsIssue(ctx *Ctx) (err error) {
 		}
 		return
 	}
-	issues, err := j.githubIssues(ctx, j.Org, j.Repo, ctx.DateFrom)
+	var issues []map[string]interface{}
+	if j.GraphQL {
+		issues, err = j.githubGraphQLIssues(ctx, j.Org, j.Repo, ctx.DateFrom)
+	} else {
+		issues, err = j.githubIssues(ctx, j.Org, j.Repo, ctx.DateFrom)
+	}
 	FatalOnError(err)
 	runtime.GC()
 	nIss = len(issues)
@@ -2814,7 +3059,10 @@ func (j *DSGitHub) FetchItemsPullRequest(ctx *Ctx) (err error) {
 	// If it would we could use Pulls API to fetch all pulls when no date from is specified
 	// If there is a date from Pulls API doesn't support Since parameter
 	// if ctx.DateFrom != nil {
-	if 1 == 1 {
+	// GraphQL API returns pulls with all their sub items in bulk, so we don't need to go via issues
+	if j.GraphQL {
+		pulls, err = j.githubGraphQLPulls(ctx, j.Org, j.Repo, ctx.DateFrom)
+	} else if 1 == 1 {
 		pulls, err = j.githubPullsFromIssues(ctx, j.Org, j.Repo, ctx.DateFrom)
 	} else {
 		pulls, err = j.githubPulls(ctx, j.Org, j.Repo)
@@ -2964,6 +3212,23 @@ func (j *DSGitHub) ItemID(item interface{}) string {
 		}
 		return fmt.Sprintf("%v", id)
 	}
+	if j.Category == "release" {
+		// Every release snapshot is a separate item (download counts time series)
+		id, _ := item.(map[string]interface{})["id"].(float64)
+		fetchedOn, ok := item.(map[string]interface{})["fetched_on"]
+		if !ok {
+			Fatalf("%s: ItemID() - cannot extract fetched_on from %+v", j.DS, DumpKeys(item))
+		}
+		return fmt.Sprintf("%s/%s/%s/%d/%v", j.Org, j.Repo, j.Category, int64(id), fetchedOn)
+	}
+	if j.Category == "workflow_run" {
+		// Run numbers are only unique within a workflow
+		id, ok := item.(map[string]interface{})["id"]
+		if !ok {
+			Fatalf("%s: ItemID() - cannot extract id from %+v", j.DS, DumpKeys(item))
+		}
+		return fmt.Sprintf("%s/%s/%s/%d", j.Org, j.Repo, j.Category, int64(id.(float64)))
+	}
 	number, ok := item.(map[string]interface{})["number"]
 	if !ok {
 		Fatalf("%s: ItemID() - cannot extract number from %+v", j.DS, DumpKeys(item))
@@ -3010,7 +3275,7 @@ func (j *DSGitHub) AddMetadata(ctx *Ctx, item interface{}) (mItem map[string]int
 
 // ItemUpdatedOn - return updated on date for an item
 func (j *DSGitHub) ItemUpdatedOn(item interface{}) time.Time {
-	if j.Category == "repository" {
+	if j.Category == "repository" || j.Category == "release" {
 		epochNS, ok := item.(map[string]interface{})["fetched_on"].(float64)
 		if ok {
 			epochNS *= 1.0e9
@@ -3221,6 +3486,71 @@ func (j *DSGitHub) GetItemIdentities(ctx *Ctx, doc interface{}) (identities map[
 		// TODO: commits
 		// We don't process commits_data - we only hold array of commits SHAs here
 		// Code to process this is commented out because p2o is not doing this neither
+	case "event":
+		// event: events_data[].actor_data
+		identities = make(map[[3]string]struct{})
+		item, _ := Dig(doc, []string{"data"}, true, false)
+		events, ok := Dig(item, []string{"events_data"}, false, true)
+		if ok && events != nil {
+			ary, _ := events.([]interface{})
+			for _, event := range ary {
+				ev, _ := event.(map[string]interface{})
+				actor, ok := Dig(ev, []string{"actor_data"}, false, true)
+				if ok && actor != nil && len(actor.(map[string]interface{})) > 0 {
+					identities[j.IdentityForObject(ctx, actor.(map[string]interface{}))] = struct{}{}
+				}
+			}
+		}
+	case "discussion":
+		// discussion: user_data
+		// discussion: answer_chosen_by_data
+		// discussion: comments_data[].user_data
+		// discussion: comments_data[].replies_data[].user_data
+		identities = make(map[[3]string]struct{})
+		item, _ := Dig(doc, []string{"data"}, true, false)
+		for _, key := range []string{"user_data", "answer_chosen_by_data"} {
+			user, ok := Dig(item, []string{key}, false, true)
+			if ok && user != nil && len(user.(map[string]interface{})) > 0 {
+				identities[j.IdentityForObject(ctx, user.(map[string]interface{}))] = struct{}{}
+			}
+		}
+		discussion, _ := item.(map[string]interface{})
+		for _, comment := range GitHubDiscussionComments(discussion) {
+			user, ok := Dig(comment, []string{"user_data"}, false, true)
+			if ok && user != nil && len(user.(map[string]interface{})) > 0 {
+				identities[j.IdentityForObject(ctx, user.(map[string]interface{}))] = struct{}{}
+			}
+		}
+	case "release":
+		// release: author_data
+		// release: assets[].uploader_data
+		identities = make(map[[3]string]struct{})
+		item, _ := Dig(doc, []string{"data"}, true, false)
+		user, ok := Dig(item, []string{"author_data"}, false, true)
+		if ok && user != nil && len(user.(map[string]interface{})) > 0 {
+			identities[j.IdentityForObject(ctx, user.(map[string]interface{}))] = struct{}{}
+		}
+		assets, ok := Dig(item, []string{"assets"}, false, true)
+		if ok && assets != nil {
+			ary, _ := assets.([]interface{})
+			for _, asset := range ary {
+				user, ok := Dig(asset, []string{"uploader_data"}, false, true)
+				if ok && user != nil && len(user.(map[string]interface{})) > 0 {
+					identities[j.IdentityForObject(ctx, user.(map[string]interface{}))] = struct{}{}
+				}
+			}
+		}
+	case "workflow_run":
+		// workflow run: actor_data
+		// workflow run: triggering_actor_data
+		identities = make(map[[3]string]struct{})
+		item, _ := Dig(doc, []string{"data"}, true, false)
+		for _, key := range []string{"actor_data", "triggering_actor_data"} {
+			user, ok := Dig(item, []string{key}, false, true)
+			if ok && user != nil && len(user.(map[string]interface{})) > 0 {
+				identities[j.IdentityForObject(ctx, user.(map[string]interface{}))] = struct{}{}
+			}
+		}
 	}
 	return
 }
@@ -3237,6 +3567,14 @@ func GitHubEnrichItemsFunc(ctx *Ctx, ds DS, thrN int, items []interface{}, docs
 		return j.GitHubIssueEnrichItemsFunc(ctx, thrN, items, docs)
 	case "pull_request":
 		return j.GitHubPullRequestEnrichItemsFunc(ctx, thrN, items, docs)
+	case "event":
+		return j.GitHubEventEnrichItemsFunc(ctx, thrN, items, docs)
+	case "discussion":
+		return j.GitHubDiscussionEnrichItemsFunc(ctx, thrN, items, docs)
+	case "release":
+		return j.GitHubReleaseEnrichItemsFunc(ctx, thrN, items, docs)
+	case "workflow_run":
+		return j.GitHubWorkflowRunEnrichItemsFunc(ctx, thrN, items, docs)
 	default:
 		err = fmt.Errorf("GitHubEnrichItemsFunc: unknown category %s", j.Category)
 	}
@@ -3834,6 +4172,9 @@ func (j *DSGitHub) EnrichItems(ctx *Ctx) (err error) {
 	Printf("%s/%s: enriching items\n", j.URL, j.Category)
 	err = ForEachESItem(ctx, j, true, ESBulkUploadFunc, GitHubEnrichItemsFunc, nil, true)
 	Printf("%s/%s: enriched items\n", j.URL, j.Category)
+	if err == nil && j.Category == "pull_request" && j.GitIndex != "" {
+		err = j.LinkPullRequestCommits(ctx)
+	}
 	return
 }
 
@@ -3846,6 +4187,12 @@ func (j *DSGitHub) EnrichItem(ctx *Ctx, item map[string]interface{}, author stri
 		return j.EnrichIssueItem(ctx, item, author, affs, extra)
 	case "pull_request":
 		return j.EnrichPullRequestItem(ctx, item, author, affs, extra)
+	case "discussion":
+		return j.EnrichDiscussionItem(ctx, item, author, affs, extra)
+	case "release":
+		return j.EnrichReleaseItem(ctx, item, author, affs, extra)
+	case "workflow_run":
+		return j.EnrichWorkflowRunItem(ctx, item, author, affs, extra)
 	default:
 		err = fmt.Errorf("EnrichItem: unknown category %s", j.Category)
 	}
@@ -4983,18 +5330,7 @@ func (j *DSGitHub) EnrichIssueItem(ctx *Ctx, item map[string]interface{}, author
 		// rich["item_type"] = "pull request"
 		rich["item_type"] = "issue pull request"
 	}
-	githubRepo := j.URL
-	if strings.HasSuffix(githubRepo, ".git") {
-		githubRepo = githubRepo[:len(githubRepo)-4]
-	}
-	if strings.Contains(githubRepo, GitHubURLRoot) {
-		githubRepo = strings.Replace(githubRepo, GitHubURLRoot, "", -1)
-	}
-	var repoShortName string
-	arr := strings.Split(githubRepo, "/")
-	if len(arr) > 1 {
-		repoShortName = arr[1]
-	}
+	githubRepo, repoShortName := j.GetRepoShortURL(j.URL)
 	rich["repo_short_name"] = repoShortName
 	rich["github_repo"] = githubRepo
 	rich["url_id"] = fmt.Sprintf("%s/issues/%d", githubRepo, number)
@@ -5012,7 +5348,9 @@ func (j *DSGitHub) EnrichIssueItem(ctx *Ctx, item map[string]interface{}, author
 	}
 	rich["n_reactions"] = reactions
 	// if comments+reactions > 0 {
-	if commentsVal > 0 || nComments > 0 {
+	userLogin, _ := rich["user_login"].(string)
+	nAttentionEvents := len(j.AttentionEventDates(issue, userLogin))
+	if commentsVal > 0 || nComments > 0 || nAttentionEvents > 0 {
 		firstAttention := j.GetFirstIssueAttention(issue)
 		rich["time_to_first_attention"] = float64(firstAttention.Sub(createdAt).Seconds()) / 86400.0
 	}
@@ -5082,6 +5420,7 @@ func (j *DSGitHub) GetFirstIssueAttention(issue map[string]interface{}) (dt time
 			}
 		}
 	*/
+	dts = append(dts, j.AttentionEventDates(issue, userLogin)...)
 	nDts := len(dts)
 	if nDts == 0 {
 		// If there was no action of anybody else that author's, then fallback to author's actions
@@ -5159,6 +5498,12 @@ func (j *DSGitHub) EnrichPullRequestItem(ctx *Ctx, item map[string]interface{},
 	iMergedAt, _ := pull["merged_at"]
 	rich["merged_at"] = iMergedAt
 	rich["merged"], _ = pull["merged"]
+	rich["commit_shas"] = GitHubPullCommitSHAs(pull)
+	// GitHub sets merge_commit_sha to a test merge commit for not merged PRs
+	rich["merge_commit_sha"] = nil
+	if iMergedAt != nil {
+		rich["merge_commit_sha"], _ = pull["merge_commit_sha"]
+	}
 	rich["user_login"], _ = Dig(pull, []string{"user", "login"}, false, true)
 	iUserData, ok := pull["user_data"]
 	if ok && iUserData != nil {
@@ -5349,18 +5694,7 @@ func (j *DSGitHub) EnrichPullRequestItem(ctx *Ctx, item map[string]interface{},
 	rich["n_review_comments"] = nReviewComments
 	rich["pull_request"] = true
 	rich["item_type"] = "pull request"
-	githubRepo := j.URL
-	if strings.HasSuffix(githubRepo, ".git") {
-		githubRepo = githubRepo[:len(githubRepo)-4]
-	}
-	if strings.Contains(githubRepo, GitHubURLRoot) {
-		githubRepo = strings.Replace(githubRepo, GitHubURLRoot, "", -1)
-	}
-	var repoShortName string
-	arr := strings.Split(githubRepo, "/")
-	if len(arr) > 1 {
-		repoShortName = arr[1]
-	}
+	githubRepo, repoShortName := j.GetRepoShortURL(j.URL)
 	rich["repo_short_name"] = repoShortName
 	rich["github_repo"] = githubRepo
 	rich["url_id"] = fmt.Sprintf("%s/pull/%d", githubRepo, number)
@@ -5394,7 +5728,8 @@ func (j *DSGitHub) EnrichPullRequestItem(ctx *Ctx, item map[string]interface{},
 		firstReviewDate := j.GetFirstPullRequestReviewDate(pull, false)
 		rich["time_to_merge_request_response"] = float64(firstReviewDate.Sub(createdAt).Seconds()) / 86400.0
 	}
-	if nReviewComments > 0 || nComments > 0 {
+	userLogin, _ := rich["user_login"].(string)
+	if nReviewComments > 0 || nComments > 0 || len(j.AttentionEventDates(pull, userLogin)) > 0 {
 		firstAttentionDate := j.GetFirstPullRequestReviewDate(pull, true)
 		rich["time_to_first_attention"] = float64(firstAttentionDate.Sub(createdAt).Seconds()) / 86400.0
 	}
@@ -5463,6 +5798,7 @@ func (j *DSGitHub) GetFirstPullRequestReviewDate(pull map[string]interface{}, co
 				dts = append(dts, submittedAt)
 			}
 		}
+		dts = append(dts, j.AttentionEventDates(pull, userLogin)...)
 	}
 	nDts := len(dts)
 	if nDts == 0 {
@@ -5634,6 +5970,50 @@ func (j *DSGitHub) AllRoles(ctx *Ctx, rich map[string]interface{}) (roles []stri
 				possibleRoles = append(possibleRoles, "reviewer")
 			}
 		}
+	case "event":
+		roles = []string{Author}
+		if rich == nil {
+			return
+		}
+		possibleRoles = GitHubEventRoles
+		possibleRoles = append(possibleRoles, "actor")
+	case "discussion":
+		roles = []string{Author}
+		if rich == nil {
+			return
+		}
+		typ, ok := rich["type"]
+		if ok {
+			switch typ.(string) {
+			case "discussion":
+				possibleRoles = GitHubDiscussionRoles
+			case "discussion_comment", "discussion_reply":
+				possibleRoles = GitHubDiscussionCommentRoles
+				possibleRoles = append(possibleRoles, "commenter")
+			}
+		}
+	case "release":
+		roles = []string{Author}
+		if rich == nil {
+			return
+		}
+		typ, ok := rich["type"]
+		if ok {
+			switch typ.(string) {
+			case "release":
+				possibleRoles = GitHubReleaseRoles
+			case "release_asset":
+				possibleRoles = GitHubReleaseAssetRoles
+				possibleRoles = append(possibleRoles, "uploader")
+			}
+		}
+	case "workflow_run":
+		roles = []string{Author}
+		if rich == nil {
+			return
+		}
+		possibleRoles = GitHubWorkflowRunRoles
+		possibleRoles = append(possibleRoles, "actor")
 	}
 	for _, possibleRole := range possibleRoles {
 		_, ok := Dig(rich, []string{possibleRole + "_id"}, false, true)
@@ -0,0 +1,1563 @@
+package dads
+
+import (
+	"fmt"
+	neturl "net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// GitLabBackendVersion - backend version
+	GitLabBackendVersion = "0.0.1"
+	// GitLabDefaultURL - default GitLab instance
+	GitLabDefaultURL = "https://gitlab.com"
+	// GitLabDefaultMaxItems - default page size
+	GitLabDefaultMaxItems = 100
+	// GitLabDefaultMinRate - default min rate limit points before waiting for reset
+	GitLabDefaultMinRate = 10
+	// GitLabDefaultRetryAfter - seconds to wait when rate limited response has no Retry-After header
+	GitLabDefaultRetryAfter = 60
+	// GitLabRateLimitHeader - remaining requests header
+	GitLabRateLimitHeader = "RateLimit-Remaining"
+	// GitLabRateLimitResetHeader - rate limit reset (epoch seconds) header
+	GitLabRateLimitResetHeader = "RateLimit-Reset"
+	// GitLabApprovedNote - system note body added when user approves a merge request
+	GitLabApprovedNote = "approved this merge request"
+	// GitLabUnapprovedNote - system note body added when user revokes merge request approval
+	GitLabUnapprovedNote = "unapproved this merge request"
+)
+
+var (
+	// GitLabRawMapping - GitLab raw index mapping
+	GitLabRawMapping = []byte(`{"dynamic":true,"properties":{"metadata__updated_on":{"type":"date"},"data":{"dynamic":false,"properties":{}}}}`)
+	// GitLabRichMapping - GitLab rich index mapping, the same as GitHub's so both can be queried together
+	GitLabRichMapping = GitHubRichMapping
+	// GitLabCategories - categories defined for GitLab
+	GitLabCategories = map[string]struct{}{"issue": {}, "merge_request": {}, "pipeline": {}}
+	// GitLabIssueRoles - roles to fetch affiliation data for gitlab issue
+	GitLabIssueRoles = []string{"user_data", "assignee_data"}
+	// GitLabMergeRequestRoles - roles to fetch affiliation data for gitlab merge request
+	GitLabMergeRequestRoles = []string{"user_data", "assignee_data", "merged_by_data"}
+	// GitLabNoteRoles - roles to fetch affiliation data for gitlab issue or merge request note
+	GitLabNoteRoles = []string{"user_data"}
+	// GitLabApprovalRoles - roles to fetch affiliation data for gitlab merge request approval
+	GitLabApprovalRoles = []string{"user_data"}
+	// GitLabStates - maps GitLab issue/merge request state to GitHub state, so dashboards work for both
+	GitLabStates = map[string]string{"opened": "open", "closed": "closed", "merged": "closed", "locked": "closed"}
+)
+
+// DSGitLab - DS implementation for GitLab (gitlab.com or self-managed)
+type DSGitLab struct {
+	DS             string
+	URL            string // From DA_GITLAB_URL - GitLab instance URL, default https://gitlab.com
+	Project        string // From DA_GITLAB_PROJECT - project path with namespace, like group/subgroup/project
+	Category       string // From DA_GITLAB_CATEGORY - issue, merge_request or pipeline
+	Token          string // From DA_GITLAB_TOKEN - personal, group or project access token, optional for public projects
+	MaxItems       int    // From DA_GITLAB_MAX_ITEMS - page size, default 100 (max allowed by GitLab)
+	MinRate        int    // From DA_GITLAB_MIN_RATE - wait for rate limit reset when less requests remain, default 10
+	WaitRate       bool   // From DA_GITLAB_WAIT_RATE - will wait for rate limit reset (default), otherwise will fail
+	NoSSLVerify    bool   // From DA_GITLAB_NO_SSL_VERIFY
+	APIURL         string
+	ProjectURL     string
+	RateLimit      int
+	RateLimitReset int
+	Users          map[float64]map[string]interface{} // users cache by id
+}
+
+// ParseArgs - parse gitlab specific environment variables
+func (j *DSGitLab) ParseArgs(ctx *Ctx) (err error) {
+	j.DS = GitLab
+	prefix := "DA_GITLAB_"
+	j.URL = os.Getenv(prefix + "URL")
+	j.Project = os.Getenv(prefix + "PROJECT")
+	j.Category = os.Getenv(prefix + "CATEGORY")
+	j.Token = os.Getenv(prefix + "TOKEN")
+	AddRedacted(j.Token, false)
+	if ctx.Env("MAX_ITEMS") != "" {
+		maxItems, err := strconv.Atoi(ctx.Env("MAX_ITEMS"))
+		FatalOnError(err)
+		if maxItems > 0 {
+			j.MaxItems = maxItems
+		}
+	} else {
+		j.MaxItems = GitLabDefaultMaxItems
+	}
+	if ctx.Env("MIN_RATE") != "" {
+		minRate, err := strconv.Atoi(ctx.Env("MIN_RATE"))
+		FatalOnError(err)
+		if minRate > 0 {
+			j.MinRate = minRate
+		}
+	} else {
+		j.MinRate = GitLabDefaultMinRate
+	}
+	j.WaitRate = os.Getenv(prefix+"WAIT_RATE") == "" || StringToBool(os.Getenv(prefix+"WAIT_RATE"))
+	j.NoSSLVerify = StringToBool(os.Getenv(prefix + "NO_SSL_VERIFY"))
+	if j.NoSSLVerify {
+		NoSSLVerify()
+	}
+	return
+}
+
+// Validate - is current DS configuration OK?
+func (j *DSGitLab) Validate(ctx *Ctx) (err error) {
+	j.URL = strings.TrimSpace(j.URL)
+	if j.URL == "" {
+		j.URL = GitLabDefaultURL
+	}
+	j.URL = strings.TrimSuffix(j.URL, "/")
+	j.Project = strings.Trim(strings.TrimSpace(j.Project), "/")
+	j.Project = strings.TrimSuffix(j.Project, ".git")
+	if j.Project == "" {
+		err = fmt.Errorf("gitlab project must be set")
+		return
+	}
+	j.Category = strings.TrimSpace(j.Category)
+	_, ok := GitLabCategories[j.Category]
+	if !ok {
+		err = fmt.Errorf("unsupported gitlab category '%s', allowed: issue, merge_request, pipeline", j.Category)
+		return
+	}
+	if j.MaxItems > GitLabDefaultMaxItems {
+		j.MaxItems = GitLabDefaultMaxItems
+	}
+	j.APIURL = j.URL + "/api/v4"
+	j.ProjectURL = j.URL + "/" + j.Project
+	j.RateLimit, j.RateLimitReset = -1, -1
+	j.Users = make(map[float64]map[string]interface{})
+	return
+}
+
+// Name - return data source name
+func (j *DSGitLab) Name() string {
+	return j.DS
+}
+
+// Info - return DS configuration in a human readable form
+func (j DSGitLab) Info() string {
+	return fmt.Sprintf("%+v", j)
+}
+
+// CustomFetchRaw - is this datasource using custom fetch raw implementation?
+func (j *DSGitLab) CustomFetchRaw() bool {
+	return false
+}
+
+// FetchRaw - implement fetch raw data for gitlab datasource
+func (j *DSGitLab) FetchRaw(ctx *Ctx) (err error) {
+	Printf("%s should use generic FetchRaw()\n", j.DS)
+	return
+}
+
+// CustomEnrich - is this datasource using custom enrich implementation?
+func (j *DSGitLab) CustomEnrich() bool {
+	return false
+}
+
+// Enrich - implement enrich data for gitlab datasource
+func (j *DSGitLab) Enrich(ctx *Ctx) (err error) {
+	Printf("%s should use generic Enrich()\n", j.DS)
+	return
+}
+
+// CalculateTimeToReset - calculate time to reset rate limits based on rate limit value and rate limit reset value
+// RateLimit-Reset is an epoch timestamp in seconds
+func (j *DSGitLab) CalculateTimeToReset(ctx *Ctx, rateLimit, rateLimitReset int) (seconds int) {
+	seconds = rateLimitReset - int(time.Now().Unix()) + 1
+	if seconds < 0 {
+		seconds = 0
+	}
+	if ctx.Debug > 1 {
+		Printf("CalculateTimeToReset(%d,%d) -> %d\n", rateLimit, rateLimitReset, seconds)
+	}
+	return
+}
+
+// GitLabRetryAfter - return rate limit state that makes SleepForRateLimit wait as requested by 429 response's Retry-After header
+func GitLabRetryAfter(headers map[string][]string, now time.Time) (rateLimit, rateLimitReset int) {
+	after := GitLabDefaultRetryAfter
+	for k, v := range headers {
+		if strings.ToLower(k) != "retry-after" || len(v) == 0 {
+			continue
+		}
+		seconds, err := strconv.Atoi(strings.TrimSpace(v[0]))
+		if err == nil && seconds >= 0 {
+			after = seconds
+		}
+		break
+	}
+	return 1, int(now.Unix()) + after
+}
+
+// GitLabNextURL - return next page URL from "Link" header or "" when this is the last page
+func GitLabNextURL(headers map[string][]string) string {
+	for k, v := range headers {
+		if strings.ToLower(k) != "link" {
+			continue
+		}
+		for _, link := range strings.Split(strings.Join(v, ","), ",") {
+			ary := strings.Split(link, ";")
+			if len(ary) < 2 {
+				continue
+			}
+			for _, param := range ary[1:] {
+				if strings.Replace(strings.TrimSpace(param), " ", "", -1) == `rel="next"` {
+					return strings.Trim(strings.TrimSpace(ary[0]), "<>")
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// ProjectAPIURL - return project's API URL, project path is URL encoded as GitLab requires
+func (j *DSGitLab) ProjectAPIURL() string {
+	return j.APIURL + "/projects/" + neturl.PathEscape(j.Project)
+}
+
+// gitlabGet - GET gitlab API URL, waits for rate limit reset when needed
+// returns status for 403 and 404 (features not enabled or not available for the token), res is nil then
+func (j *DSGitLab) gitlabGet(ctx *Ctx, url string) (res interface{}, status int, next string, err error) {
+	var headers map[string]string
+	if j.Token != "" {
+		headers = map[string]string{"PRIVATE-TOKEN": j.Token}
+	}
+	var outHeaders map[string][]string
+	rates := 0
+	for {
+		err = SleepForRateLimit(ctx, j, j.RateLimit, j.RateLimitReset, j.MinRate, j.WaitRate)
+		if err != nil {
+			return
+		}
+		if ctx.Debug > 1 {
+			Printf("gitlab url: %s\n", url)
+		}
+		res, status, _, outHeaders, err = Request(
+			ctx,
+			url,
+			Get,
+			headers,
+			nil,
+			nil,
+			map[[2]int]struct{}{{200, 200}: {}}, // JSON statuses: 200
+			nil,                                 // Error statuses
+			map[[2]int]struct{}{{200, 200}: {}, {403, 404}: {}, {429, 429}: {}}, // OK statuses: 200, 403, 404, 429
+			nil,   // Cache statuses
+			true,  // retry
+			nil,   // cache duration
+			false, // skip in dry-run mode
+		)
+		// Too many requests
+		if status == 429 {
+			j.RateLimit, j.RateLimitReset = GitLabRetryAfter(outHeaders, time.Now())
+			rates++
+			continue
+		}
+		if err != nil {
+			return
+		}
+		j.RateLimit, j.RateLimitReset, _ = UpdateRateLimit(ctx, j, outHeaders, GitLabRateLimitHeader, GitLabRateLimitResetHeader)
+		if rates > 0 {
+			Printf("recovered after %d rate limits\n", rates)
+		}
+		break
+	}
+	if status != 200 {
+		res = nil
+		return
+	}
+	next = GitLabNextURL(outHeaders)
+	return
+}
+
+// gitlabGetObject - GET a single gitlab API object, nil when it is not available (403, 404)
+func (j *DSGitLab) gitlabGetObject(ctx *Ctx, url string) (object map[string]interface{}, err error) {
+	res, status, _, err := j.gitlabGet(ctx, url)
+	if err != nil || status != 200 {
+		return
+	}
+	object, ok := res.(map[string]interface{})
+	if !ok {
+		err = fmt.Errorf("cannot parse JSON object from %s: %+v", url, DumpPreview(res, 100))
+	}
+	return
+}
+
+// gitlabPages - GET all pages of a gitlab API list and call f for every object
+// available is false when the first page is not available (403, 404)
+func (j *DSGitLab) gitlabPages(ctx *Ctx, url string, f func(map[string]interface{}) error) (available bool, err error) {
+	sep := "?"
+	if strings.Contains(url, "?") {
+		sep = "&"
+	}
+	url += sep + "per_page=" + strconv.Itoa(j.MaxItems)
+	for url != "" {
+		var (
+			res    interface{}
+			status int
+		)
+		res, status, url, err = j.gitlabGet(ctx, url)
+		if err != nil {
+			return
+		}
+		if status != 200 {
+			return
+		}
+		available = true
+		ary, ok := res.([]interface{})
+		if !ok {
+			err = fmt.Errorf("cannot parse JSON array: %+v", DumpPreview(res, 100))
+			return
+		}
+		for _, iObject := range ary {
+			object, ok := iObject.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			err = f(object)
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// GitLabUserData - return user data in GitHub's user_data shape from user's basic info (as embedded in API objects) and its profile
+func GitLabUserData(user, profile map[string]interface{}) (userData map[string]interface{}) {
+	userData = map[string]interface{}{
+		"id":         user["id"],
+		"login":      user["username"],
+		"name":       user["name"],
+		"avatar_url": user["avatar_url"],
+		"web_url":    user["web_url"],
+		"email":      nil,
+		"company":    nil,
+		"location":   nil,
+	}
+	if profile == nil {
+		return
+	}
+	for _, field := range []string{"public_email", "email"} {
+		email, _ := profile[field].(string)
+		if email != "" {
+			userData["email"] = email
+			break
+		}
+	}
+	organization, _ := profile["organization"].(string)
+	if organization != "" {
+		userData["company"] = organization
+	}
+	location, _ := profile["location"].(string)
+	if location != "" {
+		userData["location"] = location
+	}
+	return
+}
+
+// gitlabUser - return user data (cached) for a user embedded in API object, nil for missing user
+func (j *DSGitLab) gitlabUser(ctx *Ctx, iUser interface{}) (userData map[string]interface{}, err error) {
+	user, ok := iUser.(map[string]interface{})
+	if !ok || user == nil {
+		return
+	}
+	id, ok := user["id"].(float64)
+	if !ok {
+		return
+	}
+	userData, ok = j.Users[id]
+	if ok {
+		return
+	}
+	profile, err := j.gitlabGetObject(ctx, fmt.Sprintf("%s/users/%d", j.APIURL, int64(id)))
+	if err != nil {
+		return
+	}
+	userData = GitLabUserData(user, profile)
+	j.Users[id] = userData
+	return
+}
+
+// gitlabUsers - return users data for a list of users embedded in API object
+func (j *DSGitLab) gitlabUsers(ctx *Ctx, iUsers interface{}) (usersData []interface{}, err error) {
+	usersData = []interface{}{}
+	users, _ := iUsers.([]interface{})
+	for _, iUser := range users {
+		var userData map[string]interface{}
+		userData, err = j.gitlabUser(ctx, iUser)
+		if err != nil {
+			return
+		}
+		if userData != nil {
+			usersData = append(usersData, userData)
+		}
+	}
+	return
+}
+
+// addNoteUsers - add user_data to notes
+func (j *DSGitLab) addNoteUsers(ctx *Ctx, notes []interface{}) (err error) {
+	for _, iNote := range notes {
+		note, _ := iNote.(map[string]interface{})
+		var userData map[string]interface{}
+		userData, err = j.gitlabUser(ctx, note["author"])
+		if err != nil {
+			return
+		}
+		note["user_data"] = userData
+	}
+	return
+}
+
+// gitlabNotes - get all issue notes (user comments and system notes), oldest first
+func (j *DSGitLab) gitlabNotes(ctx *Ctx, iid int) (notes []interface{}, err error) {
+	notes = []interface{}{}
+	url := fmt.Sprintf("%s/issues/%d/notes?sort=asc&order_by=created_at", j.ProjectAPIURL(), iid)
+	_, err = j.gitlabPages(ctx, url, func(note map[string]interface{}) error {
+		notes = append(notes, note)
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	err = j.addNoteUsers(ctx, notes)
+	return
+}
+
+// gitlabDiscussionNotes - get all merge request discussions and return their notes (oldest first) and discussions count
+// Discussions contain all merge request notes (stand-alone comments are single note discussions), so notes are not fetched separately
+// Each note gets its discussion id and discussion's resolved state
+func (j *DSGitLab) gitlabDiscussionNotes(ctx *Ctx, iid int) (notes []interface{}, nDiscussions, nUnresolved int, err error) {
+	notes = []interface{}{}
+	url := fmt.Sprintf("%s/merge_requests/%d/discussions", j.ProjectAPIURL(), iid)
+	_, err = j.gitlabPages(ctx, url, func(discussion map[string]interface{}) error {
+		discussionNotes, _ := discussion["notes"].([]interface{})
+		resolvable, resolved := false, true
+		userNotes := 0
+		for _, iNote := range discussionNotes {
+			note, ok := iNote.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			system, _ := note["system"].(bool)
+			if !system {
+				userNotes++
+			}
+			noteResolvable, _ := note["resolvable"].(bool)
+			if noteResolvable {
+				resolvable = true
+				noteResolved, _ := note["resolved"].(bool)
+				resolved = resolved && noteResolved
+			}
+			note["discussion_id"], _ = discussion["id"]
+			notes = append(notes, note)
+		}
+		if userNotes > 0 {
+			nDiscussions++
+		}
+		if resolvable && !resolved {
+			nUnresolved++
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	sort.SliceStable(notes, func(a, b int) bool {
+		ca, _ := notes[a].(map[string]interface{})["created_at"].(string)
+		cb, _ := notes[b].(map[string]interface{})["created_at"].(string)
+		da, _ := TimeParseAny(ca)
+		db, _ := TimeParseAny(cb)
+		return da.Before(db)
+	})
+	err = j.addNoteUsers(ctx, notes)
+	return
+}
+
+// GitLabApprovals - return merge request approvals: user and approved_at date
+// Approval dates come from "approved this merge request" system notes (approvals API has no dates),
+// approvedBy is the approvals API "approved_by" list, when it is nil (API not available) approvals are taken from notes only
+func GitLabApprovals(approvedBy []interface{}, notes []interface{}) (approvals []interface{}) {
+	approvals = []interface{}{}
+	approvedAt := make(map[float64]interface{})
+	noteUsers := make(map[float64]interface{})
+	order := []float64{}
+	for _, iNote := range notes {
+		note, _ := iNote.(map[string]interface{})
+		system, _ := note["system"].(bool)
+		if !system {
+			continue
+		}
+		body, _ := note["body"].(string)
+		id, _ := Dig(note, []string{"author", "id"}, false, true)
+		fID, ok := id.(float64)
+		if !ok {
+			continue
+		}
+		switch strings.TrimSpace(body) {
+		case GitLabApprovedNote:
+			_, ok := noteUsers[fID]
+			if !ok {
+				order = append(order, fID)
+			}
+			approvedAt[fID], _ = note["created_at"]
+			noteUsers[fID], _ = note["author"]
+		case GitLabUnapprovedNote:
+			delete(approvedAt, fID)
+		}
+	}
+	if approvedBy == nil {
+		for _, id := range order {
+			at, ok := approvedAt[id]
+			if ok {
+				approvals = append(approvals, map[string]interface{}{"user": noteUsers[id], "approved_at": at})
+			}
+		}
+		return
+	}
+	for _, iApproval := range approvedBy {
+		user, ok := Dig(iApproval, []string{"user"}, false, true)
+		if !ok {
+			continue
+		}
+		id, _ := Dig(user, []string{"id"}, false, true)
+		fID, _ := id.(float64)
+		at, _ := approvedAt[fID]
+		approvals = append(approvals, map[string]interface{}{"user": user, "approved_at": at})
+	}
+	return
+}
+
+// ProcessIssue - add issue's users and notes
+func (j *DSGitLab) ProcessIssue(ctx *Ctx, issue map[string]interface{}) (err error) {
+	err = j.ProcessIssueUsers(ctx, issue)
+	if err != nil {
+		return
+	}
+	iid, _ := issue["iid"].(float64)
+	issue["notes_data"], err = j.gitlabNotes(ctx, int(iid))
+	return
+}
+
+// ProcessMergeRequest - add merge request's users, discussions notes and approvals
+func (j *DSGitLab) ProcessMergeRequest(ctx *Ctx, mr map[string]interface{}) (err error) {
+	err = j.ProcessIssueUsers(ctx, mr)
+	if err != nil {
+		return
+	}
+	mergedBy, ok := mr["merge_user"]
+	if !ok || mergedBy == nil {
+		mergedBy, _ = mr["merged_by"]
+	}
+	mr["merged_by_data"], err = j.gitlabUser(ctx, mergedBy)
+	if err != nil {
+		return
+	}
+	mr["reviewers_data"], err = j.gitlabUsers(ctx, mr["reviewers"])
+	if err != nil {
+		return
+	}
+	fIID, _ := mr["iid"].(float64)
+	iid := int(fIID)
+	notes, nDiscussions, nUnresolved, err := j.gitlabDiscussionNotes(ctx, iid)
+	if err != nil {
+		return
+	}
+	mr["notes_data"] = notes
+	mr["n_discussions"] = nDiscussions
+	mr["n_unresolved_discussions"] = nUnresolved
+	var approvedBy []interface{}
+	approvalsInfo, err := j.gitlabGetObject(ctx, fmt.Sprintf("%s/merge_requests/%d/approvals", j.ProjectAPIURL(), iid))
+	if err != nil {
+		return
+	}
+	if approvalsInfo != nil {
+		approvedBy, _ = approvalsInfo["approved_by"].([]interface{})
+		if approvedBy == nil {
+			approvedBy = []interface{}{}
+		}
+		mr["approvals_required"], _ = approvalsInfo["approvals_required"]
+	}
+	approvals := GitLabApprovals(approvedBy, notes)
+	for _, iApproval := range approvals {
+		approval, _ := iApproval.(map[string]interface{})
+		approval["user_data"], err = j.gitlabUser(ctx, approval["user"])
+		if err != nil {
+			return
+		}
+	}
+	mr["approvals_data"] = approvals
+	return
+}
+
+// ProcessIssueUsers - add author and assignees user data to an issue or merge request
+func (j *DSGitLab) ProcessIssueUsers(ctx *Ctx, issue map[string]interface{}) (err error) {
+	issue["user_data"], err = j.gitlabUser(ctx, issue["author"])
+	if err != nil {
+		return
+	}
+	issue["assignee_data"], err = j.gitlabUser(ctx, issue["assignee"])
+	if err != nil {
+		return
+	}
+	issue["assignees_data"], err = j.gitlabUsers(ctx, issue["assignees"])
+	return
+}
+
+// FetchItems - implement fetch items for gitlab datasource
+// Items are listed by update date (oldest first) starting from date from, each is then completed by its details
+func (j *DSGitLab) FetchItems(ctx *Ctx) (err error) {
+	var dateFrom time.Time
+	if ctx.DateFrom != nil {
+		dateFrom = *ctx.DateFrom
+	} else {
+		dateFrom = DefaultDateFrom
+	}
+	var (
+		path    string
+		process func(*Ctx, map[string]interface{}) error
+	)
+	switch j.Category {
+	case "issue":
+		path, process = "/issues?scope=all&", j.ProcessIssue
+	case "merge_request":
+		path, process = "/merge_requests?scope=all&", j.ProcessMergeRequest
+	case "pipeline":
+		path, process = "/pipelines?", j.ProcessPipeline
+	}
+	url := j.ProjectAPIURL() + path + "order_by=updated_at&sort=asc&updated_after=" + neturl.QueryEscape(dateFrom.UTC().Format(time.RFC3339))
+	var allItems []interface{}
+	nItems := 0
+	available, err := j.gitlabPages(ctx, url, func(item map[string]interface{}) (e error) {
+		if ctx.DateTo != nil {
+			updated, e := TimeParseInterfaceString(item["updated_at"])
+			if e == nil && updated.After(*ctx.DateTo) {
+				return nil
+			}
+		}
+		e = process(ctx, item)
+		if e != nil {
+			return
+		}
+		esItem := j.AddMetadata(ctx, item)
+		if ctx.Project != "" {
+			item["project"] = ctx.Project
+		}
+		esItem["data"] = item
+		allItems = append(allItems, esItem)
+		nItems++
+		if len(allItems) >= ctx.ESBulkSize {
+			e = SendToElastic(ctx, j, true, UUID, allItems)
+			if e != nil {
+				Printf("error %v sending %d %s items to ElasticSearch\n", e, len(allItems), j.Category)
+				return
+			}
+			allItems = []interface{}{}
+		}
+		return
+	})
+	if err != nil {
+		return
+	}
+	if !available {
+		err = fmt.Errorf("%s: %s list is not available, check project path, token and whether the feature is enabled", j.ProjectURL, j.Category)
+		return
+	}
+	if ctx.Debug > 0 {
+		Printf("%s: %d %s items fetched, %d remaining items to send to ES\n", j.ProjectURL, nItems, j.Category, len(allItems))
+	}
+	if len(allItems) > 0 {
+		err = SendToElastic(ctx, j, true, UUID, allItems)
+		if err != nil {
+			Printf("Error %v sending %d %s items to ES\n", err, len(allItems), j.Category)
+		}
+	}
+	return
+}
+
+// SupportDateFrom - does DS support resuming from date?
+func (j *DSGitLab) SupportDateFrom() bool {
+	return true
+}
+
+// SupportOffsetFrom - does DS support resuming from offset?
+func (j *DSGitLab) SupportOffsetFrom() bool {
+	return false
+}
+
+// DateField - return date field used to detect where to restart from
+func (j *DSGitLab) DateField(*Ctx) string {
+	return DefaultDateField
+}
+
+// RichIDField - return rich ID field name
+func (j *DSGitLab) RichIDField(*Ctx) string {
+	return DefaultIDField
+}
+
+// RichAuthorField - return rich author field name
+func (j *DSGitLab) RichAuthorField(*Ctx) string {
+	return DefaultAuthorField
+}
+
+// OffsetField - return offset field used to detect where to restart from
+func (j *DSGitLab) OffsetField(*Ctx) string {
+	return DefaultOffsetField
+}
+
+// OriginField - return origin field used to detect where to restart from
+func (j *DSGitLab) OriginField(ctx *Ctx) string {
+	if ctx.Tag != "" {
+		return DefaultTagField
+	}
+	return DefaultOriginField
+}
+
+// Categories - return a set of configured categories
+func (j *DSGitLab) Categories() map[string]struct{} {
+	return GitLabCategories
+}
+
+// ResumeNeedsOrigin - is origin field needed when resuming
+// Origin should be needed when multiple configurations save to the same index
+func (j *DSGitLab) ResumeNeedsOrigin(ctx *Ctx, raw bool) bool {
+	return true
+}
+
+// ResumeNeedsCategory - is category field needed when resuming
+// Category should be needed when multiple types of categories save to the same index
+// or there are multiple types of documents within the same category
+func (j *DSGitLab) ResumeNeedsCategory(ctx *Ctx, raw bool) bool {
+	return true
+}
+
+// Origin - return current origin
+func (j *DSGitLab) Origin(ctx *Ctx) string {
+	return j.ProjectURL
+}
+
+// ItemID - return unique identifier for an item
+// issues and merge requests use project-wide iid, pipelines their id
+func (j *DSGitLab) ItemID(item interface{}) string {
+	field := "iid"
+	if j.Category == "pipeline" {
+		field = "id"
+	}
+	id, ok := item.(map[string]interface{})[field].(float64)
+	if !ok {
+		Fatalf("%s: ItemID() - cannot extract %s from %+v", j.DS, field, DumpKeys(item))
+	}
+	return fmt.Sprintf("%s/%s/%d", j.Project, j.Category, int64(id))
+}
+
+// AddMetadata - add metadata to the item
+func (j *DSGitLab) AddMetadata(ctx *Ctx, item interface{}) (mItem map[string]interface{}) {
+	mItem = make(map[string]interface{})
+	origin := j.ProjectURL
+	tag := ctx.Tag
+	if tag == "" {
+		tag = origin
+	}
+	itemID := j.ItemID(item)
+	updatedOn := j.ItemUpdatedOn(item)
+	uuid := UUIDNonEmpty(ctx, origin, itemID)
+	timestamp := time.Now()
+	mItem["backend_name"] = j.DS
+	mItem["backend_version"] = GitLabBackendVersion
+	mItem["timestamp"] = fmt.Sprintf("%.06f", float64(timestamp.UnixNano())/1.0e9)
+	mItem[UUID] = uuid
+	mItem[DefaultOriginField] = origin
+	mItem[DefaultTagField] = tag
+	mItem[DefaultOffsetField] = float64(updatedOn.Unix())
+	mItem["category"] = j.ItemCategory(item)
+	mItem["is_gitlab_"+j.Category] = 1
+	mItem["search_fields"] = make(map[string]interface{})
+	FatalOnError(DeepSet(mItem, []string{"search_fields", "project"}, j.Project, false))
+	FatalOnError(DeepSet(mItem, []string{"search_fields", "item_id"}, itemID, false))
+	mItem[DefaultDateField] = ToESDate(updatedOn)
+	mItem[DefaultTimestampField] = ToESDate(timestamp)
+	mItem[ProjectSlug] = ctx.ProjectSlug
+	return
+}
+
+// ItemUpdatedOn - return updated on date for an item
+func (j *DSGitLab) ItemUpdatedOn(item interface{}) time.Time {
+	iWhen, _ := Dig(item, []string{"updated_at"}, true, false)
+	when, err := TimeParseInterfaceString(iWhen)
+	FatalOnError(err)
+	return when
+}
+
+// ItemCategory - return unique identifier for an item
+func (j *DSGitLab) ItemCategory(item interface{}) string {
+	return j.Category
+}
+
+// ElasticRawMapping - Raw index mapping definition
+func (j *DSGitLab) ElasticRawMapping() []byte {
+	return GitLabRawMapping
+}
+
+// ElasticRichMapping - Rich index mapping definition
+func (j *DSGitLab) ElasticRichMapping() []byte {
+	return GitLabRichMapping
+}
+
+// IdentityForObject - construct identity from a given user data object
+func (j *DSGitLab) IdentityForObject(ctx *Ctx, user map[string]interface{}) (identity [3]string) {
+	for i, field := range []string{"name", "login", "email"} {
+		identity[i] = Nil
+		value, _ := user[field].(string)
+		if value != "" {
+			identity[i] = value
+		}
+	}
+	return
+}
+
+// GetItemIdentities return list of item's identities, each one is [3]string
+// (name, username, email) tripples, special value Nil "none" means null
+// we use string and not *string which allows nil to allow usage as a map key
+func (j *DSGitLab) GetItemIdentities(ctx *Ctx, doc interface{}) (identities map[[3]string]struct{}, err error) {
+	if ctx.Debug > 2 {
+		defer func() {
+			Printf("GetItemIdentities: %+v -> %+v\n", DumpPreview(doc, 100), identities)
+		}()
+	}
+	iItem, ok := Dig(doc, []string{"data"}, false, true)
+	if !ok {
+		return
+	}
+	item, _ := iItem.(map[string]interface{})
+	identities = make(map[[3]string]struct{})
+	add := func(iUser interface{}) {
+		user, ok := iUser.(map[string]interface{})
+		if ok && user != nil {
+			identities[j.IdentityForObject(ctx, user)] = struct{}{}
+		}
+	}
+	for _, field := range []string{"user_data", "assignee_data", "merged_by_data"} {
+		add(item[field])
+	}
+	for _, field := range []string{"assignees_data", "reviewers_data"} {
+		users, _ := item[field].([]interface{})
+		for _, user := range users {
+			add(user)
+		}
+	}
+	for _, field := range []string{"notes_data", "approvals_data"} {
+		objects, _ := item[field].([]interface{})
+		for _, object := range objects {
+			user, _ := Dig(object, []string{"user_data"}, false, true)
+			add(user)
+		}
+	}
+	return
+}
+
+// GitLabEnrichItemsFunc - iterate items and enrich them
+// items is a current pack of input items
+// docs is a pointer to where extracted identities will be stored
+func GitLabEnrichItemsFunc(ctx *Ctx, ds DS, thrN int, items []interface{}, docs *[]interface{}) (err error) {
+	j, _ := ds.(*DSGitLab)
+	if ctx.Debug > 0 {
+		Printf("%s/%s: gitlab enrich items %d/%d func\n", j.ProjectURL, j.Category, len(items), len(*docs))
+	}
+	var (
+		mtx *sync.RWMutex
+		ch  chan error
+	)
+	if thrN > 1 {
+		mtx = &sync.RWMutex{}
+		ch = make(chan error)
+	}
+	dbConfigured := ctx.AffsDBConfigured()
+	getRichItems := func(doc map[string]interface{}) (richItems []interface{}, e error) {
+		var rich map[string]interface{}
+		rich, e = j.EnrichItem(ctx, doc, "", dbConfigured, nil)
+		if e != nil {
+			return
+		}
+		riches := []interface{}{rich}
+		data, _ := doc["data"].(map[string]interface{})
+		if j.Category != "pipeline" {
+			var comments []interface{}
+			comments, e = j.EnrichNotes(ctx, rich, data, dbConfigured)
+			if e != nil {
+				return
+			}
+			riches = append(riches, comments...)
+		}
+		if j.Category == "merge_request" {
+			var approvals []interface{}
+			approvals, e = j.EnrichApprovals(ctx, rich, data, dbConfigured)
+			if e != nil {
+				return
+			}
+			riches = append(riches, approvals...)
+		}
+		for _, rich := range riches {
+			_, authorIDOK := Dig(rich, []string{"author_id"}, false, true)
+			if !authorIDOK && ctx.CheckAuthorID {
+				continue
+			}
+			richItems = append(richItems, rich)
+		}
+		return
+	}
+	nThreads := 0
+	procItem := func(c chan error, idx int) (e error) {
+		if thrN > 1 {
+			mtx.RLock()
+		}
+		item := items[idx]
+		if thrN > 1 {
+			mtx.RUnlock()
+		}
+		defer func() {
+			if c != nil {
+				c <- e
+			}
+		}()
+		src, ok := item.(map[string]interface{})["_source"]
+		if !ok {
+			e = fmt.Errorf("Missing _source in item %+v", DumpKeys(item))
+			return
+		}
+		doc, ok := src.(map[string]interface{})
+		if !ok {
+			e = fmt.Errorf("Failed to parse document %+v", doc)
+			return
+		}
+		richItems, e := getRichItems(doc)
+		if e != nil {
+			return
+		}
+		for _, rich := range richItems {
+			e = EnrichItem(ctx, ds, rich.(map[string]interface{}))
+			if e != nil {
+				return
+			}
+		}
+		if thrN > 1 {
+			mtx.Lock()
+		}
+		*docs = append(*docs, richItems...)
+		if thrN > 1 {
+			mtx.Unlock()
+		}
+		return
+	}
+	if thrN > 1 {
+		for i := range items {
+			go func(i int) {
+				_ = procItem(ch, i)
+			}(i)
+			nThreads++
+			if nThreads == thrN {
+				err = <-ch
+				if err != nil {
+					return
+				}
+				nThreads--
+			}
+		}
+		for nThreads > 0 {
+			err = <-ch
+			nThreads--
+			if err != nil {
+				return
+			}
+		}
+		return
+	}
+	for i := range items {
+		err = procItem(nil, i)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// EnrichItems - perform the enrichment
+func (j *DSGitLab) EnrichItems(ctx *Ctx) (err error) {
+	Printf("%s/%s: enriching items\n", j.ProjectURL, j.Category)
+	err = ForEachESItem(ctx, j, true, ESBulkUploadFunc, GitLabEnrichItemsFunc, nil, true)
+	return
+}
+
+// EnrichItem - return rich item from raw item for a given author type
+func (j *DSGitLab) EnrichItem(ctx *Ctx, item map[string]interface{}, author string, affs bool, extra interface{}) (rich map[string]interface{}, err error) {
+	switch j.Category {
+	case "issue":
+		return j.EnrichIssueItem(ctx, item, affs)
+	case "merge_request":
+		return j.EnrichMergeRequestItem(ctx, item, affs)
+	case "pipeline":
+		return j.EnrichPipelineItem(ctx, item, affs)
+	}
+	err = fmt.Errorf("unknown gitlab category '%s'", j.Category)
+	return
+}
+
+// GitLabUserFields - set GitHub-like identity fields (<prefix>_login, _name, _avatar_url, _domain, _org, _location, _geolocation) from user data
+func GitLabUserFields(rich map[string]interface{}, prefix string, iUser interface{}) {
+	user, _ := iUser.(map[string]interface{})
+	if user == nil {
+		for _, suff := range []string{"_login", "_name", "_avatar_url", "_domain", "_org", "_location", "_geolocation"} {
+			rich[prefix+suff] = nil
+		}
+		return
+	}
+	rich[prefix+"_login"], _ = user["login"]
+	rich[prefix+"_name"], _ = user["name"]
+	rich[prefix+"_avatar_url"], _ = user["avatar_url"]
+	rich[prefix+"_domain"] = nil
+	email, _ := user["email"].(string)
+	ary := strings.Split(email, "@")
+	if len(ary) > 1 {
+		rich[prefix+"_domain"] = strings.TrimSpace(ary[1])
+	}
+	rich[prefix+"_org"], _ = user["company"]
+	rich[prefix+"_location"], _ = user["location"]
+	rich[prefix+"_geolocation"] = nil
+}
+
+// GitLabFirstAttention - return first date of other than author's activity in notes (and approvals)
+// falls back to author's own activity when there is no other, ok is false when there is no activity at all
+// userNotesOnly skips system notes (label changes, approvals, etc.)
+func GitLabFirstAttention(authorID interface{}, notes, approvals []interface{}, userNotesOnly bool) (dt time.Time, ok bool) {
+	dts := []time.Time{}
+	udts := []time.Time{}
+	add := func(userID, iWhen interface{}) {
+		when, err := TimeParseInterfaceString(iWhen)
+		if err != nil {
+			return
+		}
+		if userID == authorID {
+			udts = append(udts, when)
+			return
+		}
+		dts = append(dts, when)
+	}
+	for _, iNote := range notes {
+		note, _ := iNote.(map[string]interface{})
+		system, _ := note["system"].(bool)
+		if system && userNotesOnly {
+			continue
+		}
+		userID, _ := Dig(note, []string{"author", "id"}, false, true)
+		add(userID, note["created_at"])
+	}
+	for _, iApproval := range approvals {
+		approval, _ := iApproval.(map[string]interface{})
+		if approval["approved_at"] == nil {
+			continue
+		}
+		userID, _ := Dig(approval, []string{"user", "id"}, false, true)
+		add(userID, approval["approved_at"])
+	}
+	if len(dts) == 0 {
+		dts = udts
+	}
+	if len(dts) == 0 {
+		return
+	}
+	sort.Slice(dts, func(i, j int) bool {
+		return dts[i].Before(dts[j])
+	})
+	return dts[0], true
+}
+
+// gitlabRepoNames - return project path and its short name
+func (j *DSGitLab) gitlabRepoNames() (repo, shortName string) {
+	repo = j.Project
+	ary := strings.Split(repo, "/")
+	shortName = ary[len(ary)-1]
+	return
+}
+
+// enrichIssueCommon - set fields shared by issue and merge request rich items (GitHub issue/pull request compatible)
+func (j *DSGitLab) enrichIssueCommon(ctx *Ctx, item, issue, rich map[string]interface{}, userNotesOnly bool) (createdAt time.Time) {
+	for _, field := range RawFields {
+		v, _ := item[field]
+		rich[field] = v
+	}
+	if ctx.Project != "" {
+		rich["project"] = ctx.Project
+	}
+	rich["repo_name"] = j.ProjectURL
+	rich["repository"] = j.ProjectURL
+	rich["id"] = j.ItemID(issue)
+	rich["type"] = j.Category
+	rich["category"] = j.Category
+	createdAt, _ = TimeParseInterfaceString(issue["created_at"])
+	updatedOn, _ := Dig(item, []string{j.DateField(ctx)}, true, false)
+	rich["created_at"] = createdAt
+	rich["updated_at"] = updatedOn
+	gitlabState, _ := issue["state"].(string)
+	rich["gitlab_state"] = gitlabState
+	state, ok := GitLabStates[gitlabState]
+	if !ok {
+		state = gitlabState
+	}
+	rich["state"] = state
+	// merged merge requests have no closed_at
+	iClosedAt, _ := issue["closed_at"]
+	if iClosedAt == nil {
+		iClosedAt, _ = issue["merged_at"]
+	}
+	rich["closed_at"] = iClosedAt
+	rich["time_to_close_days"] = nil
+	if iClosedAt != nil {
+		closedAt, e := TimeParseInterfaceString(iClosedAt)
+		if e == nil {
+			rich["time_to_close_days"] = float64(closedAt.Sub(createdAt).Seconds()) / 86400.0
+		}
+	}
+	if state == "closed" {
+		rich["time_open_days"] = rich["time_to_close_days"]
+	} else {
+		rich["time_open_days"] = float64(time.Now().Sub(createdAt).Seconds()) / 86400.0
+	}
+	iid, _ := issue["iid"].(float64)
+	rich["id_in_repo"] = int(iid)
+	rich["title"], _ = issue["title"]
+	rich["title_analyzed"], _ = issue["title"]
+	rich["body"], _ = issue["description"]
+	rich["body_analyzed"], _ = issue["description"]
+	rich["url"], _ = issue["web_url"]
+	rich["user_login"], _ = Dig(issue, []string{"author", "username"}, false, true)
+	userData, _ := issue["user_data"].(map[string]interface{})
+	GitLabUserFields(rich, "user", userData)
+	rich["author_login"] = rich["user_login"]
+	rich["author_name"] = rich["user_name"]
+	rich["author_avatar_url"] = rich["user_avatar_url"]
+	GitLabUserFields(rich, "assignee", issue["assignee_data"])
+	labels := []interface{}{}
+	iLabels, _ := issue["labels"].([]interface{})
+	for _, iLabel := range iLabels {
+		switch label := iLabel.(type) {
+		case string:
+			labels = append(labels, label)
+		case map[string]interface{}:
+			name, ok := label["name"].(string)
+			if ok {
+				labels = append(labels, name)
+			}
+		}
+	}
+	rich["labels"] = labels
+	assignees := []interface{}{}
+	iAssignees, _ := issue["assignees_data"].([]interface{})
+	for _, iAssignee := range iAssignees {
+		login, _ := Dig(iAssignee, []string{"login"}, false, true)
+		if login != nil {
+			assignees = append(assignees, login)
+		}
+	}
+	rich["assignees_data"] = assignees
+	rich["n_assignees"] = len(assignees)
+	notes, _ := issue["notes_data"].([]interface{})
+	commenters := map[string]struct{}{}
+	nComments := 0
+	for _, iNote := range notes {
+		note, _ := iNote.(map[string]interface{})
+		system, _ := note["system"].(bool)
+		if system {
+			continue
+		}
+		nComments++
+		login, _ := Dig(note, []string{"author", "username"}, false, true)
+		sLogin, _ := login.(string)
+		if sLogin != "" {
+			commenters[sLogin] = struct{}{}
+		}
+	}
+	comms := []string{}
+	for commenter := range commenters {
+		comms = append(comms, commenter)
+	}
+	sort.Strings(comms)
+	rich["commenters"] = comms
+	rich["n_commenters"] = len(comms)
+	rich["n_comments"] = nComments
+	userNotes, _ := issue["user_notes_count"].(float64)
+	rich["n_total_comments"] = int(userNotes)
+	upvotes, _ := issue["upvotes"].(float64)
+	downvotes, _ := issue["downvotes"].(float64)
+	rich["n_reactions"] = int(upvotes + downvotes)
+	repo, shortName := j.gitlabRepoNames()
+	rich["gitlab_repo"] = repo
+	rich["repo_short_name"] = shortName
+	authorID, _ := Dig(issue, []string{"author", "id"}, false, true)
+	approvals, _ := issue["approvals_data"].([]interface{})
+	rich["time_to_first_attention"] = nil
+	firstAttention, ok := GitLabFirstAttention(authorID, notes, approvals, userNotesOnly)
+	if ok {
+		rich["time_to_first_attention"] = float64(firstAttention.Sub(createdAt).Seconds()) / 86400.0
+	}
+	rich[j.DateField(ctx)] = createdAt
+	return
+}
+
+// enrichAffs - set affiliation fields for given roles, author fields come from user_data role, alias fields (like reviewer or commenter) too
+func (j *DSGitLab) enrichAffs(ctx *Ctx, rich, item map[string]interface{}, roles []string, date time.Time, alias string) (err error) {
+	authorKey := "user_data"
+	affsItems, err := j.AffsItems(ctx, item, roles, date)
+	if err != nil {
+		return
+	}
+	for prop, value := range affsItems {
+		rich[prop] = value
+	}
+	for _, suff := range AffsFields {
+		rich[Author+suff] = rich[authorKey+suff]
+		if alias != "" {
+			rich[alias+suff] = rich[authorKey+suff]
+		}
+	}
+	orgsKey := authorKey + MultiOrgNames
+	_, ok := Dig(rich, []string{orgsKey}, false, true)
+	if !ok {
+		rich[orgsKey] = []interface{}{}
+	}
+	return
+}
+
+// EnrichIssueItem - return rich issue item from raw item
+func (j *DSGitLab) EnrichIssueItem(ctx *Ctx, item map[string]interface{}, affs bool) (rich map[string]interface{}, err error) {
+	rich = make(map[string]interface{})
+	issue, ok := item["data"].(map[string]interface{})
+	if !ok {
+		err = fmt.Errorf("missing data field in item %+v", DumpKeys(item))
+		return
+	}
+	createdAt := j.enrichIssueCommon(ctx, item, issue, rich, false)
+	rich["issue_id"], _ = issue["id"]
+	rich["pull_request"] = false
+	rich["item_type"] = "issue"
+	rich["url_id"] = fmt.Sprintf("%s/issues/%d", j.Project, rich["id_in_repo"])
+	rich["confidential"], _ = issue["confidential"]
+	if affs {
+		err = j.enrichAffs(ctx, rich, issue, GitLabIssueRoles, createdAt, "")
+		if err != nil {
+			return
+		}
+	}
+	for prop, value := range CommonFields(j, createdAt, j.Category) {
+		rich[prop] = value
+	}
+	return
+}
+
+// EnrichMergeRequestItem - return rich merge request item from raw item (GitHub pull request compatible)
+func (j *DSGitLab) EnrichMergeRequestItem(ctx *Ctx, item map[string]interface{}, affs bool) (rich map[string]interface{}, err error) {
+	rich = make(map[string]interface{})
+	mr, ok := item["data"].(map[string]interface{})
+	if !ok {
+		err = fmt.Errorf("missing data field in item %+v", DumpKeys(item))
+		return
+	}
+	createdAt := j.enrichIssueCommon(ctx, item, mr, rich, false)
+	rich["pull_request_id"], _ = mr["id"]
+	rich["pull_request"] = true
+	rich["item_type"] = "pull request"
+	rich["url_id"] = fmt.Sprintf("%s/merge_requests/%d", j.Project, rich["id_in_repo"])
+	for _, field := range []string{"source_branch", "target_branch", "draft", "sha", "approvals_required", "n_discussions", "n_unresolved_discussions"} {
+		rich[field], _ = mr[field]
+	}
+	iMergedAt, _ := mr["merged_at"]
+	rich["merged_at"] = iMergedAt
+	rich["merged"] = iMergedAt != nil
+	rich["merge_commit_sha"] = nil
+	rich["code_merge_duration"] = nil
+	rich["time_to_merge"] = nil
+	if iMergedAt != nil {
+		rich["merge_commit_sha"], _ = mr["merge_commit_sha"]
+		if rich["merge_commit_sha"] == nil {
+			rich["merge_commit_sha"], _ = mr["squash_commit_sha"]
+		}
+		mergedAt, e := TimeParseInterfaceString(iMergedAt)
+		if e == nil {
+			rich["code_merge_duration"] = float64(mergedAt.Sub(createdAt).Seconds()) / 86400.0
+			rich["time_to_merge"] = rich["code_merge_duration"]
+		}
+	}
+	GitLabUserFields(rich, "merge_author", mr["merged_by_data"])
+	reviewers := []interface{}{}
+	iReviewers, _ := mr["reviewers_data"].([]interface{})
+	for _, iReviewer := range iReviewers {
+		login, _ := Dig(iReviewer, []string{"login"}, false, true)
+		if login != nil {
+			reviewers = append(reviewers, login)
+		}
+	}
+	rich["requested_reviewers_data"] = reviewers
+	rich["n_requested_reviewers"] = len(reviewers)
+	approvers := []string{}
+	iApprovals, _ := mr["approvals_data"].([]interface{})
+	for _, iApproval := range iApprovals {
+		login, _ := Dig(iApproval, []string{"user_data", "login"}, false, true)
+		sLogin, _ := login.(string)
+		if sLogin != "" {
+			approvers = append(approvers, sLogin)
+		}
+	}
+	rich["review_commenters"] = approvers
+	rich["n_review_commenters"] = len(approvers)
+	rich["n_review_comments"] = len(iApprovals)
+	rich["is_approved"] = len(iApprovals) > 0
+	rich["num_review_comments"] = rich["n_comments"]
+	rich["time_to_merge_request_response"] = nil
+	notes, _ := mr["notes_data"].([]interface{})
+	authorID, _ := Dig(mr, []string{"author", "id"}, false, true)
+	firstResponse, ok := GitLabFirstAttention(authorID, notes, nil, true)
+	if ok {
+		rich["time_to_merge_request_response"] = float64(firstResponse.Sub(createdAt).Seconds()) / 86400.0
+	}
+	if affs {
+		err = j.enrichAffs(ctx, rich, mr, GitLabMergeRequestRoles, createdAt, "")
+		if err != nil {
+			return
+		}
+	}
+	for prop, value := range CommonFields(j, createdAt, j.Category) {
+		rich[prop] = value
+	}
+	return
+}
+
+// EnrichNotes - return rich comment items for issue or merge request user notes (system notes are skipped)
+func (j *DSGitLab) EnrichNotes(ctx *Ctx, parent, item map[string]interface{}, affs bool) (richItems []interface{}, err error) {
+	id, _ := parent["id"].(string)
+	copyParentFields := []string{"category", "gitlab_repo", "repo_name", "repository", "repo_short_name", "pull_request", "url"}
+	notes, _ := item["notes_data"].([]interface{})
+	parentType := "issue"
+	itemType := "issue comment"
+	if j.Category == "merge_request" {
+		parentType = "pull_request"
+		itemType = "pull request comment"
+	}
+	for _, iNote := range notes {
+		note, _ := iNote.(map[string]interface{})
+		system, _ := note["system"].(bool)
+		if system {
+			continue
+		}
+		rich := make(map[string]interface{})
+		for _, field := range RawFields {
+			rich[field], _ = parent[field]
+		}
+		for _, field := range copyParentFields {
+			rich[field], _ = parent[field]
+		}
+		if ctx.Project != "" {
+			rich["project"] = ctx.Project
+		}
+		rich["type"] = j.Category + "_comment"
+		rich["item_type"] = itemType
+		rich[j.Category+"_comment"] = true
+		rich[parentType+"_created_at"], _ = parent["created_at"]
+		rich[parentType+"_id"], _ = parent[parentType+"_id"]
+		rich[parentType+"_number"], _ = parent["id_in_repo"]
+		fNoteID, _ := note["id"].(float64)
+		noteID := int64(fNoteID)
+		rich["id_in_repo"] = noteID
+		rich[parentType+"_comment_id"] = noteID
+		rich["id"] = id + "/comment/" + fmt.Sprintf("%d", noteID)
+		rich["url_id"] = fmt.Sprintf("%v/note/%d", parent["url_id"], noteID)
+		for _, field := range []string{"created_at", "updated_at", "body", "discussion_id", "resolvable", "resolved"} {
+			rich[field], _ = note[field]
+		}
+		rich["body_analyzed"] = rich["body"]
+		rich["commenter_login"], _ = Dig(note, []string{"author", "username"}, false, true)
+		GitLabUserFields(rich, "commenter", note["user_data"])
+		rich["author_login"] = rich["commenter_login"]
+		rich["author_name"] = rich["commenter_name"]
+		rich["author_avatar_url"] = rich["commenter_avatar_url"]
+		createdAt, _ := TimeParseInterfaceString(note["created_at"])
+		rich[j.DateField(ctx)] = createdAt
+		if affs {
+			err = j.enrichAffs(ctx, rich, note, GitLabNoteRoles, createdAt, "commenter")
+			if err != nil {
+				return
+			}
+		}
+		for prop, value := range CommonFields(j, createdAt, j.Category) {
+			rich[prop] = value
+		}
+		for prop, value := range CommonFields(j, createdAt, j.Category+"_comment") {
+			rich[prop] = value
+		}
+		richItems = append(richItems, rich)
+	}
+	return
+}
+
+// EnrichApprovals - return rich merge request approvals, they are GitHub pull request reviews with APPROVED state
+func (j *DSGitLab) EnrichApprovals(ctx *Ctx, parent, mr map[string]interface{}, affs bool) (richItems []interface{}, err error) {
+	id, _ := parent["id"].(string)
+	copyParentFields := []string{"category", "gitlab_repo", "repo_name", "repository", "url", "repo_short_name", "merged"}
+	approvals, _ := mr["approvals_data"].([]interface{})
+	firstIdx := -1
+	var firstApproval time.Time
+	for i, iApproval := range approvals {
+		approval, _ := iApproval.(map[string]interface{})
+		approvedAt, e := TimeParseInterfaceString(approval["approved_at"])
+		if e == nil && (firstIdx < 0 || approvedAt.Before(firstApproval)) {
+			firstIdx, firstApproval = i, approvedAt
+		}
+	}
+	for i, iApproval := range approvals {
+		approval, _ := iApproval.(map[string]interface{})
+		rich := make(map[string]interface{})
+		for _, field := range RawFields {
+			rich[field], _ = parent[field]
+		}
+		for _, field := range copyParentFields {
+			rich[field], _ = parent[field]
+		}
+		if ctx.Project != "" {
+			rich["project"] = ctx.Project
+		}
+		rich["type"] = j.Category + "_review"
+		rich["item_type"] = "pull request review"
+		rich["pull_request_review"] = true
+		rich["pull_request_id"], _ = parent["pull_request_id"]
+		rich["pull_request_number"], _ = parent["id_in_repo"]
+		rich["pull_request_created_at"], _ = parent["created_at"]
+		rich["is_approved"] = true
+		rich["state"] = "APPROVED"
+		rich["is_first_review"] = i == firstIdx
+		rich["is_first_approval"] = i == firstIdx
+		rich["submitted_at"], _ = approval["approved_at"]
+		userID, _ := Dig(approval, []string{"user", "id"}, false, true)
+		fUserID, _ := userID.(float64)
+		rich["id"] = id + "/review/" + fmt.Sprintf("%d", int64(fUserID))
+		rich["url_id"] = fmt.Sprintf("%v/approval/%d", parent["url_id"], int64(fUserID))
+		rich["reviewer_login"], _ = Dig(approval, []string{"user", "username"}, false, true)
+		GitLabUserFields(rich, "reviewer", approval["user_data"])
+		rich["author_login"] = rich["reviewer_login"]
+		rich["author_name"] = rich["reviewer_name"]
+		rich["author_avatar_url"] = rich["reviewer_avatar_url"]
+		// approvals without a date (no approval note found) are dated as merge request's last update
+		approvedAt, e := TimeParseInterfaceString(approval["approved_at"])
+		if e != nil {
+			approvedAt, _ = TimeParseInterfaceString(parent["updated_at"])
+		}
+		rich[j.DateField(ctx)] = approvedAt
+		if affs {
+			err = j.enrichAffs(ctx, rich, approval, GitLabApprovalRoles, approvedAt, "reviewer")
+			if err != nil {
+				return
+			}
+		}
+		for prop, value := range CommonFields(j, approvedAt, j.Category) {
+			rich[prop] = value
+		}
+		for prop, value := range CommonFields(j, approvedAt, j.Category+"_review") {
+			rich[prop] = value
+		}
+		richItems = append(richItems, rich)
+	}
+	return
+}
+
+// AffsItems - return affiliations data items for given roles and date
+func (j *DSGitLab) AffsItems(ctx *Ctx, item map[string]interface{}, roles []string, date interface{}) (affsItems map[string]interface{}, err error) {
+	affsItems = make(map[string]interface{})
+	dt, _ := date.(time.Time)
+	for _, role := range roles {
+		identity := j.GetRoleIdentity(ctx, item, role)
+		if len(identity) == 0 {
+			continue
+		}
+		affsIdentity, empty, e := IdentityAffsData(ctx, j, identity, nil, dt, role)
+		if e != nil {
+			Printf("%s/%s: AffsItems/IdentityAffsData: error: %v for %v,%v,%v\n", j.ProjectURL, j.Category, e, identity, dt, role)
+			if ctx.AffsAPIFailFatal {
+				err = e
+				return
+			}
+		}
+		if empty {
+			Printf("%s/%s: no identity affiliation data for identity %+v, role %s\n", j.ProjectURL, j.Category, identity, role)
+			continue
+		}
+		for prop, value := range affsIdentity {
+			affsItems[prop] = value
+		}
+		for _, suff := range RequiredAffsFields {
+			k := role + suff
+			_, ok := affsIdentity[k]
+			if !ok {
+				affsIdentity[k] = Unknown
+			}
+		}
+	}
+	return
+}
+
+// GetRoleIdentity - return identity data for a given role
+func (j *DSGitLab) GetRoleIdentity(ctx *Ctx, item map[string]interface{}, role string) (identity map[string]interface{}) {
+	user, ok := item[role].(map[string]interface{})
+	if ok && len(user) > 0 {
+		ident := j.IdentityForObject(ctx, user)
+		identity = map[string]interface{}{
+			"name":     ident[0],
+			"username": ident[1],
+			"email":    ident[2],
+		}
+	}
+	return
+}
+
+// AllRoles - return all roles defined for the backend
+// roles can be static (always the same) or dynamic (per item)
+// second return parameter is static mode (true/false)
+// dynamic roles will use item to get its roles
+func (j *DSGitLab) AllRoles(ctx *Ctx, rich map[string]interface{}) (roles []string, static bool) {
+	roles = []string{Author}
+	if rich == nil {
+		return
+	}
+	var possibleRoles []string
+	typ, _ := rich["type"].(string)
+	switch typ {
+	case "issue":
+		possibleRoles = GitLabIssueRoles
+	case "merge_request":
+		possibleRoles = GitLabMergeRequestRoles
+	case "issue_comment", "merge_request_comment":
+		possibleRoles = append(GitLabNoteRoles, "commenter")
+	case "merge_request_review":
+		possibleRoles = append(GitLabApprovalRoles, "reviewer")
+	case "pipeline":
+		possibleRoles = append(GitLabPipelineRoles, "actor")
+	}
+	for _, possibleRole := range possibleRoles {
+		_, ok := Dig(rich, []string{possibleRole + "_id"}, false, true)
+		if ok {
+			roles = append(roles, possibleRole)
+		}
+	}
+	return
+}
+
+// HasIdentities - does this data source support identity data
+func (j *DSGitLab) HasIdentities() bool {
+	return true
+}
+
+// UseDefaultMapping - apply MappingNotAnalyzeString for raw/rich (raw=fals/true) index in this DS?
+func (j *DSGitLab) UseDefaultMapping(ctx *Ctx, raw bool) bool {
+	return raw
+}
@@ -0,0 +1,108 @@
+package dads
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGitLabPaging(t *testing.T) {
+	headers := map[string][]string{
+		"Link": {`<https://gitlab.com/api/v4/projects/1/issues?page=1&per_page=2>; rel="prev", <https://gitlab.com/api/v4/projects/1/issues?page=3&per_page=2>; rel="next", <https://gitlab.com/api/v4/projects/1/issues?page=1&per_page=2>; rel="first"`},
+	}
+	next := GitLabNextURL(headers)
+	if next != "https://gitlab.com/api/v4/projects/1/issues?page=3&per_page=2" {
+		t.Errorf("unexpected next URL %s", next)
+	}
+	if GitLabNextURL(map[string][]string{"link": {`<https://gitlab.com/api/v4/x?page=1>; rel="first"`}}) != "" {
+		t.Errorf("last page should have no next URL")
+	}
+	now := time.Unix(1000, 0)
+	rateLimit, rateLimitReset := GitLabRetryAfter(map[string][]string{"Retry-After": {"30"}}, now)
+	if rateLimit != 1 || rateLimitReset != 1030 {
+		t.Errorf("unexpected rate limit %d, %d", rateLimit, rateLimitReset)
+	}
+	_, rateLimitReset = GitLabRetryAfter(nil, now)
+	if rateLimitReset != 1000+GitLabDefaultRetryAfter {
+		t.Errorf("unexpected default rate limit reset %d", rateLimitReset)
+	}
+}
+
+func TestGitLabApprovals(t *testing.T) {
+	alice := map[string]interface{}{"id": 1.0, "username": "alice"}
+	bob := map[string]interface{}{"id": 2.0, "username": "bob"}
+	carol := map[string]interface{}{"id": 3.0, "username": "carol"}
+	notes := []interface{}{
+		map[string]interface{}{"system": false, "body": "LGTM", "author": bob, "created_at": "2021-06-01T09:00:00.000Z"},
+		map[string]interface{}{"system": true, "body": "approved this merge request", "author": bob, "created_at": "2021-06-01T10:00:00.000Z"},
+		map[string]interface{}{"system": true, "body": "approved this merge request", "author": carol, "created_at": "2021-06-01T11:00:00.000Z"},
+		map[string]interface{}{"system": true, "body": "unapproved this merge request", "author": carol, "created_at": "2021-06-01T12:00:00.000Z"},
+		map[string]interface{}{"system": true, "body": "approved this merge request", "author": bob, "created_at": "2021-06-02T10:00:00.000Z"},
+	}
+	approvals := GitLabApprovals(nil, notes)
+	if len(approvals) != 1 {
+		t.Errorf("expected 1 approval from notes, got %+v", approvals)
+		return
+	}
+	approval := approvals[0].(map[string]interface{})
+	if approval["user"].(map[string]interface{})["username"] != "bob" || approval["approved_at"] != "2021-06-02T10:00:00.000Z" {
+		t.Errorf("unexpected approval %+v", approval)
+	}
+	approvals = GitLabApprovals([]interface{}{map[string]interface{}{"user": bob}, map[string]interface{}{"user": alice}}, notes)
+	if len(approvals) != 2 {
+		t.Errorf("expected 2 approvals from API, got %+v", approvals)
+		return
+	}
+	if approvals[0].(map[string]interface{})["approved_at"] != "2021-06-02T10:00:00.000Z" || approvals[1].(map[string]interface{})["approved_at"] != nil {
+		t.Errorf("unexpected approvals dates %+v", approvals)
+	}
+	dt, ok := GitLabFirstAttention(1.0, notes, nil, true)
+	if !ok || !dt.Equal(time.Date(2021, 6, 1, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected first response %v", dt)
+	}
+	dt, ok = GitLabFirstAttention(2.0, notes[1:], nil, false)
+	if !ok || !dt.Equal(time.Date(2021, 6, 1, 11, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected first attention %v", dt)
+	}
+	dt, ok = GitLabFirstAttention(2.0, notes[:2], nil, false)
+	if !ok || !dt.Equal(time.Date(2021, 6, 1, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("author's own activity expected when there is no other, got %v", dt)
+	}
+	_, ok = GitLabFirstAttention(1.0, notes[1:], nil, true)
+	if ok {
+		t.Errorf("system notes should not count as a response")
+	}
+}
+
+func TestGitLabUserAndResult(t *testing.T) {
+	user := map[string]interface{}{"id": 1.0, "username": "alice", "name": "Alice", "avatar_url": "https://a"}
+	data := GitLabUserData(user, map[string]interface{}{"public_email": "alice@example.com", "organization": "LF"})
+	if data["login"] != "alice" || data["email"] != "alice@example.com" || data["company"] != "LF" || data["location"] != nil {
+		t.Errorf("unexpected user data %+v", data)
+	}
+	rich := map[string]interface{}{}
+	GitLabUserFields(rich, "reviewer", data)
+	if rich["reviewer_login"] != "alice" || rich["reviewer_domain"] != "example.com" || rich["reviewer_org"] != "LF" {
+		t.Errorf("unexpected user fields %+v", rich)
+	}
+	GitLabUserFields(rich, "reviewer", nil)
+	if rich["reviewer_login"] != nil || rich["reviewer_domain"] != nil {
+		t.Errorf("missing user should clear fields %+v", rich)
+	}
+	var testCases = []struct {
+		status   interface{}
+		expected interface{}
+	}{
+		{status: "success", expected: "SUCCESS"},
+		{status: "failed", expected: "FAILURE"},
+		{status: "canceled", expected: "ABORTED"},
+		{status: "skipped", expected: "NOT_BUILT"},
+		{status: "running", expected: nil},
+		{status: nil, expected: nil},
+	}
+	for index, test := range testCases {
+		got := GitLabPipelineResult(test.status)
+		if got != test.expected {
+			t.Errorf("test number %d, expected %v, got %v", index+1, test.expected, got)
+		}
+	}
+}
@@ -49,6 +49,17 @@ type DSRocketchat struct {
 	WaitRate     bool   // From DA_ROCKETCHAT_WAIT_RATE - will wait for rate limit refresh if set, otherwise will fail is rate limit is reached
 	NoSSLVerify  bool   // From DA_ROCKETCHAT_NO_SSL_VERIFY
 	SingleOrigin bool   // From DA_ROCKETCHAT_SINGLE_ORIGIN - if you want to store only one rocketchat endpoint in the index
+	// Server-wide mode: used when DA_ROCKETCHAT_CHANNEL is not set
+	AllChannels   bool // From DA_ROCKETCHAT_ALL_CHANNELS - fetch all server's public channels
+	IncludeGroups bool // From DA_ROCKETCHAT_INCLUDE_GROUPS - also fetch private groups (all of them with admin token, otherwise token user's ones)
+	IncludeDMs    bool // From DA_ROCKETCHAT_INCLUDE_DMS - also fetch token user's direct messages, DMs are never fetched unless this is set
+	Threads       bool // From DA_ROCKETCHAT_THREADS - fetch thread replies via chat.getThreadMessages
+	// Current room (always a public channel when not in server-wide mode)
+	RoomType   string                 // RocketchatRoomChannel, RocketchatRoomGroup or RocketchatRoomDM
+	RoomID     string                 // set in server-wide mode
+	Room       map[string]interface{} // room info from rooms list, set in server-wide mode
+	Rooms      []map[string]interface{}
+	RoomResume map[string]OriginResume
 }
 
 // ParseArgs - parse rocketchat specific environment variables
@@ -85,6 +96,10 @@ func (j *DSRocketchat) ParseArgs(ctx *Ctx) (err error) {
 		NoSSLVerify()
 	}
 	j.SingleOrigin = StringToBool(os.Getenv(prefix + "SINGLE_ORIGIN"))
+	j.AllChannels = StringToBool(os.Getenv(prefix + "ALL_CHANNELS"))
+	j.IncludeGroups = StringToBool(os.Getenv(prefix + "INCLUDE_GROUPS"))
+	j.IncludeDMs = StringToBool(os.Getenv(prefix + "INCLUDE_DMS"))
+	j.Threads = StringToBool(os.Getenv(prefix + "THREADS"))
 	return
 }
 
@@ -95,9 +110,15 @@ func (j *DSRocketchat) Validate(ctx *Ctx) (err error) {
 		j.URL = j.URL[:len(j.URL)-1]
 	}
 	j.Channel = strings.TrimSpace(j.Channel)
-	if j.URL == "" || j.Channel == "" || j.User == "" || j.Token == "" {
-		err = fmt.Errorf("URL, Channel, User, Token must all be set")
+	if j.URL == "" || (j.Channel == "" && !j.AllChannels) || j.User == "" || j.Token == "" {
+		err = fmt.Errorf("URL, Channel (or all channels mode), User, Token must all be set")
+		return
+	}
+	if j.Channel != "" && j.AllChannels {
+		Printf("channel %s set, ignoring all channels mode\n", j.Channel)
+		j.AllChannels = false
 	}
+	j.RoomType = RocketchatRoomChannel
 	return
 }
 
@@ -113,22 +134,28 @@ func (j DSRocketchat) Info() string {
 
 // CustomFetchRaw - is this datasource using custom fetch raw implementation?
 func (j *DSRocketchat) CustomFetchRaw() bool {
-	return false
+	return j.AllChannels && j.Channel == ""
 }
 
 // FetchRaw - implement fetch raw data for rocketchat datasource
 func (j *DSRocketchat) FetchRaw(ctx *Ctx) (err error) {
+	if j.CustomFetchRaw() {
+		return j.fetchAllRooms(ctx)
+	}
 	Printf("%s should use generic FetchRaw()\n", j.DS)
 	return
 }
 
 // CustomEnrich - is this datasource using custom enrich implementation?
 func (j *DSRocketchat) CustomEnrich() bool {
-	return false
+	return j.AllChannels && j.Channel == ""
 }
 
 // Enrich - implement enrich data for rocketchat datasource
 func (j *DSRocketchat) Enrich(ctx *Ctx) (err error) {
+	if j.CustomEnrich() {
+		return j.enrichAllRooms(ctx)
+	}
 	Printf("%s should use generic Enrich()\n", j.DS)
 	return
 }
@@ -149,8 +176,9 @@ func (j *DSRocketchat) CalculateTimeToReset(ctx *Ctx, rateLimit, rateLimitReset
 func (j *DSRocketchat) GetRocketchatMessages(ctx *Ctx, fromDate string, offset, rateLimit, rateLimitReset, thrN int) (messages []map[string]interface{}, newOffset, total, outRateLimit, outRateLimitReset int, err error) {
 	query := `{"_updatedAt": {"$gte": {"$date": "` + fromDate + `"}}}`
 	url := j.URL + fmt.Sprintf(
-		`/api/v1/channels.messages?roomName=%s&count=%d&offset=%d&sort=%s&query=%s`,
-		neturl.QueryEscape(j.Channel),
+		`/api/v1/%s.messages?%s&count=%d&offset=%d&sort=%s&query=%s`,
+		RocketchatRoomAPIs[j.RoomType],
+		j.roomQuery(),
 		j.MaxItems,
 		offset,
 		neturl.QueryEscape(`{"_updatedAt": 1}`),
@@ -255,64 +283,15 @@ func (j *DSRocketchat) FetchItems(ctx *Ctx) (err error) {
 		dateFrom = DefaultDateFrom
 	}
 	sDateFrom = ToESDate(dateFrom)
+	if j.RoomType == RocketchatRoomDM && !j.IncludeDMs {
+		err = fmt.Errorf("%s: direct messages are only fetched when DA_ROCKETCHAT_INCLUDE_DMS is set", j.Origin(ctx))
+		return
+	}
 	rateLimit, rateLimitReset := -1, -1
-	cacheDur := time.Duration(48) * time.Hour
-	url := j.URL + "/api/v1/channels.info?roomName=" + neturl.QueryEscape(j.Channel)
-	method := Get
-	headers := map[string]string{"X-User-ID": j.User, "X-Auth-Token": j.Token}
-	var (
-		res        interface{}
-		status     int
-		outHeaders map[string][]string
-	)
 	thrN := GetThreadsNum(ctx)
-	sleeps, rates := 0, 0
-	for {
-		err = SleepForRateLimit(ctx, j, rateLimit, rateLimitReset, j.MinRate, j.WaitRate)
-		if err != nil {
-			return
-		}
-		// curl -s -H 'X-Auth-Token: token' -H 'X-User-ID: user' URL/api/v1/channels.info?roomName=channel | jq '.'
-		// 48 hours for caching channel info
-		res, status, _, outHeaders, err = Request(
-			ctx,
-			url,
-			method,
-			headers,
-			nil,
-			nil,
-			map[[2]int]struct{}{{200, 200}: {}, {429, 429}: {}}, // JSON statuses: 200, 429
-			nil, // Error statuses
-			map[[2]int]struct{}{{200, 200}: {}, {429, 429}: {}}, // OK statuses: 200, 429
-			map[[2]int]struct{}{{200, 200}: {}},                 // Cache statuses: 200
-			true,                                                // retry
-			&cacheDur,                                           // cache duration
-			false,                                               // skip in dry-run mode
-		)
-		rateLimit, rateLimitReset, _ = UpdateRateLimit(ctx, j, outHeaders, "", "")
-		// Rate limit
-		if status == 413 {
-			rates++
-			continue
-		}
-		// Too many requests
-		if status == 429 {
-			sleeps++
-			j.SleepAsRequested(res, thrN)
-			continue
-		}
-		if sleeps > 0 || rates > 0 {
-			Printf("recovered after %d sleeps and %d rate limits\n", sleeps, rates)
-		}
-		if err != nil {
-			return
-		}
-		break
-	}
-	channelInfo, ok := res.(map[string]interface{})["channel"]
-	if !ok {
-		data, _ := res.(map[string]interface{})
-		err = fmt.Errorf("cannot read channel info from:\n%s", data)
+	var channelInfo interface{}
+	channelInfo, rateLimit, rateLimitReset, err = j.GetRocketchatRoomInfo(ctx, rateLimit, rateLimitReset, thrN)
+	if err != nil {
 		return
 	}
 	// Process messages (possibly in threads)
@@ -381,6 +360,7 @@ func (j *DSRocketchat) FetchItems(ctx *Ctx) (err error) {
 		return
 	}
 	offset, total := 0, 0
+	seen := make(map[string]struct{})
 	if thrN > 1 {
 		for {
 			var messages []map[string]interface{}
@@ -388,6 +368,10 @@ func (j *DSRocketchat) FetchItems(ctx *Ctx) (err error) {
 			if err != nil {
 				return
 			}
+			messages, rateLimit, rateLimitReset, err = j.AddThreadReplies(ctx, messages, dateFrom, seen, rateLimit, rateLimitReset, thrN)
+			if err != nil {
+				return
+			}
 			for _, message := range messages {
 				message["channel_info"] = channelInfo
 				go func(message map[string]interface{}) {
@@ -437,6 +421,10 @@ func (j *DSRocketchat) FetchItems(ctx *Ctx) (err error) {
 			if err != nil {
 				return
 			}
+			messages, rateLimit, rateLimitReset, err = j.AddThreadReplies(ctx, messages, dateFrom, seen, rateLimit, rateLimitReset, thrN)
+			if err != nil {
+				return
+			}
 			for _, message := range messages {
 				message["channel_info"] = channelInfo
 				_, err = processMsg(nil, message)
@@ -477,6 +465,75 @@ func (j *DSRocketchat) FetchItems(ctx *Ctx) (err error) {
 	return
 }
 
+// GetRocketchatRoomInfo - get current room info, it is already known in server-wide mode, otherwise it is fetched
+func (j *DSRocketchat) GetRocketchatRoomInfo(ctx *Ctx, rateLimit, rateLimitReset, thrN int) (channelInfo interface{}, outRateLimit, outRateLimitReset int, err error) {
+	if j.Room != nil {
+		channelInfo, outRateLimit, outRateLimitReset = j.Room, rateLimit, rateLimitReset
+		return
+	}
+	cacheDur := time.Duration(48) * time.Hour
+	url := j.URL + "/api/v1/" + RocketchatRoomAPIs[j.RoomType] + ".info?roomName=" + neturl.QueryEscape(j.Channel)
+	method := Get
+	headers := map[string]string{"X-User-ID": j.User, "X-Auth-Token": j.Token}
+	var (
+		res        interface{}
+		status     int
+		outHeaders map[string][]string
+	)
+	sleeps, rates := 0, 0
+	for {
+		err = SleepForRateLimit(ctx, j, rateLimit, rateLimitReset, j.MinRate, j.WaitRate)
+		if err != nil {
+			return
+		}
+		// curl -s -H 'X-Auth-Token: token' -H 'X-User-ID: user' URL/api/v1/channels.info?roomName=channel | jq '.'
+		// 48 hours for caching channel info
+		res, status, _, outHeaders, err = Request(
+			ctx,
+			url,
+			method,
+			headers,
+			nil,
+			nil,
+			map[[2]int]struct{}{{200, 200}: {}, {429, 429}: {}}, // JSON statuses: 200, 429
+			nil, // Error statuses
+			map[[2]int]struct{}{{200, 200}: {}, {429, 429}: {}}, // OK statuses: 200, 429
+			map[[2]int]struct{}{{200, 200}: {}},                 // Cache statuses: 200
+			true,                                                // retry
+			&cacheDur,                                           // cache duration
+			false,                                               // skip in dry-run mode
+		)
+		rateLimit, rateLimitReset, _ = UpdateRateLimit(ctx, j, outHeaders, "", "")
+		// Rate limit
+		if status == 413 {
+			rates++
+			continue
+		}
+		// Too many requests
+		if status == 429 {
+			sleeps++
+			j.SleepAsRequested(res, thrN)
+			continue
+		}
+		if sleeps > 0 || rates > 0 {
+			Printf("recovered after %d sleeps and %d rate limits\n", sleeps, rates)
+		}
+		if err != nil {
+			return
+		}
+		break
+	}
+	var ok bool
+	channelInfo, ok = res.(map[string]interface{})[RocketchatRoomInfoKeys[j.RoomType]]
+	if !ok {
+		data, _ := res.(map[string]interface{})
+		err = fmt.Errorf("cannot read channel info from:\n%s", data)
+		return
+	}
+	outRateLimit, outRateLimitReset = rateLimit, rateLimitReset
+	return
+}
+
 // SupportDateFrom - does DS support resuming from date?
 func (j *DSRocketchat) SupportDateFrom() bool {
 	return true
@@ -806,6 +863,7 @@ func (j *DSRocketchat) EnrichItem(ctx *Ctx, item map[string]interface{}, author
 		channelInfo, _ := iChannelInfo.(map[string]interface{})
 		j.SetChannelInfo(rich, channelInfo)
 	}
+	j.SetThreadInfo(rich, message)
 	rich["total_urls"] = 0
 	iURLs, ok := message["urls"]
 	if ok {
@@ -859,6 +917,28 @@ func (j *DSRocketchat) SetChannelInfo(rich, channel map[string]interface{}) {
 	rich["channel_num_users"], _ = channel["usersCount"]
 	rich["channel_topic"], _ = channel["topic"]
 	rich["avatar"], _ = Dig(channel, []string{"lastMessage", "avatar"}, false, true)
+	// Channel info fetched before server-wide mode had no room type, those were always public channels
+	roomType, _ := channel["t"].(string)
+	if roomType == "" {
+		roomType = RocketchatRoomChannel
+	}
+	rich["room_type"] = RocketchatRoomTypes[roomType]
+}
+
+// SetThreadInfo - set rich thread info: parent message id for thread replies and number of replies for thread parents
+func (j *DSRocketchat) SetThreadInfo(rich, message map[string]interface{}) {
+	rich["thread_parent_id"] = nil
+	rich["is_thread_reply"] = 0
+	tmid, _ := message["tmid"].(string)
+	if tmid != "" {
+		rich["thread_parent_id"] = tmid
+		rich["is_thread_reply"] = 1
+	}
+	rich["thread_replies"] = 0
+	tcount, ok := message["tcount"].(float64)
+	if ok {
+		rich["thread_replies"] = int(tcount)
+	}
 }
 
 // GetMentions - convert raw mentions to rich mentions
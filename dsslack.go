@@ -0,0 +1,1221 @@
+package dads
+
+import (
+	"fmt"
+	"math"
+	neturl "net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/LF-Engineering/dev-analytics-libraries/emoji"
+)
+
+const (
+	// SlackBackendVersion - backend version
+	SlackBackendVersion = "0.0.1"
+	// SlackDefaultURL - default Slack URL, API is at SlackDefaultURL/api
+	SlackDefaultURL = "https://slack.com"
+	// SlackMinRate - rate limit value meaning that Slack asked to wait, Slack doesn't report remaining points, only Retry-After when limit is hit
+	SlackMinRate = 1
+	// SlackDefaultRetryAfter - seconds to wait when rate limited response has no Retry-After header
+	SlackDefaultRetryAfter = 60
+	// SlackThreadsLookback - threads started that long before date from are checked for replies posted since date from
+	SlackThreadsLookback = 30 * 24 * time.Hour
+	// SlackEditsLookback - messages posted that long before date from are checked for edits made since date from
+	SlackEditsLookback = 30 * 24 * time.Hour
+)
+
+var (
+	// SlackRawMapping - Slack raw index mapping
+	SlackRawMapping = []byte(`{"dynamic":true,"properties":{"metadata__updated_on":{"type":"date"},"data":{"dynamic":false,"properties":{}}}}`)
+	// SlackRichMapping - Slack rich index mapping
+	SlackRichMapping = []byte(`{"properties":{"metadata__updated_on":{"type":"date"},"msg_analyzed":{"type":"text","fielddata":true,"index":true}}}`)
+	// SlackCategories - categories defined for Slack
+	SlackCategories = map[string]struct{}{Message: {}}
+	// SlackDefaultMaxItems - max items to retrieve from API via a single request
+	SlackDefaultMaxItems = 200
+	// SlackDefaultSearchField - default search field
+	SlackDefaultSearchField = "item_id"
+	// SlackRoles - roles to fetch affiliation data for slack messages
+	SlackRoles = []string{"user_data"}
+	// SlackMentionRE - user mention in message text: <@U123ABC> or <@U123ABC|name>
+	SlackMentionRE = regexp.MustCompile(`<@([UW][A-Z0-9]+)(?:\|[^>]*)?>`)
+	// SlackURLRE - link in message text: <https://example.com> or <https://example.com|label>
+	SlackURLRE = regexp.MustCompile(`<(https?://[^|>]+)(?:\|[^>]*)?>`)
+)
+
+// DSSlack - DS implementation for slack
+type DSSlack struct {
+	DS             string
+	URL            string // From DA_SLACK_URL - slack URL, defaults to SlackDefaultURL
+	Channel        string // From DA_SLACK_CHANNEL - slack channel ID
+	Token          string // From DA_SLACK_TOKEN - bot token (needs channels:history, channels:read, users:read, users:read.email and groups:* for private channels)
+	MaxItems       int    // From DA_SLACK_MAX_ITEMS, defaults to SlackDefaultMaxItems (200)
+	WaitRate       bool   // From DA_SLACK_WAIT_RATE - will wait as requested by Retry-After when rate limited (default), otherwise will fail
+	NoSSLVerify    bool   // From DA_SLACK_NO_SSL_VERIFY
+	SingleOrigin   bool   // From DA_SLACK_SINGLE_ORIGIN - if you want to store only one slack channel in the index
+	AllChannels    bool   // From DA_SLACK_ALL_CHANNELS - fetch all workspace's public channels the bot is a member of (when Channel is not set)
+	IncludePrivate bool   // From DA_SLACK_INCLUDE_PRIVATE - all channels mode: also fetch private channels the bot is a member of
+	Threads        bool   // From DA_SLACK_THREADS - fetch thread replies via conversations.replies
+	// Direct messages are never fetched
+	RateLimit      int
+	RateLimitReset int
+	ChannelInfo    map[string]interface{} // current channel info from channels list, set in all channels mode
+	Channels       []map[string]interface{}
+	ChannelResume  map[string]OriginResume
+	Users          map[string]map[string]interface{} // users.info cache
+}
+
+// ParseArgs - parse slack specific environment variables
+func (j *DSSlack) ParseArgs(ctx *Ctx) (err error) {
+	j.DS = Slack
+	prefix := "DA_SLACK_"
+	j.URL = os.Getenv(prefix + "URL")
+	j.Channel = os.Getenv(prefix + "CHANNEL")
+	j.Token = os.Getenv(prefix + "TOKEN")
+	AddRedacted(j.Token, false)
+	if ctx.Env("MAX_ITEMS") != "" {
+		maxItems, err := strconv.Atoi(ctx.Env("MAX_ITEMS"))
+		FatalOnError(err)
+		if maxItems > 0 {
+			j.MaxItems = maxItems
+		}
+	} else {
+		j.MaxItems = SlackDefaultMaxItems
+	}
+	j.WaitRate = os.Getenv(prefix+"WAIT_RATE") == "" || StringToBool(os.Getenv(prefix+"WAIT_RATE"))
+	j.NoSSLVerify = StringToBool(os.Getenv(prefix + "NO_SSL_VERIFY"))
+	if j.NoSSLVerify {
+		NoSSLVerify()
+	}
+	j.SingleOrigin = StringToBool(os.Getenv(prefix + "SINGLE_ORIGIN"))
+	j.AllChannels = StringToBool(os.Getenv(prefix + "ALL_CHANNELS"))
+	j.IncludePrivate = StringToBool(os.Getenv(prefix + "INCLUDE_PRIVATE"))
+	j.Threads = StringToBool(os.Getenv(prefix + "THREADS"))
+	return
+}
+
+// Validate - is current DS configuration OK?
+func (j *DSSlack) Validate(ctx *Ctx) (err error) {
+	j.URL = strings.TrimSpace(j.URL)
+	if j.URL == "" {
+		j.URL = SlackDefaultURL
+	}
+	if strings.HasSuffix(j.URL, "/") {
+		j.URL = j.URL[:len(j.URL)-1]
+	}
+	j.Channel = strings.TrimSpace(j.Channel)
+	if (j.Channel == "" && !j.AllChannels) || j.Token == "" {
+		err = fmt.Errorf("Channel (or all channels mode), Token must all be set")
+		return
+	}
+	if j.Channel != "" && j.AllChannels {
+		Printf("channel %s set, ignoring all channels mode\n", j.Channel)
+		j.AllChannels = false
+	}
+	if j.MaxItems > 1000 {
+		j.MaxItems = 1000
+	}
+	j.RateLimit, j.RateLimitReset = -1, -1
+	j.Users = make(map[string]map[string]interface{})
+	return
+}
+
+// Name - return data source name
+func (j *DSSlack) Name() string {
+	return j.DS
+}
+
+// Info - return DS configuration in a human readable form
+func (j DSSlack) Info() string {
+	return fmt.Sprintf("%+v", j)
+}
+
+// CustomFetchRaw - is this datasource using custom fetch raw implementation?
+func (j *DSSlack) CustomFetchRaw() bool {
+	return j.AllChannels && j.Channel == ""
+}
+
+// FetchRaw - implement fetch raw data for slack datasource
+func (j *DSSlack) FetchRaw(ctx *Ctx) (err error) {
+	if j.CustomFetchRaw() {
+		return j.fetchAllChannels(ctx)
+	}
+	Printf("%s should use generic FetchRaw()\n", j.DS)
+	return
+}
+
+// CustomEnrich - is this datasource using custom enrich implementation?
+func (j *DSSlack) CustomEnrich() bool {
+	return j.AllChannels && j.Channel == ""
+}
+
+// Enrich - implement enrich data for slack datasource
+func (j *DSSlack) Enrich(ctx *Ctx) (err error) {
+	if j.CustomEnrich() {
+		return j.enrichAllChannels(ctx)
+	}
+	Printf("%s should use generic Enrich()\n", j.DS)
+	return
+}
+
+// CalculateTimeToReset - calculate time to reset rate limits based on rate limit value and rate limit reset value
+// rateLimitReset is an epoch time (in seconds) after which Slack accepts requests again
+func (j *DSSlack) CalculateTimeToReset(ctx *Ctx, rateLimit, rateLimitReset int) (seconds int) {
+	seconds = rateLimitReset - int(time.Now().Unix())
+	if seconds < 0 {
+		seconds = 0
+	}
+	if ctx.Debug > 1 {
+		Printf("CalculateTimeToReset(%d,%d) -> %d\n", rateLimit, rateLimitReset, seconds)
+	}
+	return
+}
+
+// SlackRetryAfter - return rate limit values (to be used with SleepForRateLimit) from rate limited response's Retry-After header
+func SlackRetryAfter(headers map[string][]string, now time.Time) (rateLimit, rateLimitReset int) {
+	seconds := SlackDefaultRetryAfter
+	for k, v := range headers {
+		if strings.ToLower(k) != "retry-after" || len(v) == 0 {
+			continue
+		}
+		after, err := strconv.Atoi(strings.TrimSpace(v[0]))
+		if err == nil && after >= 0 {
+			seconds = after
+		}
+		break
+	}
+	rateLimit, rateLimitReset = SlackMinRate, int(now.Unix())+seconds+1
+	return
+}
+
+// SlackTS - convert time to slack timestamp
+func SlackTS(dt time.Time) string {
+	return fmt.Sprintf("%d.%06d", dt.Unix(), dt.Nanosecond()/1000)
+}
+
+// SlackTSToTime - convert slack timestamp (like "1623456789.000200") to time
+func SlackTSToTime(ts string) (dt time.Time, err error) {
+	f, err := strconv.ParseFloat(ts, 64)
+	if err != nil {
+		return
+	}
+	sec, frac := math.Modf(f)
+	dt = time.Unix(int64(sec), int64(math.Round(frac*1e6))*1000).UTC()
+	return
+}
+
+// slackGet - call slack Web API method and return its response, waits when rate limited (if allowed)
+// Slack returns errors with 200 status, they are detected via "ok" response property
+func (j *DSSlack) slackGet(ctx *Ctx, method string, args neturl.Values) (data map[string]interface{}, err error) {
+	url := j.URL + "/api/" + method + "?" + args.Encode()
+	headers := map[string]string{"Authorization": "Bearer " + j.Token}
+	var (
+		res        interface{}
+		status     int
+		outHeaders map[string][]string
+	)
+	rates := 0
+	for {
+		err = SleepForRateLimit(ctx, j, j.RateLimit, j.RateLimitReset, SlackMinRate, j.WaitRate)
+		if err != nil {
+			return
+		}
+		if ctx.Debug > 1 {
+			Printf("slack url: %s\n", url)
+		}
+		res, status, _, outHeaders, err = Request(
+			ctx,
+			url,
+			Get,
+			headers,
+			nil,
+			nil,
+			map[[2]int]struct{}{{200, 200}: {}}, // JSON statuses: 200
+			nil,                                 // Error statuses
+			map[[2]int]struct{}{{200, 200}: {}, {429, 429}: {}}, // OK statuses: 200, 429
+			nil,   // Cache statuses
+			true,  // retry
+			nil,   // cache duration
+			false, // skip in dry-run mode
+		)
+		// Too many requests
+		if status == 429 {
+			j.RateLimit, j.RateLimitReset = SlackRetryAfter(outHeaders, time.Now())
+			rates++
+			continue
+		}
+		if err != nil {
+			return
+		}
+		j.RateLimit, j.RateLimitReset = -1, -1
+		if rates > 0 {
+			Printf("recovered after %d rate limits\n", rates)
+		}
+		break
+	}
+	data, ok := res.(map[string]interface{})
+	if !ok {
+		err = fmt.Errorf("%s: cannot parse JSON from (status: %d):\n%s", method, status, string(res.([]byte)))
+		return
+	}
+	success, _ := data["ok"].(bool)
+	if !success {
+		errMsg, _ := data["error"].(string)
+		err = fmt.Errorf("%s: %s", method, errMsg)
+	}
+	return
+}
+
+// slackPages - call a paginated slack Web API method and call f for every item under key of all pages (following next_cursor)
+func (j *DSSlack) slackPages(ctx *Ctx, method string, args neturl.Values, key string, f func(map[string]interface{}) error) (err error) {
+	args.Set("limit", strconv.Itoa(j.MaxItems))
+	for {
+		var data map[string]interface{}
+		data, err = j.slackGet(ctx, method, args)
+		if err != nil {
+			return
+		}
+		items, _ := data[key].([]interface{})
+		for _, iItem := range items {
+			item, ok := iItem.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			err = f(item)
+			if err != nil {
+				return
+			}
+		}
+		cursor, _ := Dig(data, []string{"response_metadata", "next_cursor"}, false, true)
+		sCursor, _ := cursor.(string)
+		if sCursor == "" {
+			break
+		}
+		args.Set("cursor", sCursor)
+	}
+	return
+}
+
+// GetSlackUser - get user via users.info (cached), email is only returned when token has users:read.email scope
+// returns nil for unknown users
+func (j *DSSlack) GetSlackUser(ctx *Ctx, id string) (user map[string]interface{}, err error) {
+	user, ok := j.Users[id]
+	if ok {
+		return
+	}
+	data, err := j.slackGet(ctx, "users.info", neturl.Values{"user": []string{id}})
+	if err != nil {
+		if strings.HasSuffix(err.Error(), "user_not_found") {
+			Printf("slack user %s not found\n", id)
+			j.Users[id] = nil
+			err = nil
+		}
+		return
+	}
+	full, _ := data["user"].(map[string]interface{})
+	user = map[string]interface{}{}
+	for _, field := range []string{"id", "name", "real_name", "is_bot", "deleted", "tz"} {
+		v, ok := full[field]
+		if ok {
+			user[field] = v
+		}
+	}
+	profile := map[string]interface{}{}
+	for _, field := range []string{"email", "real_name", "display_name"} {
+		v, ok := Dig(full, []string{"profile", field}, false, true)
+		if ok {
+			profile[field] = v
+		}
+	}
+	user["profile"] = profile
+	j.Users[id] = user
+	return
+}
+
+// SlackUserName - return user's real name (falls back to profile's real name and display name)
+func SlackUserName(user map[string]interface{}) string {
+	for _, path := range [][]string{{"real_name"}, {"profile", "real_name"}, {"profile", "display_name"}} {
+		name, _ := Dig(user, path, false, true)
+		sName, _ := name.(string)
+		if sName != "" {
+			return sName
+		}
+	}
+	return ""
+}
+
+// SlackMentionedUsers - return IDs of users mentioned in message text
+func SlackMentionedUsers(text string) (ids []string) {
+	seen := map[string]struct{}{}
+	for _, match := range SlackMentionRE.FindAllStringSubmatch(text, -1) {
+		_, ok := seen[match[1]]
+		if ok {
+			continue
+		}
+		seen[match[1]] = struct{}{}
+		ids = append(ids, match[1])
+	}
+	return
+}
+
+// SlackURLs - return URLs linked in message text
+func SlackURLs(text string) (urls []interface{}) {
+	urls = []interface{}{}
+	for _, match := range SlackURLRE.FindAllStringSubmatch(text, -1) {
+		urls = append(urls, match[1])
+	}
+	return
+}
+
+// AddMessageUsers - add resolved users to raw message: author (user_data), mentions (as rocketchat has them) and reactions' users
+func (j *DSSlack) AddMessageUsers(ctx *Ctx, message map[string]interface{}) (err error) {
+	userID, _ := message["user"].(string)
+	if userID != "" {
+		var user map[string]interface{}
+		user, err = j.GetSlackUser(ctx, userID)
+		if err != nil {
+			return
+		}
+		if user != nil {
+			message["user_data"] = user
+		}
+	}
+	text, _ := message["text"].(string)
+	mentions := []interface{}{}
+	for _, id := range SlackMentionedUsers(text) {
+		var user map[string]interface{}
+		user, err = j.GetSlackUser(ctx, id)
+		if err != nil {
+			return
+		}
+		mention := map[string]interface{}{"_id": id, "username": nil, "name": nil}
+		if user != nil {
+			mention["username"] = user["name"]
+			mention["name"] = SlackUserName(user)
+		}
+		mentions = append(mentions, mention)
+	}
+	if len(mentions) > 0 {
+		message["mentions"] = mentions
+	}
+	reactions, _ := message["reactions"].([]interface{})
+	for _, iReaction := range reactions {
+		reaction, ok := iReaction.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		userNames, names := []interface{}{}, []interface{}{}
+		users, _ := reaction["users"].([]interface{})
+		for _, iID := range users {
+			id, _ := iID.(string)
+			if id == "" {
+				continue
+			}
+			var user map[string]interface{}
+			user, err = j.GetSlackUser(ctx, id)
+			if err != nil {
+				return
+			}
+			if user != nil {
+				userNames = append(userNames, user["name"])
+				names = append(names, SlackUserName(user))
+			}
+		}
+		reaction["usernames"] = userNames
+		reaction["names"] = names
+	}
+	return
+}
+
+// SlackChannelAllowed - can a channel returned by conversations.list be fetched
+// Bot can only read history of channels it is a member of, DMs are never fetched
+func SlackChannelAllowed(channel map[string]interface{}, includePrivate bool) bool {
+	id, _ := channel["id"].(string)
+	if id == "" {
+		return false
+	}
+	im, _ := channel["is_im"].(bool)
+	mpim, _ := channel["is_mpim"].(bool)
+	if im || mpim {
+		return false
+	}
+	private, _ := channel["is_private"].(bool)
+	if private && !includePrivate {
+		return false
+	}
+	member, _ := channel["is_member"].(bool)
+	return member
+}
+
+// slackChannels - list all workspace channels to fetch
+func (j *DSSlack) slackChannels(ctx *Ctx) (channels []map[string]interface{}, err error) {
+	types := "public_channel"
+	if j.IncludePrivate {
+		types += ",private_channel"
+	}
+	all := 0
+	err = j.slackPages(
+		ctx,
+		"conversations.list",
+		neturl.Values{"types": []string{types}, "exclude_archived": []string{"true"}},
+		"channels",
+		func(channel map[string]interface{}) error {
+			all++
+			if SlackChannelAllowed(channel, j.IncludePrivate) {
+				channels = append(channels, channel)
+			}
+			return nil
+		},
+	)
+	if err != nil {
+		return
+	}
+	Printf("%s: %d channels found, %d to process (bot must be a member of a channel to fetch it)\n", j.URL, all, len(channels))
+	return
+}
+
+// switchToChannel - switch DSSlack to i-th workspace channel, negative i switches back to all channels mode
+func (j *DSSlack) switchToChannel(i int) string {
+	if i < 0 {
+		j.Channel, j.ChannelInfo = "", nil
+		return ""
+	}
+	j.ChannelInfo = j.Channels[i]
+	j.Channel, _ = j.ChannelInfo["id"].(string)
+	return j.Channel
+}
+
+// forEachChannel - call f for every workspace channel with DSSlack switched to that channel
+func (j *DSSlack) forEachChannel(ctx *Ctx, f func(string) error) (err error) {
+	if j.Channels == nil {
+		j.Channels, err = j.slackChannels(ctx)
+		if err != nil {
+			return
+		}
+	}
+	return ForEachOrigin(ctx, j, len(j.Channels), j.switchToChannel, f)
+}
+
+// fetchAllChannels - generic fetch raw for every workspace channel
+func (j *DSSlack) fetchAllChannels(ctx *Ctx) (err error) {
+	if j.ChannelResume == nil {
+		j.ChannelResume = make(map[string]OriginResume)
+	}
+	return j.forEachChannel(ctx, FetchRawOrigin(ctx, j, j.ChannelResume))
+}
+
+// enrichAllChannels - generic enrich for every workspace channel, starting from resume state detected while fetching its raw data
+func (j *DSSlack) enrichAllChannels(ctx *Ctx) (err error) {
+	return j.forEachChannel(ctx, EnrichOrigin(ctx, j, j.ChannelResume))
+}
+
+// GetSlackChannelInfo - get current channel info, it is already known in all channels mode, otherwise it is fetched
+func (j *DSSlack) GetSlackChannelInfo(ctx *Ctx) (channelInfo map[string]interface{}, err error) {
+	if j.ChannelInfo != nil {
+		channelInfo = j.ChannelInfo
+	} else {
+		var data map[string]interface{}
+		data, err = j.slackGet(ctx, "conversations.info", neturl.Values{"channel": []string{j.Channel}, "include_num_members": []string{"true"}})
+		if err != nil {
+			return
+		}
+		var ok bool
+		channelInfo, ok = data["channel"].(map[string]interface{})
+		if !ok {
+			err = fmt.Errorf("cannot read channel info from:\n%s", data)
+			return
+		}
+	}
+	im, _ := channelInfo["is_im"].(bool)
+	mpim, _ := channelInfo["is_mpim"].(bool)
+	if im || mpim {
+		err = fmt.Errorf("%s: direct messages are not fetched", j.Origin(ctx))
+	}
+	return
+}
+
+// SlackActiveThread - is message a thread parent with replies posted since date from
+func SlackActiveThread(message map[string]interface{}, dateFrom time.Time) bool {
+	replyCount, _ := message["reply_count"].(float64)
+	latestReply, _ := message["latest_reply"].(string)
+	if replyCount == 0 || latestReply == "" {
+		return false
+	}
+	dt, err := SlackTSToTime(latestReply)
+	return err == nil && !dt.Before(dateFrom)
+}
+
+// SlackMessageUpdatedOn - return message update date: its last edit date or its post date when it was never edited
+func SlackMessageUpdatedOn(message map[string]interface{}) (dt time.Time, err error) {
+	ts, _ := message["ts"].(string)
+	dt, err = SlackTSToTime(ts)
+	if err != nil {
+		return
+	}
+	edited, _ := message["edited"].(map[string]interface{})
+	editedTS, _ := edited["ts"].(string)
+	if editedTS == "" {
+		return
+	}
+	editedAt, e := SlackTSToTime(editedTS)
+	if e == nil && editedAt.After(dt) {
+		dt = editedAt
+	}
+	return
+}
+
+// SlackEditedSince - is message edited since date from
+func SlackEditedSince(message map[string]interface{}, dateFrom time.Time) bool {
+	edited, _ := message["edited"].(map[string]interface{})
+	editedTS, _ := edited["ts"].(string)
+	if editedTS == "" {
+		return false
+	}
+	dt, err := SlackMessageUpdatedOn(message)
+	return err == nil && !dt.Before(dateFrom)
+}
+
+// FetchItems - implement fetch items for slack datasource
+// Messages are fetched sequentially: Slack rate limits are per method and token, so multiple threads would only wait more
+// Threads started up to SlackThreadsLookback before date from are revisited, so replies posted since date from are not missed
+// Messages posted up to SlackEditsLookback before date from and edited since then are fetched again, their update date is the edit date
+// Slack doesn't report when reactions were added, so reactions to messages posted before date from are only updated with their edits
+func (j *DSSlack) FetchItems(ctx *Ctx) (err error) {
+	var dateFrom time.Time
+	if ctx.DateFrom != nil {
+		dateFrom = *ctx.DateFrom
+	} else {
+		dateFrom = DefaultDateFrom
+	}
+	oldest := SlackTS(dateFrom)
+	scanFrom := oldest
+	if ctx.DateFrom != nil {
+		lookback := SlackEditsLookback
+		if j.Threads && SlackThreadsLookback > lookback {
+			lookback = SlackThreadsLookback
+		}
+		scanFrom = SlackTS(dateFrom.Add(-lookback))
+	}
+	channelInfo, err := j.GetSlackChannelInfo(ctx)
+	if err != nil {
+		return
+	}
+	var allMsgs []interface{}
+	seen := make(map[string]struct{})
+	processMsg := func(message map[string]interface{}) (e error) {
+		ts, _ := message["ts"].(string)
+		_, ok := seen[ts]
+		if ok || ts == "" {
+			return
+		}
+		seen[ts] = struct{}{}
+		e = j.AddMessageUsers(ctx, message)
+		if e != nil {
+			return
+		}
+		message["channel_info"] = channelInfo
+		esItem := j.AddMetadata(ctx, message)
+		if ctx.Project != "" {
+			message["project"] = ctx.Project
+		}
+		esItem["data"] = message
+		allMsgs = append(allMsgs, esItem)
+		if len(allMsgs) >= ctx.ESBulkSize {
+			e = SendToElastic(ctx, j, true, UUID, allMsgs)
+			if e != nil {
+				Printf("error %v sending %d messages to ElasticSearch\n", e, len(allMsgs))
+			}
+			allMsgs = []interface{}{}
+		}
+		return
+	}
+	fetchReplies := func(ts string) error {
+		// First returned message is the thread parent, it is already processed or (for active threads) updated with new reply count
+		return j.slackPages(
+			ctx,
+			"conversations.replies",
+			neturl.Values{"channel": []string{j.Channel}, "ts": []string{ts}, "oldest": []string{oldest}, "inclusive": []string{"true"}},
+			"messages",
+			processMsg,
+		)
+	}
+	// Threads started before date from (in lookback window) with replies since date from
+	// and messages posted before date from (in lookback window) edited since date from
+	activeThreads := []string{}
+	nEdited := 0
+	err = j.slackPages(
+		ctx,
+		"conversations.history",
+		neturl.Values{"channel": []string{j.Channel}, "oldest": []string{scanFrom}, "inclusive": []string{"true"}},
+		"messages",
+		func(message map[string]interface{}) (e error) {
+			ts, _ := message["ts"].(string)
+			dt, tsErr := SlackTSToTime(ts)
+			if tsErr == nil && dt.Before(dateFrom) {
+				if j.Threads && SlackActiveThread(message, dateFrom) && !dt.Before(dateFrom.Add(-SlackThreadsLookback)) {
+					activeThreads = append(activeThreads, ts)
+				}
+				if SlackEditedSince(message, dateFrom) && !dt.Before(dateFrom.Add(-SlackEditsLookback)) {
+					nEdited++
+					e = processMsg(message)
+				}
+				return
+			}
+			e = processMsg(message)
+			if e != nil {
+				return
+			}
+			replyCount, _ := message["reply_count"].(float64)
+			if !j.Threads || replyCount == 0 {
+				return
+			}
+			return fetchReplies(ts)
+		},
+	)
+	if err != nil {
+		return
+	}
+	if ctx.Debug > 0 && len(activeThreads) > 0 {
+		Printf("%s: %d threads started before %v have new replies\n", j.Origin(ctx), len(activeThreads), dateFrom)
+	}
+	if ctx.Debug > 0 && nEdited > 0 {
+		Printf("%s: %d messages posted before %v were edited since then\n", j.Origin(ctx), nEdited, dateFrom)
+	}
+	for _, ts := range activeThreads {
+		err = fetchReplies(ts)
+		if err != nil {
+			return
+		}
+	}
+	nMsgs := len(allMsgs)
+	if ctx.Debug > 0 {
+		Printf("%d remaining messages to send to ES\n", nMsgs)
+	}
+	if nMsgs > 0 {
+		err = SendToElastic(ctx, j, true, UUID, allMsgs)
+		if err != nil {
+			Printf("Error %v sending %d messages to ES\n", err, len(allMsgs))
+		}
+	}
+	return
+}
+
+// SupportDateFrom - does DS support resuming from date?
+func (j *DSSlack) SupportDateFrom() bool {
+	return true
+}
+
+// SupportOffsetFrom - does DS support resuming from offset?
+func (j *DSSlack) SupportOffsetFrom() bool {
+	return false
+}
+
+// DateField - return date field used to detect where to restart from
+func (j *DSSlack) DateField(*Ctx) string {
+	return DefaultDateField
+}
+
+// RichIDField - return rich ID field name
+func (j *DSSlack) RichIDField(*Ctx) string {
+	return UUID
+}
+
+// RichAuthorField - return rich author field name
+func (j *DSSlack) RichAuthorField(*Ctx) string {
+	return DefaultAuthorField
+}
+
+// OffsetField - return offset field used to detect where to restart from
+func (j *DSSlack) OffsetField(*Ctx) string {
+	return DefaultOffsetField
+}
+
+// OriginField - return origin field used to detect where to restart from
+func (j *DSSlack) OriginField(ctx *Ctx) string {
+	if ctx.Tag != "" {
+		return DefaultTagField
+	}
+	return DefaultOriginField
+}
+
+// Categories - return a set of configured categories
+func (j *DSSlack) Categories() map[string]struct{} {
+	return SlackCategories
+}
+
+// ResumeNeedsOrigin - is origin field needed when resuming
+// Origin should be needed when multiple configurations save to the same index
+func (j *DSSlack) ResumeNeedsOrigin(ctx *Ctx, raw bool) bool {
+	return !j.SingleOrigin
+}
+
+// ResumeNeedsCategory - is category field needed when resuming
+// Category should be needed when multiple types of categories save to the same index
+// or there are multiple types of documents within the same category
+func (j *DSSlack) ResumeNeedsCategory(ctx *Ctx, raw bool) bool {
+	return false
+}
+
+// Origin - return current origin
+func (j *DSSlack) Origin(ctx *Ctx) string {
+	return j.URL + "/" + j.Channel
+}
+
+// ItemID - return unique identifier for an item (message timestamp is unique within a channel)
+func (j *DSSlack) ItemID(item interface{}) string {
+	id, _ := Dig(item, []string{"ts"}, true, false)
+	return id.(string)
+}
+
+// AddMetadata - add metadata to the item
+func (j *DSSlack) AddMetadata(ctx *Ctx, item interface{}) (mItem map[string]interface{}) {
+	mItem = make(map[string]interface{})
+	origin := j.Origin(ctx)
+	tag := ctx.Tag
+	if tag == "" {
+		tag = origin
+	}
+	itemID := j.ItemID(item)
+	updatedOn := j.ItemUpdatedOn(item)
+	uuid := UUIDNonEmpty(ctx, origin, itemID)
+	timestamp := time.Now()
+	mItem["backend_name"] = j.DS
+	mItem["backend_version"] = SlackBackendVersion
+	mItem["timestamp"] = fmt.Sprintf("%.06f", float64(timestamp.UnixNano())/1.0e9)
+	mItem[UUID] = uuid
+	mItem[DefaultOriginField] = origin
+	mItem[DefaultTagField] = tag
+	mItem[DefaultOffsetField] = float64(updatedOn.Unix())
+	mItem["category"] = j.ItemCategory(item)
+	mItem["search_fields"] = make(map[string]interface{})
+	channelID, _ := Dig(item, []string{"channel_info", "id"}, true, false)
+	channelName, _ := Dig(item, []string{"channel_info", "name"}, true, false)
+	FatalOnError(DeepSet(mItem, []string{"search_fields", SlackDefaultSearchField}, itemID, false))
+	FatalOnError(DeepSet(mItem, []string{"search_fields", "channel_id"}, channelID, false))
+	FatalOnError(DeepSet(mItem, []string{"search_fields", "channel_name"}, channelName, false))
+	mItem[DefaultDateField] = ToESDate(updatedOn)
+	mItem[DefaultTimestampField] = ToESDate(timestamp)
+	mItem[ProjectSlug] = ctx.ProjectSlug
+	return
+}
+
+// ItemUpdatedOn - return updated on date for an item, edited messages are updated when edited
+// so messages edited since date from are enriched again
+func (j *DSSlack) ItemUpdatedOn(item interface{}) time.Time {
+	updated, err := SlackMessageUpdatedOn(item.(map[string]interface{}))
+	FatalOnError(err)
+	return updated
+}
+
+// ItemCategory - return unique identifier for an item
+func (j *DSSlack) ItemCategory(item interface{}) string {
+	return Message
+}
+
+// ElasticRawMapping - Raw index mapping definition
+func (j *DSSlack) ElasticRawMapping() []byte {
+	return SlackRawMapping
+}
+
+// ElasticRichMapping - Rich index mapping definition
+func (j *DSSlack) ElasticRichMapping() []byte {
+	return SlackRichMapping
+}
+
+// GetItemIdentities return list of item's identities, each one is [3]string
+// (name, username, email) tripples, special value Nil "none" means null
+// we use string and not *string which allows nil to allow usage as a map key
+func (j *DSSlack) GetItemIdentities(ctx *Ctx, doc interface{}) (identities map[[3]string]struct{}, err error) {
+	if ctx.Debug > 2 {
+		defer func() {
+			Printf("GetItemIdentities: %+v -> %+v\n", DumpPreview(doc, 100), identities)
+		}()
+	}
+	identity := j.GetRoleIdentity(ctx, doc.(map[string]interface{}), "user_data")
+	if len(identity) == 0 {
+		return
+	}
+	name, username, email := identity["name"].(string), identity["username"].(string), identity["email"].(string)
+	if name == Nil && username == Nil && email == Nil {
+		return
+	}
+	identities = map[[3]string]struct{}{{name, username, email}: {}}
+	return
+}
+
+// SlackEnrichItemsFunc - iterate items and enrich them
+// items is a current pack of input items
+// docs is a pointer to where extracted identities will be stored
+func SlackEnrichItemsFunc(ctx *Ctx, ds DS, thrN int, items []interface{}, docs *[]interface{}) (err error) {
+	if ctx.Debug > 0 {
+		Printf("slack enrich items %d/%d func\n", len(items), len(*docs))
+	}
+	var (
+		mtx *sync.RWMutex
+		ch  chan error
+	)
+	if thrN > 1 {
+		mtx = &sync.RWMutex{}
+		ch = make(chan error)
+	}
+	dbConfigured := ctx.AffsDBConfigured()
+	nThreads := 0
+	procItem := func(c chan error, idx int) (e error) {
+		if thrN > 1 {
+			mtx.RLock()
+		}
+		item := items[idx]
+		if thrN > 1 {
+			mtx.RUnlock()
+		}
+		defer func() {
+			if c != nil {
+				c <- e
+			}
+		}()
+		src, ok := item.(map[string]interface{})["_source"]
+		if !ok {
+			e = fmt.Errorf("Missing _source in item %+v", DumpKeys(item))
+			return
+		}
+		doc, ok := src.(map[string]interface{})
+		if !ok {
+			e = fmt.Errorf("Failed to parse document %+v", doc)
+			return
+		}
+		// Actual item enrichment
+		var rich map[string]interface{}
+		rich, e = ds.EnrichItem(ctx, doc, "", dbConfigured, nil)
+		if e != nil {
+			return
+		}
+		e = EnrichItem(ctx, ds, rich)
+		if e != nil {
+			return
+		}
+		if thrN > 1 {
+			mtx.Lock()
+		}
+		*docs = append(*docs, rich)
+		if thrN > 1 {
+			mtx.Unlock()
+		}
+		return
+	}
+	if thrN > 1 {
+		for i := range items {
+			go func(i int) {
+				_ = procItem(ch, i)
+			}(i)
+			nThreads++
+			if nThreads == thrN {
+				err = <-ch
+				if err != nil {
+					return
+				}
+				nThreads--
+			}
+		}
+		for nThreads > 0 {
+			err = <-ch
+			nThreads--
+			if err != nil {
+				return
+			}
+		}
+		return
+	}
+	for i := range items {
+		err = procItem(nil, i)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// EnrichItems - perform the enrichment
+func (j *DSSlack) EnrichItems(ctx *Ctx) (err error) {
+	Printf("enriching items\n")
+	err = ForEachESItem(ctx, j, true, ESBulkUploadFunc, SlackEnrichItemsFunc, nil, true)
+	return
+}
+
+// EnrichItem - return rich item from raw item for a given author type
+func (j *DSSlack) EnrichItem(ctx *Ctx, item map[string]interface{}, author string, affs bool, extra interface{}) (rich map[string]interface{}, err error) {
+	rich = make(map[string]interface{})
+	for _, field := range RawFields {
+		v, _ := item[field]
+		rich[field] = v
+	}
+	message, ok := item["data"].(map[string]interface{})
+	if !ok {
+		err = fmt.Errorf("missing data field in item %+v", DumpKeys(item))
+		return
+	}
+	msg, _ := message["text"].(string)
+	rich["msg_analyzed"] = msg
+	rich["msg"] = msg
+	rich["rid"], _ = Dig(message, []string{"channel_info", "id"}, false, true)
+	rich["msg_id"], _ = message["ts"]
+	rich["msg_parent"] = nil
+	rich["subtype"], _ = message["subtype"]
+	rich["user_id"], _ = message["user"]
+	rich["user_name"] = nil
+	rich["user_username"] = nil
+	user, ok := message["user_data"].(map[string]interface{})
+	if ok {
+		rich["user_name"] = SlackUserName(user)
+		rich["user_username"], _ = user["name"]
+		rich["user_tz"], _ = user["tz"]
+	}
+	rich["is_edited"] = 0
+	edited, ok := message["edited"].(map[string]interface{})
+	if ok {
+		editedTS, _ := edited["ts"].(string)
+		editedAt, err := SlackTSToTime(editedTS)
+		if err == nil {
+			rich["edited_at"] = editedAt
+		}
+		rich["edited_by_user_id"], _ = edited["user"]
+		if edited["user"] == message["user"] {
+			rich["edited_by_username"] = rich["user_username"]
+		}
+		rich["is_edited"] = 1
+	}
+	files, ok := message["files"].([]interface{})
+	if ok && len(files) > 0 {
+		file, _ := files[0].(map[string]interface{})
+		rich["file_id"], _ = file["id"]
+		rich["file_name"], _ = file["name"]
+		rich["file_type"], _ = file["filetype"]
+	}
+	rich["replies"] = 0
+	replyCount, ok := message["reply_count"].(float64)
+	if ok {
+		rich["replies"] = int(replyCount)
+	}
+	rich["total_reactions"] = 0
+	reactions, ok := message["reactions"].([]interface{})
+	if ok {
+		rich["reactions"], rich["total_reactions"] = j.GetReactions(reactions)
+	}
+	rich["total_mentions"] = 0
+	mentions, ok := message["mentions"].([]interface{})
+	if ok {
+		mentionsAry := j.GetMentions(mentions)
+		rich["mentions"] = mentionsAry
+		rich["total_mentions"] = len(mentionsAry)
+	}
+	channelInfo, ok := message["channel_info"].(map[string]interface{})
+	if ok {
+		j.SetChannelInfo(rich, channelInfo)
+	}
+	j.SetThreadInfo(rich, message)
+	urls := SlackURLs(msg)
+	rich["message_urls"] = urls
+	rich["total_urls"] = len(urls)
+	// metadata__updated_on is the last edit date, message is created when posted
+	ts, _ := message["ts"].(string)
+	var createdOn time.Time
+	createdOn, err = SlackTSToTime(ts)
+	if err != nil {
+		return
+	}
+	if affs {
+		authorKey := "user_data"
+		var affsItems map[string]interface{}
+		affsItems, err = j.AffsItems(ctx, item, SlackRoles, createdOn)
+		if err != nil {
+			return
+		}
+		for prop, value := range affsItems {
+			rich[prop] = value
+		}
+		for _, suff := range AffsFields {
+			rich[Author+suff] = rich[authorKey+suff]
+		}
+		orgsKey := authorKey + MultiOrgNames
+		_, ok := Dig(rich, []string{orgsKey}, false, true)
+		if !ok {
+			rich[orgsKey] = []interface{}{}
+		}
+	}
+	for prop, value := range CommonFields(j, createdOn, Message) {
+		rich[prop] = value
+	}
+	return
+}
+
+// SetChannelInfo - set rich channel info from raw channel info
+func (j *DSSlack) SetChannelInfo(rich, channel map[string]interface{}) {
+	rich["channel_id"], _ = channel["id"]
+	rich["channel_updated_at"] = nil
+	updated, ok := channel["updated"].(float64)
+	if ok && updated > 0 {
+		rich["channel_updated_at"] = time.Unix(0, int64(updated)*int64(time.Millisecond)).UTC()
+	}
+	rich["channel_created_at"] = nil
+	created, ok := channel["created"].(float64)
+	if ok && created > 0 {
+		rich["channel_created_at"] = time.Unix(int64(created), 0).UTC()
+	}
+	rich["channel_num_messages"] = nil
+	rich["channel_name"], _ = channel["name"]
+	rich["channel_num_users"], _ = channel["num_members"]
+	rich["channel_topic"], _ = Dig(channel, []string{"topic", "value"}, false, true)
+	rich["avatar"] = nil
+	private, _ := channel["is_private"].(bool)
+	if private {
+		rich["room_type"] = "group"
+	} else {
+		rich["room_type"] = "channel"
+	}
+}
+
+// SetThreadInfo - set rich thread info: parent message id for thread replies and number of replies for thread parents
+func (j *DSSlack) SetThreadInfo(rich, message map[string]interface{}) {
+	rich["thread_parent_id"] = nil
+	rich["is_thread_reply"] = 0
+	ts, _ := message["ts"].(string)
+	threadTS, _ := message["thread_ts"].(string)
+	if threadTS != "" && threadTS != ts {
+		rich["thread_parent_id"] = threadTS
+		rich["msg_parent"] = threadTS
+		rich["is_thread_reply"] = 1
+	}
+	rich["thread_replies"] = rich["replies"]
+}
+
+// GetMentions - convert raw mentions to rich mentions
+func (j *DSSlack) GetMentions(mentions []interface{}) (richMentions []map[string]interface{}) {
+	for _, iUsr := range mentions {
+		usr, _ := iUsr.(map[string]interface{})
+		richMentions = append(richMentions, map[string]interface{}{
+			"username": usr["username"],
+			"id":       usr["_id"],
+			"name":     usr["name"],
+		})
+	}
+	return
+}
+
+// GetReactions - convert raw reactions to rich reactions
+func (j *DSSlack) GetReactions(reactions []interface{}) (richReactions []map[string]interface{}, nReactions int) {
+	for _, iReaction := range reactions {
+		reaction, _ := iReaction.(map[string]interface{})
+		name, _ := reaction["name"].(string)
+		reactionType := ":" + name + ":"
+		userNames, _ := reaction["usernames"].([]interface{})
+		names, _ := reaction["names"].([]interface{})
+		if userNames == nil {
+			userNames = []interface{}{}
+		}
+		if names == nil {
+			names = []interface{}{}
+		}
+		// users list can be truncated, count is always complete
+		count := len(userNames)
+		fCount, ok := reaction["count"].(float64)
+		if ok {
+			count = int(fCount)
+		}
+		richReactions = append(richReactions, map[string]interface{}{
+			"type":     reactionType,
+			"emoji":    emoji.GetEmojiUnicode(reactionType),
+			"username": userNames,
+			"names":    names,
+			"count":    count,
+		})
+		nReactions += count
+	}
+	return
+}
+
+// AffsItems - return affiliations data items for given roles and date
+func (j *DSSlack) AffsItems(ctx *Ctx, message map[string]interface{}, roles []string, date interface{}) (affsItems map[string]interface{}, err error) {
+	affsItems = make(map[string]interface{})
+	var dt time.Time
+	dt, err = TimeParseInterfaceString(date)
+	if err != nil {
+		return
+	}
+	for _, role := range roles {
+		identity := j.GetRoleIdentity(ctx, message, role)
+		if len(identity) == 0 {
+			continue
+		}
+		affsIdentity, empty, e := IdentityAffsData(ctx, j, identity, nil, dt, role)
+		if e != nil {
+			Printf("AffsItems/IdentityAffsData: error: %v for %v,%v,%v\n", e, identity, dt, role)
+			if ctx.AffsAPIFailFatal {
+				err = e
+				return
+			}
+		}
+		if empty {
+			Printf("no identity affiliation data for identity %+v\n", identity)
+			continue
+		}
+		for prop, value := range affsIdentity {
+			affsItems[prop] = value
+		}
+		for _, suff := range RequiredAffsFields {
+			k := role + suff
+			_, ok := affsIdentity[k]
+			if !ok {
+				affsIdentity[k] = Unknown
+			}
+		}
+	}
+	return
+}
+
+// GetRoleIdentity - return identity data for a given role
+// Messages posted by bots and integrations have no user data, so they have no identity
+func (j *DSSlack) GetRoleIdentity(ctx *Ctx, item map[string]interface{}, role string) (identity map[string]interface{}) {
+	iUser, ok := Dig(item, []string{"data", role}, false, true)
+	if !ok {
+		return
+	}
+	user, _ := iUser.(map[string]interface{})
+	name, username, email := Nil, Nil, Nil
+	sName := SlackUserName(user)
+	if sName != "" {
+		name = sName
+	}
+	sUserName, _ := user["name"].(string)
+	if sUserName != "" {
+		username = sUserName
+	}
+	iEmail, _ := Dig(user, []string{"profile", "email"}, false, true)
+	sEmail, _ := iEmail.(string)
+	if sEmail != "" {
+		email = sEmail
+	}
+	identity = map[string]interface{}{"name": name, "username": username, "email": email}
+	return
+}
+
+// AllRoles - return all roles defined for the backend
+// roles can be static (always the same) or dynamic (per item)
+// second return parameter is static mode (true/false)
+// dynamic roles will use item to get its roles
+func (j *DSSlack) AllRoles(ctx *Ctx, item map[string]interface{}) ([]string, bool) {
+	return SlackRoles, true
+}
+
+// HasIdentities - does this data source support identity data
+func (j *DSSlack) HasIdentities() bool {
+	return true
+}
+
+// UseDefaultMapping - apply MappingNotAnalyzeString for raw/rich (raw=fals/true) index in this DS?
+func (j *DSSlack) UseDefaultMapping(ctx *Ctx, raw bool) bool {
+	return true
+}
@@ -0,0 +1,135 @@
+package dads
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSlackTS(t *testing.T) {
+	dt, err := SlackTSToTime("1623456789.000200")
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	expected := time.Date(2021, 6, 12, 0, 13, 9, 200000, time.UTC)
+	if !dt.Equal(expected) {
+		t.Errorf("expected %v, got %v", expected, dt)
+	}
+	if SlackTS(expected) != "1623456789.000200" {
+		t.Errorf("unexpected slack timestamp %s", SlackTS(expected))
+	}
+	now := time.Unix(1000, 0)
+	rateLimit, rateLimitReset := SlackRetryAfter(map[string][]string{"Retry-After": {"30"}}, now)
+	if rateLimit != SlackMinRate || rateLimitReset != 1031 {
+		t.Errorf("unexpected rate limit %d, %d", rateLimit, rateLimitReset)
+	}
+	_, rateLimitReset = SlackRetryAfter(nil, now)
+	if rateLimitReset != 1000+SlackDefaultRetryAfter+1 {
+		t.Errorf("unexpected default rate limit reset %d", rateLimitReset)
+	}
+}
+
+func TestSlackActiveThread(t *testing.T) {
+	dateFrom := time.Date(2021, 6, 12, 0, 0, 0, 0, time.UTC)
+	var testCases = []struct {
+		message  map[string]interface{}
+		expected bool
+	}{
+		{message: map[string]interface{}{"ts": "1622505600.000100"}, expected: false},
+		{message: map[string]interface{}{"ts": "1622505600.000100", "reply_count": 2.0, "latest_reply": "1622592000.000100"}, expected: false},
+		{message: map[string]interface{}{"ts": "1622505600.000100", "reply_count": 3.0, "latest_reply": "1623456789.000200"}, expected: true},
+		{message: map[string]interface{}{"ts": "1622505600.000100", "reply_count": 1.0, "latest_reply": SlackTS(dateFrom)}, expected: true},
+		{message: map[string]interface{}{"ts": "1622505600.000100", "reply_count": 1.0}, expected: false},
+	}
+	for index, test := range testCases {
+		got := SlackActiveThread(test.message, dateFrom)
+		if got != test.expected {
+			t.Errorf("test number %d, expected %v, got %v", index+1, test.expected, got)
+		}
+	}
+}
+
+func TestSlackEditedSince(t *testing.T) {
+	dateFrom := time.Date(2021, 6, 12, 0, 0, 0, 0, time.UTC)
+	var testCases = []struct {
+		message           map[string]interface{}
+		expectedUpdatedOn string
+		expectedEdited    bool
+	}{
+		{message: map[string]interface{}{"ts": "1622505600.000100"}, expectedUpdatedOn: "1622505600.000100", expectedEdited: false},
+		{message: map[string]interface{}{"ts": "1622505600.000100", "edited": map[string]interface{}{"user": "U1", "ts": "1622592000.000000"}}, expectedUpdatedOn: "1622592000.000000", expectedEdited: false},
+		{message: map[string]interface{}{"ts": "1622505600.000100", "edited": map[string]interface{}{"user": "U1", "ts": "1623456789.000200"}}, expectedUpdatedOn: "1623456789.000200", expectedEdited: true},
+		{message: map[string]interface{}{"ts": "1623456789.000200", "edited": map[string]interface{}{"user": "U1"}}, expectedUpdatedOn: "1623456789.000200", expectedEdited: false},
+	}
+	for index, test := range testCases {
+		updatedOn, err := SlackMessageUpdatedOn(test.message)
+		if err != nil {
+			t.Errorf("test number %d, unexpected error: %v", index+1, err)
+			continue
+		}
+		if SlackTS(updatedOn) != test.expectedUpdatedOn {
+			t.Errorf("test number %d, expected updated on %s, got %s", index+1, test.expectedUpdatedOn, SlackTS(updatedOn))
+		}
+		got := SlackEditedSince(test.message, dateFrom)
+		if got != test.expectedEdited {
+			t.Errorf("test number %d, expected %v, got %v", index+1, test.expectedEdited, got)
+		}
+	}
+}
+
+func TestSlackMessageParsing(t *testing.T) {
+	text := "cc <@U01ABC> and <@W02DEF|bob>, see <https://example.com/doc|doc> and <https://lfx.dev>, again <@U01ABC>"
+	mentions := SlackMentionedUsers(text)
+	if len(mentions) != 2 || mentions[0] != "U01ABC" || mentions[1] != "W02DEF" {
+		t.Errorf("unexpected mentions: %+v", mentions)
+	}
+	urls := SlackURLs(text)
+	if len(urls) != 2 || urls[0] != "https://example.com/doc" || urls[1] != "https://lfx.dev" {
+		t.Errorf("unexpected urls: %+v", urls)
+	}
+	var testCases = []struct {
+		channel        map[string]interface{}
+		includePrivate bool
+		expected       bool
+	}{
+		{channel: map[string]interface{}{"id": "C1", "is_member": true}, expected: true},
+		{channel: map[string]interface{}{"id": "C2", "is_member": false}, expected: false},
+		{channel: map[string]interface{}{"id": "G1", "is_private": true, "is_member": true}, expected: false},
+		{channel: map[string]interface{}{"id": "G1", "is_private": true, "is_member": true}, includePrivate: true, expected: true},
+		{channel: map[string]interface{}{"id": "D1", "is_im": true, "is_member": true}, includePrivate: true, expected: false},
+		{channel: map[string]interface{}{"id": "G2", "is_mpim": true, "is_private": true, "is_member": true}, includePrivate: true, expected: false},
+	}
+	for index, test := range testCases {
+		got := SlackChannelAllowed(test.channel, test.includePrivate)
+		if got != test.expected {
+			t.Errorf("test number %d, expected %v, got %v", index+1, test.expected, got)
+		}
+	}
+}
+
+func TestSlackRichFields(t *testing.T) {
+	j := &DSSlack{}
+	reactions, n := j.GetReactions([]interface{}{
+		map[string]interface{}{"name": "+1", "count": 3.0, "users": []interface{}{"U1", "U2", "U3"}, "usernames": []interface{}{"alice", "bob"}, "names": []interface{}{"Alice", "Bob"}},
+	})
+	if n != 3 || len(reactions) != 1 || reactions[0]["type"] != ":+1:" || reactions[0]["emoji"] != "\U0001f44d" || reactions[0]["count"] != 3 {
+		t.Errorf("unexpected reactions: %+v, %d", reactions, n)
+	}
+	item := map[string]interface{}{"data": map[string]interface{}{
+		"ts":        "1623456789.000200",
+		"thread_ts": "1623456000.000100",
+		"user_data": map[string]interface{}{"name": "alice", "real_name": "", "profile": map[string]interface{}{"real_name": "Alice A", "email": "alice@example.com"}},
+	}}
+	identity := j.GetRoleIdentity(nil, item, "user_data")
+	if identity["name"] != "Alice A" || identity["username"] != "alice" || identity["email"] != "alice@example.com" {
+		t.Errorf("unexpected identity: %+v", identity)
+	}
+	if len(j.GetRoleIdentity(nil, map[string]interface{}{"data": map[string]interface{}{"bot_id": "B1"}}, "user_data")) != 0 {
+		t.Errorf("expected no identity for bot message")
+	}
+	rich := map[string]interface{}{"replies": 0}
+	j.SetThreadInfo(rich, item["data"].(map[string]interface{}))
+	if rich["thread_parent_id"] != "1623456000.000100" || rich["is_thread_reply"] != 1 {
+		t.Errorf("unexpected thread fields: %+v", rich)
+	}
+}
@@ -0,0 +1,602 @@
+package dads
+
+import (
+	"encoding/base64"
+	"fmt"
+	neturl "net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+const (
+	// GerritTransportSSH - fetch reviews via `ssh gerrit query` (default)
+	GerritTransportSSH = "ssh"
+	// GerritTransportREST - fetch reviews via gerrit REST API
+	GerritTransportREST = "rest"
+	// GerritRESTMagicPrefix - XSSI protection prefix gerrit puts before every JSON response
+	GerritRESTMagicPrefix = ")]}'"
+	// GerritRESTDateFormat - gerrit REST API timestamp format, always UTC
+	GerritRESTDateFormat = "2006-01-02 15:04:05.000000000"
+)
+
+var (
+	// GerritTransports - supported gerrit transports
+	GerritTransports = map[string]struct{}{GerritTransportSSH: {}, GerritTransportREST: {}}
+	// GerritRESTOptions - additional fields requested from /changes/ endpoint
+	GerritRESTOptions = []string{"ALL_REVISIONS", "ALL_COMMITS", "DETAILED_LABELS", "MESSAGES", "DETAILED_ACCOUNTS", "ALL_FILES"}
+	// GerritRESTFileTypes - REST API file status to `gerrit query --files` type
+	GerritRESTFileTypes = map[string]string{"A": "ADDED", "D": "DELETED", "R": "RENAMED", "C": "COPIED", "W": "REWRITE"}
+	// GerritRESTVoteMessageRegexp - change message first line with votes, like "Patch Set 2: Code-Review+2 Verified+1"
+	GerritRESTVoteMessageRegexp = regexp.MustCompile(`^Patch Set (\d+):(.*)$`)
+	// GerritRESTVoteRegexp - single vote "Label+N"/"Label-N" or vote removal "-Label" from change message
+	GerritRESTVoteRegexp = regexp.MustCompile(`^(?:([A-Za-z][\w-]*?)([+-]\d+)|-([A-Za-z][\w-]*))$`)
+)
+
+// RESTBaseURL - return gerrit REST API base URL, authenticated endpoints are prefixed with "/a"
+func (j *DSGerrit) RESTBaseURL(auth bool) string {
+	url := j.Scheme + "://" + j.URL
+	if auth && j.User != "" && j.HTTPPassword != "" {
+		url += "/a"
+	}
+	return url
+}
+
+// RESTRequest - execute GET request on gerrit REST API and return JSON data with XSSI prefix stripped
+func (j *DSGerrit) RESTRequest(ctx *Ctx, path string) (result interface{}, err error) {
+	url := j.RESTBaseURL(true) + path
+	var headers map[string]string
+	if j.User != "" && j.HTTPPassword != "" {
+		headers = map[string]string{"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte(j.User+":"+j.HTTPPassword))}
+	}
+	if ctx.Debug > 0 {
+		Printf("gerrit REST request: %s\n", url)
+	}
+	var res interface{}
+	res, _, _, _, err = Request(
+		ctx,
+		url,
+		Get,
+		headers,
+		nil,
+		nil,
+		nil,                                 // JSON statuses: none, gerrit prefixes JSON with XSSI protection
+		map[[2]int]struct{}{{400, 599}: {}}, // Error statuses: 400-599
+		nil,                                 // OK statuses
+		nil,                                 // Cache statuses
+		true,                                // retry
+		nil,                                 // cache duration
+		false,                               // skip in dry-run mode
+	)
+	if err != nil {
+		return
+	}
+	data, ok := res.([]byte)
+	if !ok {
+		err = fmt.Errorf("cannot read gerrit REST response from %s: %+v", url, res)
+		return
+	}
+	data = []byte(strings.TrimPrefix(strings.TrimSpace(string(data)), GerritRESTMagicPrefix))
+	err = jsoniter.Unmarshal(data, &result)
+	if err != nil {
+		err = fmt.Errorf("cannot parse gerrit REST response from %s: %v: %s", url, err, BytesToStringTrunc(data, MaxPayloadPrintfLen, true))
+	}
+	return
+}
+
+// GetGerritRESTVersion - get gerrit version via REST API
+func (j *DSGerrit) GetGerritRESTVersion(ctx *Ctx) (err error) {
+	var res interface{}
+	res, err = j.RESTRequest(ctx, "/config/server/version")
+	if err != nil {
+		return
+	}
+	version, _ := res.(string)
+	match := GerritVersionRegexp.FindAllStringSubmatch("gerrit version "+version, -1)
+	if len(match) < 1 {
+		err = fmt.Errorf("cannot parse gerrit version '%+v'", res)
+		return
+	}
+	j.VersionMajor, _ = strconv.Atoi(match[0][1])
+	j.VersionMinor, _ = strconv.Atoi(match[0][2])
+	if ctx.Debug > 0 {
+		Printf("Detected gerrit %d.%d\n", j.VersionMajor, j.VersionMinor)
+	}
+	return
+}
+
+// GetGerritRESTReviews - get gerrit reviews via REST API, returned reviews have the same structure as `gerrit query` ones
+func (j *DSGerrit) GetGerritRESTReviews(ctx *Ctx, after string, afterEpoch float64, startFrom int) (reviews []map[string]interface{}, newStartFrom int, err error) {
+	query := `after:"` + after + `" (status:open OR status:closed)`
+	if ctx.ProjectFilter && ctx.Project != "" {
+		query = "project:" + ctx.Project + " " + query
+	}
+	path := "/changes/?q=" + neturl.QueryEscape(query) + "&n=" + strconv.Itoa(j.MaxReviews)
+	if startFrom > 0 {
+		path += "&S=" + strconv.Itoa(startFrom)
+	}
+	for _, opt := range GerritRESTOptions {
+		path += "&o=" + opt
+	}
+	var res interface{}
+	res, err = j.RESTRequest(ctx, path)
+	if err != nil {
+		return
+	}
+	changes, ok := res.([]interface{})
+	if !ok {
+		err = fmt.Errorf("cannot read changes array from %s response: %+v", path, DumpPreview(res, 100))
+		return
+	}
+	baseURL := j.RESTBaseURL(false)
+	for i, iChange := range changes {
+		change, ok := iChange.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if i == len(changes)-1 {
+			moreChanges, _ := change["_more_changes"].(bool)
+			if moreChanges {
+				newStartFrom = startFrom + len(changes)
+				if ctx.Debug > 0 {
+					Printf("#%d) moreChanges: %v, newStartFrom: %d\n", i, moreChanges, newStartFrom)
+				}
+			}
+		}
+		review := GerritRESTChangeToReview(baseURL, change)
+		lastUpdated, ok := review["lastUpdated"].(float64)
+		if !ok {
+			Printf("cannot read lastUpdated from %v\n", DumpKeys(change))
+			continue
+		}
+		if lastUpdated < afterEpoch {
+			if ctx.Debug > 1 {
+				Printf("#%d) lastUpdated: %v < afterEpoch: %v, skipping\n", i, lastUpdated, afterEpoch)
+			}
+			continue
+		}
+		// inline comments and related changes are not returned by /changes/ query, they need calls per change
+		changeID := fmt.Sprintf("%s~%.0f", neturl.PathEscape(fmt.Sprintf("%v", change["project"])), change["_number"])
+		var comments, related interface{}
+		comments, err = j.RESTRequest(ctx, "/changes/"+changeID+"/comments")
+		if err != nil {
+			return
+		}
+		GerritRESTAddInlineComments(review, comments)
+		related, err = j.RESTRequest(ctx, "/changes/"+changeID+"/revisions/current/related")
+		if err != nil {
+			return
+		}
+		GerritRESTAddDependencies(review, related)
+		reviews = append(reviews, review)
+	}
+	return
+}
+
+// GerritRESTEpoch - convert gerrit REST API timestamp to epoch seconds, as used by `gerrit query`
+func GerritRESTEpoch(iDate interface{}) (epoch float64, ok bool) {
+	sDate, ok := iDate.(string)
+	if !ok {
+		return
+	}
+	dt, err := time.Parse(GerritRESTDateFormat, sDate)
+	if err != nil {
+		ok = false
+		return
+	}
+	epoch = float64(dt.Unix())
+	return
+}
+
+// GerritRESTAccount - convert gerrit REST API AccountInfo (or GitPersonInfo) to `gerrit query` account object
+func GerritRESTAccount(iAccount interface{}) (account map[string]interface{}, ok bool) {
+	obj, ok := iAccount.(map[string]interface{})
+	if !ok {
+		return
+	}
+	account = make(map[string]interface{})
+	for _, field := range []string{"name", "email", "username"} {
+		val, _ := obj[field].(string)
+		if val != "" {
+			account[field] = val
+		}
+	}
+	ok = len(account) > 0
+	return
+}
+
+// GerritRESTApprovals - return approvals from DETAILED_LABELS labels.*.all, in `gerrit query --all-approvals` format
+// Accounts without vote (value 0 or no value) are reviewers, not voters, they are skipped
+func GerritRESTApprovals(iLabels interface{}) (approvals []interface{}) {
+	labels, _ := iLabels.(map[string]interface{})
+	names := []string{}
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		all, _ := Dig(labels[name], []string{"all"}, false, true)
+		votes, _ := all.([]interface{})
+		for _, iVote := range votes {
+			vote, ok := iVote.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			value, _ := vote["value"].(float64)
+			if value == 0 {
+				continue
+			}
+			by, ok := GerritRESTAccount(vote)
+			if !ok {
+				continue
+			}
+			approval := map[string]interface{}{
+				"type":        name,
+				"description": name,
+				"value":       strconv.Itoa(int(value)),
+				"by":          by,
+			}
+			epoch, ok := GerritRESTEpoch(vote["date"])
+			if ok {
+				approval["grantedOn"] = epoch
+			}
+			approvals = append(approvals, approval)
+		}
+	}
+	return
+}
+
+// GerritRESTMessageApprovals - rebuild approvals per patch set number from change messages like "Patch Set 1: Code-Review+2",
+// DETAILED_LABELS only has current patch set votes, so this is the only source of votes on older patch sets
+// last vote of a given account on a given label wins, like in `gerrit query --all-approvals`
+func GerritRESTMessageApprovals(messages []interface{}) (approvals map[float64][]interface{}) {
+	approvals = make(map[float64][]interface{})
+	votes := make(map[float64]map[string]map[string]interface{})
+	keys := make(map[float64][]string)
+	for _, iMessage := range messages {
+		message, ok := iMessage.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		text, _ := message["message"].(string)
+		match := GerritRESTVoteMessageRegexp.FindStringSubmatch(strings.SplitN(text, "\n", 2)[0])
+		if match == nil {
+			continue
+		}
+		by, ok := GerritRESTAccount(message["author"])
+		if !ok {
+			continue
+		}
+		psNumber, ok := message["_revision_number"].(float64)
+		if !ok {
+			n, _ := strconv.Atoi(match[1])
+			psNumber = float64(n)
+		}
+		// votes are keyed by account ID, accounts without ID (DETAILED_ACCOUNTS not granted) by their details
+		account := fmt.Sprintf("%v", by)
+		id, ok := Dig(message, []string{"author", "_account_id"}, false, true)
+		if ok {
+			account = fmt.Sprintf("%v", id)
+		}
+		if votes[psNumber] == nil {
+			votes[psNumber] = make(map[string]map[string]interface{})
+		}
+		for _, token := range strings.Fields(match[2]) {
+			vote := GerritRESTVoteRegexp.FindStringSubmatch(token)
+			if vote == nil {
+				continue
+			}
+			if vote[3] != "" {
+				delete(votes[psNumber], vote[3]+":"+account)
+				continue
+			}
+			value, _ := strconv.Atoi(vote[2])
+			key := vote[1] + ":" + account
+			if value == 0 {
+				delete(votes[psNumber], key)
+				continue
+			}
+			approval := map[string]interface{}{
+				"type":        vote[1],
+				"description": vote[1],
+				"value":       strconv.Itoa(value),
+				"by":          by,
+			}
+			epoch, ok := GerritRESTEpoch(message["date"])
+			if ok {
+				approval["grantedOn"] = epoch
+			}
+			_, exists := votes[psNumber][key]
+			votes[psNumber][key] = approval
+			if !exists {
+				keys[psNumber] = append(keys[psNumber], key)
+			}
+		}
+	}
+	for psNumber, psKeys := range keys {
+		for _, key := range psKeys {
+			approval, ok := votes[psNumber][key]
+			if ok {
+				approvals[psNumber] = append(approvals[psNumber], approval)
+			}
+		}
+		sort.SliceStable(approvals[psNumber], func(i, j int) bool {
+			return approvals[psNumber][i].(map[string]interface{})["type"].(string) < approvals[psNumber][j].(map[string]interface{})["type"].(string)
+		})
+	}
+	return
+}
+
+// GerritRESTRevisionSize - return revision size from its files, like `gerrit query --patch-sets` does:
+// magic files (/COMMIT_MSG, /MERGE_LIST) are not counted and deletions are negative
+func GerritRESTRevisionSize(iFiles interface{}) (insertions, deletions float64, ok bool) {
+	files, ok := iFiles.(map[string]interface{})
+	if !ok || len(files) == 0 {
+		ok = false
+		return
+	}
+	for fileName, iFile := range files {
+		if GerritMagicFile(fileName) {
+			continue
+		}
+		inserted, _ := Dig(iFile, []string{"lines_inserted"}, false, true)
+		deleted, _ := Dig(iFile, []string{"lines_deleted"}, false, true)
+		fInserted, _ := inserted.(float64)
+		fDeleted, _ := deleted.(float64)
+		insertions += fInserted
+		deletions -= fDeleted
+	}
+	return
+}
+
+// GerritRESTChangeToReview - map gerrit REST API ChangeInfo to the review object returned by `gerrit query --format=JSON`
+// REST API only returns votes on the current patch set (including copied ones), votes on older patch sets are rebuilt from change messages
+func GerritRESTChangeToReview(baseURL string, change map[string]interface{}) (review map[string]interface{}) {
+	review = make(map[string]interface{})
+	for from, to := range map[string]string{"project": "project", "branch": "branch", "change_id": "id", "_number": "number", "subject": "subject", "status": "status", "topic": "topic", "hashtags": "hashtags"} {
+		v, ok := change[from]
+		if ok {
+			review[to] = v
+		}
+	}
+	status, _ := change["status"].(string)
+	review["open"] = status == "NEW"
+	wip, ok := change["work_in_progress"].(bool)
+	if ok && wip {
+		review["wip"] = true
+	}
+	owner, ok := GerritRESTAccount(change["owner"])
+	if ok {
+		review["owner"] = owner
+	}
+	project, _ := change["project"].(string)
+	number, _ := change["_number"].(float64)
+	review["url"] = fmt.Sprintf("%s/c/%s/+/%.0f", baseURL, project, number)
+	for from, to := range map[string]string{"created": "createdOn", "updated": "lastUpdated", "submitted": "submitted"} {
+		epoch, ok := GerritRESTEpoch(change[from])
+		if ok {
+			review[to] = epoch
+		}
+	}
+	iReviewers, ok := Dig(change, []string{"reviewers", "REVIEWER"}, false, true)
+	if ok {
+		reviewers, _ := iReviewers.([]interface{})
+		allReviewers := []interface{}{}
+		for _, iReviewer := range reviewers {
+			reviewer, ok := GerritRESTAccount(iReviewer)
+			if ok {
+				allReviewers = append(allReviewers, reviewer)
+			}
+		}
+		review["allReviewers"] = allReviewers
+	}
+	// Change messages become comments
+	messages, _ := change["messages"].([]interface{})
+	comments := []interface{}{}
+	for _, iMessage := range messages {
+		message, ok := iMessage.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		epoch, ok := GerritRESTEpoch(message["date"])
+		if !ok {
+			continue
+		}
+		text, _ := message["message"].(string)
+		comment := map[string]interface{}{"timestamp": epoch, "message": text}
+		author, ok := GerritRESTAccount(message["author"])
+		if ok {
+			comment["reviewer"] = author
+		}
+		comments = append(comments, comment)
+	}
+	review["comments"] = comments
+	messageApprovals := GerritRESTMessageApprovals(messages)
+	// Revisions map is keyed by commit SHA, gerrit query returns patch sets ordered by number
+	currentRevision, _ := change["current_revision"].(string)
+	revisions, _ := change["revisions"].(map[string]interface{})
+	patchSets := []interface{}{}
+	for sha, iRevision := range revisions {
+		revision, ok := iRevision.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		psNumber, _ := revision["_number"].(float64)
+		patchSet := map[string]interface{}{"number": psNumber, "revision": sha}
+		for _, field := range []string{"ref", "kind"} {
+			v, ok := revision[field]
+			if ok {
+				patchSet[field] = v
+			}
+		}
+		epoch, ok := GerritRESTEpoch(revision["created"])
+		if ok {
+			patchSet["createdOn"] = epoch
+		}
+		uploader, ok := GerritRESTAccount(revision["uploader"])
+		if ok {
+			patchSet["uploader"] = uploader
+		}
+		commit, _ := revision["commit"].(map[string]interface{})
+		if commit != nil {
+			author, ok := GerritRESTAccount(commit["author"])
+			if ok {
+				patchSet["author"] = author
+			}
+			parents := []interface{}{}
+			iParents, _ := commit["parents"].([]interface{})
+			for _, iParent := range iParents {
+				parent, _ := Dig(iParent, []string{"commit"}, false, true)
+				if parent != nil {
+					parents = append(parents, parent)
+				}
+			}
+			patchSet["parents"] = parents
+			if sha == currentRevision {
+				review["commitMessage"], _ = commit["message"]
+			}
+		}
+		insertions, deletions, ok := GerritRESTRevisionSize(revision["files"])
+		if !ok && sha == currentRevision {
+			// no files returned, change size is the current revision size
+			insertions, _ = change["insertions"].(float64)
+			deletions, _ = change["deletions"].(float64)
+			deletions = -deletions
+			ok = true
+		}
+		if ok {
+			patchSet["sizeInsertions"] = insertions
+			patchSet["sizeDeletions"] = deletions
+		}
+		iFiles, _ := revision["files"].(map[string]interface{})
+		if len(iFiles) > 0 {
+			files := []interface{}{}
+			for fileName, iFile := range iFiles {
+				fileInfo, _ := iFile.(map[string]interface{})
+				fileType := "MODIFIED"
+				status, _ := fileInfo["status"].(string)
+				t, ok := GerritRESTFileTypes[status]
+				if ok {
+					fileType = t
+				}
+				inserted, _ := fileInfo["lines_inserted"].(float64)
+				deleted, _ := fileInfo["lines_deleted"].(float64)
+				files = append(files, map[string]interface{}{"file": fileName, "type": fileType, "insertions": inserted, "deletions": -deleted})
+			}
+			sort.Slice(files, func(i, j int) bool {
+				return files[i].(map[string]interface{})["file"].(string) < files[j].(map[string]interface{})["file"].(string)
+			})
+			patchSet["files"] = files
+		}
+		approvals := messageApprovals[psNumber]
+		if sha == currentRevision {
+			approvals = GerritRESTApprovals(change["labels"])
+		}
+		if len(approvals) > 0 {
+			patchSet["approvals"] = approvals
+		}
+		patchSets = append(patchSets, patchSet)
+	}
+	sort.Slice(patchSets, func(i, j int) bool {
+		return patchSets[i].(map[string]interface{})["number"].(float64) < patchSets[j].(map[string]interface{})["number"].(float64)
+	})
+	review["patchSets"] = patchSets
+	return
+}
+
+// GerritRESTAddInlineComments - add inline comments returned by /changes/{id}/comments to review patch sets,
+// as `gerrit query --patch-sets --comments` does, REST comments have additional timestamp field
+func GerritRESTAddInlineComments(review map[string]interface{}, iComments interface{}) {
+	fileComments, ok := iComments.(map[string]interface{})
+	if !ok {
+		return
+	}
+	patchSets, _ := review["patchSets"].([]interface{})
+	byNumber := make(map[int]map[string]interface{})
+	for _, iPatchSet := range patchSets {
+		patchSet, ok := iPatchSet.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		number, _ := patchSet["number"].(float64)
+		byNumber[int(number)] = patchSet
+	}
+	fileNames := []string{}
+	for fileName := range fileComments {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+	for _, fileName := range fileNames {
+		comments, _ := fileComments[fileName].([]interface{})
+		for _, iComment := range comments {
+			comment, ok := iComment.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			number, _ := comment["patch_set"].(float64)
+			patchSet, ok := byNumber[int(number)]
+			if !ok {
+				continue
+			}
+			inline := map[string]interface{}{"file": fileName, "message": comment["message"]}
+			line, ok := comment["line"]
+			if ok {
+				inline["line"] = line
+			}
+			id, ok := comment["id"]
+			if ok {
+				inline["id"] = id
+			}
+			epoch, ok := GerritRESTEpoch(comment["updated"])
+			if ok {
+				inline["timestamp"] = epoch
+			}
+			reviewer, ok := GerritRESTAccount(comment["author"])
+			if ok {
+				inline["reviewer"] = reviewer
+			}
+			psComments, _ := patchSet["comments"].([]interface{})
+			patchSet["comments"] = append(psComments, inline)
+		}
+	}
+}
+
+// GerritRESTAddDependencies - set dependsOn/neededBy of a review from /changes/{id}/revisions/current/related result
+// related changes are ordered from the top of the stack, so the direct parent follows and the direct child precedes the change
+func GerritRESTAddDependencies(review map[string]interface{}, iRelated interface{}) {
+	iChanges, _ := Dig(iRelated, []string{"changes"}, false, true)
+	changes, _ := iChanges.([]interface{})
+	number, _ := review["number"].(float64)
+	dependency := func(iChange interface{}) []interface{} {
+		change, ok := iChange.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		dep := map[string]interface{}{"id": change["change_id"], "number": change["_change_number"]}
+		revision, ok := Dig(change, []string{"commit", "commit"}, false, true)
+		if ok {
+			dep["revision"] = revision
+		}
+		revNumber, _ := change["_revision_number"].(float64)
+		currentRevNumber, _ := change["_current_revision_number"].(float64)
+		dep["isCurrentPatchSet"] = revNumber == currentRevNumber
+		return []interface{}{dep}
+	}
+	for i, iChange := range changes {
+		changeNumber, _ := Dig(iChange, []string{"_change_number"}, false, true)
+		if changeNumber != number {
+			continue
+		}
+		if i+1 < len(changes) {
+			review["dependsOn"] = dependency(changes[i+1])
+		}
+		if i > 0 {
+			review["neededBy"] = dependency(changes[i-1])
+		}
+		return
+	}
+}
@@ -0,0 +1,172 @@
+package dads
+
+import (
+	"reflect"
+	"testing"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+func TestGerritRESTRevisionSize(t *testing.T) {
+	var testCases = []struct {
+		files              interface{}
+		expectedInsertions float64
+		expectedDeletions  float64
+		expectedOK         bool
+	}{
+		{files: nil, expectedOK: false},
+		{files: map[string]interface{}{}, expectedOK: false},
+		{
+			files: map[string]interface{}{
+				"/COMMIT_MSG": map[string]interface{}{"status": "A", "lines_inserted": 10.0},
+				"/MERGE_LIST": map[string]interface{}{"status": "A", "lines_inserted": 4.0},
+				"a.go":        map[string]interface{}{"lines_inserted": 5.0, "lines_deleted": 2.0},
+				"b.go":        map[string]interface{}{"status": "D", "lines_deleted": 7.0},
+			},
+			expectedInsertions: 5.0,
+			expectedDeletions:  -9.0,
+			expectedOK:         true,
+		},
+	}
+	for index, test := range testCases {
+		gotInsertions, gotDeletions, gotOK := GerritRESTRevisionSize(test.files)
+		if gotOK != test.expectedOK || gotInsertions != test.expectedInsertions || gotDeletions != test.expectedDeletions {
+			t.Errorf("test number %d, expected %v/%v/%v, got %v/%v/%v", index+1, test.expectedInsertions, test.expectedDeletions, test.expectedOK, gotInsertions, gotDeletions, gotOK)
+		}
+	}
+}
+
+func TestGerritRESTChangeToReview(t *testing.T) {
+	change := map[string]interface{}{}
+	err := jsoniter.Unmarshal([]byte(`{
+		"project":"sdc","branch":"master","change_id":"Iabc","_number":121462,"subject":"Fix tests","status":"MERGED",
+		"created":"2021-05-20 15:24:38.000000000","updated":"2021-05-20 16:19:57.000000000","insertions":45,"deletions":22,
+		"owner":{"_account_id":1,"name":"Owner","email":"owner@est.tech","username":"owner"},
+		"current_revision":"bbb",
+		"revisions":{
+			"bbb":{"_number":2,"created":"2021-05-20 15:30:00.000000000","kind":"TRIVIAL_REBASE","ref":"refs/changes/62/121462/2","uploader":{"_account_id":1,"name":"Owner"},"commit":{"parents":[{"commit":"ppp"}],"author":{"name":"Owner","email":"owner@est.tech"},"message":"Fix tests\n"}},
+			"aaa":{"_number":1,"created":"2021-05-20 15:24:38.000000000","kind":"REWORK","ref":"refs/changes/62/121462/1","uploader":{"_account_id":1,"name":"Owner"},"files":{"/COMMIT_MSG":{"status":"A","lines_inserted":9},"a.go":{"lines_inserted":40,"lines_deleted":20}}}
+		},
+		"labels":{
+			"Verified":{"all":[{"_account_id":3,"name":"CI","username":"ci","value":1,"date":"2021-05-20 15:31:00.000000000"},{"_account_id":1,"name":"Owner"}]},
+			"Code-Review":{"all":[{"_account_id":2,"name":"Reviewer","username":"rev","value":2,"date":"2021-05-20 15:26:00.000000000"},{"_account_id":1,"name":"Owner","value":0}]}
+		},
+		"messages":[
+			{"date":"2021-05-20 15:24:38.000000000","message":"Uploaded patch set 1.","author":{"_account_id":1,"name":"Owner"}},
+			{"date":"2021-05-20 15:25:00.000000000","message":"Patch Set 1: Code-Review+1","author":{"_account_id":2,"name":"Reviewer","username":"rev"}},
+			{"date":"2021-05-20 15:26:00.000000000","message":"Patch Set 1: Code-Review+2","author":{"_account_id":2,"name":"Reviewer","username":"rev"}},
+			{"date":"2021-05-20 15:27:00.000000000","message":"Change has been successfully merged"}
+		]
+	}`), &change)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	review := GerritRESTChangeToReview("https://gerrit.onap.org/r", change)
+	if review["id"] != "Iabc" || review["number"] != 121462.0 || review["open"] != false || review["lastUpdated"] != 1621527597.0 {
+		t.Errorf("unexpected review fields: %+v", review)
+	}
+	if review["url"] != "https://gerrit.onap.org/r/c/sdc/+/121462" || review["commitMessage"] != "Fix tests\n" {
+		t.Errorf("unexpected url or commit message: %v, %v", review["url"], review["commitMessage"])
+	}
+	comments, _ := review["comments"].([]interface{})
+	if len(comments) != 4 {
+		t.Errorf("expected 4 comments, got %d", len(comments))
+	}
+	patchSets, _ := review["patchSets"].([]interface{})
+	if len(patchSets) != 2 {
+		t.Errorf("expected 2 patch sets, got %d", len(patchSets))
+		return
+	}
+	first, _ := patchSets[0].(map[string]interface{})
+	second, _ := patchSets[1].(map[string]interface{})
+	if first["revision"] != "aaa" || second["revision"] != "bbb" {
+		t.Errorf("unexpected patch sets: %+v", patchSets)
+	}
+	// first patch set size is calculated from its files, current one (without files) has change size
+	if first["sizeInsertions"] != 40.0 || first["sizeDeletions"] != -20.0 || second["sizeInsertions"] != 45.0 || second["sizeDeletions"] != -22.0 {
+		t.Errorf("unexpected patch sets sizes: %+v", patchSets)
+	}
+	expectedApprovals := []interface{}{
+		map[string]interface{}{"type": "Code-Review", "description": "Code-Review", "value": "2", "grantedOn": 1621524360.0, "by": map[string]interface{}{"name": "Reviewer", "username": "rev"}},
+		map[string]interface{}{"type": "Verified", "description": "Verified", "value": "1", "grantedOn": 1621524660.0, "by": map[string]interface{}{"name": "CI", "username": "ci"}},
+	}
+	if !reflect.DeepEqual(second["approvals"], expectedApprovals) {
+		t.Errorf("expected approvals %+v, got %+v", expectedApprovals, second["approvals"])
+	}
+	// first patch set votes are rebuilt from change messages, last vote wins
+	expectedApprovals = []interface{}{
+		map[string]interface{}{"type": "Code-Review", "description": "Code-Review", "value": "2", "grantedOn": 1621524360.0, "by": map[string]interface{}{"name": "Reviewer", "username": "rev"}},
+	}
+	if !reflect.DeepEqual(first["approvals"], expectedApprovals) {
+		t.Errorf("expected first patch set approvals %+v, got %+v", expectedApprovals, first["approvals"])
+	}
+}
+
+func TestGerritRESTMessageApprovals(t *testing.T) {
+	var messages []interface{}
+	err := jsoniter.Unmarshal([]byte(`[
+		{"date":"2021-05-20 15:24:38.000000000","message":"Uploaded patch set 1.","author":{"_account_id":1,"name":"Owner"},"_revision_number":1},
+		{"date":"2021-05-20 15:25:00.000000000","message":"Patch Set 1: Verified+1\n\nBuild Successful","author":{"_account_id":3,"name":"CI"},"_revision_number":1},
+		{"date":"2021-05-20 15:26:00.000000000","message":"Patch Set 1: Code-Review-1\n\n(2 comments)","author":{"_account_id":2,"name":"Reviewer"},"_revision_number":1},
+		{"date":"2021-05-20 15:27:00.000000000","message":"Patch Set 1: Code-Review+2 Workflow+1","author":{"_account_id":4,"name":"Other"},"_revision_number":1},
+		{"date":"2021-05-20 15:28:00.000000000","message":"Patch Set 1: -Code-Review","author":{"_account_id":2,"name":"Reviewer"},"_revision_number":1},
+		{"date":"2021-05-20 15:29:00.000000000","message":"Patch Set 2: Code-Review+1 Looks good","author":{"_account_id":2,"name":"Reviewer"}},
+		{"date":"2021-05-20 15:30:00.000000000","message":"Patch Set 2: Verified+0","author":{"_account_id":3,"name":"CI"}},
+		{"date":"2021-05-20 15:31:00.000000000","message":"Patch Set 3: Code-Review+1"}
+	]`), &messages)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	var testCases = []struct {
+		psNumber float64
+		expected []interface{}
+	}{
+		{
+			psNumber: 1,
+			expected: []interface{}{
+				map[string]interface{}{"type": "Code-Review", "description": "Code-Review", "value": "2", "grantedOn": 1621524420.0, "by": map[string]interface{}{"name": "Other"}},
+				map[string]interface{}{"type": "Verified", "description": "Verified", "value": "1", "grantedOn": 1621524300.0, "by": map[string]interface{}{"name": "CI"}},
+				map[string]interface{}{"type": "Workflow", "description": "Workflow", "value": "1", "grantedOn": 1621524420.0, "by": map[string]interface{}{"name": "Other"}},
+			},
+		},
+		{
+			psNumber: 2,
+			expected: []interface{}{
+				map[string]interface{}{"type": "Code-Review", "description": "Code-Review", "value": "1", "grantedOn": 1621524540.0, "by": map[string]interface{}{"name": "Reviewer"}},
+			},
+		},
+		{
+			psNumber: 3,
+			expected: nil,
+		},
+	}
+	approvals := GerritRESTMessageApprovals(messages)
+	for index, test := range testCases {
+		got := approvals[test.psNumber]
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("test number %d, expected patch set %.0f approvals %+v, got %+v", index+1, test.psNumber, test.expected, got)
+		}
+	}
+}
+
+func TestGerritRESTAddDependencies(t *testing.T) {
+	var related interface{}
+	err := jsoniter.Unmarshal([]byte(`{"changes":[
+		{"change_id":"Ic","_change_number":3,"commit":{"commit":"ccc"},"_revision_number":1,"_current_revision_number":1},
+		{"change_id":"Ib","_change_number":2,"commit":{"commit":"bbb"},"_revision_number":2,"_current_revision_number":2},
+		{"change_id":"Ia","_change_number":1,"commit":{"commit":"aaa"},"_revision_number":1,"_current_revision_number":2}
+	]}`), &related)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	review := map[string]interface{}{"number": 2.0}
+	GerritRESTAddDependencies(review, related)
+	expectedDependsOn := []interface{}{map[string]interface{}{"id": "Ia", "number": 1.0, "revision": "aaa", "isCurrentPatchSet": false}}
+	expectedNeededBy := []interface{}{map[string]interface{}{"id": "Ic", "number": 3.0, "revision": "ccc", "isCurrentPatchSet": true}}
+	if !reflect.DeepEqual(review["dependsOn"], expectedDependsOn) || !reflect.DeepEqual(review["neededBy"], expectedNeededBy) {
+		t.Errorf("expected dependsOn %+v and neededBy %+v, got %+v and %+v", expectedDependsOn, expectedNeededBy, review["dependsOn"], review["neededBy"])
+	}
+}
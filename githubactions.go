@@ -0,0 +1,583 @@
+package dads
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// GitHubActionsResults - maps GitHub Actions conclusion to Jenkins build result, so CI dashboards work for both
+	GitHubActionsResults = map[string]string{
+		"success":   "SUCCESS",
+		"failure":   "FAILURE",
+		"timed_out": "FAILURE",
+		"cancelled": "ABORTED",
+		"skipped":   "NOT_BUILT",
+	}
+	// GitHubActionsBuiltOn - builtOn value for runs (jobs use runner name)
+	GitHubActionsBuiltOn = "github-actions"
+	// GitHubActionsRunsLookback - runs can only be filtered by creation date, so runs created that long before date from are fetched again
+	// to get the final state of runs that were still queued or in progress during the previous sync
+	GitHubActionsRunsLookback = 7 * 24 * time.Hour
+)
+
+// GitHubActionsResult - return Jenkins-like result of a workflow run or job, nil when it is not completed yet
+func GitHubActionsResult(status, conclusion interface{}) interface{} {
+	if status != "completed" {
+		return nil
+	}
+	sConclusion, _ := conclusion.(string)
+	result, ok := GitHubActionsResults[sConclusion]
+	if !ok {
+		result = strings.ToUpper(sConclusion)
+	}
+	return result
+}
+
+// GitHubActionsRunsSince - return creation date workflow runs should be fetched from, nil means all runs
+func GitHubActionsRunsSince(dateFrom *time.Time) *time.Time {
+	if dateFrom == nil {
+		return nil
+	}
+	since := dateFrom.Add(-GitHubActionsRunsLookback)
+	return &since
+}
+
+// GitHubActionsDuration - return duration in milliseconds between from and to dates (0 when any of them is missing)
+func GitHubActionsDuration(from, to interface{}) int {
+	if from == nil || to == nil {
+		return 0
+	}
+	dtFrom, err := TimeParseInterfaceString(from)
+	if err != nil {
+		return 0
+	}
+	dtTo, err := TimeParseInterfaceString(to)
+	if err != nil || dtTo.Before(dtFrom) {
+		return 0
+	}
+	return int(dtTo.Sub(dtFrom) / time.Millisecond)
+}
+
+// GitHubWorkflowJob - return workflow job with only fields that we use
+func GitHubWorkflowJob(restJob map[string]interface{}) (job map[string]interface{}) {
+	job = map[string]interface{}{}
+	for _, field := range []string{"id", "run_id", "run_attempt", "name", "html_url", "status", "conclusion", "started_at", "completed_at", "runner_name", "runner_group_name", "labels"} {
+		job[field], _ = restJob[field]
+	}
+	steps := []interface{}{}
+	iSteps, _ := restJob["steps"].([]interface{})
+	for _, iStep := range iSteps {
+		step, ok := iStep.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		steps = append(
+			steps,
+			map[string]interface{}{
+				"number":       step["number"],
+				"name":         step["name"],
+				"status":       step["status"],
+				"conclusion":   step["conclusion"],
+				"started_at":   step["started_at"],
+				"completed_at": step["completed_at"],
+			},
+		)
+	}
+	job["steps"] = steps
+	return
+}
+
+func (j *DSGitHub) githubWorkflowRuns(ctx *Ctx, org, repo string, since *time.Time) (runsData []map[string]interface{}, err error) {
+	// Runs can only be filtered by creation date, runs are returned from the most recently created
+	apiPath := fmt.Sprintf("repos/%s/%s/actions/runs", org, repo)
+	if since != nil {
+		apiPath += "?created=%3E%3D" + ToYMDTHMSZDate(*since)
+	}
+	err = j.githubGetPages(
+		ctx,
+		fmt.Sprintf("%s/%s workflow runs", org, repo),
+		apiPath,
+		"",
+		func(page interface{}) error {
+			runs, _ := Dig(page, []string{"workflow_runs"}, false, true)
+			ary, _ := runs.([]interface{})
+			for _, iRun := range ary {
+				run, ok := iRun.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				// Repositories objects are huge and the same for all runs, head commit only needs its id
+				delete(run, "repository")
+				delete(run, "head_repository")
+				headCommitID, _ := Dig(run, []string{"head_commit", "id"}, false, true)
+				run["head_commit"] = map[string]interface{}{"id": headCommitID}
+				runsData = append(runsData, run)
+			}
+			return nil
+		},
+	)
+	if ctx.Debug > 2 {
+		Printf("workflow runs got from API: %+v\n", runsData)
+	}
+	return
+}
+
+func (j *DSGitHub) githubWorkflowJobs(ctx *Ctx, org, repo string, runID int64) (jobs []interface{}, err error) {
+	jobs = []interface{}{}
+	err = j.githubGetPages(
+		ctx,
+		fmt.Sprintf("%s/%s/%d workflow jobs", org, repo, runID),
+		fmt.Sprintf("repos/%s/%s/actions/runs/%d/jobs?filter=all", org, repo, runID),
+		"",
+		func(page interface{}) error {
+			iJobs, _ := Dig(page, []string{"jobs"}, false, true)
+			ary, _ := iJobs.([]interface{})
+			for _, iJob := range ary {
+				job, ok := iJob.(map[string]interface{})
+				if ok {
+					jobs = append(jobs, GitHubWorkflowJob(job))
+				}
+			}
+			return nil
+		},
+	)
+	if ctx.Debug > 2 {
+		Printf("workflow jobs got from API: %+v\n", jobs)
+	}
+	return
+}
+
+// ProcessWorkflowRun - add workflow run jobs and actors data
+func (j *DSGitHub) ProcessWorkflowRun(ctx *Ctx, inRun map[string]interface{}) (run map[string]interface{}, err error) {
+	run = inRun
+	run["actor_data"] = map[string]interface{}{}
+	run["triggering_actor_data"] = map[string]interface{}{}
+	for key, dataKey := range map[string]string{"actor": "actor_data", "triggering_actor": "triggering_actor_data"} {
+		err = j.githubGraphQLUserData(ctx, run, key, dataKey)
+		if err != nil {
+			return
+		}
+	}
+	iRunID, ok := run["id"].(float64)
+	if !ok {
+		run["jobs_data"] = []interface{}{}
+		return
+	}
+	run["jobs_data"], err = j.githubWorkflowJobs(ctx, j.Org, j.Repo, int64(iRunID))
+	return
+}
+
+// FetchItemsWorkflowRun - implement raw workflow runs data for GitHub datasource
+func (j *DSGitHub) FetchItemsWorkflowRun(ctx *Ctx) (err error) {
+	runs, err := j.githubWorkflowRuns(ctx, j.Org, j.Repo, GitHubActionsRunsSince(ctx.DateFrom))
+	FatalOnError(err)
+	nRuns := len(runs)
+	Printf("%s/%s: got %d workflow runs\n", j.URL, j.Category, nRuns)
+	items := []interface{}{}
+	for i, run := range runs {
+		var item map[string]interface{}
+		item, err = j.ProcessWorkflowRun(ctx, run)
+		if err != nil {
+			return
+		}
+		esItem := j.AddMetadata(ctx, item)
+		if ctx.Project != "" {
+			item["project"] = ctx.Project
+		}
+		esItem["data"] = item
+		items = append(items, esItem)
+		if i%ItemsPerPage == 0 {
+			Printf("%s/%s: processed %d/%d workflow runs\n", j.URL, j.Category, i, nRuns)
+		}
+		if len(items) >= ctx.ESBulkSize {
+			err = SendToElastic(ctx, j, true, UUID, items)
+			if err != nil {
+				Printf("%s/%s: error %v sending %d workflow runs to ElasticSearch\n", j.URL, j.Category, err, len(items))
+				return
+			}
+			items = []interface{}{}
+		}
+	}
+	if len(items) > 0 {
+		err = SendToElastic(ctx, j, true, UUID, items)
+		if err != nil {
+			Printf("%s/%s: error %v sending %d workflow runs to ES\n", j.URL, j.Category, err, len(items))
+		}
+	}
+	return
+}
+
+// EnrichWorkflowRunItem - return rich item from raw workflow run item
+// Build fields (result, duration, builtOn, build, job_url, job_name, job_build, build_date, branch) have the same meaning as in jenkins.BuildsEnrich
+func (j *DSGitHub) EnrichWorkflowRunItem(ctx *Ctx, item map[string]interface{}, author string, affs bool, extra interface{}) (rich map[string]interface{}, err error) {
+	rich = make(map[string]interface{})
+	run, ok := item["data"].(map[string]interface{})
+	if !ok {
+		err = fmt.Errorf("missing data field in item %+v", DumpKeys(item))
+		return
+	}
+	for _, field := range RawFields {
+		v, _ := item[field]
+		rich[field] = v
+	}
+	if ctx.Project != "" {
+		rich["project"] = ctx.Project
+	}
+	rich["repo_name"] = j.URL
+	rich["repository"] = j.URL
+	rich["id"] = j.ItemID(run)
+	rich["type"] = j.Category
+	rich["category"] = j.Category
+	rich["item_type"] = "workflow run"
+	for _, field := range []string{"workflow_id", "run_attempt", "status", "conclusion", "event", "head_branch", "head_sha", "path"} {
+		rich[field], _ = run[field]
+	}
+	rich["run_id"], _ = run["id"]
+	rich["workflow_name"], _ = run["name"]
+	workflowName, _ := run["name"].(string)
+	runNumber, _ := run["run_number"].(float64)
+	buildDate, ok := run["run_started_at"]
+	if !ok || buildDate == nil {
+		buildDate, _ = run["created_at"]
+	}
+	createdAt, _ := TimeParseInterfaceString(buildDate)
+	rich["fullDisplayName"] = fmt.Sprintf("%s #%d", workflowName, int(runNumber))
+	rich["fullDisplayName_analyzed"] = rich["fullDisplayName"]
+	rich["url"], _ = run["html_url"]
+	rich["result"] = GitHubActionsResult(run["status"], run["conclusion"])
+	duration := 0
+	if run["status"] == "completed" {
+		duration = GitHubActionsDuration(buildDate, run["updated_at"])
+	}
+	rich["duration"] = duration
+	rich["duration_days"] = float64(duration) / (1000.0 * 86400.0)
+	rich["builtOn"] = GitHubActionsBuiltOn
+	rich["build"] = int(runNumber)
+	rich["job_url"] = j.URL + "/actions"
+	workflowPath, _ := run["path"].(string)
+	if workflowPath != "" {
+		rich["job_url"] = j.URL + "/actions/workflows/" + path.Base(workflowPath)
+	}
+	rich["job_name"] = workflowName
+	rich["job_build"] = fmt.Sprintf("%s/%d", workflowName, int(runNumber))
+	rich["build_date"] = createdAt
+	rich["branch"], _ = run["head_branch"]
+	prNumbers := []interface{}{}
+	iPRs, _ := run["pull_requests"].([]interface{})
+	for _, iPR := range iPRs {
+		number, ok := Dig(iPR, []string{"number"}, false, true)
+		if ok {
+			prNumbers = append(prNumbers, number)
+		}
+	}
+	rich["pull_request_numbers"] = prNumbers
+	nJobs, nFailedJobs := 0, 0
+	iJobs, _ := run["jobs_data"].([]interface{})
+	for _, iJob := range iJobs {
+		job, _ := iJob.(map[string]interface{})
+		nJobs++
+		if GitHubActionsResult(job["status"], job["conclusion"]) == "FAILURE" {
+			nFailedJobs++
+		}
+	}
+	rich["n_jobs"] = nJobs
+	rich["n_failed_jobs"] = nFailedJobs
+	githubRepo, _ := j.GetRepoShortURL(j.URL)
+	rich["github_repo"] = githubRepo
+	rich["url_id"] = fmt.Sprintf("%s/actions/runs/%v", githubRepo, run["id"])
+	rich["triggering_actor_login"], _ = Dig(run, []string{"triggering_actor", "login"}, false, true)
+	j.enrichWorkflowActor(run, rich)
+	rich[j.DateField(ctx)] = createdAt
+	if affs {
+		err = j.enrichWorkflowAffs(ctx, run, rich, createdAt)
+		if err != nil {
+			return
+		}
+	}
+	for prop, value := range CommonFields(j, createdAt, j.Category) {
+		rich[prop] = value
+	}
+	return
+}
+
+// enrichWorkflowActor - set run's actor identity fields on a workflow run or job rich item
+func (j *DSGitHub) enrichWorkflowActor(run, rich map[string]interface{}) {
+	rich["actor_login"], _ = Dig(run, []string{"actor", "login"}, false, true)
+	iActorData, ok := run["actor_data"]
+	if ok && iActorData != nil {
+		user, _ := iActorData.(map[string]interface{})
+		rich["author_login"], _ = user["login"]
+		rich["author_name"], _ = user["name"]
+		rich["author_avatar_url"], _ = user["avatar_url"]
+		rich["actor_name"], _ = user["name"]
+		rich["actor_domain"] = nil
+		iEmail, ok := user["email"]
+		if ok {
+			email, _ := iEmail.(string)
+			ary := strings.Split(email, "@")
+			if len(ary) > 1 {
+				rich["actor_domain"] = strings.TrimSpace(ary[1])
+			}
+		}
+		rich["actor_org"], _ = user["company"]
+		rich["actor_location"], _ = user["location"]
+		rich["actor_geolocation"] = nil
+	} else {
+		rich["author_login"] = nil
+		rich["author_name"] = nil
+		rich["author_avatar_url"] = nil
+		rich["actor_name"] = nil
+		rich["actor_domain"] = nil
+		rich["actor_org"] = nil
+		rich["actor_location"] = nil
+		rich["actor_geolocation"] = nil
+	}
+}
+
+// enrichWorkflowAffs - set run's actor affiliations on a workflow run or job rich item
+func (j *DSGitHub) enrichWorkflowAffs(ctx *Ctx, run, rich map[string]interface{}, date time.Time) (err error) {
+	authorKey := "actor_data"
+	var affsItems map[string]interface{}
+	affsItems, err = j.AffsItems(ctx, run, GitHubWorkflowRunRoles, date)
+	if err != nil {
+		return
+	}
+	for prop, value := range affsItems {
+		rich[prop] = value
+	}
+	for _, suff := range AffsFields {
+		rich[Author+suff] = rich[authorKey+suff]
+		rich["actor"+suff] = rich[authorKey+suff]
+	}
+	orgsKey := authorKey + MultiOrgNames
+	_, ok := Dig(rich, []string{orgsKey}, false, true)
+	if !ok {
+		rich[orgsKey] = []interface{}{}
+	}
+	return
+}
+
+// EnrichWorkflowJobs - return rich jobs from raw workflow run
+func (j *DSGitHub) EnrichWorkflowJobs(ctx *Ctx, run, runRich map[string]interface{}, jobs []map[string]interface{}, affs bool) (richItems []interface{}, err error) {
+	// type: category, type(_), item_type( )
+	// copy run: github_repo, repo_name, repository, workflow_id, workflow_name, run_id, event, head_branch, head_sha, build, branch
+	// build: fullDisplayName, url, result, duration, duration_days, builtOn, job_url, job_name, job_build, build_date
+	// identify: id, job_id, url_id
+	// standard: metadata..., origin, project, project_slug, uuid
+	// calc: n_steps, n_failed_steps, failed_step
+	// identity: author_... -> actor_... (run actor)
+	// common: is_github_workflow_run=1, is_github_workflow_run_job=1
+	iID, _ := runRich["id"]
+	id, _ := iID.(string)
+	copyRunFields := []string{"category", "github_repo", "repo_name", "repository", "workflow_id", "workflow_name", "run_id", "run_attempt", "event", "head_branch", "head_sha", "build", "branch"}
+	workflowName, _ := runRich["workflow_name"].(string)
+	for _, job := range jobs {
+		rich := make(map[string]interface{})
+		for _, field := range RawFields {
+			v, _ := runRich[field]
+			rich[field] = v
+		}
+		for _, field := range copyRunFields {
+			rich[field], _ = runRich[field]
+		}
+		if ctx.Project != "" {
+			rich["project"] = ctx.Project
+		}
+		rich["type"] = j.Category + "_job"
+		rich["item_type"] = "workflow job"
+		jobName, _ := job["name"].(string)
+		iJobID, _ := job["id"].(float64)
+		jobID := int64(iJobID)
+		rich["job_id"] = jobID
+		rich["id"] = id + "/job/" + fmt.Sprintf("%d", jobID)
+		rich["url_id"] = fmt.Sprintf("%v/actions/runs/%v/jobs/%d", runRich["github_repo"], runRich["run_id"], jobID)
+		rich["status"], _ = job["status"]
+		rich["conclusion"], _ = job["conclusion"]
+		rich["runner_name"], _ = job["runner_name"]
+		rich["runner_group_name"], _ = job["runner_group_name"]
+		rich["runner_labels"], _ = job["labels"]
+		rich["fullDisplayName"] = fmt.Sprintf("%s / %s #%v", workflowName, jobName, runRich["build"])
+		rich["fullDisplayName_analyzed"] = rich["fullDisplayName"]
+		rich["url"], _ = job["html_url"]
+		rich["result"] = GitHubActionsResult(job["status"], job["conclusion"])
+		duration := GitHubActionsDuration(job["started_at"], job["completed_at"])
+		rich["duration"] = duration
+		rich["duration_days"] = float64(duration) / (1000.0 * 86400.0)
+		rich["builtOn"] = GitHubActionsBuiltOn
+		runnerName, _ := job["runner_name"].(string)
+		if runnerName != "" {
+			rich["builtOn"] = runnerName
+		}
+		rich["job_url"], _ = runRich["url"]
+		rich["job_name"] = workflowName + "/" + jobName
+		rich["job_build"] = fmt.Sprintf("%s/%s/%v", workflowName, jobName, runRich["build"])
+		startedAt, e := TimeParseInterfaceString(job["started_at"])
+		if e != nil {
+			startedAt, _ = runRich["build_date"].(time.Time)
+		}
+		rich["build_date"] = startedAt
+		nSteps, nFailedSteps := 0, 0
+		rich["failed_step"] = nil
+		steps, _ := job["steps"].([]interface{})
+		for _, iStep := range steps {
+			step, _ := iStep.(map[string]interface{})
+			nSteps++
+			if step["conclusion"] == "failure" {
+				nFailedSteps++
+				if rich["failed_step"] == nil {
+					rich["failed_step"], _ = step["name"]
+				}
+			}
+		}
+		rich["n_steps"] = nSteps
+		rich["n_failed_steps"] = nFailedSteps
+		j.enrichWorkflowActor(run, rich)
+		rich[j.DateField(ctx)] = startedAt
+		if affs {
+			err = j.enrichWorkflowAffs(ctx, run, rich, startedAt)
+			if err != nil {
+				return
+			}
+		}
+		for prop, value := range CommonFields(j, startedAt, j.Category) {
+			rich[prop] = value
+		}
+		for prop, value := range CommonFields(j, startedAt, j.Category+"_job") {
+			rich[prop] = value
+		}
+		richItems = append(richItems, rich)
+	}
+	return
+}
+
+// GitHubWorkflowRunEnrichItemsFunc - iterate items and enrich them
+// items is a current pack of input items
+// docs is a pointer to where extracted identities will be stored
+func (j *DSGitHub) GitHubWorkflowRunEnrichItemsFunc(ctx *Ctx, thrN int, items []interface{}, docs *[]interface{}) (err error) {
+	if ctx.Debug > 0 {
+		Printf("%s/%s: github enrich workflow run items %d/%d func\n", j.URL, j.Category, len(items), len(*docs))
+	}
+	var (
+		mtx *sync.RWMutex
+		ch  chan error
+	)
+	if thrN > 1 {
+		mtx = &sync.RWMutex{}
+		ch = make(chan error)
+	}
+	dbConfigured := ctx.AffsDBConfigured()
+	getRichItems := func(doc map[string]interface{}) (richItems []interface{}, e error) {
+		var rich map[string]interface{}
+		rich, e = j.EnrichItem(ctx, doc, "", dbConfigured, nil)
+		if e != nil {
+			return
+		}
+		_, authorIDOK := Dig(rich, []string{"author_id"}, false, true)
+		if authorIDOK || !ctx.CheckAuthorID {
+			richItems = append(richItems, rich)
+		}
+		// workflow run: jobs_data[]
+		run, _ := doc["data"].(map[string]interface{})
+		ary, _ := run["jobs_data"].([]interface{})
+		var jobs []map[string]interface{}
+		for _, iJob := range ary {
+			job, ok := iJob.(map[string]interface{})
+			if ok {
+				jobs = append(jobs, job)
+			}
+		}
+		if len(jobs) == 0 {
+			return
+		}
+		var riches []interface{}
+		riches, e = j.EnrichWorkflowJobs(ctx, run, rich, jobs, dbConfigured)
+		if e != nil {
+			return
+		}
+		for _, rich := range riches {
+			_, authorIDOK := Dig(rich, []string{"author_id"}, false, true)
+			if !authorIDOK && ctx.CheckAuthorID {
+				continue
+			}
+			richItems = append(richItems, rich)
+		}
+		return
+	}
+	nThreads := 0
+	procItem := func(c chan error, idx int) (e error) {
+		if thrN > 1 {
+			mtx.RLock()
+		}
+		item := items[idx]
+		if thrN > 1 {
+			mtx.RUnlock()
+		}
+		defer func() {
+			if c != nil {
+				c <- e
+			}
+		}()
+		src, ok := item.(map[string]interface{})["_source"]
+		if !ok {
+			e = fmt.Errorf("Missing _source in item %+v", DumpKeys(item))
+			return
+		}
+		doc, ok := src.(map[string]interface{})
+		if !ok {
+			e = fmt.Errorf("Failed to parse document %+v", doc)
+			return
+		}
+		richItems, e := getRichItems(doc)
+		if e != nil {
+			return
+		}
+		for _, rich := range richItems {
+			e = EnrichItem(ctx, j, rich.(map[string]interface{}))
+			if e != nil {
+				return
+			}
+		}
+		if thrN > 1 {
+			mtx.Lock()
+		}
+		*docs = append(*docs, richItems...)
+		if thrN > 1 {
+			mtx.Unlock()
+		}
+		return
+	}
+	if thrN > 1 {
+		for i := range items {
+			go func(i int) {
+				_ = procItem(ch, i)
+			}(i)
+			nThreads++
+			if nThreads == thrN {
+				err = <-ch
+				if err != nil {
+					return
+				}
+				nThreads--
+			}
+		}
+		for nThreads > 0 {
+			err = <-ch
+			nThreads--
+			if err != nil {
+				return
+			}
+		}
+		return
+	}
+	for i := range items {
+		err = procItem(nil, i)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,90 @@
+package dads
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGitHubActionsResult(t *testing.T) {
+	var testCases = []struct {
+		status     interface{}
+		conclusion interface{}
+		expected   interface{}
+	}{
+		{status: "in_progress", conclusion: nil, expected: nil},
+		{status: "queued", conclusion: nil, expected: nil},
+		{status: "completed", conclusion: "success", expected: "SUCCESS"},
+		{status: "completed", conclusion: "failure", expected: "FAILURE"},
+		{status: "completed", conclusion: "timed_out", expected: "FAILURE"},
+		{status: "completed", conclusion: "cancelled", expected: "ABORTED"},
+		{status: "completed", conclusion: "action_required", expected: "ACTION_REQUIRED"},
+	}
+	for index, test := range testCases {
+		got := GitHubActionsResult(test.status, test.conclusion)
+		if got != test.expected {
+			t.Errorf("test number %d, expected %v/%v to give %v, got %v", index+1, test.status, test.conclusion, test.expected, got)
+		}
+	}
+}
+
+func TestGitHubActionsRunsSince(t *testing.T) {
+	if GitHubActionsRunsSince(nil) != nil {
+		t.Errorf("expected all runs to be fetched when date from is not set")
+	}
+	dateFrom := time.Date(2021, 6, 10, 12, 0, 0, 0, time.UTC)
+	since := GitHubActionsRunsSince(&dateFrom)
+	if since == nil || !since.Equal(time.Date(2021, 6, 3, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected runs created within lookback window to be fetched again, got %v", since)
+	}
+}
+
+func TestGitHubActionsDuration(t *testing.T) {
+	var testCases = []struct {
+		from     interface{}
+		to       interface{}
+		expected int
+	}{
+		{from: "2021-05-20T10:00:00Z", to: "2021-05-20T10:01:30Z", expected: 90000},
+		{from: "2021-05-20T10:00:00Z", to: nil, expected: 0},
+		{from: nil, to: "2021-05-20T10:00:00Z", expected: 0},
+		{from: "2021-05-20T10:00:00Z", to: "2021-05-20T09:00:00Z", expected: 0},
+	}
+	for index, test := range testCases {
+		got := GitHubActionsDuration(test.from, test.to)
+		if got != test.expected {
+			t.Errorf("test number %d, expected %v-%v to give %d, got %d", index+1, test.from, test.to, test.expected, got)
+		}
+	}
+}
+
+func TestGitHubWorkflowJob(t *testing.T) {
+	restJob := map[string]interface{}{
+		"id":            1.0,
+		"run_id":        2.0,
+		"name":          "build",
+		"status":        "completed",
+		"conclusion":    "failure",
+		"started_at":    "2021-05-20T10:00:00Z",
+		"completed_at":  "2021-05-20T10:05:00Z",
+		"runner_name":   "GitHub Actions 2",
+		"labels":        []interface{}{"ubuntu-latest"},
+		"check_run_url": "https://api.github.com/repos/o/r/check-runs/1",
+		"steps": []interface{}{
+			map[string]interface{}{"number": 1.0, "name": "checkout", "status": "completed", "conclusion": "success", "started_at": "a", "completed_at": "b", "extra": true},
+		},
+	}
+	job := GitHubWorkflowJob(restJob)
+	if _, ok := job["check_run_url"]; ok {
+		t.Errorf("unexpected check_run_url in %+v", job)
+	}
+	if job["runner_name"] != "GitHub Actions 2" || !reflect.DeepEqual(job["labels"], []interface{}{"ubuntu-latest"}) {
+		t.Errorf("unexpected job fields: %+v", job)
+	}
+	expectedSteps := []interface{}{
+		map[string]interface{}{"number": 1.0, "name": "checkout", "status": "completed", "conclusion": "success", "started_at": "a", "completed_at": "b"},
+	}
+	if !reflect.DeepEqual(job["steps"], expectedSteps) {
+		t.Errorf("expected steps %+v, got %+v", expectedSteps, job["steps"])
+	}
+}
@@ -0,0 +1,250 @@
+package dads
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// GitHubAppJWTExpiry - GitHub App JWT lifetime (GitHub allows up to 10 minutes)
+	GitHubAppJWTExpiry = 9 * time.Minute
+	// GitHubAppJWTClockDrift - JWT is issued this much in the past to allow for clock drift
+	GitHubAppJWTClockDrift = time.Minute
+	// GitHubAppTokenRefreshMargin - installation tokens (valid for 1 hour) are refreshed this much before they expire
+	GitHubAppTokenRefreshMargin = 5 * time.Minute
+)
+
+// GitHubAppParseKey - parse GitHub App private key, key is either PEM contents or a path to a PEM file
+func GitHubAppParseKey(key string) (privateKey *rsa.PrivateKey, err error) {
+	data := []byte(key)
+	if !strings.Contains(key, "-----BEGIN") {
+		data, err = ioutil.ReadFile(key)
+		if err != nil {
+			return
+		}
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		err = fmt.Errorf("cannot decode GitHub App private key PEM")
+		return
+	}
+	privateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err == nil {
+		return
+	}
+	parsed, e := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if e != nil {
+		return
+	}
+	var ok bool
+	privateKey, ok = parsed.(*rsa.PrivateKey)
+	if !ok {
+		err = fmt.Errorf("GitHub App private key is not an RSA key")
+		return
+	}
+	err = nil
+	return
+}
+
+// GitHubAppJWTHeader - GitHub App JWT header
+type GitHubAppJWTHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+}
+
+// GitHubAppJWTClaims - GitHub App JWT claims
+type GitHubAppJWTClaims struct {
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+	Issuer    string `json:"iss"`
+}
+
+// GitHubAppJWT - return RS256 signed JWT authenticating as GitHub App appID
+func GitHubAppJWT(appID string, key *rsa.PrivateKey, now time.Time) (token string, err error) {
+	header, err := jsoniter.Marshal(GitHubAppJWTHeader{Alg: "RS256", Typ: "JWT"})
+	if err != nil {
+		return
+	}
+	claims, err := jsoniter.Marshal(
+		GitHubAppJWTClaims{
+			IssuedAt:  now.Add(-GitHubAppJWTClockDrift).Unix(),
+			ExpiresAt: now.Add(GitHubAppJWTExpiry).Unix(),
+			Issuer:    appID,
+		},
+	)
+	if err != nil {
+		return
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	hash := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		return
+	}
+	token = unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)
+	return
+}
+
+// GitHubAppHeaders - return headers used to call GitHub App API endpoints
+func GitHubAppHeaders(appID string, key *rsa.PrivateKey) (headers map[string]string, err error) {
+	jwt, err := GitHubAppJWT(appID, key, time.Now())
+	if err != nil {
+		return
+	}
+	headers = map[string]string{"Authorization": "Bearer " + jwt, "Accept": "application/vnd.github.v3+json"}
+	return
+}
+
+// GitHubAppInstallationID - find installation of GitHub App on a given org (or on a given repo or user account when org is a user account)
+func GitHubAppInstallationID(ctx *Ctx, apiURL, appID string, key *rsa.PrivateKey, org, repo string) (id int64, err error) {
+	headers, err := GitHubAppHeaders(appID, key)
+	if err != nil {
+		return
+	}
+	paths := []string{"orgs/" + org + "/installation", "users/" + org + "/installation"}
+	if repo != "" {
+		paths[1] = "repos/" + org + "/" + repo + "/installation"
+	}
+	var errs []string
+	for _, path := range paths {
+		res, _, _, _, e := Request(
+			ctx,
+			apiURL+path,
+			Get,
+			headers,
+			nil,
+			nil,
+			map[[2]int]struct{}{{200, 200}: {}}, // JSON statuses: 200
+			map[[2]int]struct{}{{400, 599}: {}}, // Error statuses: 400-599
+			nil,                                 // OK statuses
+			nil,                                 // Cache statuses
+			false,                               // retry
+			nil,                                 // cache duration
+			false,                               // skip in dry-run mode
+		)
+		if e != nil {
+			errs = append(errs, e.Error())
+			continue
+		}
+		iID, ok := Dig(res, []string{"id"}, false, true)
+		if ok {
+			fID, _ := iID.(float64)
+			id = int64(fID)
+			return
+		}
+	}
+	err = fmt.Errorf("GitHub App %s is not installed on %s/%s: %s", appID, org, repo, strings.Join(errs, ", "))
+	return
+}
+
+// GitHubAppTokenSource - oauth2 token source minting GitHub App installation tokens
+// Wrap it with oauth2.ReuseTokenSource, so new token is only minted when the current one is about to expire
+type GitHubAppTokenSource struct {
+	Ctx            *Ctx
+	APIURL         string
+	AppID          string
+	Key            *rsa.PrivateKey
+	InstallationID int64
+}
+
+// Token - mint a new installation access token
+func (s *GitHubAppTokenSource) Token() (token *oauth2.Token, err error) {
+	headers, err := GitHubAppHeaders(s.AppID, s.Key)
+	if err != nil {
+		return
+	}
+	res, _, _, _, err := Request(
+		s.Ctx,
+		fmt.Sprintf("%sapp/installations/%d/access_tokens", s.APIURL, s.InstallationID),
+		Post,
+		headers,
+		nil,
+		nil,
+		map[[2]int]struct{}{{200, 201}: {}}, // JSON statuses: 200-201
+		map[[2]int]struct{}{{400, 599}: {}}, // Error statuses: 400-599
+		nil,                                 // OK statuses
+		nil,                                 // Cache statuses
+		true,                                // retry
+		nil,                                 // cache duration
+		false,                               // skip in dry-run mode
+	)
+	if err != nil {
+		return
+	}
+	accessToken, _ := Dig(res, []string{"token"}, false, true)
+	sAccessToken, ok := accessToken.(string)
+	if !ok || sAccessToken == "" {
+		err = fmt.Errorf("cannot get GitHub App %s installation %d token", s.AppID, s.InstallationID)
+		return
+	}
+	AddRedacted(sAccessToken, false)
+	expiresAt, _ := Dig(res, []string{"expires_at"}, false, true)
+	expiry, e := TimeParseInterfaceString(expiresAt)
+	if e != nil {
+		expiry = time.Now().Add(time.Hour)
+	}
+	token = &oauth2.Token{AccessToken: sAccessToken, TokenType: "token", Expiry: expiry.Add(-GitHubAppTokenRefreshMargin)}
+	if s.Ctx.Debug > 0 {
+		Printf("minted GitHub App %s installation %d token valid until %v\n", s.AppID, s.InstallationID, expiry)
+	}
+	return
+}
+
+// githubAppTokenSources - return token sources for all configured GitHub Apps
+// AppIDs, AppKeys and (optional) AppInstallationIDs are "," separated lists of the same length
+// when installation ID is not given it is looked up for the configured org
+func (j *DSGitHub) githubAppTokenSources(ctx *Ctx) (sources []oauth2.TokenSource, err error) {
+	if j.AppIDs == "" {
+		return
+	}
+	appIDs := strings.Split(j.AppIDs, ",")
+	keys := strings.Split(j.AppKeys, ",")
+	if len(keys) != len(appIDs) {
+		err = fmt.Errorf("github app IDs and private keys lists must have the same length, got %d and %d", len(appIDs), len(keys))
+		return
+	}
+	var installationIDs []string
+	if j.AppInstallationIDs != "" {
+		installationIDs = strings.Split(j.AppInstallationIDs, ",")
+		if len(installationIDs) != len(appIDs) {
+			err = fmt.Errorf("github app IDs and installation IDs lists must have the same length, got %d and %d", len(appIDs), len(installationIDs))
+			return
+		}
+	}
+	for i, appID := range appIDs {
+		appID = strings.TrimSpace(appID)
+		var key *rsa.PrivateKey
+		key, err = GitHubAppParseKey(strings.TrimSpace(keys[i]))
+		if err != nil {
+			return
+		}
+		var installationID int64
+		if installationIDs != nil {
+			installationID, err = strconv.ParseInt(strings.TrimSpace(installationIDs[i]), 10, 64)
+		} else {
+			installationID, err = GitHubAppInstallationID(ctx, j.APIURL, appID, key, j.Org, j.Repo)
+		}
+		if err != nil {
+			return
+		}
+		source := &GitHubAppTokenSource{Ctx: ctx, APIURL: j.APIURL, AppID: appID, Key: key, InstallationID: installationID}
+		sources = append(sources, oauth2.ReuseTokenSource(nil, source))
+		if ctx.Debug > 0 {
+			Printf("GitHub App %s installation %d configured\n", appID, installationID)
+		}
+	}
+	return
+}
@@ -0,0 +1,673 @@
+package dads
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// GitHubGraphQLDiscussionsPageSize - how many discussions to fetch in a single GraphQL query (comments have nested replies)
+	GitHubGraphQLDiscussionsPageSize = 10
+)
+
+var (
+	// GitHubGraphQLDiscussionReplyFields - discussion comment reply selection
+	GitHubGraphQLDiscussionReplyFields = "id databaseId body createdAt updatedAt url authorAssociation upvoteCount isAnswer author{" + GitHubGraphQLActorFields + "} reactions{totalCount}"
+	// GitHubGraphQLDiscussionCommentFields - discussion comment selection (including its replies)
+	GitHubGraphQLDiscussionCommentFields = GitHubGraphQLDiscussionReplyFields + " " +
+		GitHubGraphQLConnection("replies", GitHubGraphQLInnerPageSize, GitHubGraphQLDiscussionReplyFields)
+	// GitHubGraphQLDiscussionFields - discussion selection
+	GitHubGraphQLDiscussionFields = "__typename id databaseId number title body createdAt updatedAt closed closedAt locked url authorAssociation upvoteCount author{" + GitHubGraphQLActorFields + "} " +
+		"category{name slug isAnswerable} answerChosenAt answerChosenBy{" + GitHubGraphQLActorFields + "} answer{databaseId} reactions{totalCount} " +
+		GitHubGraphQLConnection("labels", GitHubGraphQLNestedPageSize, "name") + " " +
+		GitHubGraphQLConnection("comments", GitHubGraphQLNestedPageSize/2, GitHubGraphQLDiscussionCommentFields)
+)
+
+// GitHubGraphQLDiscussionComment - return REST-like discussion comment (or reply) from GraphQL discussion comment node
+func GitHubGraphQLDiscussionComment(node map[string]interface{}) (comment map[string]interface{}) {
+	comment = map[string]interface{}{
+		"id":                 node["databaseId"],
+		"node_id":            node["id"],
+		"body":               GitHubGraphQLBody(node["body"], MaxCommentBodyLength),
+		"created_at":         node["createdAt"],
+		"updated_at":         node["updatedAt"],
+		"html_url":           node["url"],
+		"author_association": node["authorAssociation"],
+		"user":               GitHubGraphQLUser(node["author"]),
+		"upvote_count":       node["upvoteCount"],
+		"is_answer":          node["isAnswer"] == true,
+		"reactions":          map[string]interface{}{"total_count": GitHubGraphQLTotalCount(node, "reactions")},
+	}
+	comment["body_analyzed"] = comment["body"]
+	_, ok := node["replies"]
+	if ok {
+		replies := []interface{}{}
+		for _, reply := range GitHubGraphQLNodes(node, "replies") {
+			r := GitHubGraphQLDiscussionComment(reply)
+			r["in_reply_to_id"] = node["databaseId"]
+			replies = append(replies, r)
+		}
+		comment["replies"] = GitHubGraphQLTotalCount(node, "replies")
+		comment["replies_data"] = replies
+	}
+	return
+}
+
+// GitHubGraphQLDiscussion - return REST-like discussion from GraphQL discussion node
+func GitHubGraphQLDiscussion(node map[string]interface{}) (discussion map[string]interface{}) {
+	state := "open"
+	if node["closed"] == true {
+		state = "closed"
+	}
+	labels := []interface{}{}
+	for _, label := range GitHubGraphQLNodes(node, "labels") {
+		labels = append(labels, map[string]interface{}{"name": label["name"]})
+	}
+	comments := []interface{}{}
+	for _, comment := range GitHubGraphQLNodes(node, "comments") {
+		comments = append(comments, GitHubGraphQLDiscussionComment(comment))
+	}
+	answerID, _ := Dig(node, []string{"answer", "databaseId"}, false, true)
+	category, _ := node["category"].(map[string]interface{})
+	discussion = map[string]interface{}{
+		"id":                 node["databaseId"],
+		"node_id":            node["id"],
+		"number":             node["number"],
+		"title":              node["title"],
+		"body":               GitHubGraphQLBody(node["body"], MaxIssueBodyLength),
+		"state":              state,
+		"locked":             node["locked"],
+		"created_at":         node["createdAt"],
+		"updated_at":         node["updatedAt"],
+		"closed_at":          node["closedAt"],
+		"html_url":           node["url"],
+		"author_association": node["authorAssociation"],
+		"user":               GitHubGraphQLUser(node["author"]),
+		"upvote_count":       node["upvoteCount"],
+		"category": map[string]interface{}{
+			"name":          category["name"],
+			"slug":          category["slug"],
+			"is_answerable": category["isAnswerable"],
+		},
+		"answer_id":        answerID,
+		"answer_chosen_at": node["answerChosenAt"],
+		"answer_chosen_by": GitHubGraphQLUser(node["answerChosenBy"]),
+		"labels":           labels,
+		"reactions":        map[string]interface{}{"total_count": GitHubGraphQLTotalCount(node, "reactions")},
+		"comments":         GitHubGraphQLTotalCount(node, "comments"),
+		"comments_data":    comments,
+	}
+	return
+}
+
+// GitHubDiscussionComments - return discussion comments and their replies as a flat list
+func GitHubDiscussionComments(discussion map[string]interface{}) (comments []map[string]interface{}) {
+	iComments, _ := discussion["comments_data"].([]interface{})
+	for _, iComment := range iComments {
+		comment, ok := iComment.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		comments = append(comments, comment)
+		iReplies, _ := comment["replies_data"].([]interface{})
+		for _, iReply := range iReplies {
+			reply, ok := iReply.(map[string]interface{})
+			if ok {
+				comments = append(comments, reply)
+			}
+		}
+	}
+	return
+}
+
+// GitHubDiscussionDates - return first response (comment or reply by somebody other than the author) date
+// and date of the comment chosen as an answer, ok flags are false when there is no such comment
+func GitHubDiscussionDates(discussion map[string]interface{}) (firstResponse time.Time, firstResponseOK bool, answer time.Time, answerOK bool) {
+	iUserLogin, _ := Dig(discussion, []string{"user", "login"}, false, true)
+	userLogin, _ := iUserLogin.(string)
+	dts := []time.Time{}
+	for _, comment := range GitHubDiscussionComments(discussion) {
+		createdAt, err := TimeParseInterfaceString(comment["created_at"])
+		if err != nil {
+			continue
+		}
+		if comment["is_answer"] == true {
+			answer = createdAt
+			answerOK = true
+		}
+		iLogin, _ := Dig(comment, []string{"user", "login"}, false, true)
+		login, _ := iLogin.(string)
+		if login == userLogin {
+			continue
+		}
+		dts = append(dts, createdAt)
+	}
+	if len(dts) > 0 {
+		sort.Slice(dts, func(i, j int) bool {
+			return dts[i].Before(dts[j])
+		})
+		firstResponse = dts[0]
+		firstResponseOK = true
+	}
+	return
+}
+
+// githubGraphQLExpandDiscussion - fetch all pages of discussion's nested connections
+func (j *DSGitHub) githubGraphQLExpandDiscussion(ctx *Ctx, node map[string]interface{}) (err error) {
+	for _, conn := range [][2]string{
+		{"labels", "name"},
+		{"comments", GitHubGraphQLDiscussionCommentFields},
+	} {
+		err = j.githubGraphQLExpand(ctx, node, "Discussion", conn[0], "", conn[1])
+		if err != nil {
+			return
+		}
+	}
+	for _, comment := range GitHubGraphQLNodes(node, "comments") {
+		err = j.githubGraphQLExpand(ctx, comment, "DiscussionComment", "replies", "", GitHubGraphQLDiscussionReplyFields)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// githubGraphQLDiscussions - fetch discussions with comments and replies using GraphQL API (there is no REST API for them)
+func (j *DSGitHub) githubGraphQLDiscussions(ctx *Ctx, org, repo string, since *time.Time) (discussionsData []map[string]interface{}, err error) {
+	err = j.githubGraphQLItems(
+		ctx,
+		org,
+		repo,
+		"discussions",
+		GitHubGraphQLDiscussionFields,
+		GitHubGraphQLDiscussionsPageSize,
+		since,
+		func(node map[string]interface{}) (e error) {
+			e = j.githubGraphQLExpandDiscussion(ctx, node)
+			if e != nil {
+				return
+			}
+			discussionsData = append(discussionsData, GitHubGraphQLDiscussion(node))
+			return
+		},
+	)
+	if ctx.Debug > 2 {
+		Printf("discussions got from GraphQL API: %+v\n", discussionsData)
+	}
+	return
+}
+
+// ProcessDiscussion - add users data to discussion, its comments and replies
+func (j *DSGitHub) ProcessDiscussion(ctx *Ctx, inDiscussion map[string]interface{}) (discussion map[string]interface{}, err error) {
+	discussion = inDiscussion
+	discussion["user_data"] = map[string]interface{}{}
+	discussion["answer_chosen_by_data"] = map[string]interface{}{}
+	for key, dataKey := range map[string]string{"user": "user_data", "answer_chosen_by": "answer_chosen_by_data"} {
+		err = j.githubGraphQLUserData(ctx, discussion, key, dataKey)
+		if err != nil {
+			return
+		}
+	}
+	for _, comment := range GitHubDiscussionComments(discussion) {
+		err = j.githubGraphQLUserData(ctx, comment, "user", "user_data")
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// FetchItemsDiscussion - implement raw discussion data for GitHub datasource
+func (j *DSGitHub) FetchItemsDiscussion(ctx *Ctx) (err error) {
+	discussions, err := j.githubGraphQLDiscussions(ctx, j.Org, j.Repo, ctx.DateFrom)
+	FatalOnError(err)
+	nDiscussions := len(discussions)
+	Printf("%s/%s: got %d discussions\n", j.URL, j.Category, nDiscussions)
+	items := []interface{}{}
+	for i, discussion := range discussions {
+		var item map[string]interface{}
+		item, err = j.ProcessDiscussion(ctx, discussion)
+		if err != nil {
+			return
+		}
+		esItem := j.AddMetadata(ctx, item)
+		if ctx.Project != "" {
+			item["project"] = ctx.Project
+		}
+		esItem["data"] = item
+		items = append(items, esItem)
+		if i%ItemsPerPage == 0 {
+			Printf("%s/%s: processed %d/%d discussions\n", j.URL, j.Category, i, nDiscussions)
+		}
+		if len(items) >= ctx.ESBulkSize {
+			err = SendToElastic(ctx, j, true, UUID, items)
+			if err != nil {
+				Printf("%s/%s: error %v sending %d discussions to ElasticSearch\n", j.URL, j.Category, err, len(items))
+				return
+			}
+			items = []interface{}{}
+		}
+	}
+	if ctx.Debug > 0 {
+		Printf("%d remaining discussions to send to ES\n", len(items))
+	}
+	if len(items) > 0 {
+		err = SendToElastic(ctx, j, true, UUID, items)
+		if err != nil {
+			Printf("%s/%s: error %v sending %d discussions to ES\n", j.URL, j.Category, err, len(items))
+		}
+	}
+	return
+}
+
+// EnrichDiscussionItem - return rich item from raw discussion item
+func (j *DSGitHub) EnrichDiscussionItem(ctx *Ctx, item map[string]interface{}, author string, affs bool, extra interface{}) (rich map[string]interface{}, err error) {
+	rich = make(map[string]interface{})
+	discussion, ok := item["data"].(map[string]interface{})
+	if !ok {
+		err = fmt.Errorf("missing data field in item %+v", DumpKeys(item))
+		return
+	}
+	for _, field := range RawFields {
+		v, _ := item[field]
+		rich[field] = v
+	}
+	if ctx.Project != "" {
+		rich["project"] = ctx.Project
+	}
+	rich["repo_name"] = j.URL
+	rich["repository"] = j.URL
+	rich["id"] = j.ItemID(discussion)
+	rich["discussion_id"], _ = discussion["id"]
+	iCreatedAt, _ := discussion["created_at"]
+	createdAt, _ := TimeParseInterfaceString(iCreatedAt)
+	updatedOn, _ := Dig(item, []string{j.DateField(ctx)}, true, false)
+	rich["type"] = j.Category
+	rich["category"] = j.Category
+	rich["item_type"] = j.Category
+	rich["created_at"] = createdAt
+	rich["updated_at"] = updatedOn
+	rich["closed_at"], _ = discussion["closed_at"]
+	rich["state"], _ = discussion["state"]
+	rich["locked"], _ = discussion["locked"]
+	iNumber, _ := discussion["number"]
+	number := int(iNumber.(float64))
+	rich["id_in_repo"] = number
+	rich["title"], _ = discussion["title"]
+	rich["title_analyzed"], _ = discussion["title"]
+	rich["body"], _ = discussion["body"]
+	rich["body_analyzed"], _ = discussion["body"]
+	rich["url"], _ = discussion["html_url"]
+	rich["author_association"], _ = discussion["author_association"]
+	rich["discussion_category"], _ = Dig(discussion, []string{"category", "name"}, false, true)
+	rich["discussion_category_slug"], _ = Dig(discussion, []string{"category", "slug"}, false, true)
+	isAnswerable, _ := Dig(discussion, []string{"category", "is_answerable"}, false, true)
+	rich["is_answerable"] = 0
+	if isAnswerable == true {
+		rich["is_answerable"] = 1
+	}
+	rich["is_answered"] = 0
+	answerID, ok := discussion["answer_id"]
+	if ok && answerID != nil {
+		rich["is_answered"] = 1
+	}
+	rich["answer_id"] = answerID
+	rich["answer_chosen_at"], _ = discussion["answer_chosen_at"]
+	rich["answer_chosen_by_login"], _ = Dig(discussion, []string{"answer_chosen_by", "login"}, false, true)
+	rich["answer_author_login"] = nil
+	nComments, nReplies := 0, 0
+	for _, comment := range GitHubDiscussionComments(discussion) {
+		_, isReply := comment["in_reply_to_id"]
+		if isReply {
+			nReplies++
+		} else {
+			nComments++
+		}
+		if comment["is_answer"] == true {
+			rich["answer_author_login"], _ = Dig(comment, []string{"user", "login"}, false, true)
+		}
+	}
+	rich["n_comments"] = nComments
+	rich["n_replies"] = nReplies
+	rich["n_total_comments"] = nComments + nReplies
+	rich["n_upvotes"], _ = discussion["upvote_count"]
+	rich["n_reactions"], _ = Dig(discussion, []string{"reactions", "total_count"}, false, true)
+	labels := []interface{}{}
+	iLabels, _ := discussion["labels"].([]interface{})
+	for _, iLabel := range iLabels {
+		label, _ := Dig(iLabel, []string{"name"}, false, true)
+		labels = append(labels, label)
+	}
+	rich["labels"] = labels
+	firstResponse, firstResponseOK, answer, answerOK := GitHubDiscussionDates(discussion)
+	rich["time_to_first_response"] = nil
+	if firstResponseOK {
+		rich["time_to_first_response"] = float64(firstResponse.Sub(createdAt).Seconds()) / 86400.0
+	}
+	rich["time_to_answer"] = nil
+	if answerOK {
+		rich["time_to_answer"] = float64(answer.Sub(createdAt).Seconds()) / 86400.0
+	}
+	githubRepo, repoShortName := j.GetRepoShortURL(j.URL)
+	rich["repo_short_name"] = repoShortName
+	rich["github_repo"] = githubRepo
+	rich["url_id"] = fmt.Sprintf("%s/discussions/%d", githubRepo, number)
+	rich["user_login"], _ = Dig(discussion, []string{"user", "login"}, false, true)
+	iUserData, ok := discussion["user_data"]
+	if ok && iUserData != nil {
+		user, _ := iUserData.(map[string]interface{})
+		rich["author_login"], _ = user["login"]
+		rich["author_name"], _ = user["name"]
+		rich["author_avatar_url"], _ = user["avatar_url"]
+		rich["user_avatar_url"] = rich["author_avatar_url"]
+		rich["user_name"], _ = user["name"]
+		rich["user_domain"] = nil
+		iEmail, ok := user["email"]
+		if ok {
+			email, _ := iEmail.(string)
+			ary := strings.Split(email, "@")
+			if len(ary) > 1 {
+				rich["user_domain"] = strings.TrimSpace(ary[1])
+			}
+		}
+		rich["user_org"], _ = user["company"]
+		rich["user_location"], _ = user["location"]
+		rich["user_geolocation"] = nil
+	} else {
+		rich["author_login"] = nil
+		rich["author_name"] = nil
+		rich["author_avatar_url"] = nil
+		rich["user_avatar_url"] = nil
+		rich["user_name"] = nil
+		rich["user_domain"] = nil
+		rich["user_org"] = nil
+		rich["user_location"] = nil
+		rich["user_geolocation"] = nil
+	}
+	rich[j.DateField(ctx)] = createdAt
+	if affs {
+		authorKey := "user_data"
+		var affsItems map[string]interface{}
+		affsItems, err = j.AffsItems(ctx, discussion, GitHubDiscussionRoles, createdAt)
+		if err != nil {
+			return
+		}
+		for prop, value := range affsItems {
+			rich[prop] = value
+		}
+		for _, suff := range AffsFields {
+			rich[Author+suff] = rich[authorKey+suff]
+		}
+		orgsKey := authorKey + MultiOrgNames
+		_, ok := Dig(rich, []string{orgsKey}, false, true)
+		if !ok {
+			rich[orgsKey] = []interface{}{}
+		}
+	}
+	for prop, value := range CommonFields(j, createdAt, j.Category) {
+		rich[prop] = value
+	}
+	return
+}
+
+// EnrichDiscussionComments - return rich comments, answers and replies from raw discussion
+func (j *DSGitHub) EnrichDiscussionComments(ctx *Ctx, discussion map[string]interface{}, comments []map[string]interface{}, affs bool) (richItems []interface{}, err error) {
+	// type: category, type(_), item_type( ), is_answer
+	// copy discussion: github_repo, repo_name, repository, discussion_category
+	// copy comment: created_at, updated_at, body, body_analyzed, author_association, html_url
+	// identify: id, id_in_repo, discussion_comment_id, url_id
+	// standard: metadata..., origin, project, project_slug, uuid
+	// parent: discussion_id, discussion_number, in_reply_to_id
+	// calc: n_reactions, n_upvotes, time_since_discussion_created
+	// identity: author_... -> commenter_...,
+	// common: is_github_discussion=1, is_github_discussion_comment=1 (or is_github_discussion_reply=1), is_github_discussion_answer=1
+	iID, _ := discussion["id"]
+	id, _ := iID.(string)
+	discussionNumber, _ := discussion["id_in_repo"]
+	iGithubRepo, _ := discussion["github_repo"]
+	githubRepo, _ := iGithubRepo.(string)
+	discussionCreatedAt, _ := discussion["created_at"].(time.Time)
+	copyDiscussionFields := []string{"category", "github_repo", "repo_name", "repository", "repo_short_name", "discussion_category", "discussion_category_slug"}
+	copyCommentFields := []string{"created_at", "updated_at", "body", "body_analyzed", "author_association", "html_url"}
+	for _, comment := range comments {
+		rich := make(map[string]interface{})
+		for _, field := range RawFields {
+			v, _ := discussion[field]
+			rich[field] = v
+		}
+		for _, field := range copyDiscussionFields {
+			rich[field], _ = discussion[field]
+		}
+		for _, field := range copyCommentFields {
+			rich[field], _ = comment[field]
+		}
+		if ctx.Project != "" {
+			rich["project"] = ctx.Project
+		}
+		inReplyTo, isReply := comment["in_reply_to_id"]
+		isAnswer := comment["is_answer"] == true
+		suffix := "comment"
+		if isReply {
+			suffix = "reply"
+		}
+		rich["type"] = j.Category + "_" + suffix
+		rich["item_type"] = j.Category + " " + suffix
+		if isAnswer {
+			rich["item_type"] = j.Category + " answer"
+		}
+		rich["is_answer"] = 0
+		if isAnswer {
+			rich["is_answer"] = 1
+		}
+		rich["in_reply_to_id"] = inReplyTo
+		rich["discussion_created_at"] = discussionCreatedAt
+		rich["discussion_id"], _ = discussion["discussion_id"]
+		rich["discussion_number"] = discussionNumber
+		iCID, _ := comment["id"]
+		cid := int64(iCID.(float64))
+		rich["id_in_repo"] = cid
+		rich["discussion_comment_id"] = cid
+		rich["id"] = id + "/" + suffix + "/" + fmt.Sprintf("%d", cid)
+		rich["url"], _ = comment["html_url"]
+		rich["url_id"] = fmt.Sprintf("%s/discussions/%v/comments/%d", githubRepo, discussionNumber, cid)
+		rich["n_reactions"], _ = Dig(comment, []string{"reactions", "total_count"}, false, true)
+		rich["n_upvotes"], _ = comment["upvote_count"]
+		rich["n_replies"], _ = comment["replies"]
+		rich["commenter_association"], _ = comment["author_association"]
+		rich["commenter_login"], _ = Dig(comment, []string{"user", "login"}, false, true)
+		iCommenterData, ok := comment["user_data"]
+		if ok && iCommenterData != nil {
+			user, _ := iCommenterData.(map[string]interface{})
+			rich["author_login"], _ = user["login"]
+			rich["author_name"], _ = user["name"]
+			rich["author_avatar_url"], _ = user["avatar_url"]
+			rich["commenter_avatar_url"] = rich["author_avatar_url"]
+			rich["commenter_name"], _ = user["name"]
+			rich["commenter_domain"] = nil
+			iEmail, ok := user["email"]
+			if ok {
+				email, _ := iEmail.(string)
+				ary := strings.Split(email, "@")
+				if len(ary) > 1 {
+					rich["commenter_domain"] = strings.TrimSpace(ary[1])
+				}
+			}
+			rich["commenter_org"], _ = user["company"]
+			rich["commenter_location"], _ = user["location"]
+			rich["commenter_geolocation"] = nil
+		} else {
+			rich["author_login"] = nil
+			rich["author_name"] = nil
+			rich["author_avatar_url"] = nil
+			rich["commenter_avatar_url"] = nil
+			rich["commenter_name"] = nil
+			rich["commenter_domain"] = nil
+			rich["commenter_org"] = nil
+			rich["commenter_location"] = nil
+			rich["commenter_geolocation"] = nil
+		}
+		iCreatedAt, _ := comment["created_at"]
+		createdAt, _ := TimeParseInterfaceString(iCreatedAt)
+		rich["time_since_discussion_created"] = float64(createdAt.Sub(discussionCreatedAt).Seconds()) / 86400.0
+		rich[j.DateField(ctx)] = createdAt
+		if affs {
+			authorKey := "user_data"
+			var affsItems map[string]interface{}
+			affsItems, err = j.AffsItems(ctx, comment, GitHubDiscussionCommentRoles, createdAt)
+			if err != nil {
+				return
+			}
+			for prop, value := range affsItems {
+				rich[prop] = value
+			}
+			for _, suff := range AffsFields {
+				rich[Author+suff] = rich[authorKey+suff]
+				rich["commenter"+suff] = rich[authorKey+suff]
+			}
+			orgsKey := authorKey + MultiOrgNames
+			_, ok := Dig(rich, []string{orgsKey}, false, true)
+			if !ok {
+				rich[orgsKey] = []interface{}{}
+			}
+		}
+		for prop, value := range CommonFields(j, createdAt, j.Category) {
+			rich[prop] = value
+		}
+		for prop, value := range CommonFields(j, createdAt, j.Category+"_"+suffix) {
+			rich[prop] = value
+		}
+		if isAnswer {
+			for prop, value := range CommonFields(j, createdAt, j.Category+"_answer") {
+				rich[prop] = value
+			}
+		}
+		richItems = append(richItems, rich)
+	}
+	return
+}
+
+// GitHubDiscussionEnrichItemsFunc - iterate items and enrich them
+// items is a current pack of input items
+// docs is a pointer to where extracted identities will be stored
+func (j *DSGitHub) GitHubDiscussionEnrichItemsFunc(ctx *Ctx, thrN int, items []interface{}, docs *[]interface{}) (err error) {
+	if ctx.Debug > 0 {
+		Printf("%s/%s: github enrich discussion items %d/%d func\n", j.URL, j.Category, len(items), len(*docs))
+	}
+	var (
+		mtx *sync.RWMutex
+		ch  chan error
+	)
+	if thrN > 1 {
+		mtx = &sync.RWMutex{}
+		ch = make(chan error)
+	}
+	dbConfigured := ctx.AffsDBConfigured()
+	getRichItems := func(doc map[string]interface{}) (richItems []interface{}, e error) {
+		var rich map[string]interface{}
+		rich, e = j.EnrichItem(ctx, doc, "", dbConfigured, nil)
+		if e != nil {
+			return
+		}
+		_, authorIDOK := Dig(rich, []string{"author_id"}, false, true)
+		if authorIDOK || !ctx.CheckAuthorID {
+			richItems = append(richItems, rich)
+		}
+		data, _ := Dig(doc, []string{"data"}, true, false)
+		// discussion: comments_data[].user_data
+		// discussion: comments_data[].replies_data[].user_data
+		discussion, _ := data.(map[string]interface{})
+		comments := GitHubDiscussionComments(discussion)
+		if len(comments) == 0 {
+			return
+		}
+		var riches []interface{}
+		riches, e = j.EnrichDiscussionComments(ctx, rich, comments, dbConfigured)
+		if e != nil {
+			return
+		}
+		for _, rich := range riches {
+			_, authorIDOK := Dig(rich, []string{"author_id"}, false, true)
+			if !authorIDOK && ctx.CheckAuthorID {
+				continue
+			}
+			richItems = append(richItems, rich)
+		}
+		return
+	}
+	nThreads := 0
+	procItem := func(c chan error, idx int) (e error) {
+		if thrN > 1 {
+			mtx.RLock()
+		}
+		item := items[idx]
+		if thrN > 1 {
+			mtx.RUnlock()
+		}
+		defer func() {
+			if c != nil {
+				c <- e
+			}
+		}()
+		src, ok := item.(map[string]interface{})["_source"]
+		if !ok {
+			e = fmt.Errorf("Missing _source in item %+v", DumpKeys(item))
+			return
+		}
+		doc, ok := src.(map[string]interface{})
+		if !ok {
+			e = fmt.Errorf("Failed to parse document %+v", doc)
+			return
+		}
+		richItems, e := getRichItems(doc)
+		if e != nil {
+			return
+		}
+		for _, rich := range richItems {
+			e = EnrichItem(ctx, j, rich.(map[string]interface{}))
+			if e != nil {
+				return
+			}
+		}
+		if thrN > 1 {
+			mtx.Lock()
+		}
+		*docs = append(*docs, richItems...)
+		if thrN > 1 {
+			mtx.Unlock()
+		}
+		return
+	}
+	if thrN > 1 {
+		for i := range items {
+			go func(i int) {
+				_ = procItem(ch, i)
+			}(i)
+			nThreads++
+			if nThreads == thrN {
+				err = <-ch
+				if err != nil {
+					return
+				}
+				nThreads--
+			}
+		}
+		for nThreads > 0 {
+			err = <-ch
+			nThreads--
+			if err != nil {
+				return
+			}
+		}
+		return
+	}
+	for i := range items {
+		err = procItem(nil, i)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,67 @@
+package dads
+
+import (
+	"reflect"
+	"testing"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+func TestGitHubGraphQLDiscussion(t *testing.T) {
+	node := map[string]interface{}{}
+	err := jsoniter.Unmarshal([]byte(`{
+		"__typename":"Discussion","id":"D_1","databaseId":501,"number":12,"title":"How to?","body":"Question","closed":false,"locked":false,
+		"createdAt":"2021-05-20T10:00:00Z","updatedAt":"2021-05-22T10:00:00Z","url":"https://github.com/o/r/discussions/12","upvoteCount":3,
+		"author":{"__typename":"User","login":"asker"},"category":{"name":"Q&A","slug":"q-a","isAnswerable":true},
+		"answerChosenAt":"2021-05-21T12:00:00Z","answerChosenBy":{"login":"asker"},"answer":{"databaseId":602},"reactions":{"totalCount":2},
+		"labels":{"totalCount":1,"pageInfo":{"hasNextPage":false},"nodes":[{"name":"question"}]},
+		"comments":{"totalCount":2,"pageInfo":{"hasNextPage":false},"nodes":[
+			{"id":"DC_1","databaseId":601,"body":"More details?","createdAt":"2021-05-20T12:00:00Z","upvoteCount":0,"isAnswer":false,"author":{"login":"helper"},"reactions":{"totalCount":0},
+			"replies":{"totalCount":1,"pageInfo":{"hasNextPage":false},"nodes":[
+				{"id":"DC_3","databaseId":603,"body":"Sure","createdAt":"2021-05-20T13:00:00Z","upvoteCount":0,"isAnswer":false,"author":{"login":"asker"},"reactions":{"totalCount":0}}
+			]}},
+			{"id":"DC_2","databaseId":602,"body":"Do this","createdAt":"2021-05-21T10:00:00Z","upvoteCount":5,"isAnswer":true,"author":{"__typename":"Bot","login":"helpbot"},"reactions":{"totalCount":1},
+			"replies":{"totalCount":0,"pageInfo":{"hasNextPage":false},"nodes":[]}}
+		]}
+	}`), &node)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	discussion := GitHubGraphQLDiscussion(node)
+	if discussion["id"] != 501.0 || discussion["number"] != 12.0 || discussion["state"] != "open" || discussion["answer_id"] != 602.0 || discussion["comments"] != 2.0 {
+		t.Errorf("unexpected discussion fields: %+v", discussion)
+	}
+	expectedCategory := map[string]interface{}{"name": "Q&A", "slug": "q-a", "is_answerable": true}
+	if !reflect.DeepEqual(discussion["category"], expectedCategory) {
+		t.Errorf("expected category %+v, got %+v", expectedCategory, discussion["category"])
+	}
+	comments := GitHubDiscussionComments(discussion)
+	if len(comments) != 3 {
+		t.Errorf("expected 3 comments and replies, got %+v", comments)
+		return
+	}
+	if comments[1]["id"] != 603.0 || comments[1]["in_reply_to_id"] != 601.0 || comments[2]["is_answer"] != true {
+		t.Errorf("unexpected comments: %+v", comments)
+	}
+	if !reflect.DeepEqual(comments[2]["user"], map[string]interface{}{"login": "helpbot[bot]"}) {
+		t.Errorf("unexpected answer author: %+v", comments[2]["user"])
+	}
+	firstResponse, firstResponseOK, answer, answerOK := GitHubDiscussionDates(discussion)
+	if !firstResponseOK || firstResponse.Hour() != 12 || !answerOK || answer.Day() != 21 {
+		t.Errorf("unexpected first response %v/%v or answer %v/%v", firstResponse, firstResponseOK, answer, answerOK)
+	}
+}
+
+func TestGitHubDiscussionDates(t *testing.T) {
+	discussion := map[string]interface{}{
+		"user": map[string]interface{}{"login": "asker"},
+		"comments_data": []interface{}{
+			map[string]interface{}{"created_at": "2021-05-20T12:00:00Z", "user": map[string]interface{}{"login": "asker"}},
+		},
+	}
+	_, firstResponseOK, _, answerOK := GitHubDiscussionDates(discussion)
+	if firstResponseOK || answerOK {
+		t.Errorf("expected no first response and no answer, got %v, %v", firstResponseOK, answerOK)
+	}
+}
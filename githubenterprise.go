@@ -0,0 +1,104 @@
+package dads
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/go-github/v38/github"
+)
+
+const (
+	// GitHubEnterpriseAPIPath - GitHub Enterprise Server REST API path (relative to its web URL)
+	GitHubEnterpriseAPIPath = "api/v3/"
+	// GitHubEnterpriseGraphQLPath - GitHub Enterprise Server GraphQL API path (relative to its web URL)
+	GitHubEnterpriseGraphQLPath = "api/graphql"
+	// GitHubRateLimitDisabled - remaining points reported for a token when GitHub Enterprise Server has rate limiting disabled
+	GitHubRateLimitDisabled = 1 << 30
+)
+
+// GitHubURLs - return normalized REST API, web and GraphQL URL roots (all REST/web roots end with "/")
+// Empty apiURL and webURL mean public github.com, when only one of them is given the other is derived from it
+// GitHub Enterprise Server serves REST API from https://host/api/v3/ and GraphQL from https://host/api/graphql
+func GitHubURLs(apiURL, webURL string) (api, web, graphQL string, err error) {
+	api = strings.TrimSpace(apiURL)
+	web = strings.TrimSpace(webURL)
+	if api != "" && !strings.HasSuffix(api, "/") {
+		api += "/"
+	}
+	if web != "" && !strings.HasSuffix(web, "/") {
+		web += "/"
+	}
+	if (api == "" || api == GitHubAPIURLRoot) && (web == "" || web == GitHubURLRoot) {
+		api, web, graphQL = GitHubAPIURLRoot, GitHubURLRoot, GitHubGraphQLURL
+		return
+	}
+	if api == "" {
+		api = web + GitHubEnterpriseAPIPath
+	}
+	if web == "" {
+		if !strings.HasSuffix(api, "/"+GitHubEnterpriseAPIPath) {
+			err = fmt.Errorf("cannot derive GitHub web URL from API URL %s, please set it explicitly", api)
+			return
+		}
+		web = strings.TrimSuffix(api, GitHubEnterpriseAPIPath)
+	}
+	for _, u := range []string{api, web} {
+		parsed, e := url.Parse(u)
+		if e != nil || parsed.Scheme == "" || parsed.Host == "" {
+			err = fmt.Errorf("invalid GitHub URL: %s", u)
+			return
+		}
+	}
+	if strings.HasSuffix(api, "/"+GitHubEnterpriseAPIPath) {
+		graphQL = strings.TrimSuffix(api, GitHubEnterpriseAPIPath) + GitHubEnterpriseGraphQLPath
+	} else {
+		graphQL = api + "graphql"
+	}
+	return
+}
+
+// IsGitHubEnterprise - is current configuration using GitHub Enterprise Server (and not public github.com)
+func (j *DSGitHub) IsGitHubEnterprise() bool {
+	return j.APIURL != "" && j.APIURL != GitHubAPIURLRoot
+}
+
+// newGitHubClient - create go-github client for a given HTTP client (nil for public access) using configured API URL
+func (j *DSGitHub) newGitHubClient(hc *http.Client) (client *github.Client, err error) {
+	if !j.IsGitHubEnterprise() {
+		client = github.NewClient(hc)
+		return
+	}
+	// Uploads are not used by data sources, but go-github requires an upload URL for enterprise clients
+	client, err = github.NewEnterpriseClient(j.APIURL, j.APIURL, hc)
+	return
+}
+
+// GetRepoShortURL - return "org/repo" and "repo" for a given GitHub web URL of a repository
+func (j *DSGitHub) GetRepoShortURL(origin string) (githubRepo, repoShortName string) {
+	githubRepo = strings.TrimSuffix(origin, ".git")
+	webURL := j.WebURL
+	if webURL == "" {
+		webURL = GitHubURLRoot
+	}
+	githubRepo = strings.TrimPrefix(githubRepo, webURL)
+	arr := strings.Split(githubRepo, "/")
+	if len(arr) > 1 {
+		repoShortName = arr[1]
+	}
+	return
+}
+
+// GitHubRateLimitsDisabled - does given RateLimits() error mean that rate limiting is disabled on the server
+// GitHub Enterprise Server returns 404 "Rate limiting is not enabled." in that case
+func GitHubRateLimitsDisabled(err error) bool {
+	if err == nil {
+		return false
+	}
+	errResp, ok := err.(*github.ErrorResponse)
+	if ok {
+		return (errResp.Response != nil && errResp.Response.StatusCode == http.StatusNotFound) || strings.Contains(errResp.Message, "Rate limiting is not enabled")
+	}
+	return strings.Contains(err.Error(), "Rate limiting is not enabled")
+}
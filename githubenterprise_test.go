@@ -0,0 +1,75 @@
+package dads
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/v38/github"
+)
+
+func TestGitHubURLs(t *testing.T) {
+	var testCases = []struct {
+		apiURL          string
+		webURL          string
+		expectedAPI     string
+		expectedWeb     string
+		expectedGraphQL string
+		expectedErr     bool
+	}{
+		{apiURL: "", webURL: "", expectedAPI: "https://api.github.com/", expectedWeb: "https://github.com/", expectedGraphQL: "https://api.github.com/graphql"},
+		{apiURL: "https://api.github.com", webURL: "https://github.com", expectedAPI: "https://api.github.com/", expectedWeb: "https://github.com/", expectedGraphQL: "https://api.github.com/graphql"},
+		{apiURL: "https://ghe.example.com/api/v3", webURL: "", expectedAPI: "https://ghe.example.com/api/v3/", expectedWeb: "https://ghe.example.com/", expectedGraphQL: "https://ghe.example.com/api/graphql"},
+		{apiURL: "", webURL: "https://ghe.example.com", expectedAPI: "https://ghe.example.com/api/v3/", expectedWeb: "https://ghe.example.com/", expectedGraphQL: "https://ghe.example.com/api/graphql"},
+		{apiURL: "https://ghe-api.example.com/", webURL: "https://ghe.example.com/", expectedAPI: "https://ghe-api.example.com/", expectedWeb: "https://ghe.example.com/", expectedGraphQL: "https://ghe-api.example.com/graphql"},
+		{apiURL: "https://ghe-api.example.com/", webURL: "", expectedErr: true},
+		{apiURL: "", webURL: "ghe.example.com", expectedErr: true},
+	}
+	for index, test := range testCases {
+		api, web, graphQL, err := GitHubURLs(test.apiURL, test.webURL)
+		if test.expectedErr {
+			if err == nil {
+				t.Errorf("test number %d, expected error, got %s, %s, %s", index+1, api, web, graphQL)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test number %d, unexpected error: %v", index+1, err)
+			continue
+		}
+		if api != test.expectedAPI || web != test.expectedWeb || graphQL != test.expectedGraphQL {
+			t.Errorf("test number %d, expected %s, %s, %s, got %s, %s, %s", index+1, test.expectedAPI, test.expectedWeb, test.expectedGraphQL, api, web, graphQL)
+		}
+	}
+}
+
+func TestGitHubGetRepoShortURL(t *testing.T) {
+	var testCases = []struct {
+		webURL            string
+		origin            string
+		expectedRepo      string
+		expectedShortName string
+	}{
+		{webURL: "", origin: "https://github.com/org/repo", expectedRepo: "org/repo", expectedShortName: "repo"},
+		{webURL: "https://github.com/", origin: "https://github.com/org/repo.git", expectedRepo: "org/repo", expectedShortName: "repo"},
+		{webURL: "https://ghe.example.com/", origin: "https://ghe.example.com/org/repo", expectedRepo: "org/repo", expectedShortName: "repo"},
+	}
+	for index, test := range testCases {
+		j := &DSGitHub{WebURL: test.webURL}
+		repo, shortName := j.GetRepoShortURL(test.origin)
+		if repo != test.expectedRepo || shortName != test.expectedShortName {
+			t.Errorf("test number %d, expected %s, %s, got %s, %s", index+1, test.expectedRepo, test.expectedShortName, repo, shortName)
+		}
+	}
+}
+
+func TestGitHubRateLimitsDisabled(t *testing.T) {
+	notFound := &github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusNotFound}, Message: "Rate limiting is not enabled."}
+	forbidden := &github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusForbidden}, Message: "API rate limit exceeded"}
+	if !GitHubRateLimitsDisabled(notFound) {
+		t.Errorf("expected 404 response to mean disabled rate limiting")
+	}
+	if GitHubRateLimitsDisabled(forbidden) || GitHubRateLimitsDisabled(fmt.Errorf("timeout")) || GitHubRateLimitsDisabled(nil) {
+		t.Errorf("expected other errors to not mean disabled rate limiting")
+	}
+}
@@ -0,0 +1,535 @@
+package dads
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GitHubTimelineEvent - timeline event type we ingest
+type GitHubTimelineEvent struct {
+	GraphQLType string // GraphQL timeline item type
+	Selection   string // GraphQL selection specific to this event type
+	PullOnly    bool   // event only happens on pull requests
+	Attention   bool   // event made by somebody other than the issue/PR author counts as an attention
+}
+
+// GitHubTimelineEvents - timeline events (REST API names) that are ingested
+var GitHubTimelineEvents = map[string]GitHubTimelineEvent{
+	"labeled":          {GraphQLType: "LabeledEvent", Selection: "label{name}", Attention: true},
+	"unlabeled":        {GraphQLType: "UnlabeledEvent", Selection: "label{name}", Attention: true},
+	"assigned":         {GraphQLType: "AssignedEvent", Selection: "assignee{... on User{login}}", Attention: true},
+	"unassigned":       {GraphQLType: "UnassignedEvent", Selection: "assignee{... on User{login}}", Attention: true},
+	"closed":           {GraphQLType: "ClosedEvent", Selection: "closer{... on Commit{oid}}", Attention: true},
+	"reopened":         {GraphQLType: "ReopenedEvent", Attention: true},
+	"merged":           {GraphQLType: "MergedEvent", Selection: "commit{oid}", PullOnly: true, Attention: true},
+	"review_requested": {GraphQLType: "ReviewRequestedEvent", Selection: "requestedReviewer{... on User{login}}", PullOnly: true, Attention: true},
+	"ready_for_review": {GraphQLType: "ReadyForReviewEvent", PullOnly: true},
+	"cross-referenced": {GraphQLType: "CrossReferencedEvent", Selection: "source{__typename ... on Issue{number url repository{nameWithOwner}} ... on PullRequest{number url repository{nameWithOwner}}}"},
+	"renamed":          {GraphQLType: "RenamedTitleEvent", Selection: "previousTitle currentTitle", Attention: true},
+}
+
+// GitHubTimelineEventNames - return sorted names of ingested timeline events (pull request only events are skipped for issues)
+func GitHubTimelineEventNames(pull bool) (names []string) {
+	for name, event := range GitHubTimelineEvents {
+		if event.PullOnly && !pull {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// GitHubGraphQLTimelineArgs - return itemTypes argument of issue/pull request timelineItems connection
+// GraphQL item type enum is the type name in upper snake case, for example RenamedTitleEvent -> RENAMED_TITLE_EVENT
+func GitHubGraphQLTimelineArgs(pull bool) string {
+	itemTypes := []string{}
+	for _, name := range GitHubTimelineEventNames(pull) {
+		typ := GitHubTimelineEvents[name].GraphQLType
+		itemType := ""
+		for i, r := range typ {
+			if i > 0 && r >= 'A' && r <= 'Z' {
+				itemType += "_"
+			}
+			itemType += string(r)
+		}
+		itemTypes = append(itemTypes, strings.ToUpper(itemType))
+	}
+	return "itemTypes:[" + strings.Join(itemTypes, ",") + "]"
+}
+
+// GitHubGraphQLTimelineFields - return selection of issue/pull request timeline items union
+func GitHubGraphQLTimelineFields(pull bool) string {
+	fragments := []string{"__typename"}
+	for _, name := range GitHubTimelineEventNames(pull) {
+		event := GitHubTimelineEvents[name]
+		fragments = append(fragments, fmt.Sprintf("... on %s{id createdAt actor{%s} %s}", event.GraphQLType, GitHubGraphQLActorFields, event.Selection))
+	}
+	return strings.Join(fragments, " ")
+}
+
+// GitHubEventSource - return REST-like cross reference source
+func GitHubEventSource(number, htmlURL, fullName interface{}, pull bool) (source map[string]interface{}) {
+	issue := map[string]interface{}{
+		"number":     number,
+		"html_url":   htmlURL,
+		"repository": map[string]interface{}{"full_name": fullName},
+	}
+	if pull {
+		issue["pull_request"] = map[string]interface{}{"html_url": htmlURL}
+	}
+	source = map[string]interface{}{"type": "issue", "issue": issue}
+	return
+}
+
+// GitHubGraphQLEvents - return REST-like timeline events from GraphQL node's timelineItems connection
+func GitHubGraphQLEvents(node map[string]interface{}) (events []interface{}) {
+	events = []interface{}{}
+	for _, item := range GitHubGraphQLNodes(node, "timelineItems") {
+		typ, _ := item["__typename"].(string)
+		name := ""
+		for eventName, event := range GitHubTimelineEvents {
+			if event.GraphQLType == typ {
+				name = eventName
+				break
+			}
+		}
+		if name == "" {
+			continue
+		}
+		event := map[string]interface{}{
+			"node_id":    item["id"],
+			"event":      name,
+			"created_at": item["createdAt"],
+			"actor":      GitHubGraphQLUser(item["actor"]),
+		}
+		switch name {
+		case "labeled", "unlabeled":
+			labelName, _ := Dig(item, []string{"label", "name"}, false, true)
+			event["label"] = map[string]interface{}{"name": labelName}
+		case "assigned", "unassigned":
+			event["assignee"] = GitHubGraphQLUser(item["assignee"])
+		case "closed":
+			event["commit_id"] = GitHubGraphQLOid(item["closer"])
+		case "merged":
+			event["commit_id"] = GitHubGraphQLOid(item["commit"])
+		case "review_requested":
+			event["requested_reviewer"] = GitHubGraphQLUser(item["requestedReviewer"])
+		case "cross-referenced":
+			source, ok := item["source"].(map[string]interface{})
+			if ok {
+				fullName, _ := Dig(source, []string{"repository", "nameWithOwner"}, false, true)
+				event["source"] = GitHubEventSource(source["number"], source["url"], fullName, source["__typename"] == "PullRequest")
+			}
+		case "renamed":
+			event["rename"] = map[string]interface{}{"from": item["previousTitle"], "to": item["currentTitle"]}
+		}
+		events = append(events, event)
+	}
+	return
+}
+
+// GitHubRESTEvent - return timeline event from REST API with only fields that we use
+// (cross-referenced events contain the full source issue there), ok is false for events we don't ingest
+func GitHubRESTEvent(restEvent map[string]interface{}) (event map[string]interface{}, ok bool) {
+	name, _ := restEvent["event"].(string)
+	_, ok = GitHubTimelineEvents[name]
+	if !ok {
+		return
+	}
+	event = map[string]interface{}{}
+	for _, field := range []string{"id", "node_id", "event", "created_at", "actor", "label", "assignee", "commit_id", "requested_reviewer", "rename"} {
+		v, present := restEvent[field]
+		if present {
+			event[field] = v
+		}
+	}
+	for _, field := range []string{"actor", "assignee", "requested_reviewer"} {
+		login, present := Dig(restEvent, []string{field, "login"}, false, true)
+		if present {
+			event[field] = map[string]interface{}{"login": login}
+		}
+	}
+	label, present := Dig(restEvent, []string{"label", "name"}, false, true)
+	if present {
+		event["label"] = map[string]interface{}{"name": label}
+	}
+	issue, present := Dig(restEvent, []string{"source", "issue"}, false, true)
+	if present {
+		number, _ := Dig(issue, []string{"number"}, false, true)
+		htmlURL, _ := Dig(issue, []string{"html_url"}, false, true)
+		fullName, _ := Dig(issue, []string{"repository", "full_name"}, false, true)
+		_, pull := Dig(issue, []string{"pull_request"}, false, true)
+		event["source"] = GitHubEventSource(number, htmlURL, fullName, pull)
+	}
+	return
+}
+
+// GitHubEventID - return timeline event unique identifier
+// cross-referenced events have no id in REST API, they're identified by date and source then
+func GitHubEventID(event map[string]interface{}) string {
+	nodeID, ok := event["node_id"].(string)
+	if ok && nodeID != "" {
+		return nodeID
+	}
+	id, ok := event["id"].(float64)
+	if ok {
+		return fmt.Sprintf("%d", int64(id))
+	}
+	source, _ := Dig(event, []string{"source", "issue", "html_url"}, false, true)
+	return fmt.Sprintf("%v-%v-%v", event["event"], event["created_at"], source)
+}
+
+// GitHubAttentionEventDates - return dates of timeline events made by somebody other than the author or a bot that count as an attention
+func GitHubAttentionEventDates(item map[string]interface{}, userLogin string) (dts []time.Time) {
+	iEvents, ok := item["events_data"]
+	if !ok || iEvents == nil {
+		return
+	}
+	ary, _ := iEvents.([]interface{})
+	for _, iEvent := range ary {
+		event, _ := iEvent.(map[string]interface{})
+		name, _ := event["event"].(string)
+		if !GitHubTimelineEvents[name].Attention {
+			continue
+		}
+		iActorLogin, _ := Dig(event, []string{"actor", "login"}, false, true)
+		actorLogin, _ := iActorLogin.(string)
+		// GitHub Apps (dependabot, CI integrations) are not a human attention
+		if actorLogin == "" || actorLogin == userLogin || strings.HasSuffix(actorLogin, "[bot]") {
+			continue
+		}
+		createdAt, err := TimeParseInterfaceString(event["created_at"])
+		if err == nil {
+			dts = append(dts, createdAt)
+		}
+	}
+	return
+}
+
+// AttentionEventDates - return attention timeline events dates when they are enabled, the same way for REST and GraphQL APIs
+func (j *DSGitHub) AttentionEventDates(item map[string]interface{}, userLogin string) []time.Time {
+	if !j.AttentionEvents {
+		return nil
+	}
+	return GitHubAttentionEventDates(item, userLogin)
+}
+
+func (j *DSGitHub) githubIssueTimeline(ctx *Ctx, org, repo string, number int) (events []interface{}, err error) {
+	events = []interface{}{}
+	err = j.githubGetPages(
+		ctx,
+		fmt.Sprintf("%s/%s/%d issue timeline", org, repo, number),
+		fmt.Sprintf("repos/%s/%s/issues/%d/timeline", org, repo, number),
+		"application/vnd.github.mockingbird-preview+json",
+		func(page interface{}) error {
+			evs, _ := page.([]interface{})
+			for _, ev := range evs {
+				restEvent, _ := ev.(map[string]interface{})
+				event, ok := GitHubRESTEvent(restEvent)
+				if ok {
+					events = append(events, event)
+				}
+			}
+			return nil
+		},
+	)
+	if ctx.Debug > 2 {
+		Printf("issue timeline got from API: %+v\n", events)
+	}
+	return
+}
+
+// ProcessIssueEvents - add issue timeline events (when not already fetched via GraphQL API) with actors data
+func (j *DSGitHub) ProcessIssueEvents(ctx *Ctx, inIssue map[string]interface{}) (issue map[string]interface{}, err error) {
+	issue = inIssue
+	// Event documents only need issue fields and its timeline, GraphQL API also returns comments and reactions
+	delete(issue, "comments_data")
+	delete(issue, "reactions_data")
+	_, ok := issue["events_data"]
+	if !ok {
+		number, ok := Dig(issue, []string{"number"}, false, true)
+		if !ok {
+			issue["events_data"] = []interface{}{}
+			return
+		}
+		issue["events_data"], err = j.githubIssueTimeline(ctx, j.Org, j.Repo, int(number.(float64)))
+		if err != nil {
+			return
+		}
+	}
+	events, _ := issue["events_data"].([]interface{})
+	for _, iEvent := range events {
+		event, ok := iEvent.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		err = j.githubGraphQLUserData(ctx, event, "actor", "actor_data")
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// EnrichIssueEvents - return rich timeline events from raw issue/pull request
+func (j *DSGitHub) EnrichIssueEvents(ctx *Ctx, item map[string]interface{}, affs bool) (richItems []interface{}, err error) {
+	// type: category, type(_), item_type( ), event_type
+	// copy issue: github_repo, repo_name, repository, pull_request
+	// identify: id, event_id, url_id
+	// standard: metadata..., origin, project, project_slug, uuid
+	// parent: issue_id, issue_number, issue_title, issue_state, issue_url, issue_created_at
+	// calc: is_author_event, time_since_issue_created
+	// identity: author_... -> actor_...,
+	// common: is_github_event=1, is_github_event_<event_type>=1
+	issue, ok := item["data"].(map[string]interface{})
+	if !ok {
+		err = fmt.Errorf("missing data field in item %+v", DumpKeys(item))
+		return
+	}
+	iEvents, _ := issue["events_data"].([]interface{})
+	if len(iEvents) == 0 {
+		return
+	}
+	id := j.ItemID(issue)
+	iNumber, _ := issue["number"].(float64)
+	number := int(iNumber)
+	iIssueCreatedAt, _ := issue["created_at"]
+	issueCreatedAt, _ := TimeParseInterfaceString(iIssueCreatedAt)
+	iUserLogin, _ := Dig(issue, []string{"user", "login"}, false, true)
+	userLogin, _ := iUserLogin.(string)
+	_, isPull := issue["pull_request"]
+	if !isPull {
+		_, isPull = issue["head"]
+	}
+	itemType := "issue event"
+	if isPull {
+		itemType = "pull request event"
+	}
+	githubRepo, repoShortName := j.GetRepoShortURL(j.URL)
+	for _, iEvent := range iEvents {
+		event, ok := iEvent.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		rich := make(map[string]interface{})
+		for _, field := range RawFields {
+			v, _ := item[field]
+			rich[field] = v
+		}
+		if ctx.Project != "" {
+			rich["project"] = ctx.Project
+		}
+		eventType, _ := event["event"].(string)
+		eventID := GitHubEventID(event)
+		rich["type"] = j.Category
+		rich["category"] = j.Category
+		rich["item_type"] = itemType
+		rich["pull_request"] = isPull
+		rich["repo_name"] = j.URL
+		rich["repository"] = j.URL
+		rich["github_repo"] = githubRepo
+		rich["repo_short_name"] = repoShortName
+		rich["issue_id"], _ = issue["id"]
+		rich["issue_number"] = number
+		rich["id_in_repo"] = number
+		rich["issue_title"], _ = issue["title"]
+		rich["issue_state"], _ = issue["state"]
+		rich["issue_url"], _ = issue["html_url"]
+		rich["issue_created_at"] = issueCreatedAt
+		rich["id"] = id + "/event/" + eventID
+		rich["event_id"] = eventID
+		rich["event_type"] = eventType
+		rich["url_id"] = fmt.Sprintf("%s/issues/%d/events/%s", githubRepo, number, eventID)
+		createdAt, _ := TimeParseInterfaceString(event["created_at"])
+		rich["created_at"] = createdAt
+		rich["time_since_issue_created"] = float64(createdAt.Sub(issueCreatedAt).Seconds()) / 86400.0
+		rich["label"], _ = Dig(event, []string{"label", "name"}, false, true)
+		rich["assignee_login"], _ = Dig(event, []string{"assignee", "login"}, false, true)
+		rich["requested_reviewer_login"], _ = Dig(event, []string{"requested_reviewer", "login"}, false, true)
+		rich["commit_id"], _ = event["commit_id"]
+		rich["rename_from"], _ = Dig(event, []string{"rename", "from"}, false, true)
+		rich["rename_to"], _ = Dig(event, []string{"rename", "to"}, false, true)
+		rich["cross_reference_source_url"], _ = Dig(event, []string{"source", "issue", "html_url"}, false, true)
+		rich["cross_reference_source_number"], _ = Dig(event, []string{"source", "issue", "number"}, false, true)
+		rich["cross_reference_source_repo"], _ = Dig(event, []string{"source", "issue", "repository", "full_name"}, false, true)
+		rich["cross_reference_source_is_pull_request"] = 0
+		if eventType == "cross-referenced" {
+			_, ok := Dig(event, []string{"source", "issue", "pull_request"}, false, true)
+			if ok {
+				rich["cross_reference_source_is_pull_request"] = 1
+			}
+		}
+		iActorLogin, _ := Dig(event, []string{"actor", "login"}, false, true)
+		actorLogin, _ := iActorLogin.(string)
+		rich["is_author_event"] = 0
+		if actorLogin != "" && actorLogin == userLogin {
+			rich["is_author_event"] = 1
+		}
+		iActorData, ok := event["actor_data"]
+		if ok && iActorData != nil {
+			user, _ := iActorData.(map[string]interface{})
+			rich["author_login"], _ = user["login"]
+			rich["actor_login"], _ = user["login"]
+			rich["author_name"], _ = user["name"]
+			rich["author_avatar_url"], _ = user["avatar_url"]
+			rich["actor_avatar_url"] = rich["author_avatar_url"]
+			rich["actor_name"], _ = user["name"]
+			rich["actor_domain"] = nil
+			iEmail, ok := user["email"]
+			if ok {
+				email, _ := iEmail.(string)
+				ary := strings.Split(email, "@")
+				if len(ary) > 1 {
+					rich["actor_domain"] = strings.TrimSpace(ary[1])
+				}
+			}
+			rich["actor_org"], _ = user["company"]
+			rich["actor_location"], _ = user["location"]
+			rich["actor_geolocation"] = nil
+		} else {
+			rich["author_login"] = nil
+			rich["author_name"] = nil
+			rich["author_avatar_url"] = nil
+			rich["actor_avatar_url"] = nil
+			rich["actor_login"] = iActorLogin
+			rich["actor_name"] = nil
+			rich["actor_domain"] = nil
+			rich["actor_org"] = nil
+			rich["actor_location"] = nil
+			rich["actor_geolocation"] = nil
+		}
+		rich[j.DateField(ctx)] = createdAt
+		if affs {
+			authorKey := "actor_data"
+			var affsItems map[string]interface{}
+			affsItems, err = j.AffsItems(ctx, event, GitHubEventRoles, createdAt)
+			if err != nil {
+				return
+			}
+			for prop, value := range affsItems {
+				rich[prop] = value
+			}
+			for _, suff := range AffsFields {
+				rich[Author+suff] = rich[authorKey+suff]
+				rich["actor"+suff] = rich[authorKey+suff]
+			}
+			orgsKey := authorKey + MultiOrgNames
+			_, ok := Dig(rich, []string{orgsKey}, false, true)
+			if !ok {
+				rich[orgsKey] = []interface{}{}
+			}
+		}
+		for prop, value := range CommonFields(j, createdAt, j.Category) {
+			rich[prop] = value
+		}
+		for prop, value := range CommonFields(j, createdAt, j.Category+"_"+strings.Replace(eventType, "-", "_", -1)) {
+			rich[prop] = value
+		}
+		richItems = append(richItems, rich)
+	}
+	return
+}
+
+// GitHubEventEnrichItemsFunc - iterate items and enrich them
+// items is a current pack of input items
+// docs is a pointer to where extracted identities will be stored
+func (j *DSGitHub) GitHubEventEnrichItemsFunc(ctx *Ctx, thrN int, items []interface{}, docs *[]interface{}) (err error) {
+	if ctx.Debug > 0 {
+		Printf("%s/%s: github enrich event items %d/%d func\n", j.URL, j.Category, len(items), len(*docs))
+	}
+	var (
+		mtx *sync.RWMutex
+		ch  chan error
+	)
+	if thrN > 1 {
+		mtx = &sync.RWMutex{}
+		ch = make(chan error)
+	}
+	dbConfigured := ctx.AffsDBConfigured()
+	nThreads := 0
+	procItem := func(c chan error, idx int) (e error) {
+		if thrN > 1 {
+			mtx.RLock()
+		}
+		item := items[idx]
+		if thrN > 1 {
+			mtx.RUnlock()
+		}
+		defer func() {
+			if c != nil {
+				c <- e
+			}
+		}()
+		src, ok := item.(map[string]interface{})["_source"]
+		if !ok {
+			e = fmt.Errorf("Missing _source in item %+v", DumpKeys(item))
+			return
+		}
+		doc, ok := src.(map[string]interface{})
+		if !ok {
+			e = fmt.Errorf("Failed to parse document %+v", doc)
+			return
+		}
+		var (
+			riches    []interface{}
+			richItems []interface{}
+		)
+		riches, e = j.EnrichIssueEvents(ctx, doc, dbConfigured)
+		if e != nil {
+			return
+		}
+		for _, rich := range riches {
+			_, authorIDOK := Dig(rich, []string{"author_id"}, false, true)
+			if !authorIDOK && ctx.CheckAuthorID {
+				continue
+			}
+			e = EnrichItem(ctx, j, rich.(map[string]interface{}))
+			if e != nil {
+				return
+			}
+			richItems = append(richItems, rich)
+		}
+		if thrN > 1 {
+			mtx.Lock()
+		}
+		*docs = append(*docs, richItems...)
+		if thrN > 1 {
+			mtx.Unlock()
+		}
+		return
+	}
+	if thrN > 1 {
+		for i := range items {
+			go func(i int) {
+				_ = procItem(ch, i)
+			}(i)
+			nThreads++
+			if nThreads == thrN {
+				err = <-ch
+				if err != nil {
+					return
+				}
+				nThreads--
+			}
+		}
+		for nThreads > 0 {
+			err = <-ch
+			nThreads--
+			if err != nil {
+				return
+			}
+		}
+		return
+	}
+	for i := range items {
+		err = procItem(nil, i)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
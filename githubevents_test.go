@@ -0,0 +1,112 @@
+package dads
+
+import (
+	"reflect"
+	"testing"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+func TestGitHubGraphQLTimelineArgs(t *testing.T) {
+	expectedIssue := "itemTypes:[ASSIGNED_EVENT,CLOSED_EVENT,CROSS_REFERENCED_EVENT,LABELED_EVENT,RENAMED_TITLE_EVENT,REOPENED_EVENT,UNASSIGNED_EVENT,UNLABELED_EVENT]"
+	if got := GitHubGraphQLTimelineArgs(false); got != expectedIssue {
+		t.Errorf("expected issue timeline args %s, got %s", expectedIssue, got)
+	}
+	expectedPull := "itemTypes:[ASSIGNED_EVENT,CLOSED_EVENT,CROSS_REFERENCED_EVENT,LABELED_EVENT,MERGED_EVENT,READY_FOR_REVIEW_EVENT,RENAMED_TITLE_EVENT,REOPENED_EVENT,REVIEW_REQUESTED_EVENT,UNASSIGNED_EVENT,UNLABELED_EVENT]"
+	if got := GitHubGraphQLTimelineArgs(true); got != expectedPull {
+		t.Errorf("expected pull request timeline args %s, got %s", expectedPull, got)
+	}
+}
+
+func TestGitHubGraphQLEvents(t *testing.T) {
+	node := map[string]interface{}{}
+	err := jsoniter.Unmarshal([]byte(`{"timelineItems":{"totalCount":4,"pageInfo":{"hasNextPage":false},"nodes":[
+		{"__typename":"LabeledEvent","id":"LE_1","createdAt":"2021-05-20T16:00:00Z","actor":{"__typename":"User","login":"triager"},"label":{"name":"bug"}},
+		{"__typename":"MergedEvent","id":"ME_1","createdAt":"2021-05-21T09:00:00Z","actor":{"__typename":"Bot","login":"merger"},"commit":{"oid":"mmm"}},
+		{"__typename":"CrossReferencedEvent","id":"CR_1","createdAt":"2021-05-21T10:00:00Z","actor":{"login":"other"},"source":{"__typename":"PullRequest","number":9,"url":"https://github.com/o/x/pull/9","repository":{"nameWithOwner":"o/x"}}},
+		{"__typename":"SubscribedEvent","id":"SE_1","createdAt":"2021-05-21T11:00:00Z"}
+	]}}`), &node)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	expected := []interface{}{
+		map[string]interface{}{"node_id": "LE_1", "event": "labeled", "created_at": "2021-05-20T16:00:00Z", "actor": map[string]interface{}{"login": "triager"}, "label": map[string]interface{}{"name": "bug"}},
+		map[string]interface{}{"node_id": "ME_1", "event": "merged", "created_at": "2021-05-21T09:00:00Z", "actor": map[string]interface{}{"login": "merger[bot]"}, "commit_id": "mmm"},
+		map[string]interface{}{"node_id": "CR_1", "event": "cross-referenced", "created_at": "2021-05-21T10:00:00Z", "actor": map[string]interface{}{"login": "other"}, "source": map[string]interface{}{
+			"type": "issue",
+			"issue": map[string]interface{}{
+				"number":       9.0,
+				"html_url":     "https://github.com/o/x/pull/9",
+				"repository":   map[string]interface{}{"full_name": "o/x"},
+				"pull_request": map[string]interface{}{"html_url": "https://github.com/o/x/pull/9"},
+			},
+		}},
+	}
+	got := GitHubGraphQLEvents(node)
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected events %+v, got %+v", expected, got)
+	}
+}
+
+func TestGitHubRESTEvent(t *testing.T) {
+	var testCases = []struct {
+		event      string
+		expected   map[string]interface{}
+		expectedOK bool
+	}{
+		{
+			event:      `{"id":1,"node_id":"SE_1","event":"subscribed","created_at":"2021-05-20T16:00:00Z","actor":{"login":"u","id":5}}`,
+			expectedOK: false,
+		},
+		{
+			event:      `{"id":2,"node_id":"AE_1","event":"assigned","created_at":"2021-05-20T16:00:00Z","actor":{"login":"u","id":5},"assignee":{"login":"a","id":6},"url":"x"}`,
+			expected:   map[string]interface{}{"id": 2.0, "node_id": "AE_1", "event": "assigned", "created_at": "2021-05-20T16:00:00Z", "actor": map[string]interface{}{"login": "u"}, "assignee": map[string]interface{}{"login": "a"}},
+			expectedOK: true,
+		},
+		{
+			event:      `{"event":"cross-referenced","created_at":"2021-05-20T16:00:00Z","actor":{"login":"u"},"source":{"type":"issue","issue":{"number":3,"title":"t","html_url":"https://github.com/o/r/issues/3","repository":{"full_name":"o/r","id":7}}}}`,
+			expected:   map[string]interface{}{"event": "cross-referenced", "created_at": "2021-05-20T16:00:00Z", "actor": map[string]interface{}{"login": "u"}, "source": GitHubEventSource(3.0, "https://github.com/o/r/issues/3", "o/r", false)},
+			expectedOK: true,
+		},
+	}
+	for index, test := range testCases {
+		restEvent := map[string]interface{}{}
+		err := jsoniter.Unmarshal([]byte(test.event), &restEvent)
+		if err != nil {
+			t.Errorf("test number %d, unexpected error: %v", index+1, err)
+			continue
+		}
+		got, gotOK := GitHubRESTEvent(restEvent)
+		if gotOK != test.expectedOK || !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("test number %d, expected %s to give %+v/%v, got %+v/%v", index+1, test.event, test.expected, test.expectedOK, got, gotOK)
+		}
+	}
+}
+
+func TestGitHubAttentionEventDates(t *testing.T) {
+	item := map[string]interface{}{
+		"events_data": []interface{}{
+			map[string]interface{}{"event": "labeled", "created_at": "2021-05-20T16:00:00Z", "actor": map[string]interface{}{"login": "author"}},
+			map[string]interface{}{"event": "cross-referenced", "created_at": "2021-05-20T17:00:00Z", "actor": map[string]interface{}{"login": "other"}},
+			map[string]interface{}{"event": "assigned", "created_at": "2021-05-20T18:00:00Z", "actor": map[string]interface{}{"login": "other"}},
+			map[string]interface{}{"event": "closed", "created_at": "2021-05-20T19:00:00Z", "actor": nil},
+			map[string]interface{}{"event": "labeled", "created_at": "2021-05-20T15:00:00Z", "actor": map[string]interface{}{"login": "dependabot[bot]"}},
+		},
+	}
+	got := GitHubAttentionEventDates(item, "author")
+	if len(got) != 1 || got[0].Hour() != 18 {
+		t.Errorf("expected single attention date at 18:00, got %+v", got)
+	}
+	if got := GitHubAttentionEventDates(map[string]interface{}{}, "author"); len(got) != 0 {
+		t.Errorf("expected no attention dates, got %+v", got)
+	}
+	j := &DSGitHub{}
+	if got := j.AttentionEventDates(item, "author"); len(got) != 0 {
+		t.Errorf("expected attention events to be disabled by default, got %+v", got)
+	}
+	j.AttentionEvents = true
+	if got := j.AttentionEventDates(item, "author"); len(got) != 1 {
+		t.Errorf("expected single attention date when enabled, got %+v", got)
+	}
+}
@@ -0,0 +1,846 @@
+package dads
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// GitHubGraphQLIssuesPageSize - how many issues to fetch in a single GraphQL query
+	GitHubGraphQLIssuesPageSize = 20
+	// GitHubGraphQLPullsPageSize - how many pull requests to fetch in a single GraphQL query (they have more nested connections)
+	GitHubGraphQLPullsPageSize = 10
+	// GitHubGraphQLNestedPageSize - how many nested nodes (comments, reviews, labels, ...) to fetch per page
+	GitHubGraphQLNestedPageSize = 100
+	// GitHubGraphQLInnerPageSize - how many doubly nested nodes (comment reactions, review thread comments) to fetch per page
+	GitHubGraphQLInnerPageSize = 20
+	// GitHubGraphQLMinRemaining - switch token (or wait for reset) when GraphQL points remaining drop below this
+	GitHubGraphQLMinRemaining = 100
+	// GitHubGraphQLMaxRetries - how many times to retry a GraphQL query rejected because of rate limits
+	GitHubGraphQLMaxRetries = 5
+)
+
+var (
+	// GitHubGraphQLReactionContents - maps GraphQL ReactionContent enum to REST API reaction content
+	GitHubGraphQLReactionContents = map[string]string{
+		"THUMBS_UP":   "+1",
+		"THUMBS_DOWN": "-1",
+		"LAUGH":       "laugh",
+		"HOORAY":      "hooray",
+		"CONFUSED":    "confused",
+		"HEART":       "heart",
+		"ROCKET":      "rocket",
+		"EYES":        "eyes",
+	}
+	// GitHubGraphQLRateLimit - rate limit selection added to every query
+	GitHubGraphQLRateLimit = "rateLimit{cost remaining resetAt}"
+	// GitHubGraphQLPageInfo - page info selection of every connection
+	GitHubGraphQLPageInfo = "pageInfo{hasNextPage endCursor}"
+	// GitHubGraphQLActorFields - actor selection
+	GitHubGraphQLActorFields = "__typename login"
+	// GitHubGraphQLReactionFields - reaction selection
+	GitHubGraphQLReactionFields = "databaseId content user{login}"
+	// GitHubGraphQLCommentFields - issue comment selection
+	GitHubGraphQLCommentFields = "id databaseId body createdAt updatedAt url authorAssociation author{" + GitHubGraphQLActorFields + "} " +
+		GitHubGraphQLConnection("reactions", GitHubGraphQLInnerPageSize, GitHubGraphQLReactionFields)
+	// GitHubGraphQLReviewFields - pull request review selection
+	GitHubGraphQLReviewFields = "id databaseId body state submittedAt url authorAssociation author{" + GitHubGraphQLActorFields + "} commit{oid}"
+	// GitHubGraphQLReviewCommentFields - pull request review comment selection
+	GitHubGraphQLReviewCommentFields = "id databaseId body path diffHunk position originalPosition createdAt updatedAt url authorAssociation author{" + GitHubGraphQLActorFields + "} " +
+		"commit{oid} originalCommit{oid} replyTo{databaseId} pullRequestReview{databaseId} " +
+		GitHubGraphQLConnection("reactions", GitHubGraphQLInnerPageSize/2, GitHubGraphQLReactionFields)
+	// GitHubGraphQLReviewThreadFields - pull request review thread selection
+	GitHubGraphQLReviewThreadFields = "id " + GitHubGraphQLConnection("comments", GitHubGraphQLInnerPageSize, GitHubGraphQLReviewCommentFields)
+	// GitHubGraphQLReviewRequestFields - pull request review request selection (teams are skipped like in REST requested reviewers)
+	GitHubGraphQLReviewRequestFields = "requestedReviewer{__typename ... on User{login}}"
+	// GitHubGraphQLIssueBaseFields - issue selection, it is also valid for pull requests fetched as issues
+	GitHubGraphQLIssueBaseFields = "__typename id databaseId number title body state createdAt updatedAt closedAt url authorAssociation author{" + GitHubGraphQLActorFields + "} " +
+		GitHubGraphQLConnection("labels", GitHubGraphQLNestedPageSize, "name") + " " +
+		GitHubGraphQLConnection("assignees", GitHubGraphQLNestedPageSize, "login") + " " +
+		GitHubGraphQLConnection("reactions", GitHubGraphQLNestedPageSize, GitHubGraphQLReactionFields) + " " +
+		GitHubGraphQLConnection("comments", GitHubGraphQLNestedPageSize, GitHubGraphQLCommentFields)
+	// GitHubGraphQLIssueFields - issue selection including its timeline events
+	GitHubGraphQLIssueFields = GitHubGraphQLIssueBaseFields + " " +
+		GitHubGraphQLConnectionWithArgs("timelineItems", GitHubGraphQLTimelineArgs(false), GitHubGraphQLNestedPageSize, GitHubGraphQLTimelineFields(false))
+	// GitHubGraphQLPullAsIssueFields - pull request fetched as an issue selection including its timeline events
+	GitHubGraphQLPullAsIssueFields = GitHubGraphQLIssueBaseFields + " " +
+		GitHubGraphQLConnectionWithArgs("timelineItems", GitHubGraphQLTimelineArgs(true), GitHubGraphQLNestedPageSize, GitHubGraphQLTimelineFields(true))
+	// GitHubGraphQLPullFields - pull request selection
+	GitHubGraphQLPullFields = GitHubGraphQLPullAsIssueFields + " isDraft merged mergedAt mergedBy{" + GitHubGraphQLActorFields + "} additions deletions changedFiles " +
+		"headRefName headRefOid baseRefName baseRefOid baseRepository{forkCount} mergeCommit{oid} " +
+		GitHubGraphQLConnection("reviews", GitHubGraphQLNestedPageSize, GitHubGraphQLReviewFields) + " " +
+		GitHubGraphQLConnection("reviewRequests", GitHubGraphQLNestedPageSize, GitHubGraphQLReviewRequestFields) + " " +
+		GitHubGraphQLConnection("commits", GitHubGraphQLNestedPageSize, "commit{oid}") + " " +
+		GitHubGraphQLConnection("reviewThreads", GitHubGraphQLNestedPageSize/2, GitHubGraphQLReviewThreadFields)
+)
+
+// GitHubGraphQLConnection - return selection of a paginated connection field
+func GitHubGraphQLConnection(field string, first int, selection string) string {
+	return GitHubGraphQLConnectionWithArgs(field, "", first, selection)
+}
+
+// GitHubGraphQLConnectionWithArgs - return selection of a paginated connection field with additional arguments
+func GitHubGraphQLConnectionWithArgs(field, args string, first int, selection string) string {
+	if args != "" {
+		args = "," + args
+	}
+	return fmt.Sprintf("%s(first:%d%s){totalCount %s nodes{%s}}", field, first, args, GitHubGraphQLPageInfo, selection)
+}
+
+// GitHubGraphQLNodes - return nodes of a connection field
+func GitHubGraphQLNodes(node map[string]interface{}, field string) (nodes []map[string]interface{}) {
+	iNodes, _ := Dig(node, []string{field, "nodes"}, false, true)
+	ary, _ := iNodes.([]interface{})
+	for _, iNode := range ary {
+		n, ok := iNode.(map[string]interface{})
+		if ok {
+			nodes = append(nodes, n)
+		}
+	}
+	return
+}
+
+// GitHubGraphQLTotalCount - return total count of a connection field
+func GitHubGraphQLTotalCount(node map[string]interface{}, field string) float64 {
+	iCnt, _ := Dig(node, []string{field, "totalCount"}, false, true)
+	cnt, _ := iCnt.(float64)
+	return cnt
+}
+
+// GitHubGraphQLUser - return REST-like user object from GraphQL actor
+// GraphQL returns bot logins without the "[bot]" suffix that REST API uses
+func GitHubGraphQLUser(iActor interface{}) interface{} {
+	actor, ok := iActor.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	login, _ := actor["login"].(string)
+	if login == "" {
+		return nil
+	}
+	typ, _ := actor["__typename"].(string)
+	if typ == "Bot" && !strings.HasSuffix(login, "[bot]") {
+		login += "[bot]"
+	}
+	return map[string]interface{}{"login": login}
+}
+
+// GitHubGraphQLBody - return body truncated to maxLen
+func GitHubGraphQLBody(iBody interface{}, maxLen int) interface{} {
+	body, ok := iBody.(string)
+	if !ok {
+		return iBody
+	}
+	if len(body) > maxLen {
+		return body[:maxLen]
+	}
+	return body
+}
+
+// GitHubGraphQLOid - return oid from GraphQL commit object or nil
+func GitHubGraphQLOid(iCommit interface{}) interface{} {
+	oid, ok := Dig(iCommit, []string{"oid"}, false, true)
+	if !ok {
+		return nil
+	}
+	return oid
+}
+
+// GitHubGraphQLReactions - return REST-like reactions from GraphQL node's reactions connection
+func GitHubGraphQLReactions(node map[string]interface{}) (reactions []interface{}) {
+	reactions = []interface{}{}
+	for _, reaction := range GitHubGraphQLNodes(node, "reactions") {
+		content, _ := reaction["content"].(string)
+		restContent, ok := GitHubGraphQLReactionContents[content]
+		if !ok {
+			restContent = strings.ToLower(content)
+		}
+		reactions = append(
+			reactions,
+			map[string]interface{}{
+				"id":      reaction["databaseId"],
+				"content": restContent,
+				"user":    GitHubGraphQLUser(reaction["user"]),
+			},
+		)
+	}
+	return
+}
+
+// GitHubGraphQLComment - return REST-like issue comment from GraphQL issue comment
+func GitHubGraphQLComment(repoAPIURL string, node map[string]interface{}) (comment map[string]interface{}) {
+	comment = map[string]interface{}{
+		"id":                 node["databaseId"],
+		"node_id":            node["id"],
+		"body":               GitHubGraphQLBody(node["body"], MaxCommentBodyLength),
+		"created_at":         node["createdAt"],
+		"updated_at":         node["updatedAt"],
+		"html_url":           node["url"],
+		"author_association": node["authorAssociation"],
+		"user":               GitHubGraphQLUser(node["author"]),
+		"reactions":          map[string]interface{}{"total_count": GitHubGraphQLTotalCount(node, "reactions")},
+		"reactions_data":     GitHubGraphQLReactions(node),
+	}
+	comment["body_analyzed"] = comment["body"]
+	id, ok := node["databaseId"].(float64)
+	if ok {
+		comment["url"] = fmt.Sprintf("%s/issues/comments/%d", repoAPIURL, int64(id))
+	}
+	return
+}
+
+// GitHubGraphQLIssue - return REST-like issue from GraphQL issue or pull request node
+// Pull requests are returned as issues with "pull_request" set, just like REST issues API does
+func GitHubGraphQLIssue(repoAPIURL string, node map[string]interface{}) (issue map[string]interface{}) {
+	number, _ := node["number"].(float64)
+	isPull := node["__typename"] == "PullRequest"
+	state, _ := node["state"].(string)
+	state = strings.ToLower(state)
+	if state == "merged" {
+		state = "closed"
+	}
+	labels := []interface{}{}
+	for _, label := range GitHubGraphQLNodes(node, "labels") {
+		labels = append(labels, map[string]interface{}{"name": label["name"]})
+	}
+	var assignee interface{}
+	assignees := []interface{}{}
+	for _, iAssignee := range GitHubGraphQLNodes(node, "assignees") {
+		user := GitHubGraphQLUser(iAssignee)
+		if user == nil {
+			continue
+		}
+		if assignee == nil {
+			assignee = user
+		}
+		assignees = append(assignees, user)
+	}
+	comments := []interface{}{}
+	for _, comment := range GitHubGraphQLNodes(node, "comments") {
+		comments = append(comments, GitHubGraphQLComment(repoAPIURL, comment))
+	}
+	issue = map[string]interface{}{
+		"id":                 node["databaseId"],
+		"node_id":            node["id"],
+		"number":             node["number"],
+		"title":              node["title"],
+		"body":               GitHubGraphQLBody(node["body"], MaxIssueBodyLength),
+		"state":              state,
+		"created_at":         node["createdAt"],
+		"updated_at":         node["updatedAt"],
+		"closed_at":          node["closedAt"],
+		"html_url":           node["url"],
+		"url":                fmt.Sprintf("%s/issues/%d", repoAPIURL, int(number)),
+		"author_association": node["authorAssociation"],
+		"user":               GitHubGraphQLUser(node["author"]),
+		"labels":             labels,
+		"assignee":           assignee,
+		"assignees":          assignees,
+		"comments":           GitHubGraphQLTotalCount(node, "comments"),
+		"reactions":          map[string]interface{}{"total_count": GitHubGraphQLTotalCount(node, "reactions")},
+		"comments_data":      comments,
+		"reactions_data":     GitHubGraphQLReactions(node),
+		"events_data":        GitHubGraphQLEvents(node),
+		"is_pull":            isPull,
+	}
+	issue["body_analyzed"] = issue["body"]
+	if isPull {
+		issue["pull_request"] = map[string]interface{}{
+			"url":      fmt.Sprintf("%s/pulls/%d", repoAPIURL, int(number)),
+			"html_url": node["url"],
+		}
+	}
+	return
+}
+
+// GitHubGraphQLPull - return REST-like pull request from GraphQL pull request node
+func GitHubGraphQLPull(repoAPIURL string, node map[string]interface{}) (pull map[string]interface{}) {
+	number, _ := node["number"].(float64)
+	pullURL := fmt.Sprintf("%s/pulls/%d", repoAPIURL, int(number))
+	issue := GitHubGraphQLIssue(repoAPIURL, node)
+	pull = map[string]interface{}{}
+	for _, field := range []string{"id", "node_id", "number", "title", "body", "body_analyzed", "state", "created_at", "updated_at", "closed_at", "html_url", "author_association", "user", "labels", "assignee", "assignees", "comments", "events_data"} {
+		pull[field] = issue[field]
+	}
+	pull["url"] = pullURL
+	pull["issue_url"] = issue["url"]
+	pull["body"] = GitHubGraphQLBody(node["body"], MaxPullBodyLength)
+	pull["body_analyzed"] = pull["body"]
+	pull["draft"] = node["isDraft"]
+	pull["merged"] = node["merged"]
+	pull["merged_at"] = node["mergedAt"]
+	pull["merged_by"] = GitHubGraphQLUser(node["mergedBy"])
+	pull["merge_commit_sha"] = GitHubGraphQLOid(node["mergeCommit"])
+	pull["additions"] = node["additions"]
+	pull["deletions"] = node["deletions"]
+	pull["changed_files"] = node["changedFiles"]
+	pull["commits"] = GitHubGraphQLTotalCount(node, "commits")
+	pull["head"] = map[string]interface{}{"ref": node["headRefName"], "sha": node["headRefOid"]}
+	forks, _ := Dig(node, []string{"baseRepository", "forkCount"}, false, true)
+	pull["base"] = map[string]interface{}{"ref": node["baseRefName"], "sha": node["baseRefOid"], "repo": map[string]interface{}{"forks_count": forks}}
+	reviews := []interface{}{}
+	for _, rev := range GitHubGraphQLNodes(node, "reviews") {
+		review := map[string]interface{}{
+			"id":                 rev["databaseId"],
+			"node_id":            rev["id"],
+			"body":               GitHubGraphQLBody(rev["body"], MaxReviewBodyLength),
+			"state":              rev["state"],
+			"submitted_at":       rev["submittedAt"],
+			"html_url":           rev["url"],
+			"pull_request_url":   pullURL,
+			"commit_id":          GitHubGraphQLOid(rev["commit"]),
+			"author_association": rev["authorAssociation"],
+			"user":               GitHubGraphQLUser(rev["author"]),
+		}
+		review["body_analyzed"] = review["body"]
+		reviews = append(reviews, review)
+	}
+	pull["reviews_data"] = reviews
+	reviewComments := []interface{}{}
+	for _, thread := range GitHubGraphQLNodes(node, "reviewThreads") {
+		for _, comm := range GitHubGraphQLNodes(thread, "comments") {
+			reviewComment := map[string]interface{}{
+				"id":                     comm["databaseId"],
+				"node_id":                comm["id"],
+				"body":                   GitHubGraphQLBody(comm["body"], MaxReviewCommentBodyLength),
+				"path":                   comm["path"],
+				"diff_hunk":              comm["diffHunk"],
+				"position":               comm["position"],
+				"original_position":      comm["originalPosition"],
+				"commit_id":              GitHubGraphQLOid(comm["commit"]),
+				"original_commit_id":     GitHubGraphQLOid(comm["originalCommit"]),
+				"created_at":             comm["createdAt"],
+				"updated_at":             comm["updatedAt"],
+				"html_url":               comm["url"],
+				"pull_request_url":       pullURL,
+				"author_association":     comm["authorAssociation"],
+				"user":                   GitHubGraphQLUser(comm["author"]),
+				"pull_request_review_id": nil,
+				"reactions":              map[string]interface{}{"total_count": GitHubGraphQLTotalCount(comm, "reactions")},
+				"reactions_data":         GitHubGraphQLReactions(comm),
+			}
+			reviewComment["body_analyzed"] = reviewComment["body"]
+			id, ok := comm["databaseId"].(float64)
+			if ok {
+				reviewComment["url"] = fmt.Sprintf("%s/pulls/comments/%d", repoAPIURL, int64(id))
+			}
+			reviewID, ok := Dig(comm, []string{"pullRequestReview", "databaseId"}, false, true)
+			if ok {
+				reviewComment["pull_request_review_id"] = reviewID
+			}
+			replyToID, ok := Dig(comm, []string{"replyTo", "databaseId"}, false, true)
+			if ok {
+				reviewComment["in_reply_to_id"] = replyToID
+			}
+			reviewComments = append(reviewComments, reviewComment)
+		}
+	}
+	pull["review_comments"] = float64(len(reviewComments))
+	pull["review_comments_data"] = reviewComments
+	requestedReviewers := []interface{}{}
+	for _, request := range GitHubGraphQLNodes(node, "reviewRequests") {
+		user := GitHubGraphQLUser(request["requestedReviewer"])
+		if user != nil {
+			requestedReviewers = append(requestedReviewers, user)
+		}
+	}
+	pull["requested_reviewers"] = requestedReviewers
+	commits := []interface{}{}
+	for _, commit := range GitHubGraphQLNodes(node, "commits") {
+		sha := GitHubGraphQLOid(commit["commit"])
+		if sha != nil {
+			commits = append(commits, sha)
+		}
+	}
+	pull["commits_data"] = commits
+	return
+}
+
+// GitHubGraphQLErrors - check GraphQL response errors, NOT_FOUND errors are not reported (data contains nulls then)
+func GitHubGraphQLErrors(result map[string]interface{}) (rateLimited bool, err error) {
+	iErrors, ok := result["errors"]
+	if !ok || iErrors == nil {
+		return
+	}
+	errs, _ := iErrors.([]interface{})
+	msgs := []string{}
+	for _, iError := range errs {
+		e, _ := iError.(map[string]interface{})
+		typ, _ := e["type"].(string)
+		switch typ {
+		case "NOT_FOUND":
+			continue
+		case "RATE_LIMITED":
+			rateLimited = true
+		}
+		msg, _ := e["message"].(string)
+		msgs = append(msgs, typ+": "+msg)
+	}
+	if len(msgs) > 0 {
+		err = fmt.Errorf("GitHub GraphQL errors: %s", strings.Join(msgs, ", "))
+	}
+	return
+}
+
+// githubGraphQLHint - return index of the OAuth token with the most GraphQL points remaining, wait for reset when all are exhausted
+func (j *DSGitHub) githubGraphQLHint(ctx *Ctx) (hint int) {
+	if j.GitHubRateMtx != nil {
+		j.GitHubRateMtx.Lock()
+		defer j.GitHubRateMtx.Unlock()
+	}
+	now := time.Now()
+	for i := range j.TokenSources {
+		if j.GraphQLRemaining[i] >= 0 && now.After(j.GraphQLResetAt[i]) {
+			// -1 means unknown: token not used yet or its limit was already reset
+			j.GraphQLRemaining[i] = -1
+		}
+	}
+	best := j.GraphQLHint
+	if j.GraphQLRemaining[best] >= 0 && j.GraphQLRemaining[best] < GitHubGraphQLMinRemaining {
+		for i := range j.TokenSources {
+			if j.GraphQLRemaining[i] < 0 {
+				best = i
+				break
+			}
+			if j.GraphQLRemaining[i] > j.GraphQLRemaining[best] {
+				best = i
+			}
+		}
+	}
+	hint = best
+	remaining := j.GraphQLRemaining[hint]
+	if remaining >= 0 && remaining < GitHubGraphQLMinRemaining {
+		resetAt := j.GraphQLResetAt[hint]
+		for i := range j.TokenSources {
+			if j.GraphQLResetAt[i].Before(resetAt) {
+				hint = i
+				resetAt = j.GraphQLResetAt[i]
+			}
+		}
+		waitFor := resetAt.Sub(now) + time.Second
+		Printf("All GitHub GraphQL tokens have less than %d points remaining, waiting %v for token #%d reset\n", GitHubGraphQLMinRemaining, waitFor, hint)
+		time.Sleep(waitFor)
+		j.GraphQLRemaining[hint] = -1
+	}
+	j.GraphQLHint = hint
+	return
+}
+
+// githubGraphQLUpdateRate - store GraphQL rate limit state of a given token
+func (j *DSGitHub) githubGraphQLUpdateRate(ctx *Ctx, hint int, data map[string]interface{}, rateLimited bool) {
+	if j.GitHubRateMtx != nil {
+		j.GitHubRateMtx.Lock()
+		defer j.GitHubRateMtx.Unlock()
+	}
+	iRemaining, ok := Dig(data, []string{"rateLimit", "remaining"}, false, true)
+	if ok {
+		remaining, _ := iRemaining.(float64)
+		j.GraphQLRemaining[hint] = int(remaining)
+	}
+	iResetAt, ok := Dig(data, []string{"rateLimit", "resetAt"}, false, true)
+	if ok {
+		resetAt, err := TimeParseInterfaceString(iResetAt)
+		if err == nil {
+			j.GraphQLResetAt[hint] = resetAt
+		}
+	}
+	if rateLimited {
+		j.GraphQLRemaining[hint] = 0
+		if !j.GraphQLResetAt[hint].After(time.Now()) {
+			j.GraphQLResetAt[hint] = time.Now().Add(time.Minute)
+		}
+	}
+	if ctx.Debug > 1 {
+		Printf("GitHub GraphQL token #%d: %d points remaining, reset at %v\n", hint, j.GraphQLRemaining[hint], j.GraphQLResetAt[hint])
+	}
+}
+
+// githubGraphQLQuery - execute GitHub GraphQL query and return its data
+func (j *DSGitHub) githubGraphQLQuery(ctx *Ctx, query string, variables map[string]interface{}) (data map[string]interface{}, err error) {
+	var payload []byte
+	payload, err = jsoniter.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	if err != nil {
+		return
+	}
+	for try := 0; ; try++ {
+		hint := j.githubGraphQLHint(ctx)
+		var token *oauth2.Token
+		token, err = j.TokenSources[hint].Token()
+		if err != nil {
+			return
+		}
+		headers := map[string]string{"Authorization": "bearer " + token.AccessToken, ContentType: "application/json"}
+		var res interface{}
+		res, _, _, _, err = Request(
+			ctx,
+			j.GraphQLURL,
+			Post,
+			headers,
+			payload,
+			nil,
+			map[[2]int]struct{}{{200, 200}: {}}, // JSON statuses: 200
+			map[[2]int]struct{}{{400, 599}: {}}, // Error statuses: 400-599
+			nil,                                 // OK statuses
+			nil,                                 // Cache statuses
+			true,                                // retry
+			nil,                                 // cache duration
+			false,                               // skip in dry-run mode
+		)
+		if err != nil {
+			return
+		}
+		result, ok := res.(map[string]interface{})
+		if !ok {
+			err = fmt.Errorf("cannot read GitHub GraphQL response: %+v", res)
+			return
+		}
+		data, _ = result["data"].(map[string]interface{})
+		rateLimited, e := GitHubGraphQLErrors(result)
+		j.githubGraphQLUpdateRate(ctx, hint, data, rateLimited)
+		if rateLimited && try < GitHubGraphQLMaxRetries {
+			Printf("GitHub GraphQL rate limit reached on token #%d, switching token\n", hint)
+			continue
+		}
+		if e != nil {
+			err = e
+			data = nil
+		}
+		return
+	}
+}
+
+// githubGraphQLExpand - fetch remaining pages of node's connection field and append them to the connection nodes
+func (j *DSGitHub) githubGraphQLExpand(ctx *Ctx, node map[string]interface{}, nodeType, field, args, selection string) (err error) {
+	conn, ok := node[field].(map[string]interface{})
+	if !ok {
+		return
+	}
+	if args != "" {
+		args = "," + args
+	}
+	query := fmt.Sprintf(
+		"query($id:ID!,$after:String){%s node(id:$id){... on %s{%s(first:%d,after:$after%s){%s nodes{%s}}}}}",
+		GitHubGraphQLRateLimit,
+		nodeType,
+		field,
+		GitHubGraphQLNestedPageSize,
+		args,
+		GitHubGraphQLPageInfo,
+		selection,
+	)
+	for {
+		hasNext, _ := Dig(conn, []string{"pageInfo", "hasNextPage"}, false, true)
+		if hasNext != true {
+			return
+		}
+		cursor, _ := Dig(conn, []string{"pageInfo", "endCursor"}, false, true)
+		var data map[string]interface{}
+		data, err = j.githubGraphQLQuery(ctx, query, map[string]interface{}{"id": node["id"], "after": cursor})
+		if err != nil {
+			return
+		}
+		page, ok := Dig(data, []string{"node", field}, false, true)
+		if !ok {
+			err = fmt.Errorf("cannot get next %s page of %s %v", field, nodeType, node["id"])
+			return
+		}
+		nodes, _ := conn["nodes"].([]interface{})
+		more, _ := Dig(page, []string{"nodes"}, false, true)
+		moreNodes, _ := more.([]interface{})
+		conn["nodes"] = append(nodes, moreNodes...)
+		conn["pageInfo"], _ = Dig(page, []string{"pageInfo"}, false, true)
+		if ctx.Debug > 1 {
+			Printf("fetched next %d %s of %s %v\n", len(moreNodes), field, nodeType, node["id"])
+		}
+	}
+}
+
+// githubGraphQLExpandIssue - fetch all pages of issue's nested connections
+func (j *DSGitHub) githubGraphQLExpandIssue(ctx *Ctx, node map[string]interface{}) (err error) {
+	nodeType, _ := node["__typename"].(string)
+	for _, conn := range [][2]string{
+		{"labels", "name"},
+		{"assignees", "login"},
+		{"reactions", GitHubGraphQLReactionFields},
+		{"comments", GitHubGraphQLCommentFields},
+	} {
+		err = j.githubGraphQLExpand(ctx, node, nodeType, conn[0], "", conn[1])
+		if err != nil {
+			return
+		}
+	}
+	isPull := nodeType == "PullRequest"
+	err = j.githubGraphQLExpand(ctx, node, nodeType, "timelineItems", GitHubGraphQLTimelineArgs(isPull), GitHubGraphQLTimelineFields(isPull))
+	if err != nil {
+		return
+	}
+	for _, comment := range GitHubGraphQLNodes(node, "comments") {
+		err = j.githubGraphQLExpand(ctx, comment, "IssueComment", "reactions", "", GitHubGraphQLReactionFields)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// githubGraphQLExpandPull - fetch all pages of pull request's nested connections
+func (j *DSGitHub) githubGraphQLExpandPull(ctx *Ctx, node map[string]interface{}) (err error) {
+	err = j.githubGraphQLExpandIssue(ctx, node)
+	if err != nil {
+		return
+	}
+	for _, conn := range [][2]string{
+		{"reviews", GitHubGraphQLReviewFields},
+		{"reviewRequests", GitHubGraphQLReviewRequestFields},
+		{"commits", "commit{oid}"},
+		{"reviewThreads", GitHubGraphQLReviewThreadFields},
+	} {
+		err = j.githubGraphQLExpand(ctx, node, "PullRequest", conn[0], "", conn[1])
+		if err != nil {
+			return
+		}
+	}
+	for _, thread := range GitHubGraphQLNodes(node, "reviewThreads") {
+		err = j.githubGraphQLExpand(ctx, thread, "PullRequestReviewThread", "comments", "", GitHubGraphQLReviewCommentFields)
+		if err != nil {
+			return
+		}
+		for _, comment := range GitHubGraphQLNodes(thread, "comments") {
+			err = j.githubGraphQLExpand(ctx, comment, "PullRequestReviewComment", "reactions", "", GitHubGraphQLReactionFields)
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// githubGraphQLItems - page through repository's issues or pullRequests and call process on every node
+// Issues are filtered by since on the server side, pull requests don't support that, so they're
+// fetched from the most recently updated and paging stops at the first one not updated since
+func (j *DSGitHub) githubGraphQLItems(ctx *Ctx, org, repo, field, selection string, pageSize int, since *time.Time, process func(map[string]interface{}) error) (err error) {
+	variables := map[string]interface{}{"owner": org, "name": repo, "after": nil}
+	var query string
+	if field == "issues" {
+		query = fmt.Sprintf(
+			"query($owner:String!,$name:String!,$after:String,$since:DateTime){%s repository(owner:$owner,name:$name){issues(first:%d,after:$after,orderBy:{field:UPDATED_AT,direction:ASC},filterBy:{since:$since}){%s nodes{%s}}}}",
+			GitHubGraphQLRateLimit,
+			pageSize,
+			GitHubGraphQLPageInfo,
+			selection,
+		)
+		variables["since"] = nil
+		if since != nil {
+			variables["since"] = ToYMDTHMSZDate(*since)
+		}
+	} else {
+		query = fmt.Sprintf(
+			"query($owner:String!,$name:String!,$after:String){%s repository(owner:$owner,name:$name){%s(first:%d,after:$after,orderBy:{field:UPDATED_AT,direction:DESC}){%s nodes{%s}}}}",
+			GitHubGraphQLRateLimit,
+			field,
+			pageSize,
+			GitHubGraphQLPageInfo,
+			selection,
+		)
+	}
+	origin := org + "/" + repo
+	page := 0
+	for {
+		var data map[string]interface{}
+		data, err = j.githubGraphQLQuery(ctx, query, variables)
+		if err != nil {
+			return
+		}
+		repository, ok := data["repository"].(map[string]interface{})
+		if !ok {
+			if ctx.Debug > 1 {
+				Printf("githubGraphQLItems: repository not found %s\n", origin)
+			}
+			return
+		}
+		done := false
+		for _, node := range GitHubGraphQLNodes(repository, field) {
+			if since != nil && field != "issues" {
+				updatedAt, e := TimeParseInterfaceString(node["updatedAt"])
+				if e == nil && updatedAt.Before(*since) {
+					done = true
+					break
+				}
+			}
+			err = process(node)
+			if err != nil {
+				return
+			}
+		}
+		hasNext, _ := Dig(repository, []string{field, "pageInfo", "hasNextPage"}, false, true)
+		if done || hasNext != true {
+			break
+		}
+		variables["after"], _ = Dig(repository, []string{field, "pageInfo", "endCursor"}, false, true)
+		page++
+		if ctx.Debug > 0 {
+			runtime.GC()
+			Printf("%s/%s: processing next %s GraphQL page: %d\n", j.URL, j.Category, field, page)
+		}
+	}
+	return
+}
+
+// githubGraphQLIssues - fetch issues (including pull requests as issues) with comments and reactions using GraphQL API
+func (j *DSGitHub) githubGraphQLIssues(ctx *Ctx, org, repo string, since *time.Time) (issuesData []map[string]interface{}, err error) {
+	repoAPIURL := j.APIURL + "repos/" + org + "/" + repo
+	process := func(node map[string]interface{}) (e error) {
+		e = j.githubGraphQLExpandIssue(ctx, node)
+		if e != nil {
+			return
+		}
+		issuesData = append(issuesData, GitHubGraphQLIssue(repoAPIURL, node))
+		return
+	}
+	for _, fields := range [][2]string{{"issues", GitHubGraphQLIssueFields}, {"pullRequests", GitHubGraphQLPullAsIssueFields}} {
+		err = j.githubGraphQLItems(ctx, org, repo, fields[0], fields[1], GitHubGraphQLIssuesPageSize, since, process)
+		if err != nil {
+			return
+		}
+	}
+	if ctx.Debug > 2 {
+		Printf("issues got from GraphQL API: %+v\n", issuesData)
+	}
+	return
+}
+
+// githubGraphQLPulls - fetch pull requests with reviews, review comments, reactions, requested reviewers and commits using GraphQL API
+func (j *DSGitHub) githubGraphQLPulls(ctx *Ctx, org, repo string, since *time.Time) (pullsData []map[string]interface{}, err error) {
+	repoAPIURL := j.APIURL + "repos/" + org + "/" + repo
+	err = j.githubGraphQLItems(
+		ctx,
+		org,
+		repo,
+		"pullRequests",
+		GitHubGraphQLPullFields,
+		GitHubGraphQLPullsPageSize,
+		since,
+		func(node map[string]interface{}) (e error) {
+			e = j.githubGraphQLExpandPull(ctx, node)
+			if e != nil {
+				return
+			}
+			pullsData = append(pullsData, GitHubGraphQLPull(repoAPIURL, node))
+			return
+		},
+	)
+	if ctx.Debug > 2 {
+		Printf("pulls got from GraphQL API: %+v\n", pullsData)
+	}
+	return
+}
+
+// githubGraphQLUserData - set obj[dataKey] to user data of obj[key] login (if present)
+func (j *DSGitHub) githubGraphQLUserData(ctx *Ctx, obj map[string]interface{}, key, dataKey string) (err error) {
+	login, ok := Dig(obj, []string{key, "login"}, false, true)
+	if !ok {
+		return
+	}
+	obj[dataKey], _, err = j.githubUser(ctx, login.(string))
+	return
+}
+
+// githubGraphQLUsersData - return user data for a list of REST-like user objects
+func (j *DSGitHub) githubGraphQLUsersData(ctx *Ctx, iUsers interface{}) (usersData []map[string]interface{}, err error) {
+	usersData = []map[string]interface{}{}
+	users, _ := iUsers.([]interface{})
+	for _, user := range users {
+		login, ok := Dig(user, []string{"login"}, false, true)
+		if !ok {
+			continue
+		}
+		var userData map[string]interface{}
+		userData, _, err = j.githubUser(ctx, login.(string))
+		if err != nil {
+			return
+		}
+		usersData = append(usersData, userData)
+	}
+	return
+}
+
+// githubGraphQLReactionsUserData - add user data to comment-like object and its reactions
+func (j *DSGitHub) githubGraphQLReactionsUserData(ctx *Ctx, iObjs interface{}) (err error) {
+	objs, _ := iObjs.([]interface{})
+	for _, iObj := range objs {
+		obj, ok := iObj.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		err = j.githubGraphQLUserData(ctx, obj, "user", "user_data")
+		if err != nil {
+			return
+		}
+		reactions, ok := obj["reactions_data"]
+		if ok {
+			err = j.githubGraphQLReactionsUserData(ctx, reactions)
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// ProcessGraphQLIssue - add users data to issue fetched via GraphQL API (sub items are already there)
+func (j *DSGitHub) ProcessGraphQLIssue(ctx *Ctx, inIssue map[string]interface{}) (issue map[string]interface{}, err error) {
+	issue = inIssue
+	issue["user_data"] = map[string]interface{}{}
+	issue["assignee_data"] = map[string]interface{}{}
+	err = j.githubGraphQLUserData(ctx, issue, "user", "user_data")
+	if err != nil {
+		return
+	}
+	err = j.githubGraphQLUserData(ctx, issue, "assignee", "assignee_data")
+	if err != nil {
+		return
+	}
+	issue["assignees_data"], err = j.githubGraphQLUsersData(ctx, issue["assignees"])
+	if err != nil {
+		return
+	}
+	err = j.githubGraphQLReactionsUserData(ctx, issue["comments_data"])
+	if err != nil {
+		return
+	}
+	err = j.githubGraphQLReactionsUserData(ctx, issue["reactions_data"])
+	return
+}
+
+// ProcessGraphQLPull - add users data to pull request fetched via GraphQL API (sub items are already there)
+func (j *DSGitHub) ProcessGraphQLPull(ctx *Ctx, inPull map[string]interface{}) (pull map[string]interface{}, err error) {
+	pull = inPull
+	pull["user_data"] = map[string]interface{}{}
+	pull["assignee_data"] = map[string]interface{}{}
+	pull["merged_by_data"] = map[string]interface{}{}
+	for key, dataKey := range map[string]string{"user": "user_data", "assignee": "assignee_data", "merged_by": "merged_by_data"} {
+		err = j.githubGraphQLUserData(ctx, pull, key, dataKey)
+		if err != nil {
+			return
+		}
+	}
+	pull["assignees_data"], err = j.githubGraphQLUsersData(ctx, pull["assignees"])
+	if err != nil {
+		return
+	}
+	pull["requested_reviewers_data"], err = j.githubGraphQLUsersData(ctx, pull["requested_reviewers"])
+	if err != nil {
+		return
+	}
+	err = j.githubGraphQLReactionsUserData(ctx, pull["reviews_data"])
+	if err != nil {
+		return
+	}
+	err = j.githubGraphQLReactionsUserData(ctx, pull["review_comments_data"])
+	return
+}
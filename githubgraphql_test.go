@@ -0,0 +1,133 @@
+package dads
+
+import (
+	"reflect"
+	"testing"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+func TestGitHubGraphQLUser(t *testing.T) {
+	var testCases = []struct {
+		actor    interface{}
+		expected interface{}
+	}{
+		{actor: nil, expected: nil},
+		{actor: map[string]interface{}{"login": ""}, expected: nil},
+		{actor: map[string]interface{}{"__typename": "User", "login": "lukaszgryglicki"}, expected: map[string]interface{}{"login": "lukaszgryglicki"}},
+		{actor: map[string]interface{}{"__typename": "Bot", "login": "dependabot"}, expected: map[string]interface{}{"login": "dependabot[bot]"}},
+		{actor: map[string]interface{}{"login": "reactor"}, expected: map[string]interface{}{"login": "reactor"}},
+	}
+	for index, test := range testCases {
+		got := GitHubGraphQLUser(test.actor)
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("test number %d, expected %+v to give %+v, got %+v", index+1, test.actor, test.expected, got)
+		}
+	}
+}
+
+func TestGitHubGraphQLIssue(t *testing.T) {
+	node := map[string]interface{}{}
+	err := jsoniter.Unmarshal([]byte(`{
+		"__typename":"PullRequest","id":"MDExOlB1bGxSZXF1ZXN0MQ==","databaseId":1001,"number":7,"title":"Add feature","body":"Body","state":"MERGED",
+		"createdAt":"2021-05-20T15:24:38Z","updatedAt":"2021-05-21T10:00:00Z","closedAt":"2021-05-21T09:00:00Z","url":"https://github.com/o/r/pull/7",
+		"authorAssociation":"MEMBER","author":{"__typename":"User","login":"author"},
+		"labels":{"totalCount":1,"pageInfo":{"hasNextPage":false},"nodes":[{"name":"bug"}]},
+		"assignees":{"totalCount":2,"pageInfo":{"hasNextPage":false},"nodes":[{"login":"a1"},{"login":"a2"}]},
+		"reactions":{"totalCount":1,"pageInfo":{"hasNextPage":false},"nodes":[{"databaseId":5,"content":"THUMBS_UP","user":{"login":"fan"}}]},
+		"comments":{"totalCount":1,"pageInfo":{"hasNextPage":false},"nodes":[
+			{"id":"IC_1","databaseId":3001,"body":"LGTM","createdAt":"2021-05-20T16:00:00Z","updatedAt":"2021-05-20T16:00:00Z","url":"https://github.com/o/r/pull/7#issuecomment-3001",
+			"authorAssociation":"NONE","author":{"__typename":"Bot","login":"ci"},
+			"reactions":{"totalCount":1,"pageInfo":{"hasNextPage":false},"nodes":[{"databaseId":6,"content":"ROCKET","user":{"login":"fan"}}]}}
+		]}
+	}`), &node)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	issue := GitHubGraphQLIssue("https://api.github.com/repos/o/r", node)
+	if issue["id"] != 1001.0 || issue["number"] != 7.0 || issue["state"] != "closed" || issue["is_pull"] != true || issue["comments"] != 1.0 {
+		t.Errorf("unexpected issue fields: %+v", issue)
+	}
+	expectedPR := map[string]interface{}{"url": "https://api.github.com/repos/o/r/pulls/7", "html_url": "https://github.com/o/r/pull/7"}
+	if !reflect.DeepEqual(issue["pull_request"], expectedPR) {
+		t.Errorf("expected pull_request %+v, got %+v", expectedPR, issue["pull_request"])
+	}
+	if !reflect.DeepEqual(issue["assignee"], map[string]interface{}{"login": "a1"}) || !reflect.DeepEqual(issue["labels"], []interface{}{map[string]interface{}{"name": "bug"}}) {
+		t.Errorf("unexpected assignee or labels: %+v, %+v", issue["assignee"], issue["labels"])
+	}
+	expectedReactions := []interface{}{map[string]interface{}{"id": 5.0, "content": "+1", "user": map[string]interface{}{"login": "fan"}}}
+	if !reflect.DeepEqual(issue["reactions_data"], expectedReactions) {
+		t.Errorf("expected reactions %+v, got %+v", expectedReactions, issue["reactions_data"])
+	}
+	comments, _ := issue["comments_data"].([]interface{})
+	if len(comments) != 1 {
+		t.Errorf("expected 1 comment, got %+v", issue["comments_data"])
+		return
+	}
+	comment, _ := comments[0].(map[string]interface{})
+	if comment["id"] != 3001.0 || comment["url"] != "https://api.github.com/repos/o/r/issues/comments/3001" || !reflect.DeepEqual(comment["user"], map[string]interface{}{"login": "ci[bot]"}) {
+		t.Errorf("unexpected comment: %+v", comment)
+	}
+	expectedCommentReactions := []interface{}{map[string]interface{}{"id": 6.0, "content": "rocket", "user": map[string]interface{}{"login": "fan"}}}
+	if !reflect.DeepEqual(comment["reactions_data"], expectedCommentReactions) {
+		t.Errorf("expected comment reactions %+v, got %+v", expectedCommentReactions, comment["reactions_data"])
+	}
+}
+
+func TestGitHubGraphQLPull(t *testing.T) {
+	node := map[string]interface{}{}
+	err := jsoniter.Unmarshal([]byte(`{
+		"__typename":"PullRequest","id":"PR_7","databaseId":1001,"number":7,"title":"Add feature","body":"Body","state":"MERGED",
+		"createdAt":"2021-05-20T15:24:38Z","updatedAt":"2021-05-21T10:00:00Z","closedAt":"2021-05-21T09:00:00Z","url":"https://github.com/o/r/pull/7",
+		"author":{"__typename":"User","login":"author"},"merged":true,"mergedAt":"2021-05-21T09:00:00Z","mergedBy":{"__typename":"User","login":"maintainer"},
+		"headRefName":"feature","headRefOid":"hhh","baseRefName":"main","baseRefOid":"bbb","baseRepository":{"forkCount":12},"mergeCommit":{"oid":"mmm"},
+		"comments":{"totalCount":4,"pageInfo":{"hasNextPage":false},"nodes":[]},
+		"reviews":{"totalCount":1,"pageInfo":{"hasNextPage":false},"nodes":[{"id":"R_1","databaseId":2001,"body":"ok","state":"APPROVED","submittedAt":"2021-05-20T17:00:00Z","author":{"login":"reviewer"},"commit":{"oid":"hhh"}}]},
+		"reviewRequests":{"totalCount":2,"pageInfo":{"hasNextPage":false},"nodes":[{"requestedReviewer":{"__typename":"User","login":"reviewer"}},{"requestedReviewer":{"__typename":"Team"}}]},
+		"commits":{"totalCount":2,"pageInfo":{"hasNextPage":false},"nodes":[{"commit":{"oid":"ccc"}},{"commit":{"oid":"hhh"}}]},
+		"reviewThreads":{"totalCount":1,"pageInfo":{"hasNextPage":false},"nodes":[{"id":"T_1","comments":{"totalCount":2,"pageInfo":{"hasNextPage":false},"nodes":[
+			{"id":"RC_1","databaseId":4001,"body":"nit","path":"a.go","createdAt":"2021-05-20T16:30:00Z","author":{"login":"reviewer"},"pullRequestReview":{"databaseId":2001},"reactions":{"totalCount":0,"nodes":[]}},
+			{"id":"RC_2","databaseId":4002,"body":"done","path":"a.go","createdAt":"2021-05-20T16:40:00Z","author":{"login":"author"},"replyTo":{"databaseId":4001},"reactions":{"totalCount":0,"nodes":[]}}
+		]}}]}
+	}`), &node)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	pull := GitHubGraphQLPull("https://api.github.com/repos/o/r", node)
+	if pull["url"] != "https://api.github.com/repos/o/r/pulls/7" || pull["merged"] != true || pull["merge_commit_sha"] != "mmm" || pull["comments"] != 4.0 || pull["review_comments"] != 2.0 || pull["commits"] != 2.0 {
+		t.Errorf("unexpected pull fields: %+v", pull)
+	}
+	if forks, _ := Dig(pull, []string{"base", "repo", "forks_count"}, false, true); forks != 12.0 {
+		t.Errorf("expected 12 forks, got %v", forks)
+	}
+	if !reflect.DeepEqual(pull["merged_by"], map[string]interface{}{"login": "maintainer"}) {
+		t.Errorf("unexpected merged_by: %+v", pull["merged_by"])
+	}
+	if !reflect.DeepEqual(pull["commits_data"], []interface{}{"ccc", "hhh"}) {
+		t.Errorf("unexpected commits_data: %+v", pull["commits_data"])
+	}
+	if !reflect.DeepEqual(pull["requested_reviewers"], []interface{}{map[string]interface{}{"login": "reviewer"}}) {
+		t.Errorf("unexpected requested_reviewers: %+v", pull["requested_reviewers"])
+	}
+	reviews, _ := pull["reviews_data"].([]interface{})
+	if len(reviews) != 1 {
+		t.Errorf("expected 1 review, got %+v", pull["reviews_data"])
+		return
+	}
+	review, _ := reviews[0].(map[string]interface{})
+	if review["id"] != 2001.0 || review["state"] != "APPROVED" || review["commit_id"] != "hhh" || review["pull_request_url"] != pull["url"] {
+		t.Errorf("unexpected review: %+v", review)
+	}
+	reviewComments, _ := pull["review_comments_data"].([]interface{})
+	if len(reviewComments) != 2 {
+		t.Errorf("expected 2 review comments, got %+v", pull["review_comments_data"])
+		return
+	}
+	first, _ := reviewComments[0].(map[string]interface{})
+	second, _ := reviewComments[1].(map[string]interface{})
+	if first["pull_request_review_id"] != 2001.0 || second["in_reply_to_id"] != 4001.0 || second["url"] != "https://api.github.com/repos/o/r/pulls/comments/4002" {
+		t.Errorf("unexpected review comments: %+v", reviewComments)
+	}
+}
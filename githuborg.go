@@ -0,0 +1,166 @@
+package dads
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// GitHubRepoFilter - filters applied to org repositories in org-wide mode
+type GitHubRepoFilter struct {
+	Archived bool           // include archived repositories
+	Forks    bool           // include forks
+	Private  bool           // include private (and internal) repositories
+	Topics   []string       // when set, repository must have at least one of these topics
+	Regexp   *regexp.Regexp // when set, repository name must match it
+}
+
+// GitHubRepoMatches - does a repository (as returned by GitHub repos list API) pass the filter
+func GitHubRepoMatches(repo map[string]interface{}, filter *GitHubRepoFilter) bool {
+	name, _ := repo["name"].(string)
+	if name == "" {
+		return false
+	}
+	if !filter.Archived {
+		archived, _ := repo["archived"].(bool)
+		if archived {
+			return false
+		}
+	}
+	if !filter.Forks {
+		fork, _ := repo["fork"].(bool)
+		if fork {
+			return false
+		}
+	}
+	if !filter.Private {
+		private, _ := repo["private"].(bool)
+		visibility, _ := repo["visibility"].(string)
+		if private || (visibility != "" && visibility != "public") {
+			return false
+		}
+	}
+	if len(filter.Topics) > 0 {
+		topics, _ := repo["topics"].([]interface{})
+		found := false
+		for _, topic := range topics {
+			sTopic, _ := topic.(string)
+			for _, wanted := range filter.Topics {
+				if sTopic == wanted {
+					found = true
+					break
+				}
+			}
+			if found {
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if filter.Regexp != nil && !filter.Regexp.MatchString(name) {
+		return false
+	}
+	return true
+}
+
+// githubRepoFilter - create repositories filter from configuration
+func (j *DSGitHub) githubRepoFilter() (filter *GitHubRepoFilter, err error) {
+	filter = &GitHubRepoFilter{Archived: j.IncludeArchived, Forks: j.IncludeForks, Private: j.IncludePrivate}
+	if j.Topics != "" {
+		for _, topic := range strings.Split(j.Topics, ",") {
+			topic = strings.ToLower(strings.TrimSpace(topic))
+			if topic != "" {
+				filter.Topics = append(filter.Topics, topic)
+			}
+		}
+	}
+	if j.ReposRegexp != "" {
+		filter.Regexp, err = regexp.Compile(j.ReposRegexp)
+		if err != nil {
+			err = fmt.Errorf("invalid github repos regexp %s: %v", j.ReposRegexp, err)
+			return
+		}
+	}
+	return
+}
+
+// githubOrgRepos - list names of all org's repositories that pass configured filters
+// org can also be a user account, then user's repositories are listed
+func (j *DSGitHub) githubOrgRepos(ctx *Ctx) (repos []string, err error) {
+	filter, err := j.githubRepoFilter()
+	if err != nil {
+		return
+	}
+	all, skipped := 0, 0
+	process := func(data interface{}) (err error) {
+		items, _ := data.([]interface{})
+		for _, item := range items {
+			repo, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			all++
+			if !GitHubRepoMatches(repo, filter) {
+				skipped++
+				continue
+			}
+			repos = append(repos, repo["name"].(string))
+		}
+		return
+	}
+	// mercy-preview makes topics included in repositories list
+	accept := "application/vnd.github.mercy-preview+json"
+	err = j.githubGetPages(ctx, "org repos "+j.Org, "orgs/"+j.Org+"/repos?type=all", accept, process)
+	if err != nil {
+		return
+	}
+	if all == 0 {
+		err = j.githubGetPages(ctx, "user repos "+j.Org, "users/"+j.Org+"/repos?type=owner", accept, process)
+		if err != nil {
+			return
+		}
+	}
+	sort.Strings(repos)
+	Printf("%s: %d repositories found, %d skipped by filters, %d to process\n", j.Org, all, skipped, len(repos))
+	return
+}
+
+// switchToOrgRepo - switch DSGitHub to i-th org repository, negative i switches back to org-wide mode
+func (j *DSGitHub) switchToOrgRepo(i int) string {
+	if i < 0 {
+		j.Repo = ""
+		j.URL = j.WebURL + j.Org
+		return ""
+	}
+	j.Repo = j.OrgRepos[i]
+	j.URL = j.WebURL + j.Org + "/" + j.Repo
+	j.RateHandled = false
+	return j.Repo
+}
+
+// forEachOrgRepo - call f for every org repository with DSGitHub switched to that repository
+func (j *DSGitHub) forEachOrgRepo(ctx *Ctx, f func(string) error) (err error) {
+	if j.OrgRepos == nil {
+		j.OrgRepos, err = j.githubOrgRepos(ctx)
+		if err != nil {
+			return
+		}
+	}
+	return ForEachOrigin(ctx, j, len(j.OrgRepos), j.switchToOrgRepo, f)
+}
+
+// fetchOrgRepos - generic fetch raw for every org repository
+func (j *DSGitHub) fetchOrgRepos(ctx *Ctx) (err error) {
+	if j.OrgResume == nil {
+		j.OrgResume = make(map[string]OriginResume)
+	}
+	return j.forEachOrgRepo(ctx, FetchRawOrigin(ctx, j, j.OrgResume))
+}
+
+// enrichOrgRepos - generic enrich for every org repository, starting from resume state detected while fetching its raw data
+func (j *DSGitHub) enrichOrgRepos(ctx *Ctx) (err error) {
+	return j.forEachOrgRepo(ctx, EnrichOrigin(ctx, j, j.OrgResume))
+}
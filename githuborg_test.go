@@ -0,0 +1,93 @@
+package dads
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestGitHubRepoMatches(t *testing.T) {
+	repo := func(name string, archived, fork, private bool, visibility string, topics ...string) map[string]interface{} {
+		iTopics := []interface{}{}
+		for _, topic := range topics {
+			iTopics = append(iTopics, topic)
+		}
+		return map[string]interface{}{"name": name, "archived": archived, "fork": fork, "private": private, "visibility": visibility, "topics": iTopics}
+	}
+	var testCases = []struct {
+		repo     map[string]interface{}
+		filter   GitHubRepoFilter
+		expected bool
+	}{
+		{repo: repo("api", false, false, false, "public"), filter: GitHubRepoFilter{}, expected: true},
+		{repo: repo("old", true, false, false, "public"), filter: GitHubRepoFilter{}, expected: false},
+		{repo: repo("old", true, false, false, "public"), filter: GitHubRepoFilter{Archived: true}, expected: true},
+		{repo: repo("fork", false, true, false, "public"), filter: GitHubRepoFilter{}, expected: false},
+		{repo: repo("fork", false, true, false, "public"), filter: GitHubRepoFilter{Forks: true}, expected: true},
+		{repo: repo("secret", false, false, true, "private"), filter: GitHubRepoFilter{}, expected: false},
+		{repo: repo("inner", false, false, false, "internal"), filter: GitHubRepoFilter{}, expected: false},
+		{repo: repo("inner", false, false, false, "internal"), filter: GitHubRepoFilter{Private: true}, expected: true},
+		{repo: repo("api", false, false, false, "public", "go", "kubernetes"), filter: GitHubRepoFilter{Topics: []string{"kubernetes"}}, expected: true},
+		{repo: repo("api", false, false, false, "public", "go"), filter: GitHubRepoFilter{Topics: []string{"kubernetes"}}, expected: false},
+		{repo: repo("sig-api", false, false, false, ""), filter: GitHubRepoFilter{Regexp: regexp.MustCompile(`^sig-`)}, expected: true},
+		{repo: repo("api", false, false, false, ""), filter: GitHubRepoFilter{Regexp: regexp.MustCompile(`^sig-`)}, expected: false},
+		{repo: map[string]interface{}{}, filter: GitHubRepoFilter{}, expected: false},
+	}
+	for index, test := range testCases {
+		got := GitHubRepoMatches(test.repo, &test.filter)
+		if got != test.expected {
+			t.Errorf("test number %d, expected %v, got %v for %+v", index+1, test.expected, got, test.repo)
+		}
+	}
+}
+
+func TestGitHubForEachOrgRepo(t *testing.T) {
+	dateFrom := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	ctx := &Ctx{DateFrom: &dateFrom}
+	j := &DSGitHub{Org: "org", WebURL: "https://github.com/", OrgRepos: []string{"a", "b", "c"}}
+	// every repository starts from the configured date from, detected one is saved per repository
+	j.OrgResume = make(map[string]OriginResume)
+	var urls []string
+	err := j.forEachOrgRepo(
+		ctx,
+		func(repo string) error {
+			if ctx.DateFrom != &dateFrom {
+				return fmt.Errorf("date from not reset: %v", ctx.DateFrom)
+			}
+			urls = append(urls, j.URL)
+			detected := dateFrom.AddDate(0, 0, len(urls))
+			ctx.DateFrom, ctx.DateFromDetected = &detected, true
+			j.OrgResume[repo] = OriginResume{DateFrom: ctx.DateFrom, DateFromDetected: true}
+			return nil
+		},
+	)
+	if err != nil || len(urls) != 3 || urls[1] != "https://github.com/org/b" {
+		t.Errorf("unexpected processed repositories %v, error: %v", urls, err)
+	}
+	if ctx.DateFrom != &dateFrom || ctx.DateFromDetected || j.Repo != "" || j.URL != "https://github.com/org" {
+		t.Errorf("expected state to be restored, got %v/%v/%s/%s", ctx.DateFrom, ctx.DateFromDetected, j.Repo, j.URL)
+	}
+	var resumed []time.Time
+	err = ForEachOrigin(
+		ctx,
+		j,
+		len(j.OrgRepos),
+		j.switchToOrgRepo,
+		func(repo string) error {
+			state := j.OrgResume[repo]
+			ctx.DateFrom = state.DateFrom
+			resumed = append(resumed, *ctx.DateFrom)
+			if repo == "b" {
+				return fmt.Errorf("failed")
+			}
+			return nil
+		},
+	)
+	if err == nil || err.Error() != "https://github.com/org/b: failed" || len(resumed) != 2 || !resumed[1].Equal(dateFrom.AddDate(0, 0, 2)) {
+		t.Errorf("unexpected error %v or resumed dates %v", err, resumed)
+	}
+	if ctx.DateFrom != &dateFrom {
+		t.Errorf("expected date from to be restored after an error, got %v", ctx.DateFrom)
+	}
+}
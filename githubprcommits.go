@@ -0,0 +1,191 @@
+package dads
+
+import (
+	"fmt"
+	"sort"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// GitHubLinkCommitsScript - painless script setting PR data on git commit docs matching one of the links
+const GitHubLinkCommitsScript = "for(l in params.links){if(l.hash==ctx._source.hash){" +
+	"ctx._source.pull_request_number=l.number;ctx._source.pull_request_url=l.url;ctx._source.merged_via_pr=true;break;}}"
+
+// GitHubPullLink - pull request data set on a git commit that landed via this pull request
+type GitHubPullLink struct {
+	Hash   string `json:"hash"`
+	Number int    `json:"number"`
+	URL    string `json:"url"`
+}
+
+// GitHubPullCommitSHAs - return SHAs of PR commits (raw pull request holds them in commits_data)
+func GitHubPullCommitSHAs(pull map[string]interface{}) (shas []string) {
+	shas = []string{}
+	commits, _ := pull["commits_data"].([]interface{})
+	for _, commit := range commits {
+		sha, ok := commit.(string)
+		if ok && sha != "" {
+			shas = append(shas, sha)
+		}
+	}
+	return
+}
+
+// GitHubPullLinks - return git commit links for a pull request rich doc, only merged pull requests land commits
+// Merge commit is linked too, for squash and rebase merges it is the only one present on the target branch
+func GitHubPullLinks(rich map[string]interface{}) (links []GitHubPullLink) {
+	merged, _ := rich["merged"].(bool)
+	if !merged && rich["merged_at"] == nil {
+		return
+	}
+	fNumber, ok := rich["id_in_repo"].(float64)
+	if !ok {
+		return
+	}
+	url, _ := rich["url"].(string)
+	shas := map[string]struct{}{}
+	iShas, _ := rich["commit_shas"].([]interface{})
+	for _, iSha := range iShas {
+		sha, _ := iSha.(string)
+		if sha != "" {
+			shas[sha] = struct{}{}
+		}
+	}
+	mergeSha, _ := rich["merge_commit_sha"].(string)
+	if mergeSha != "" {
+		shas[mergeSha] = struct{}{}
+	}
+	for sha := range shas {
+		links = append(links, GitHubPullLink{Hash: sha, Number: int(fNumber), URL: url})
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].Hash < links[j].Hash })
+	return
+}
+
+type githubLinkCommitsPayload struct {
+	Script struct {
+		Inline string `json:"inline"`
+		Params struct {
+			Links []GitHubPullLink `json:"links"`
+		} `json:"params"`
+	} `json:"script"`
+	Query struct {
+		Bool struct {
+			Filter []interface{} `json:"filter"`
+		} `json:"bool"`
+	} `json:"query"`
+}
+
+type githubTermsHash struct {
+	Terms struct {
+		Hash []string `json:"hash"`
+	} `json:"terms"`
+}
+
+type githubTermsOrigin struct {
+	Terms struct {
+		Origin []string `json:"origin"`
+	} `json:"terms"`
+}
+
+// GitHubLinkCommitsPayloads - return update by query payloads linking git commits of given origins in packs of packSize
+func GitHubLinkCommitsPayloads(links []GitHubPullLink, origins []string, packSize int) (payloads [][]byte, err error) {
+	nLinks := len(links)
+	for from := 0; from < nLinks; from += packSize {
+		to := from + packSize
+		if to > nLinks {
+			to = nLinks
+		}
+		var (
+			payload githubLinkCommitsPayload
+			hashes  githubTermsHash
+			origin  githubTermsOrigin
+		)
+		payload.Script.Inline = GitHubLinkCommitsScript
+		payload.Script.Params.Links = links[from:to]
+		for _, link := range links[from:to] {
+			hashes.Terms.Hash = append(hashes.Terms.Hash, link.Hash)
+		}
+		origin.Terms.Origin = origins
+		payload.Query.Bool.Filter = []interface{}{hashes, origin}
+		var data []byte
+		data, err = jsoniter.Marshal(payload)
+		if err != nil {
+			return
+		}
+		payloads = append(payloads, data)
+	}
+	return
+}
+
+// LinkPullRequestCommits - set pull_request_number, pull_request_url and merged_via_pr on git commits (in GitIndex)
+// that landed via merged pull requests of the current origin, all pull requests are scanned (not only ones enriched now)
+// because git index can get commits later than pull requests are enriched
+func (j *DSGitHub) LinkPullRequestCommits(ctx *Ctx) (err error) {
+	links := []GitHubPullLink{}
+	seen := map[string]struct{}{}
+	uitems := func(c *Ctx, ds DS, thrN int, items []interface{}, docs *[]interface{}) (e error) {
+		for _, item := range items {
+			rich, ok := Dig(item, []string{"_source"}, false, true)
+			if !ok {
+				continue
+			}
+			richMap, _ := rich.(map[string]interface{})
+			for _, link := range GitHubPullLinks(richMap) {
+				_, dup := seen[link.Hash]
+				if dup {
+					continue
+				}
+				seen[link.Hash] = struct{}{}
+				links = append(links, link)
+			}
+		}
+		return
+	}
+	ufunct := func(c *Ctx, ds DS, thrN int, docs, outDocs *[]interface{}, last bool) (e error) {
+		return
+	}
+	dateFrom := ctx.DateFrom
+	ctx.DateFrom = nil
+	err = ForEachESItem(ctx, j, false, ufunct, uitems, nil, false)
+	ctx.DateFrom = dateFrom
+	if err != nil {
+		return
+	}
+	if len(links) == 0 {
+		Printf("%s/%s: no merged pull request commits to link\n", j.URL, j.Category)
+		return
+	}
+	payloads, err := GitHubLinkCommitsPayloads(links, []string{j.URL, j.URL + ".git"}, ctx.ESBulkSize)
+	if err != nil {
+		return
+	}
+	url := ctx.ESURL + "/" + j.GitIndex + "/_update_by_query?conflicts=proceed&refresh=true&timeout=20m"
+	total := 0.0
+	for _, payload := range payloads {
+		resp, _, _, _, e := Request(
+			ctx,
+			url,
+			Post,
+			map[string]string{"Content-Type": "application/json"}, // headers
+			payload,                             // payload
+			[]string{},                          // cookies
+			map[[2]int]struct{}{{200, 200}: {}}, // JSON statuses: 200
+			nil,                                 // Error statuses
+			map[[2]int]struct{}{{200, 200}: {}}, // OK statuses: 200
+			nil,                                 // Cache statuses
+			true,                                // retry
+			nil,                                 // cache for
+			true,                                // skip in dry-run mode
+		)
+		if e != nil {
+			err = fmt.Errorf("linking pull request commits in %s: %v", j.GitIndex, e)
+			return
+		}
+		updated, _ := Dig(resp, []string{"updated"}, false, true)
+		fUpdated, _ := updated.(float64)
+		total += fUpdated
+	}
+	Printf("%s/%s: linked %.0f git commits (of %d merged pull requests commits) in %s\n", j.URL, j.Category, total, len(links), j.GitIndex)
+	return
+}
@@ -0,0 +1,69 @@
+package dads
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+func TestGitHubPullLinks(t *testing.T) {
+	var testCases = []struct {
+		rich     string
+		expected []GitHubPullLink
+	}{
+		{
+			rich: `{"id_in_repo":7,"url":"https://github.com/o/r/pull/7","merged":true,"merged_at":"2021-06-01T10:00:00Z","commit_shas":["b","a"],"merge_commit_sha":"m"}`,
+			expected: []GitHubPullLink{
+				{Hash: "a", Number: 7, URL: "https://github.com/o/r/pull/7"},
+				{Hash: "b", Number: 7, URL: "https://github.com/o/r/pull/7"},
+				{Hash: "m", Number: 7, URL: "https://github.com/o/r/pull/7"},
+			},
+		},
+		{
+			rich:     `{"id_in_repo":8,"url":"https://github.com/o/r/pull/8","merged_at":"2021-06-01T10:00:00Z","commit_shas":["s"],"merge_commit_sha":"s"}`,
+			expected: []GitHubPullLink{{Hash: "s", Number: 8, URL: "https://github.com/o/r/pull/8"}},
+		},
+		{
+			rich:     `{"id_in_repo":9,"url":"https://github.com/o/r/pull/9","merged":false,"merged_at":null,"commit_shas":["c"],"merge_commit_sha":null}`,
+			expected: nil,
+		},
+	}
+	for index, test := range testCases {
+		rich := map[string]interface{}{}
+		err := jsoniter.Unmarshal([]byte(test.rich), &rich)
+		if err != nil {
+			t.Errorf("test number %d, unexpected error: %v", index+1, err)
+			continue
+		}
+		got := GitHubPullLinks(rich)
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("test number %d, expected %+v, got %+v", index+1, test.expected, got)
+		}
+	}
+}
+
+func TestGitHubLinkCommitsPayloads(t *testing.T) {
+	links := []GitHubPullLink{{Hash: "a", Number: 1, URL: "u1"}, {Hash: "b", Number: 1, URL: "u1"}, {Hash: "c", Number: 2, URL: "u2"}}
+	payloads, err := GitHubLinkCommitsPayloads(links, []string{"https://github.com/o/r", "https://github.com/o/r.git"}, 2)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	if len(payloads) != 2 {
+		t.Errorf("expected 2 payloads, got %d", len(payloads))
+		return
+	}
+	expected := `{"terms":{"hash":["c"]}},{"terms":{"origin":["https://github.com/o/r","https://github.com/o/r.git"]}}`
+	if !strings.Contains(string(payloads[1]), expected) || !strings.Contains(string(payloads[1]), `"links":[{"hash":"c","number":2,"url":"u2"}]`) {
+		t.Errorf("unexpected payload: %s", string(payloads[1]))
+	}
+}
+
+func TestGitHubPullCommitSHAs(t *testing.T) {
+	got := GitHubPullCommitSHAs(map[string]interface{}{"commits_data": []interface{}{"a", "", nil, "b"}})
+	if !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("unexpected SHAs: %+v", got)
+	}
+}
@@ -0,0 +1,467 @@
+package dads
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GitHubReleaseDownloads - return number of assets and total download count of a release
+func GitHubReleaseDownloads(release map[string]interface{}) (nAssets, downloads int) {
+	assets, _ := release["assets"].([]interface{})
+	for _, iAsset := range assets {
+		cnt, ok := Dig(iAsset, []string{"download_count"}, false, true)
+		if !ok {
+			continue
+		}
+		nAssets++
+		fCnt, _ := cnt.(float64)
+		downloads += int(fCnt)
+	}
+	return
+}
+
+func (j *DSGitHub) githubReleases(ctx *Ctx, org, repo string) (releasesData []map[string]interface{}, err error) {
+	err = j.githubGetPages(
+		ctx,
+		fmt.Sprintf("%s/%s releases", org, repo),
+		fmt.Sprintf("repos/%s/%s/releases", org, repo),
+		"",
+		func(page interface{}) error {
+			releases, _ := page.([]interface{})
+			for _, iRelease := range releases {
+				rel, ok := iRelease.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				body, _ := rel["body"].(string)
+				// We only keep release notes length, not the notes themselves
+				rel["body_length"] = len(body)
+				delete(rel, "body")
+				releasesData = append(releasesData, rel)
+			}
+			return nil
+		},
+	)
+	if ctx.Debug > 2 {
+		Printf("releases got from API: %+v\n", releasesData)
+	}
+	return
+}
+
+func (j *DSGitHub) githubTags(ctx *Ctx, org, repo string) (tags map[string]string, err error) {
+	tags = make(map[string]string)
+	err = j.githubGetPages(
+		ctx,
+		fmt.Sprintf("%s/%s tags", org, repo),
+		fmt.Sprintf("repos/%s/%s/tags", org, repo),
+		"",
+		func(page interface{}) error {
+			repoTags, _ := page.([]interface{})
+			for _, iTag := range repoTags {
+				name, _ := Dig(iTag, []string{"name"}, false, true)
+				sha, _ := Dig(iTag, []string{"commit", "sha"}, false, true)
+				sName, _ := name.(string)
+				sSHA, _ := sha.(string)
+				if sName != "" && sSHA != "" {
+					tags[sName] = sSHA
+				}
+			}
+			return nil
+		},
+	)
+	if ctx.Debug > 2 {
+		Printf("tags got from API: %+v\n", tags)
+	}
+	return
+}
+
+// ProcessRelease - add release author, assets uploaders data and tag commit
+func (j *DSGitHub) ProcessRelease(ctx *Ctx, inRelease map[string]interface{}, tags map[string]string) (release map[string]interface{}, err error) {
+	release = inRelease
+	release["author_data"] = map[string]interface{}{}
+	err = j.githubGraphQLUserData(ctx, release, "author", "author_data")
+	if err != nil {
+		return
+	}
+	release["tag_commit_sha"] = nil
+	tagName, _ := release["tag_name"].(string)
+	sha, ok := tags[tagName]
+	if ok {
+		release["tag_commit_sha"] = sha
+	}
+	assets, _ := release["assets"].([]interface{})
+	for _, iAsset := range assets {
+		asset, ok := iAsset.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		err = j.githubGraphQLUserData(ctx, asset, "uploader", "uploader_data")
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// FetchItemsRelease - implement raw releases data for GitHub datasource
+// Every run snapshots all releases (download counts change over time), just like repository category does
+func (j *DSGitHub) FetchItemsRelease(ctx *Ctx) (err error) {
+	releases, err := j.githubReleases(ctx, j.Org, j.Repo)
+	FatalOnError(err)
+	tags, err := j.githubTags(ctx, j.Org, j.Repo)
+	FatalOnError(err)
+	Printf("%s/%s: got %d releases and %d tags\n", j.URL, j.Category, len(releases), len(tags))
+	fetchedOn := fmt.Sprintf("%.6f", float64(time.Now().UnixNano())/1.0e9)
+	items := []interface{}{}
+	for _, release := range releases {
+		var item map[string]interface{}
+		item, err = j.ProcessRelease(ctx, release, tags)
+		if err != nil {
+			return
+		}
+		item["fetched_on"] = fetchedOn
+		esItem := j.AddMetadata(ctx, item)
+		if ctx.Project != "" {
+			item["project"] = ctx.Project
+		}
+		esItem["data"] = item
+		items = append(items, esItem)
+		if len(items) >= ctx.ESBulkSize {
+			err = SendToElastic(ctx, j, true, UUID, items)
+			if err != nil {
+				Printf("%s/%s: error %v sending %d releases to ElasticSearch\n", j.URL, j.Category, err, len(items))
+				return
+			}
+			items = []interface{}{}
+		}
+	}
+	if len(items) > 0 {
+		err = SendToElastic(ctx, j, true, UUID, items)
+		if err != nil {
+			Printf("%s/%s: error %v sending %d releases to ES\n", j.URL, j.Category, err, len(items))
+		}
+	}
+	return
+}
+
+// EnrichReleaseItem - return rich item from raw release snapshot item
+func (j *DSGitHub) EnrichReleaseItem(ctx *Ctx, item map[string]interface{}, author string, affs bool, extra interface{}) (rich map[string]interface{}, err error) {
+	rich = make(map[string]interface{})
+	release, ok := item["data"].(map[string]interface{})
+	if !ok {
+		err = fmt.Errorf("missing data field in item %+v", DumpKeys(item))
+		return
+	}
+	for _, field := range RawFields {
+		v, _ := item[field]
+		rich[field] = v
+	}
+	if ctx.Project != "" {
+		rich["project"] = ctx.Project
+	}
+	rich["repo_name"] = j.URL
+	rich["repository"] = j.URL
+	rich["id"] = j.ItemID(release)
+	rich["release_id"], _ = release["id"]
+	rich["type"] = j.Category
+	rich["category"] = j.Category
+	rich["item_type"] = j.Category
+	for _, field := range []string{"tag_name", "tag_commit_sha", "target_commitish", "name", "html_url", "body_length", "fetched_on"} {
+		rich[field], _ = release[field]
+	}
+	rich["url"], _ = release["html_url"]
+	for _, field := range []string{"prerelease", "draft"} {
+		rich["is_"+field] = 0
+		if release[field] == true {
+			rich["is_"+field] = 1
+		}
+	}
+	createdAt, _ := TimeParseInterfaceString(release["created_at"])
+	rich["created_at"] = createdAt
+	rich["published_at"] = nil
+	iPublishedAt, ok := release["published_at"]
+	if ok && iPublishedAt != nil {
+		publishedAt, e := TimeParseInterfaceString(iPublishedAt)
+		if e == nil {
+			rich["published_at"] = publishedAt
+			rich["days_since_published"] = float64(time.Now().Sub(publishedAt).Seconds()) / 86400.0
+		}
+	}
+	nAssets, downloads := GitHubReleaseDownloads(release)
+	rich["n_assets"] = nAssets
+	rich["download_count"] = downloads
+	githubRepo, repoShortName := j.GetRepoShortURL(j.URL)
+	rich["github_repo"] = githubRepo
+	rich["repo_short_name"] = repoShortName
+	rich["url_id"] = fmt.Sprintf("%s/releases/%v", githubRepo, rich["tag_name"])
+	rich["author_login"], _ = Dig(release, []string{"author", "login"}, false, true)
+	iAuthorData, ok := release["author_data"]
+	if ok && iAuthorData != nil {
+		user, _ := iAuthorData.(map[string]interface{})
+		rich["author_name"], _ = user["name"]
+		rich["author_avatar_url"], _ = user["avatar_url"]
+		rich["author_domain"] = nil
+		iEmail, ok := user["email"]
+		if ok {
+			email, _ := iEmail.(string)
+			ary := strings.Split(email, "@")
+			if len(ary) > 1 {
+				rich["author_domain"] = strings.TrimSpace(ary[1])
+			}
+		}
+		rich["author_org"], _ = user["company"]
+		rich["author_location"], _ = user["location"]
+		rich["author_geolocation"] = nil
+	} else {
+		rich["author_name"] = nil
+		rich["author_avatar_url"] = nil
+		rich["author_domain"] = nil
+		rich["author_org"] = nil
+		rich["author_location"] = nil
+		rich["author_geolocation"] = nil
+	}
+	// Time series: snapshot date, not release date
+	updatedOn, _ := Dig(item, []string{j.DateField(ctx)}, true, false)
+	rich[j.DateField(ctx)] = updatedOn
+	if affs {
+		authorKey := "author_data"
+		var affsItems map[string]interface{}
+		affsItems, err = j.AffsItems(ctx, release, GitHubReleaseRoles, createdAt)
+		if err != nil {
+			return
+		}
+		for prop, value := range affsItems {
+			rich[prop] = value
+		}
+		for _, suff := range AffsFields {
+			rich[Author+suff] = rich[authorKey+suff]
+		}
+		orgsKey := authorKey + MultiOrgNames
+		_, ok := Dig(rich, []string{orgsKey}, false, true)
+		if !ok {
+			rich[orgsKey] = []interface{}{}
+		}
+	}
+	for prop, value := range CommonFields(j, updatedOn, j.Category) {
+		rich[prop] = value
+	}
+	return
+}
+
+// EnrichReleaseAssets - return rich assets (download counts snapshots) from raw release
+func (j *DSGitHub) EnrichReleaseAssets(ctx *Ctx, release map[string]interface{}, assets []map[string]interface{}, affs bool) (richItems []interface{}, err error) {
+	// type: category, type(_), item_type( )
+	// copy release: github_repo, repo_name, repository, tag_name, is_prerelease, is_draft, published_at, fetched_on
+	// copy asset: name, label, content_type, size, download_count, state, browser_download_url
+	// identify: id, release_asset_id, url_id
+	// standard: metadata..., origin, project, project_slug, uuid
+	// parent: release_id
+	// identity: author_... -> uploader_...,
+	// common: is_github_release=1, is_github_release_asset=1
+	iID, _ := release["id"]
+	id, _ := iID.(string)
+	copyReleaseFields := []string{"category", "github_repo", "repo_name", "repository", "repo_short_name", "release_id", "tag_name", "is_prerelease", "is_draft", "published_at", "fetched_on"}
+	copyAssetFields := []string{"name", "label", "content_type", "size", "download_count", "state", "browser_download_url"}
+	updatedOn, _ := release[j.DateField(ctx)]
+	for _, asset := range assets {
+		rich := make(map[string]interface{})
+		for _, field := range RawFields {
+			v, _ := release[field]
+			rich[field] = v
+		}
+		for _, field := range copyReleaseFields {
+			rich[field], _ = release[field]
+		}
+		for _, field := range copyAssetFields {
+			rich[field], _ = asset[field]
+		}
+		if ctx.Project != "" {
+			rich["project"] = ctx.Project
+		}
+		rich["type"] = j.Category + "_asset"
+		rich["item_type"] = j.Category + " asset"
+		iAID, _ := asset["id"]
+		aid := int64(iAID.(float64))
+		rich["release_asset_id"] = aid
+		rich["id"] = id + "/asset/" + fmt.Sprintf("%d", aid)
+		rich["url"], _ = asset["browser_download_url"]
+		rich["url_id"] = fmt.Sprintf("%v/releases/%v/assets/%d", release["github_repo"], release["tag_name"], aid)
+		createdAt, _ := TimeParseInterfaceString(asset["created_at"])
+		rich["created_at"] = createdAt
+		rich["uploader_login"], _ = Dig(asset, []string{"uploader", "login"}, false, true)
+		iUploaderData, ok := asset["uploader_data"]
+		if ok && iUploaderData != nil {
+			user, _ := iUploaderData.(map[string]interface{})
+			rich["author_login"], _ = user["login"]
+			rich["author_name"], _ = user["name"]
+			rich["author_avatar_url"], _ = user["avatar_url"]
+			rich["uploader_name"], _ = user["name"]
+			rich["uploader_org"], _ = user["company"]
+		} else {
+			rich["author_login"] = nil
+			rich["author_name"] = nil
+			rich["author_avatar_url"] = nil
+			rich["uploader_name"] = nil
+			rich["uploader_org"] = nil
+		}
+		rich[j.DateField(ctx)] = updatedOn
+		if affs {
+			authorKey := "uploader_data"
+			var affsItems map[string]interface{}
+			affsItems, err = j.AffsItems(ctx, asset, GitHubReleaseAssetRoles, createdAt)
+			if err != nil {
+				return
+			}
+			for prop, value := range affsItems {
+				rich[prop] = value
+			}
+			for _, suff := range AffsFields {
+				rich[Author+suff] = rich[authorKey+suff]
+				rich["uploader"+suff] = rich[authorKey+suff]
+			}
+			orgsKey := authorKey + MultiOrgNames
+			_, ok := Dig(rich, []string{orgsKey}, false, true)
+			if !ok {
+				rich[orgsKey] = []interface{}{}
+			}
+		}
+		for prop, value := range CommonFields(j, updatedOn, j.Category) {
+			rich[prop] = value
+		}
+		for prop, value := range CommonFields(j, updatedOn, j.Category+"_asset") {
+			rich[prop] = value
+		}
+		richItems = append(richItems, rich)
+	}
+	return
+}
+
+// GitHubReleaseEnrichItemsFunc - iterate items and enrich them
+// items is a current pack of input items
+// docs is a pointer to where extracted identities will be stored
+func (j *DSGitHub) GitHubReleaseEnrichItemsFunc(ctx *Ctx, thrN int, items []interface{}, docs *[]interface{}) (err error) {
+	if ctx.Debug > 0 {
+		Printf("%s/%s: github enrich release items %d/%d func\n", j.URL, j.Category, len(items), len(*docs))
+	}
+	var (
+		mtx *sync.RWMutex
+		ch  chan error
+	)
+	if thrN > 1 {
+		mtx = &sync.RWMutex{}
+		ch = make(chan error)
+	}
+	dbConfigured := ctx.AffsDBConfigured()
+	getRichItems := func(doc map[string]interface{}) (richItems []interface{}, e error) {
+		var rich map[string]interface{}
+		rich, e = j.EnrichItem(ctx, doc, "", dbConfigured, nil)
+		if e != nil {
+			return
+		}
+		_, authorIDOK := Dig(rich, []string{"author_id"}, false, true)
+		if authorIDOK || !ctx.CheckAuthorID {
+			richItems = append(richItems, rich)
+		}
+		// release: assets[].uploader_data
+		iAssets, _ := Dig(doc, []string{"data", "assets"}, false, true)
+		ary, _ := iAssets.([]interface{})
+		var assets []map[string]interface{}
+		for _, iAsset := range ary {
+			asset, ok := iAsset.(map[string]interface{})
+			if ok {
+				assets = append(assets, asset)
+			}
+		}
+		if len(assets) == 0 {
+			return
+		}
+		var riches []interface{}
+		riches, e = j.EnrichReleaseAssets(ctx, rich, assets, dbConfigured)
+		if e != nil {
+			return
+		}
+		for _, rich := range riches {
+			_, authorIDOK := Dig(rich, []string{"author_id"}, false, true)
+			if !authorIDOK && ctx.CheckAuthorID {
+				continue
+			}
+			richItems = append(richItems, rich)
+		}
+		return
+	}
+	nThreads := 0
+	procItem := func(c chan error, idx int) (e error) {
+		if thrN > 1 {
+			mtx.RLock()
+		}
+		item := items[idx]
+		if thrN > 1 {
+			mtx.RUnlock()
+		}
+		defer func() {
+			if c != nil {
+				c <- e
+			}
+		}()
+		src, ok := item.(map[string]interface{})["_source"]
+		if !ok {
+			e = fmt.Errorf("Missing _source in item %+v", DumpKeys(item))
+			return
+		}
+		doc, ok := src.(map[string]interface{})
+		if !ok {
+			e = fmt.Errorf("Failed to parse document %+v", doc)
+			return
+		}
+		richItems, e := getRichItems(doc)
+		if e != nil {
+			return
+		}
+		for _, rich := range richItems {
+			e = EnrichItem(ctx, j, rich.(map[string]interface{}))
+			if e != nil {
+				return
+			}
+		}
+		if thrN > 1 {
+			mtx.Lock()
+		}
+		*docs = append(*docs, richItems...)
+		if thrN > 1 {
+			mtx.Unlock()
+		}
+		return
+	}
+	if thrN > 1 {
+		for i := range items {
+			go func(i int) {
+				_ = procItem(ch, i)
+			}(i)
+			nThreads++
+			if nThreads == thrN {
+				err = <-ch
+				if err != nil {
+					return
+				}
+				nThreads--
+			}
+		}
+		for nThreads > 0 {
+			err = <-ch
+			nThreads--
+			if err != nil {
+				return
+			}
+		}
+		return
+	}
+	for i := range items {
+		err = procItem(nil, i)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,31 @@
+package dads
+
+import (
+	"testing"
+)
+
+func TestGitHubReleaseDownloads(t *testing.T) {
+	var testCases = []struct {
+		release           map[string]interface{}
+		expectedAssets    int
+		expectedDownloads int
+	}{
+		{release: map[string]interface{}{}, expectedAssets: 0, expectedDownloads: 0},
+		{release: map[string]interface{}{"assets": []interface{}{}}, expectedAssets: 0, expectedDownloads: 0},
+		{
+			release: map[string]interface{}{"assets": []interface{}{
+				map[string]interface{}{"name": "a.tgz", "download_count": 10.0},
+				map[string]interface{}{"name": "b.zip", "download_count": 5.0},
+				map[string]interface{}{"name": "broken"},
+			}},
+			expectedAssets:    2,
+			expectedDownloads: 15,
+		},
+	}
+	for index, test := range testCases {
+		gotAssets, gotDownloads := GitHubReleaseDownloads(test.release)
+		if gotAssets != test.expectedAssets || gotDownloads != test.expectedDownloads {
+			t.Errorf("test number %d, expected %d/%d, got %d/%d", index+1, test.expectedAssets, test.expectedDownloads, gotAssets, gotDownloads)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package dads
+
+import (
+	"fmt"
+	"strings"
+)
+
+var (
+	// GitLabPipelineResults - maps GitLab pipeline status to Jenkins build result, so CI dashboards work for both
+	GitLabPipelineResults = map[string]string{
+		"success":  "SUCCESS",
+		"failed":   "FAILURE",
+		"canceled": "ABORTED",
+		"skipped":  "NOT_BUILT",
+	}
+	// GitLabPipelineFinished - pipeline statuses that will not change anymore (unless pipeline is retried)
+	GitLabPipelineFinished = map[string]struct{}{"success": {}, "failed": {}, "canceled": {}, "skipped": {}}
+	// GitLabPipelineRoles - roles to fetch affiliation data for gitlab pipeline
+	GitLabPipelineRoles = []string{"user_data"}
+	// GitLabBuiltOn - builtOn value for pipelines
+	GitLabBuiltOn = "gitlab-ci"
+)
+
+// GitLabPipelineResult - return Jenkins-like result of a pipeline, nil when it is not finished yet
+func GitLabPipelineResult(status interface{}) interface{} {
+	sStatus, _ := status.(string)
+	_, finished := GitLabPipelineFinished[sStatus]
+	if !finished {
+		return nil
+	}
+	return GitLabPipelineResults[sStatus]
+}
+
+// ProcessPipeline - add pipeline's details (list API only returns basic data) and its user
+func (j *DSGitLab) ProcessPipeline(ctx *Ctx, pipeline map[string]interface{}) (err error) {
+	id, _ := pipeline["id"].(float64)
+	details, err := j.gitlabGetObject(ctx, fmt.Sprintf("%s/pipelines/%d", j.ProjectAPIURL(), int64(id)))
+	if err != nil {
+		return
+	}
+	for k, v := range details {
+		pipeline[k] = v
+	}
+	pipeline["user_data"], err = j.gitlabUser(ctx, pipeline["user"])
+	return
+}
+
+// EnrichPipelineItem - return rich item from raw pipeline item
+// Build fields (result, duration, builtOn, build, job_url, job_name, job_build, build_date, branch) have the same meaning as in jenkins.BuildsEnrich
+func (j *DSGitLab) EnrichPipelineItem(ctx *Ctx, item map[string]interface{}, affs bool) (rich map[string]interface{}, err error) {
+	rich = make(map[string]interface{})
+	pipeline, ok := item["data"].(map[string]interface{})
+	if !ok {
+		err = fmt.Errorf("missing data field in item %+v", DumpKeys(item))
+		return
+	}
+	for _, field := range RawFields {
+		v, _ := item[field]
+		rich[field] = v
+	}
+	if ctx.Project != "" {
+		rich["project"] = ctx.Project
+	}
+	rich["repo_name"] = j.ProjectURL
+	rich["repository"] = j.ProjectURL
+	rich["id"] = j.ItemID(pipeline)
+	rich["type"] = j.Category
+	rich["category"] = j.Category
+	rich["item_type"] = "pipeline"
+	for _, field := range []string{"status", "source", "ref", "sha", "tag", "queued_duration", "started_at", "finished_at"} {
+		rich[field], _ = pipeline[field]
+	}
+	rich["pipeline_id"], _ = pipeline["id"]
+	iid, _ := pipeline["iid"].(float64)
+	if iid == 0 {
+		iid, _ = pipeline["id"].(float64)
+	}
+	ref, _ := pipeline["ref"].(string)
+	name, _ := pipeline["name"].(string)
+	if name == "" {
+		name = ref
+	}
+	rich["pipeline_name"] = name
+	buildDate, ok := pipeline["started_at"]
+	if !ok || buildDate == nil {
+		buildDate, _ = pipeline["created_at"]
+	}
+	createdAt, _ := TimeParseInterfaceString(buildDate)
+	rich["fullDisplayName"] = fmt.Sprintf("%s #%d", name, int(iid))
+	rich["fullDisplayName_analyzed"] = rich["fullDisplayName"]
+	rich["url"], _ = pipeline["web_url"]
+	rich["result"] = GitLabPipelineResult(pipeline["status"])
+	// duration in seconds is only set for finished pipelines, it doesn't include queued time
+	duration := 0
+	if rich["result"] != nil {
+		seconds, ok := pipeline["duration"].(float64)
+		if ok {
+			duration = int(seconds * 1000.0)
+		} else {
+			duration = GitHubActionsDuration(buildDate, pipeline["finished_at"])
+		}
+	}
+	rich["duration"] = duration
+	rich["duration_days"] = float64(duration) / (1000.0 * 86400.0)
+	rich["builtOn"] = GitLabBuiltOn
+	rich["build"] = int(iid)
+	rich["job_url"] = j.ProjectURL + "/-/pipelines"
+	rich["job_name"] = name
+	rich["job_build"] = fmt.Sprintf("%s/%d", name, int(iid))
+	rich["build_date"] = createdAt
+	rich["branch"] = nil
+	tag, _ := pipeline["tag"].(bool)
+	if !tag && !strings.HasPrefix(ref, "refs/merge-requests/") {
+		rich["branch"] = ref
+	}
+	repo, shortName := j.gitlabRepoNames()
+	rich["gitlab_repo"] = repo
+	rich["repo_short_name"] = shortName
+	rich["url_id"] = fmt.Sprintf("%s/pipelines/%v", repo, pipeline["id"])
+	rich["actor_login"], _ = Dig(pipeline, []string{"user", "username"}, false, true)
+	GitLabUserFields(rich, "actor", pipeline["user_data"])
+	rich["author_login"] = rich["actor_login"]
+	rich["author_name"] = rich["actor_name"]
+	rich["author_avatar_url"] = rich["actor_avatar_url"]
+	rich[j.DateField(ctx)] = createdAt
+	if affs {
+		err = j.enrichAffs(ctx, rich, pipeline, GitLabPipelineRoles, createdAt, "actor")
+		if err != nil {
+			return
+		}
+	}
+	for prop, value := range CommonFields(j, createdAt, j.Category) {
+		rich[prop] = value
+	}
+	return
+}
@@ -0,0 +1,267 @@
+package dads
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// GitLockSuffix - suffix of the lock file created next to a git clone directory
+	GitLockSuffix = ".lock"
+	// GitLastUsedFile - file touched inside a git clone each time it is used, its mtime drives LRU eviction
+	GitLastUsedFile = "dads-last-used"
+	// GitLockStaleAfter - lock files not refreshed for this long are considered left by a crashed process
+	GitLockStaleAfter = 12 * time.Hour
+	// GitLockRefreshPeriod - how often a held lock file is touched, must be well below GitLockStaleAfter
+	GitLockRefreshPeriod = 10 * time.Minute
+	// GitLockWaitPeriod - how often to check if the lock was released
+	GitLockWaitPeriod = 10 * time.Second
+	// GitLockMaxWait - give up waiting for the lock after this time
+	GitLockMaxWait = 2 * time.Hour
+)
+
+var (
+	gitLocksMtx sync.Mutex
+	gitLocks    = map[string]chan struct{}{}
+)
+
+// GitRepoClone - git clone directory found in repos path
+type GitRepoClone struct {
+	Path     string
+	Size     int64
+	LastUsed time.Time
+}
+
+// ParseByteSize - parse size like "1024", "500M", "20G", "1.5T" into number of bytes
+func ParseByteSize(str string) (size int64, err error) {
+	str = strings.ToUpper(strings.TrimSpace(str))
+	str = strings.TrimSuffix(str, "B")
+	mult := 1.0
+	if str != "" {
+		switch str[len(str)-1] {
+		case 'K':
+			mult = 1 << 10
+		case 'M':
+			mult = 1 << 20
+		case 'G':
+			mult = 1 << 30
+		case 'T':
+			mult = 1 << 40
+		}
+		if mult > 1.0 {
+			str = str[:len(str)-1]
+		}
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+	if err != nil {
+		err = fmt.Errorf("cannot parse size '%s': %v", str, err)
+		return
+	}
+	size = int64(f * mult)
+	return
+}
+
+// LockGitRepo - acquire lock for a given git clone path, wait if other process is using it
+func LockGitRepo(ctx *Ctx, path string) (err error) {
+	lockPath := path + GitLockSuffix
+	dtStart := time.Now()
+	for {
+		var f *os.File
+		f, err = os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			_, _ = f.WriteString(fmt.Sprintf("%d %s\n", os.Getpid(), ToESDate(time.Now())))
+			err = f.Close()
+			if err != nil {
+				_ = os.Remove(lockPath)
+				return
+			}
+			stop := make(chan struct{})
+			gitLocksMtx.Lock()
+			gitLocks[path] = stop
+			gitLocksMtx.Unlock()
+			go refreshGitRepoLock(ctx, path, stop)
+			if ctx.Debug > 0 {
+				Printf("locked %s\n", path)
+			}
+			return
+		}
+		if !os.IsExist(err) {
+			return
+		}
+		info, e := os.Stat(lockPath)
+		if e == nil && time.Since(info.ModTime()) > GitLockStaleAfter {
+			Printf("removing stale lock %s created %v\n", lockPath, info.ModTime())
+			_ = os.Remove(lockPath)
+			continue
+		}
+		if time.Since(dtStart) > GitLockMaxWait {
+			err = fmt.Errorf("timeout waiting for %s lock after %v", path, GitLockMaxWait)
+			return
+		}
+		Printf("%s is locked by another process, waiting\n", path)
+		time.Sleep(GitLockWaitPeriod)
+	}
+}
+
+// refreshGitRepoLock - touch held lock file periodically so other processes don't consider it stale
+func refreshGitRepoLock(ctx *Ctx, path string, stop chan struct{}) {
+	ticker := time.NewTicker(GitLockRefreshPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			RefreshGitRepoLock(ctx, path)
+		}
+	}
+}
+
+// RefreshGitRepoLock - update held lock file modification time
+func RefreshGitRepoLock(ctx *Ctx, path string) {
+	now := time.Now()
+	err := os.Chtimes(path+GitLockSuffix, now, now)
+	if err != nil {
+		Printf("error refreshing %s lock: %v\n", path, err)
+		return
+	}
+	if ctx.Debug > 1 {
+		Printf("refreshed %s lock\n", path)
+	}
+}
+
+// UnlockGitRepo - release git clone lock and mark clone as recently used
+func UnlockGitRepo(ctx *Ctx, path string) {
+	gitLocksMtx.Lock()
+	stop, ok := gitLocks[path]
+	delete(gitLocks, path)
+	gitLocksMtx.Unlock()
+	if ok {
+		close(stop)
+	}
+	TouchGitRepo(ctx, path)
+	err := os.Remove(path + GitLockSuffix)
+	if err != nil {
+		Printf("error releasing %s lock: %v\n", path, err)
+		return
+	}
+	if ctx.Debug > 0 {
+		Printf("unlocked %s\n", path)
+	}
+}
+
+// TouchGitRepo - mark git clone as recently used
+func TouchGitRepo(ctx *Ctx, path string) {
+	info, err := os.Stat(path)
+	if err != nil || !info.IsDir() {
+		return
+	}
+	f, err := os.Create(path + "/" + GitLastUsedFile)
+	if err != nil {
+		if ctx.Debug > 0 {
+			Printf("cannot mark %s as used: %v\n", path, err)
+		}
+		return
+	}
+	_ = f.Close()
+}
+
+// GitRepoClones - return all git clones stored in a given repos path
+// clone is a directory with "-git" suffix containing HEAD file
+func GitRepoClones(reposPath string) (clones []GitRepoClone, err error) {
+	err = filepath.Walk(reposPath, func(path string, info os.FileInfo, e error) error {
+		if e != nil {
+			if os.IsNotExist(e) {
+				return nil
+			}
+			return e
+		}
+		if !info.IsDir() || !strings.HasSuffix(path, "-git") {
+			return nil
+		}
+		_, e = os.Stat(path + "/HEAD")
+		if e != nil {
+			return nil
+		}
+		clone := GitRepoClone{Path: path, LastUsed: info.ModTime()}
+		lastUsed, e := os.Stat(path + "/" + GitLastUsedFile)
+		if e == nil {
+			clone.LastUsed = lastUsed.ModTime()
+		}
+		e = filepath.Walk(path, func(_ string, fi os.FileInfo, ee error) error {
+			if ee == nil && !fi.IsDir() {
+				clone.Size += fi.Size()
+			}
+			return nil
+		})
+		if e != nil {
+			return e
+		}
+		clones = append(clones, clone)
+		return filepath.SkipDir
+	})
+	return
+}
+
+// EvictGitRepos - remove least recently used git clones until total size fits in maxSize
+// clones that are locked and the one given in keep are never removed
+func EvictGitRepos(ctx *Ctx, reposPath string, maxSize int64, keep string) (err error) {
+	if maxSize <= 0 {
+		return
+	}
+	clones, err := GitRepoClones(reposPath)
+	if err != nil {
+		return
+	}
+	total := int64(0)
+	for _, clone := range clones {
+		total += clone.Size
+	}
+	if ctx.Debug > 0 {
+		Printf("%d git clones in %s use %d bytes, limit %d\n", len(clones), reposPath, total, maxSize)
+	}
+	if total <= maxSize {
+		return
+	}
+	sort.Slice(clones, func(i, j int) bool { return clones[i].LastUsed.Before(clones[j].LastUsed) })
+	for _, clone := range clones {
+		if total <= maxSize {
+			break
+		}
+		if clone.Path == keep {
+			continue
+		}
+		if ctx.DryRun {
+			Printf("would evict git clone %s (%d bytes, last used %v)\n", clone.Path, clone.Size, clone.LastUsed)
+			total -= clone.Size
+			continue
+		}
+		// Take the lock without waiting, so no other process can start using the clone while it is being removed
+		f, e := os.OpenFile(clone.Path+GitLockSuffix, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if e != nil {
+			if ctx.Debug > 0 {
+				Printf("%s is locked, not evicting\n", clone.Path)
+			}
+			continue
+		}
+		_ = f.Close()
+		Printf("evicting git clone %s (%d bytes, last used %v)\n", clone.Path, clone.Size, clone.LastUsed)
+		e = os.RemoveAll(clone.Path)
+		_ = os.Remove(clone.Path + GitLockSuffix)
+		if e != nil {
+			Printf("error evicting %s: %v\n", clone.Path, e)
+			continue
+		}
+		total -= clone.Size
+	}
+	if total > maxSize {
+		Printf("WARNING: git clones in %s still use %d bytes, limit is %d\n", reposPath, total, maxSize)
+	}
+	return
+}
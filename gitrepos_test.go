@@ -0,0 +1,68 @@
+package dads
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseByteSize(t *testing.T) {
+	var testCases = []struct {
+		input         string
+		expectedSize  int64
+		expectedValid bool
+	}{
+		{input: "1024", expectedSize: 1024, expectedValid: true},
+		{input: "500M", expectedSize: 500 << 20, expectedValid: true},
+		{input: " 20g ", expectedSize: 20 << 30, expectedValid: true},
+		{input: "1.5T", expectedSize: 3 << 39, expectedValid: true},
+		{input: "10KB", expectedSize: 10 << 10, expectedValid: true},
+		{input: "lots", expectedSize: 0, expectedValid: false},
+		{input: "", expectedSize: 0, expectedValid: false},
+	}
+	for index, test := range testCases {
+		gotSize, err := ParseByteSize(test.input)
+		gotValid := err == nil
+		if gotValid != test.expectedValid {
+			t.Errorf("test number %d, expected '%s' validation result %v, got %v", index+1, test.input, test.expectedValid, gotValid)
+		} else if gotSize != test.expectedSize {
+			t.Errorf("test number %d, expected '%s' to parse to %d, got %d", index+1, test.input, test.expectedSize, gotSize)
+		}
+	}
+}
+
+func TestLockGitRepo(t *testing.T) {
+	var ctx Ctx
+	dir, err := ioutil.TempDir("", "dads-lock-")
+	if err != nil {
+		t.Fatalf("cannot create temp dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := dir + "/repo-git"
+	lockPath := path + GitLockSuffix
+	err = LockGitRepo(&ctx, path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	old := time.Now().Add(-GitLockStaleAfter / 2)
+	_ = os.Chtimes(lockPath, old, old)
+	RefreshGitRepoLock(&ctx, path)
+	info, err := os.Stat(lockPath)
+	if err != nil {
+		t.Fatalf("expected lock file to exist: %v", err)
+	}
+	if time.Since(info.ModTime()) > time.Minute {
+		t.Errorf("expected lock file to be refreshed, modified at %v", info.ModTime())
+	}
+	UnlockGitRepo(&ctx, path)
+	if _, err = os.Stat(lockPath); !os.IsNotExist(err) {
+		t.Errorf("expected lock file to be removed, got %v", err)
+	}
+	gitLocksMtx.Lock()
+	n := len(gitLocks)
+	gitLocksMtx.Unlock()
+	if n != 0 {
+		t.Errorf("expected no held locks after unlock, got %d", n)
+	}
+}
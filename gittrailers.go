@@ -0,0 +1,207 @@
+package dads
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// Example trailer policy file (DA_GIT_TRAILER_POLICY=/path/to/policy.json):
+// {
+//   "replace_defaults": false,
+//   "trailers": [
+//     {"name": "Assisted-by", "roles": ["Co-authored-by"]},
+//     {"regexp": "^suggested[-_ ]?by$", "roles": ["Suggested-by"]}
+//   ],
+//   "roles": {
+//     "Suggested-by": {"rich_key": "authors_suggested", "author": "suggester", "same_as_author": true, "flat_doc": true, "co_authorship": false, "affiliations": true}
+//   }
+// }
+// Names are case insensitive, regexps are always matched case insensitive against the trailer name.
+// File rules are checked in order before compiled defaults, so they override default names (like "suggested-by" above).
+// Roles not defined in the file (like "Co-authored-by" above) must be one of default roles from GitTrailerOtherAuthors.
+
+// GitTrailerRole - canonical trailer role settings
+type GitTrailerRole struct {
+	RichKey      string `json:"rich_key"`       // rich item field holding nested identities, for example "authors_co_authored"
+	Author       string `json:"author"`         // role name used for affiliation fields and flat docs, for example "co_author"
+	SameAsAuthor bool   `json:"same_as_author"` // can trailer identity be the same as the main commit's author?
+	FlatDoc      bool   `json:"flat_doc"`       // generate flat "commit_<author>" docs via TrailerDoc
+	CoAuthorship bool   `json:"co_authorship"`  // count this role as co-authorship in pair programming mode
+	Affiliations bool   `json:"affiliations"`   // get affiliations data for this role's identities
+}
+
+// GitTrailerRule - maps a trailer name (or names matching a regexp) to canonical roles
+type GitTrailerRule struct {
+	Name   string   `json:"name"`
+	Regexp string   `json:"regexp"`
+	Roles  []string `json:"roles"`
+	re     *regexp.Regexp
+}
+
+// GitTrailerPolicyFile - trailer policy file format
+type GitTrailerPolicyFile struct {
+	ReplaceDefaults bool                      `json:"replace_defaults"`
+	Trailers        []GitTrailerRule          `json:"trailers"`
+	Roles           map[string]GitTrailerRole `json:"roles"`
+}
+
+// GitTrailersPolicy - effective trailers policy: defaults from compiled tables merged with an optional policy file
+type GitTrailersPolicy struct {
+	Names     map[string][]string       // lowercase trailer name -> canonical roles from compiled tables
+	Rules     []GitTrailerRule          // policy file name and regexp rules, checked in order before Names
+	Roles     map[string]GitTrailerRole // canonical role -> role settings
+	PPAuthors map[string]string         // canonical role -> pair programming authors key
+}
+
+// DefaultGitTrailersPolicy - return trailers policy built from compiled tables
+func DefaultGitTrailersPolicy() (policy *GitTrailersPolicy) {
+	policy = &GitTrailersPolicy{
+		Names:     make(map[string][]string),
+		Roles:     make(map[string]GitTrailerRole),
+		PPAuthors: make(map[string]string),
+	}
+	for name, roles := range GitAllowedTrailers {
+		policy.Names[name] = roles
+	}
+	for role, data := range GitTrailerOtherAuthors {
+		policy.Roles[role] = GitTrailerRole{
+			RichKey:      data[0],
+			Author:       data[1],
+			SameAsAuthor: GitTrailerSameAsAuthor[role],
+			FlatDoc:      GitGenerateFlatDocs,
+			CoAuthorship: GitTrailerPPAuthors[role] == "co_authors",
+			Affiliations: true,
+		}
+	}
+	for role, authorsKey := range GitTrailerPPAuthors {
+		policy.PPAuthors[role] = authorsKey
+	}
+	return
+}
+
+// LoadGitTrailersPolicy - load trailers policy from a given file, return defaults when path is empty
+func LoadGitTrailersPolicy(ctx *Ctx, path string) (policy *GitTrailersPolicy, err error) {
+	policy = DefaultGitTrailersPolicy()
+	if path == "" {
+		return
+	}
+	var data []byte
+	data, err = ioutil.ReadFile(path)
+	if err != nil {
+		err = fmt.Errorf("cannot read trailer policy file %s: %v", path, err)
+		return
+	}
+	var file GitTrailerPolicyFile
+	err = jsoniter.Unmarshal(data, &file)
+	if err != nil {
+		err = fmt.Errorf("cannot parse trailer policy file %s: %v", path, err)
+		return
+	}
+	err = policy.Merge(&file)
+	if err != nil {
+		err = fmt.Errorf("invalid trailer policy file %s: %v", path, err)
+		return
+	}
+	if ctx.Debug > 0 {
+		Printf("loaded trailer policy from %s: %d names, %d rules, %d roles\n", path, len(policy.Names), len(policy.Rules), len(policy.Roles))
+	}
+	return
+}
+
+// Merge - merge policy file data into the current policy
+func (p *GitTrailersPolicy) Merge(file *GitTrailerPolicyFile) (err error) {
+	if file.ReplaceDefaults {
+		p.Names = make(map[string][]string)
+		p.Rules = []GitTrailerRule{}
+	}
+	for role, data := range file.Roles {
+		if data.RichKey == "" || data.Author == "" {
+			err = fmt.Errorf("role %s must have rich_key and author set", role)
+			return
+		}
+		p.Roles[role] = data
+		authorsKey, ok := p.PPAuthors[role]
+		if data.CoAuthorship {
+			p.PPAuthors[role] = "co_authors"
+		} else if ok && authorsKey == "co_authors" {
+			delete(p.PPAuthors, role)
+		}
+	}
+	for i, rule := range file.Trailers {
+		if len(rule.Roles) == 0 {
+			err = fmt.Errorf("trailer rule #%d has no roles", i+1)
+			return
+		}
+		for _, role := range rule.Roles {
+			_, ok := p.Roles[role]
+			if !ok {
+				err = fmt.Errorf("trailer rule #%d references unknown role %s", i+1, role)
+				return
+			}
+		}
+		if rule.Name != "" {
+			rule.Name = strings.ToLower(strings.TrimSpace(rule.Name))
+			p.Rules = append(p.Rules, rule)
+			continue
+		}
+		if rule.Regexp == "" {
+			err = fmt.Errorf("trailer rule #%d must have name or regexp set", i+1)
+			return
+		}
+		rule.re, err = regexp.Compile("(?i)" + rule.Regexp)
+		if err != nil {
+			err = fmt.Errorf("trailer rule #%d regexp %s: %v", i+1, rule.Regexp, err)
+			return
+		}
+		p.Rules = append(p.Rules, rule)
+	}
+	return
+}
+
+// TrailerRoles - return canonical roles for a given trailer name, policy file rules take precedence over compiled names
+func (p *GitTrailersPolicy) TrailerRoles(name string) (roles []string, ok bool) {
+	lName := strings.ToLower(name)
+	for _, rule := range p.Rules {
+		if (rule.re == nil && rule.Name == lName) || (rule.re != nil && rule.re.MatchString(name)) {
+			roles = rule.Roles
+			ok = true
+			return
+		}
+	}
+	roles, ok = p.Names[lName]
+	return
+}
+
+// RichMapping - add nested mappings for policy roles not covered by a given rich mapping
+func (p *GitTrailersPolicy) RichMapping(mapping []byte) []byte {
+	var m map[string]interface{}
+	err := jsoniter.Unmarshal(mapping, &m)
+	if err != nil {
+		return mapping
+	}
+	props, ok := m["properties"].(map[string]interface{})
+	if !ok {
+		return mapping
+	}
+	added := false
+	for _, role := range p.Roles {
+		_, ok := props[role.RichKey]
+		if ok {
+			continue
+		}
+		props[role.RichKey] = map[string]interface{}{"type": "nested"}
+		added = true
+	}
+	if !added {
+		return mapping
+	}
+	data, err := jsoniter.Marshal(m)
+	if err != nil {
+		return mapping
+	}
+	return data
+}
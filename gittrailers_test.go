@@ -0,0 +1,64 @@
+package dads
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGitTrailersPolicy(t *testing.T) {
+	policy := DefaultGitTrailersPolicy()
+	err := policy.Merge(
+		&GitTrailerPolicyFile{
+			Trailers: []GitTrailerRule{
+				{Name: "Assisted-By", Roles: []string{"Co-authored-by"}},
+				{Regexp: "^suggested[-_ ]?by$", Roles: []string{"Suggested-by"}},
+			},
+			Roles: map[string]GitTrailerRole{
+				"Suggested-by": {RichKey: "authors_suggested", Author: "suggester", SameAsAuthor: true, FlatDoc: true, CoAuthorship: true},
+			},
+		},
+	)
+	if err != nil {
+		t.Errorf("unexpected error merging policy: %v", err)
+		return
+	}
+	var testCases = []struct {
+		name          string
+		expectedRoles []string
+		expectedOK    bool
+	}{
+		{name: "Reviewed-by", expectedRoles: []string{"Reviewed-by"}, expectedOK: true},
+		{name: "assisted-by", expectedRoles: []string{"Co-authored-by"}, expectedOK: true},
+		{name: "Suggested_By", expectedRoles: []string{"Suggested-by"}, expectedOK: true},
+		{name: "suggested-by", expectedRoles: []string{"Suggested-by"}, expectedOK: true},
+		{name: "Tested-by", expectedRoles: []string{"Tested-by"}, expectedOK: true},
+		{name: "Not-a-trailer", expectedRoles: nil, expectedOK: false},
+	}
+	for index, test := range testCases {
+		gotRoles, gotOK := policy.TrailerRoles(test.name)
+		if gotOK != test.expectedOK || !reflect.DeepEqual(gotRoles, test.expectedRoles) {
+			t.Errorf("test number %d, expected '%s' to map to %v/%v, got %v/%v", index+1, test.name, test.expectedRoles, test.expectedOK, gotRoles, gotOK)
+		}
+	}
+	if policy.PPAuthors["Suggested-by"] != "co_authors" {
+		t.Errorf("expected Suggested-by to count as co-authorship, got %v", policy.PPAuthors)
+	}
+	err = policy.Merge(&GitTrailerPolicyFile{Trailers: []GitTrailerRule{{Name: "x", Roles: []string{"Unknown-by"}}}})
+	if err == nil {
+		t.Errorf("expected error for unknown role")
+	}
+	// policy not loaded (no Validate call) falls back to compiled defaults
+	ctx := &Ctx{}
+	j := &DSGit{Commit: map[string]interface{}{}}
+	j.ParseTrailer(ctx, "Reviewed-by: Alice <alice@example.com>")
+	if !reflect.DeepEqual(j.Commit["Reviewed-by"], []interface{}{"Alice <alice@example.com>"}) {
+		t.Errorf("expected default policy trailer, got %+v", j.Commit)
+	}
+	if !j.TrailersNeedAffs(map[[2]string]struct{}{{"authors_reviewed", "reviewer"}: {}}) {
+		t.Errorf("expected default reviewer role to need affiliations")
+	}
+	others := j.GetOtherPPAuthors(ctx, map[string]interface{}{"data": map[string]interface{}{"Co-authored-by": []interface{}{"Bob <bob@example.com>"}}})
+	if len(others) != 1 {
+		t.Errorf("expected single pair programming author, got %+v", others)
+	}
+}
@@ -0,0 +1,362 @@
+package dads
+
+import (
+	"fmt"
+	neturl "net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// RocketchatRoomChannel - public channel room type
+	RocketchatRoomChannel = "c"
+	// RocketchatRoomGroup - private group room type
+	RocketchatRoomGroup = "p"
+	// RocketchatRoomDM - direct messages room type
+	RocketchatRoomDM = "d"
+	// RocketchatThreadsDisabledError - error message returned by thread APIs when threads are disabled server-wide
+	RocketchatThreadsDisabledError = "Threads Disabled"
+)
+
+var (
+	// RocketchatRoomAPIs - REST API prefix for each room type
+	RocketchatRoomAPIs = map[string]string{RocketchatRoomChannel: "channels", RocketchatRoomGroup: "groups", RocketchatRoomDM: "im"}
+	// RocketchatRoomInfoKeys - key holding room data in room info API response
+	RocketchatRoomInfoKeys = map[string]string{RocketchatRoomChannel: "channel", RocketchatRoomGroup: "group", RocketchatRoomDM: "room"}
+	// RocketchatRoomTypes - room type names stored in rich documents
+	RocketchatRoomTypes = map[string]string{RocketchatRoomChannel: "channel", RocketchatRoomGroup: "group", RocketchatRoomDM: "dm"}
+)
+
+// RocketchatRoomAllowed - can a room returned by rooms list APIs be fetched
+// Room type is checked again (not only which APIs are called) so DMs can never be fetched without opt-in
+func RocketchatRoomAllowed(room map[string]interface{}, includeGroups, includeDMs bool) bool {
+	id, _ := room["_id"].(string)
+	if id == "" {
+		return false
+	}
+	roomType, _ := room["t"].(string)
+	switch roomType {
+	case RocketchatRoomChannel:
+		return true
+	case RocketchatRoomGroup:
+		return includeGroups
+	case RocketchatRoomDM:
+		return includeDMs
+	}
+	return false
+}
+
+// RocketchatRoomName - room name used in origin, DMs have no name so their id is used
+func RocketchatRoomName(room map[string]interface{}) string {
+	roomType, _ := room["t"].(string)
+	name, _ := room["name"].(string)
+	if roomType == RocketchatRoomDM || name == "" {
+		name, _ = room["_id"].(string)
+	}
+	return name
+}
+
+// roomQuery - room selector used by room APIs, DMs can only be selected by id
+func (j *DSRocketchat) roomQuery() string {
+	if j.RoomType == RocketchatRoomDM {
+		return "roomId=" + neturl.QueryEscape(j.RoomID)
+	}
+	return "roomName=" + neturl.QueryEscape(j.Channel)
+}
+
+// rocketchatGet - GET rocketchat API URL waiting for rate limits, 400, 401 and 403 statuses are returned to the caller
+func (j *DSRocketchat) rocketchatGet(ctx *Ctx, url string, rateLimit, rateLimitReset, thrN int) (data map[string]interface{}, status, outRateLimit, outRateLimitReset int, err error) {
+	headers := map[string]string{"X-User-ID": j.User, "X-Auth-Token": j.Token}
+	var (
+		res        interface{}
+		outHeaders map[string][]string
+	)
+	statuses := map[[2]int]struct{}{{200, 200}: {}, {400, 401}: {}, {403, 403}: {}, {429, 429}: {}}
+	sleeps, rates := 0, 0
+	for {
+		err = SleepForRateLimit(ctx, j, rateLimit, rateLimitReset, j.MinRate, j.WaitRate)
+		if err != nil {
+			return
+		}
+		res, status, _, outHeaders, err = Request(
+			ctx,
+			url,
+			Get,
+			headers,
+			nil,
+			nil,
+			statuses, // JSON statuses: 200, 400, 401, 403, 429
+			nil,      // Error statuses
+			statuses, // OK statuses: 200, 400, 401, 403, 429
+			nil,      // Cache statuses
+			true,     // retry
+			nil,      // cache duration
+			false,    // skip in dry-run mode
+		)
+		rateLimit, rateLimitReset, _ = UpdateRateLimit(ctx, j, outHeaders, "", "")
+		if status == 413 {
+			rates++
+			continue
+		}
+		// Too many requests
+		if status == 429 {
+			j.SleepAsRequested(res, thrN)
+			sleeps++
+			continue
+		}
+		if err != nil {
+			return
+		}
+		if sleeps > 0 || rates > 0 {
+			Printf("recovered after %d sleeps and %d rate limits\n", sleeps, rates)
+		}
+		break
+	}
+	data, _ = res.(map[string]interface{})
+	outRateLimit, outRateLimitReset = rateLimit, rateLimitReset
+	return
+}
+
+// rocketchatListRooms - list all rooms from a given rooms list API, allowed is false when token has no permission to use it
+func (j *DSRocketchat) rocketchatListRooms(ctx *Ctx, api, key, roomType string, rateLimit, rateLimitReset, thrN int) (rooms []map[string]interface{}, allowed bool, outRateLimit, outRateLimitReset int, err error) {
+	offset := 0
+	for {
+		url := j.URL + fmt.Sprintf("/api/v1/%s?count=%d&offset=%d&sort=%s", api, j.MaxItems, offset, neturl.QueryEscape(`{"_id": 1}`))
+		var (
+			data   map[string]interface{}
+			status int
+		)
+		data, status, rateLimit, rateLimitReset, err = j.rocketchatGet(ctx, url, rateLimit, rateLimitReset, thrN)
+		if err != nil {
+			return
+		}
+		if status != 200 {
+			if ctx.Debug > 0 {
+				Printf("%s: status %d: %+v\n", api, status, data)
+			}
+			break
+		}
+		allowed = true
+		ary, _ := data[key].([]interface{})
+		for _, iRoom := range ary {
+			room, ok := iRoom.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			_, ok = room["t"]
+			if !ok {
+				room["t"] = roomType
+			}
+			rooms = append(rooms, room)
+		}
+		offset += len(ary)
+		fTotal, _ := data["total"].(float64)
+		if len(ary) == 0 || offset >= int(fTotal) {
+			break
+		}
+	}
+	outRateLimit, outRateLimitReset = rateLimit, rateLimitReset
+	return
+}
+
+// rocketchatRooms - list all server rooms to fetch: public channels, private groups and DMs when enabled
+func (j *DSRocketchat) rocketchatRooms(ctx *Ctx) (rooms []map[string]interface{}, err error) {
+	rateLimit, rateLimitReset := -1, -1
+	thrN := GetThreadsNum(ctx)
+	var (
+		all     []map[string]interface{}
+		listed  []map[string]interface{}
+		allowed bool
+	)
+	all, allowed, rateLimit, rateLimitReset, err = j.rocketchatListRooms(ctx, "channels.list", "channels", RocketchatRoomChannel, rateLimit, rateLimitReset, thrN)
+	if err != nil {
+		return
+	}
+	if !allowed {
+		err = fmt.Errorf("%s: token is not allowed to list channels", j.URL)
+		return
+	}
+	if j.IncludeGroups {
+		// listAll requires view-room-administration permission, otherwise only groups the token user belongs to are visible
+		listed, allowed, rateLimit, rateLimitReset, err = j.rocketchatListRooms(ctx, "groups.listAll", "groups", RocketchatRoomGroup, rateLimit, rateLimitReset, thrN)
+		if err != nil {
+			return
+		}
+		if !allowed {
+			listed, allowed, rateLimit, rateLimitReset, err = j.rocketchatListRooms(ctx, "groups.list", "groups", RocketchatRoomGroup, rateLimit, rateLimitReset, thrN)
+			if err != nil {
+				return
+			}
+		}
+		if !allowed {
+			Printf("%s: token is not allowed to list private groups, skipping them\n", j.URL)
+		}
+		all = append(all, listed...)
+	}
+	if j.IncludeDMs {
+		listed, allowed, _, _, err = j.rocketchatListRooms(ctx, "im.list", "ims", RocketchatRoomDM, rateLimit, rateLimitReset, thrN)
+		if err != nil {
+			return
+		}
+		if !allowed {
+			Printf("%s: token is not allowed to list direct messages, skipping them\n", j.URL)
+		}
+		all = append(all, listed...)
+	}
+	seen := make(map[string]struct{})
+	for _, room := range all {
+		if !RocketchatRoomAllowed(room, j.IncludeGroups, j.IncludeDMs) {
+			continue
+		}
+		id, _ := room["_id"].(string)
+		_, ok := seen[id]
+		if ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		rooms = append(rooms, room)
+	}
+	Printf("%s: %d rooms found, %d to process\n", j.URL, len(all), len(rooms))
+	return
+}
+
+// setRoom - switch DSRocketchat to a given room (nil switches back to server-wide mode)
+func (j *DSRocketchat) setRoom(room map[string]interface{}) {
+	if room == nil {
+		j.Channel, j.RoomType, j.RoomID, j.Room = "", RocketchatRoomChannel, "", nil
+		return
+	}
+	j.RoomType, _ = room["t"].(string)
+	j.RoomID, _ = room["_id"].(string)
+	j.Channel = RocketchatRoomName(room)
+	j.Room = room
+}
+
+// switchToRoom - switch DSRocketchat to i-th server room, negative i switches back to server-wide mode
+func (j *DSRocketchat) switchToRoom(i int) string {
+	if i < 0 {
+		j.setRoom(nil)
+		return ""
+	}
+	j.setRoom(j.Rooms[i])
+	return j.RoomID
+}
+
+// forEachRoom - call f for every server room with DSRocketchat switched to that room
+func (j *DSRocketchat) forEachRoom(ctx *Ctx, f func(string) error) (err error) {
+	if j.Rooms == nil {
+		j.Rooms, err = j.rocketchatRooms(ctx)
+		if err != nil {
+			return
+		}
+	}
+	return ForEachOrigin(ctx, j, len(j.Rooms), j.switchToRoom, f)
+}
+
+// fetchAllRooms - generic fetch raw for every server room
+func (j *DSRocketchat) fetchAllRooms(ctx *Ctx) (err error) {
+	if j.RoomResume == nil {
+		j.RoomResume = make(map[string]OriginResume)
+	}
+	return j.forEachRoom(ctx, FetchRawOrigin(ctx, j, j.RoomResume))
+}
+
+// enrichAllRooms - generic enrich for every server room, starting from resume state detected while fetching its raw data
+func (j *DSRocketchat) enrichAllRooms(ctx *Ctx) (err error) {
+	return j.forEachRoom(ctx, EnrichOrigin(ctx, j, j.RoomResume))
+}
+
+// RocketchatThreadsDisabled - is API error response the one returned when threads are disabled server-wide,
+// like {"success":false,"error":"Threads Disabled [error-not-allowed]","errorType":"error-not-allowed"}
+func RocketchatThreadsDisabled(data map[string]interface{}) bool {
+	msg, _ := data["error"].(string)
+	return strings.Contains(msg, RocketchatThreadsDisabledError)
+}
+
+// GetRocketchatThreadMessages - get thread replies updated since dateFrom
+func (j *DSRocketchat) GetRocketchatThreadMessages(ctx *Ctx, tmid string, dateFrom time.Time, rateLimit, rateLimitReset, thrN int) (replies []map[string]interface{}, outRateLimit, outRateLimitReset int, err error) {
+	offset := 0
+	for {
+		url := j.URL + fmt.Sprintf(
+			"/api/v1/chat.getThreadMessages?tmid=%s&count=%d&offset=%d&sort=%s",
+			neturl.QueryEscape(tmid),
+			j.MaxItems,
+			offset,
+			neturl.QueryEscape(`{"ts": 1}`),
+		)
+		var (
+			data   map[string]interface{}
+			status int
+		)
+		data, status, rateLimit, rateLimitReset, err = j.rocketchatGet(ctx, url, rateLimit, rateLimitReset, thrN)
+		if err != nil {
+			return
+		}
+		if status != 200 {
+			// Threads can be disabled server-wide, no point in asking for other threads then
+			// any other error (like no access to a single thread) only skips this thread
+			if RocketchatThreadsDisabled(data) {
+				Printf("%s: threads are disabled on the server (status %d: %+v), disabling threads\n", j.Origin(ctx), status, data)
+				j.Threads = false
+			} else {
+				Printf("%s: cannot get thread %s messages (status %d: %+v), skipping it\n", j.Origin(ctx), tmid, status, data)
+			}
+			break
+		}
+		ary, _ := data["messages"].([]interface{})
+		for _, iReply := range ary {
+			reply, ok := iReply.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			iUpdated, ok := reply["_updatedAt"].(string)
+			if !ok {
+				continue
+			}
+			updated, e := TimeParseAny(iUpdated)
+			if e != nil || updated.Before(dateFrom) {
+				continue
+			}
+			replies = append(replies, reply)
+		}
+		offset += len(ary)
+		fTotal, _ := data["total"].(float64)
+		if len(ary) == 0 || offset >= int(fTotal) {
+			break
+		}
+	}
+	outRateLimit, outRateLimitReset = rateLimit, rateLimitReset
+	return
+}
+
+// AddThreadReplies - return messages not seen yet, followed by replies of threads they start (when threads are enabled)
+// Thread parent is updated when a reply is added, so all threads with new replies are among messages updated since dateFrom
+func (j *DSRocketchat) AddThreadReplies(ctx *Ctx, messages []map[string]interface{}, dateFrom time.Time, seen map[string]struct{}, rateLimit, rateLimitReset, thrN int) (out []map[string]interface{}, outRateLimit, outRateLimitReset int, err error) {
+	add := func(message map[string]interface{}) {
+		id, _ := message["_id"].(string)
+		_, ok := seen[id]
+		if ok {
+			return
+		}
+		seen[id] = struct{}{}
+		out = append(out, message)
+	}
+	for _, message := range messages {
+		add(message)
+		tcount, _ := message["tcount"].(float64)
+		if !j.Threads || tcount == 0 {
+			continue
+		}
+		tmid, _ := message["_id"].(string)
+		var replies []map[string]interface{}
+		replies, rateLimit, rateLimitReset, err = j.GetRocketchatThreadMessages(ctx, tmid, dateFrom, rateLimit, rateLimitReset, thrN)
+		if err != nil {
+			return
+		}
+		for _, reply := range replies {
+			add(reply)
+		}
+	}
+	outRateLimit, outRateLimitReset = rateLimit, rateLimitReset
+	return
+}
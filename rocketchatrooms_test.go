@@ -0,0 +1,66 @@
+package dads
+
+import "testing"
+
+func TestRocketchatRoomAllowed(t *testing.T) {
+	channel := map[string]interface{}{"_id": "c1", "t": "c", "name": "general"}
+	group := map[string]interface{}{"_id": "p1", "t": "p", "name": "maintainers"}
+	dm := map[string]interface{}{"_id": "d1", "t": "d", "usernames": []interface{}{"alice", "bob"}}
+	var testCases = []struct {
+		room          map[string]interface{}
+		includeGroups bool
+		includeDMs    bool
+		expected      bool
+	}{
+		{room: channel, expected: true},
+		{room: group, expected: false},
+		{room: group, includeGroups: true, expected: true},
+		{room: dm, includeGroups: true, expected: false},
+		{room: dm, includeDMs: true, expected: true},
+		{room: map[string]interface{}{"_id": "x1", "t": "l"}, includeGroups: true, includeDMs: true, expected: false},
+		{room: map[string]interface{}{"t": "c", "name": "noid"}, expected: false},
+	}
+	for index, test := range testCases {
+		got := RocketchatRoomAllowed(test.room, test.includeGroups, test.includeDMs)
+		if got != test.expected {
+			t.Errorf("test number %d, expected %v, got %v", index+1, test.expected, got)
+		}
+	}
+	if RocketchatRoomName(channel) != "general" || RocketchatRoomName(dm) != "d1" {
+		t.Errorf("unexpected room names: %s, %s", RocketchatRoomName(channel), RocketchatRoomName(dm))
+	}
+}
+
+func TestRocketchatThreadInfo(t *testing.T) {
+	j := &DSRocketchat{}
+	rich := map[string]interface{}{}
+	j.SetChannelInfo(rich, map[string]interface{}{"_id": "p1", "t": "p", "name": "maintainers"})
+	j.SetThreadInfo(rich, map[string]interface{}{"_id": "m2", "tmid": "m1"})
+	if rich["room_type"] != "group" || rich["thread_parent_id"] != "m1" || rich["is_thread_reply"] != 1 || rich["thread_replies"] != 0 {
+		t.Errorf("unexpected thread reply fields: %+v", rich)
+	}
+	rich = map[string]interface{}{}
+	j.SetChannelInfo(rich, map[string]interface{}{"_id": "c1", "name": "general"})
+	j.SetThreadInfo(rich, map[string]interface{}{"_id": "m1", "tcount": 3.0})
+	if rich["room_type"] != "channel" || rich["thread_parent_id"] != nil || rich["is_thread_reply"] != 0 || rich["thread_replies"] != 3 {
+		t.Errorf("unexpected thread parent fields: %+v", rich)
+	}
+}
+
+func TestRocketchatThreadsDisabled(t *testing.T) {
+	var testCases = []struct {
+		data     map[string]interface{}
+		expected bool
+	}{
+		{data: map[string]interface{}{"success": false, "error": "Threads Disabled [error-not-allowed]", "errorType": "error-not-allowed"}, expected: true},
+		{data: map[string]interface{}{"success": false, "error": "Not Allowed [error-not-allowed]", "errorType": "error-not-allowed"}, expected: false},
+		{data: map[string]interface{}{"success": false, "error": "No message found with the id of \"m1\". [error-invalid-message]"}, expected: false},
+		{data: nil, expected: false},
+	}
+	for index, test := range testCases {
+		got := RocketchatThreadsDisabled(test.data)
+		if got != test.expected {
+			t.Errorf("test number %d, expected %v, got %v", index+1, test.expected, got)
+		}
+	}
+}